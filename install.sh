@@ -18,13 +18,19 @@ BRANCH="${EREBRUS_BRANCH:-main}"
 INSTALL_DIR="${INSTALL_DIR:-/opt/erebrus}"
 STATE_DIR="${STATE_DIR:-/var/lib/erebrus}"
 ENV_DIR="/etc/erebrus"
-BUILD_TAGS="with_reality_server"
+BUILD_TAGS="with_reality_server,with_utls"
 
 # Ports
 HTTP_PORT="${HTTP_PORT:-9080}"        # tcp  REST API
 WG_PORT="${WG_ENDPOINT_PORT:-51820}"  # udp  WireGuard
 STEALTH_TCP_PORT="${STEALTH_TCP_PORT:-443}"  # tcp  VLESS+REALITY
 STEALTH_UDP_PORT="${STEALTH_UDP_PORT:-443}"  # udp  Hysteria2
+ENABLE_TUIC="${ENABLE_TUIC:-false}"          # enables the TUIC v5 carrier
+STEALTH_TUIC_PORT="${STEALTH_TUIC_PORT:-8443}"  # udp  TUIC (only with ENABLE_TUIC=true)
+STEALTH_WS_HOST="${STEALTH_WS_HOST:-}"       # CDN hostname; enables VLESS over WebSocket+TLS
+STEALTH_WS_PORT="${STEALTH_WS_PORT:-8443}"   # tcp  VLESS over WebSocket+TLS (only with STEALTH_WS_HOST)
+STEALTH_CONNECT_HOST="${STEALTH_CONNECT_HOST:-}"         # hostname; enables the HTTPS CONNECT (naive) carrier
+STEALTH_CONNECT_PORT="${STEALTH_CONNECT_PORT:-8444}"     # tcp  HTTPS CONNECT (only with STEALTH_CONNECT_HOST)
 
 # Minimum acceptable throughput for an exit node (Mbps)
 MIN_DOWN_MBPS="${MIN_DOWN_MBPS:-50}"
@@ -513,6 +519,15 @@ gather_config() {
   EREBRUS_ACCESS="${ACCESS:-private}"
 
   ok "Stealth carriers: VLESS+REALITY ${STEALTH_TCP_PORT}/tcp · Hysteria2 ${STEALTH_UDP_PORT}/udp"
+  if [[ "$ENABLE_TUIC" == "true" ]]; then
+    ok "TUIC carrier: ${STEALTH_TUIC_PORT}/udp"
+  fi
+  if [[ -n "$STEALTH_WS_HOST" ]]; then
+    ok "CDN carrier: VLESS over WebSocket+TLS ${STEALTH_WS_PORT}/tcp for ${STEALTH_WS_HOST}"
+  fi
+  if [[ -n "$STEALTH_CONNECT_HOST" ]]; then
+    ok "HTTPS CONNECT carrier: ${STEALTH_CONNECT_PORT}/tcp for ${STEALTH_CONNECT_HOST}"
+  fi
 }
 
 # Container image: registry default; local build fallback.
@@ -564,7 +579,9 @@ GATEWAY_URL=${GATEWAY_URL}
 GATEWAY_AUTO_REGISTER=true
 EREBRUS_NODE_REGISTRATION_TOKEN=${EREBRUS_NODE_REGISTRATION_TOKEN}
 WALLET_CHAIN=SOLANA
-API_PUBLIC_URL=http://${WG_ENDPOINT_HOST}:${HTTP_PORT}
+# The API serves HTTPS with a self-signed certificate the gateway pins; the
+# gateway URL (API_PUBLIC_URL) defaults to https://WG_ENDPOINT_HOST:HTTP_PORT.
+API_TLS=${API_TLS:-self-signed}
 
 # WireGuard
 WG_CONF_DIR=/etc/wireguard
@@ -582,6 +599,12 @@ STEALTH_TCP_PORT=${STEALTH_TCP_PORT}
 STEALTH_UDP_PORT=${STEALTH_UDP_PORT}
 REALITY_SERVER_NAMES=${REALITY_SERVER_NAMES}
 HYSTERIA2_OBFS_PASSWORD=${HYSTERIA2_OBFS_PASSWORD}
+ENABLE_TUIC=${ENABLE_TUIC}
+STEALTH_TUIC_PORT=${STEALTH_TUIC_PORT}
+STEALTH_WS_HOST=${STEALTH_WS_HOST}
+STEALTH_WS_PORT=${STEALTH_WS_PORT}
+STEALTH_CONNECT_HOST=${STEALTH_CONNECT_HOST}
+STEALTH_CONNECT_PORT=${STEALTH_CONNECT_PORT}
 
 # Optional Drop/Kubo storage
 DROP_ENABLED=${DROP}
@@ -680,6 +703,15 @@ open_firewall() {
     run ufw allow "${STEALTH_TCP_PORT}/tcp" >>"$LOG_FILE" 2>&1 || true
     run ufw allow "${WG_PORT}/udp"    >>"$LOG_FILE" 2>&1 || true
     run ufw allow "${STEALTH_UDP_PORT}/udp"   >>"$LOG_FILE" 2>&1 || true
+    if [[ "$ENABLE_TUIC" == "true" ]]; then
+      run ufw allow "${STEALTH_TUIC_PORT}/udp" >>"$LOG_FILE" 2>&1 || true
+    fi
+    if [[ -n "$STEALTH_WS_HOST" ]]; then
+      run ufw allow "${STEALTH_WS_PORT}/tcp" >>"$LOG_FILE" 2>&1 || true
+    fi
+    if [[ -n "$STEALTH_CONNECT_HOST" ]]; then
+      run ufw allow "${STEALTH_CONNECT_PORT}/tcp" >>"$LOG_FILE" 2>&1 || true
+    fi
     if [[ "$DROP" == "true" ]]; then
       run ufw allow "${DROP_SWARM_PORT}/tcp" >>"$LOG_FILE" 2>&1 || true
       run ufw allow "${DROP_SWARM_PORT}/udp" >>"$LOG_FILE" 2>&1 || true
@@ -691,6 +723,15 @@ open_firewall() {
     run firewall-cmd --permanent --add-port="${STEALTH_TCP_PORT}/tcp" >>"$LOG_FILE" 2>&1 || true
     run firewall-cmd --permanent --add-port="${WG_PORT}/udp"    >>"$LOG_FILE" 2>&1 || true
     run firewall-cmd --permanent --add-port="${STEALTH_UDP_PORT}/udp"   >>"$LOG_FILE" 2>&1 || true
+    if [[ "$ENABLE_TUIC" == "true" ]]; then
+      run firewall-cmd --permanent --add-port="${STEALTH_TUIC_PORT}/udp" >>"$LOG_FILE" 2>&1 || true
+    fi
+    if [[ -n "$STEALTH_WS_HOST" ]]; then
+      run firewall-cmd --permanent --add-port="${STEALTH_WS_PORT}/tcp" >>"$LOG_FILE" 2>&1 || true
+    fi
+    if [[ -n "$STEALTH_CONNECT_HOST" ]]; then
+      run firewall-cmd --permanent --add-port="${STEALTH_CONNECT_PORT}/tcp" >>"$LOG_FILE" 2>&1 || true
+    fi
     if [[ "$DROP" == "true" ]]; then
       run firewall-cmd --permanent --add-port="${DROP_SWARM_PORT}/tcp" >>"$LOG_FILE" 2>&1 || true
       run firewall-cmd --permanent --add-port="${DROP_SWARM_PORT}/udp" >>"$LOG_FILE" 2>&1 || true
@@ -700,6 +741,15 @@ open_firewall() {
   else
     warn "No ufw/firewalld detected. Ensure these are open in your cloud security group:"
     warn "  ${HTTP_PORT}/tcp, ${STEALTH_TCP_PORT}/tcp, ${WG_PORT}/udp, ${STEALTH_UDP_PORT}/udp"
+    if [[ "$ENABLE_TUIC" == "true" ]]; then
+      warn "  TUIC carrier: ${STEALTH_TUIC_PORT}/udp"
+    fi
+    if [[ -n "$STEALTH_WS_HOST" ]]; then
+      warn "  WebSocket carrier: ${STEALTH_WS_PORT}/tcp"
+    fi
+    if [[ -n "$STEALTH_CONNECT_HOST" ]]; then
+      warn "  HTTPS CONNECT carrier: ${STEALTH_CONNECT_PORT}/tcp"
+    fi
     if [[ "$DROP" == "true" ]]; then
       warn "  Drop swarm: ${DROP_SWARM_PORT}/tcp and ${DROP_SWARM_PORT}/udp"
     fi
@@ -794,15 +844,26 @@ install_docker_mode() {
 validate_and_summary() {
   info "Validating node…"
   local out="" i
-  for i in $(seq 1 15); do
-    out="$(curl -fsS --max-time 4 "http://127.0.0.1:${HTTP_PORT}/api/v2/status" 2>/dev/null || true)"
-    [[ -n "$out" ]] && break
+  # HTTP_PORT also carries the management API, so it serves HTTPS unless
+  # API_TLS=off. The certificate is self-signed (pinned by the gateway), hence -k.
+  local api="https://127.0.0.1:${HTTP_PORT}"
+  [[ "${API_TLS:-self-signed}" == "off" ]] && api="http://127.0.0.1:${HTTP_PORT}"
+  # /startupz passes once subsystems are up and the first probe round ran.
+  for i in $(seq 1 30); do
+    curl -fsSk --max-time 4 "${api}/startupz" >/dev/null 2>&1 && break
     sleep 2
   done
+  out="$(curl -fsSk --max-time 4 "${api}/api/v2/status" 2>/dev/null || true)"
   echo
   if [[ -n "$out" ]]; then
     ok "Node is up. Run: erebrus status (or curl /api/v2/status)"
     echo "$out" | python3 -m json.tool 2>/dev/null || echo "$out"
+    if curl -fsSk --max-time 4 "${api}/readyz" >/dev/null 2>&1; then
+      ok "Node is ready"
+    else
+      warn "Node is not ready yet:"
+      curl -sSk --max-time 4 "${api}/readyz?verbose" 2>/dev/null | sed 's/^/    /'
+    fi
     if [[ -n "${GATEWAY_URL:-}" ]]; then
       if curl -fsS --max-time 6 "${GATEWAY_URL%/}/healthz" >/dev/null 2>&1; then
         ok "Gateway reachable at ${GATEWAY_URL}"
@@ -817,7 +878,7 @@ validate_and_summary() {
 
   echo
   echo -e "${C_BOLD}${C_G}Erebrus node installed (profile=${PROFILE:-standard}, access=${EREBRUS_ACCESS}).${C_RESET}"
-  echo "  REST API : http://${WG_ENDPOINT_HOST}:${HTTP_PORT}/api/v2/status"
+  echo "  REST API : ${api%%://*}://${WG_ENDPOINT_HOST}:${HTTP_PORT}/api/v2/status"
   echo "  WireGuard: ${WG_ENDPOINT_HOST}:${WG_PORT}/udp"
   echo "  Stealth  : VLESS+REALITY :${STEALTH_TCP_PORT}/tcp · Hysteria2 :${STEALTH_UDP_PORT}/udp"
   echo "  Node API key: ${NODE_API_TOKEN}"
@@ -42,7 +42,7 @@ func (s *Server) handleDropUpload(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid declared size"})
 		return
 	}
-	maxUpload := min(s.cfg.DropStorageMaxBytes, drop.MaxObjectBytes)
+	maxUpload := min(s.cfg.Load().DropStorageMaxBytes, drop.MaxObjectBytes)
 	if declaredSize > maxUpload ||
 		(c.Request.ContentLength >= 0 && c.Request.ContentLength > declaredSize) {
 		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "upload exceeds reserved size"})
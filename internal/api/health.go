@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/NetSepio/erebrus/internal/readiness"
+	"github.com/gin-gonic/gin"
+)
+
+// healthHandler serves one of /livez, /readyz and /startupz in the style of
+// the Kubernetes API server: 200 "ok" when every required check passes, 503
+// with the check list otherwise. ?verbose lists the checks on success too;
+// ?exclude=<id> (repeatable or comma-separated) leaves checks out.
+func (s *Server) healthHandler(name string, eval func(readiness.Input) readiness.Report) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var exclude []string
+		for _, v := range c.QueryArray("exclude") {
+			for _, id := range strings.Split(v, ",") {
+				if id = strings.TrimSpace(id); id != "" {
+					exclude = append(exclude, id)
+				}
+			}
+		}
+		rep, unmatched := eval(s.readinessInput()).Exclude(exclude...)
+		_, verbose := c.GetQuery("verbose")
+
+		code := http.StatusOK
+		if !rep.OK {
+			code = http.StatusServiceUnavailable
+		}
+		c.Header("Cache-Control", "no-store")
+		if rep.OK && !verbose {
+			c.String(code, "ok")
+			return
+		}
+		var b strings.Builder
+		for _, ch := range rep.Checks {
+			b.WriteString(healthLine(ch))
+		}
+		for _, id := range exclude {
+			if !slices.Contains(unmatched, id) {
+				fmt.Fprintf(&b, "[+]%s excluded: ok\n", id)
+			}
+		}
+		if len(unmatched) > 0 {
+			fmt.Fprintf(&b, "warn: some health checks cannot be excluded: no matches for %q\n", unmatched)
+		}
+		if rep.OK {
+			fmt.Fprintf(&b, "%s check passed\n", name)
+		} else {
+			fmt.Fprintf(&b, "%s check failed\n", name)
+		}
+		c.String(code, b.String())
+	}
+}
+
+func healthLine(ch readiness.Check) string {
+	status := "ok"
+	if !ch.OK {
+		status = "failed"
+	}
+	if ch.Optional {
+		status += " (optional)"
+	}
+	if ch.Detail == "" {
+		return fmt.Sprintf("[%s]%s %s\n", healthMark(ch.OK), ch.ID, status)
+	}
+	return fmt.Sprintf("[%s]%s %s: %s\n", healthMark(ch.OK), ch.ID, status, ch.Detail)
+}
+
+func healthMark(ok bool) string {
+	if ok {
+		return "+"
+	}
+	return "-"
+}
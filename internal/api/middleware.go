@@ -13,20 +13,39 @@ import (
 
 var warnOnce sync.Once
 
-// gatewayAuth guards peer-management APIs. Production requires a gateway-issued
-// short-lived PASETO (Authorization) plus the per-node key (X-Erebrus-Node-Key).
-// Debug mode still accepts the legacy bearer node key in Authorization.
-func (s *Server) gatewayAuth() gin.HandlerFunc {
-	return s.gatewayAuthForPurpose("")
+// Peer-management route purposes.
+const (
+	purposePeerList        = "peer_list"
+	purposePeerUpsert      = "peer_upsert"
+	purposePeerDelete      = "peer_delete"
+	purposePeerCredentials = "peer_credentials"
+)
+
+// peerAuth guards peer-management APIs. Production requires a gateway-issued
+// short-lived PASETO (Authorization) with the route's purpose plus the
+// per-node key (X-Erebrus-Node-Key). GATEWAY_LEGACY_PEER_TOKENS also accepts
+// purpose-less tokens, and debug mode still accepts the legacy bearer node key
+// in Authorization.
+func (s *Server) peerAuth(purpose string) gin.HandlerFunc {
+	return s.gatewayAuthFor(purpose, true)
 }
 
+// gatewayAuthForPurpose requires an exact purpose with no debug fallbacks.
 func (s *Server) gatewayAuthForPurpose(purpose string) gin.HandlerFunc {
-	nodeKey := s.cfg.EffectiveNodeKey()
-	gwPub := s.cfg.GatewayPublicKey
-	debug := s.cfg.RunType == "debug"
+	return s.gatewayAuthFor(purpose, false)
+}
+
+func (s *Server) gatewayAuthFor(purpose string, peerRoute bool) gin.HandlerFunc {
+	cfg := s.cfg.Load()
+	nodeKey := cfg.EffectiveNodeKey()
+	gwKeys := s.gwKeys
+	if gwKeys == nil {
+		gwKeys = gatewayauth.NewKeySet(gatewayauth.Key{PublicKey: cfg.GatewayPublicKey})
+	}
+	debug := cfg.RunType == "debug"
 	return func(c *gin.Context) {
 		if nodeKey == "" {
-			if debug && purpose == "" {
+			if debug && peerRoute {
 				warnOnce.Do(func() {
 					slog.Warn("NODE_KEY not set — peer API is UNAUTHENTICATED (debug only)")
 				})
@@ -44,23 +63,32 @@ func (s *Server) gatewayAuthForPurpose(purpose string) gin.HandlerFunc {
 		bearer := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
 		headerKey := strings.TrimSpace(c.GetHeader("X-Erebrus-Node-Key"))
 
-		if gwPub != "" && bearer != "" && headerKey != "" {
-			var err error
-			if purpose == "" {
-				_, err = gatewayauth.VerifyGatewayCall(bearer, gwPub, s.cfg.NodeID)
-			} else {
-				_, err = gatewayauth.VerifyGatewayCallPurpose(bearer, gwPub, s.cfg.NodeID, purpose)
-			}
+		if !gwKeys.Empty() && bearer != "" && headerKey != "" {
+			_, err := s.gwVerifier.Verify(bearer, gwKeys, gatewayauth.Request{
+				NodeID:        s.cfg.Load().NodeID,
+				Purpose:       purpose,
+				AllowUnscoped: peerRoute && cfg.GatewayLegacyPeerTokens,
+				PeerID:        c.Param("id"),
+				Method:        c.Request.Method,
+				Path:          c.Request.URL.Path,
+			})
 			if err == nil {
 				if subtle.ConstantTimeCompare([]byte(headerKey), []byte(nodeKey)) == 1 {
 					c.Next()
 					return
 				}
+				s.countAuthFailure("node_key", nil)
+			} else {
+				reason := gatewayauth.ReasonOf(err)
+				s.countAuthFailure(string(reason), err)
+				if reason == gatewayauth.ReasonUnknownKey && s.onUnknownKey != nil {
+					s.onUnknownKey()
+				}
 			}
 		}
 
 		// Debug fallback: legacy single bearer (NODE_API_TOKEN style).
-		if purpose == "" && debug && bearer != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(nodeKey)) == 1 {
+		if peerRoute && debug && bearer != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(nodeKey)) == 1 {
 			c.Next()
 			return
 		}
@@ -68,3 +96,28 @@ func (s *Server) gatewayAuthForPurpose(purpose string) gin.HandlerFunc {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 	}
 }
+
+func (s *Server) countAuthFailure(reason string, err error) {
+	slog.Debug("gateway call token rejected", "reason", reason, "err", err)
+	if s.metrics != nil {
+		s.metrics.GatewayAuthFailures.WithLabelValues(reason).Inc()
+	}
+}
+
+// metricsAuth optionally guards /metrics with METRICS_BEARER_TOKEN. Without a
+// token the endpoint is open; bind the metrics listener to loopback instead.
+func (s *Server) metricsAuth() gin.HandlerFunc {
+	token := strings.TrimSpace(s.cfg.Load().MetricsToken)
+	return func(c *gin.Context) {
+		if token == "" {
+			c.Next()
+			return
+		}
+		bearer := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		if subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+		c.Next()
+	}
+}
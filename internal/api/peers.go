@@ -20,7 +20,7 @@ func (s *Server) handlePutPeer(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "name and wg_public_key are required"})
 		return
 	}
-	if s.status == "draining" {
+	if s.status != "online" {
 		c.JSON(http.StatusConflict, gin.H{"error": "node is draining"})
 		return
 	}
@@ -12,7 +12,9 @@ import (
 
 	"github.com/NetSepio/erebrus/internal/config"
 	"github.com/NetSepio/erebrus/internal/drop"
+	"github.com/NetSepio/erebrus/internal/gatewayauth"
 	"github.com/NetSepio/erebrus/internal/readiness"
+	"github.com/NetSepio/erebrus/internal/telemetry"
 	"github.com/NetSepio/erebrus/internal/wallet"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -41,20 +43,43 @@ type Identity struct {
 
 // Server wires the Gin engine.
 type Server struct {
-	cfg  *config.Config
+	cfg  *config.Live
 	prov Provisioner
 	id   Identity
-	// status reflects drain state ("online" | "draining"); Phase 2 toggles it.
+	// status reflects drain state ("online" | "draining" | "drained").
 	status             string
 	readinessFn        func() readiness.Input
 	wireGuardPublicKey func() string
 	serviceSnapshotFn  func() map[string]string
 	drop               *drop.Service
+	gwVerifier         *gatewayauth.Verifier
+	gwKeys             *gatewayauth.KeySet
+	onUnknownKey       func()
+	metrics            *telemetry.Metrics
 }
 
 // NewServer builds the API server.
-func NewServer(cfg *config.Config, prov Provisioner, id Identity) *Server {
-	return &Server{cfg: cfg, prov: prov, id: id, status: "online"}
+func NewServer(cfg *config.Live, prov Provisioner, id Identity) *Server {
+	c := cfg.Load()
+	return &Server{
+		cfg: cfg, prov: prov, id: id, status: "online",
+		gwVerifier: gatewayauth.NewVerifier(gatewayauth.Options{
+			MaxTTL: c.GatewayTokenMaxTTL, ClockSkew: c.GatewayTokenClockSkew, Strict: c.GatewayTokenStrict,
+		}),
+	}
+}
+
+// SetGatewayKeys supplies the trusted gateway key set. Without it the
+// single GATEWAY_PUBLIC_KEY from config is trusted. onUnknownKey, if set, is
+// called when a token names a key the set does not hold.
+func (s *Server) SetGatewayKeys(ks *gatewayauth.KeySet, onUnknownKey func()) {
+	s.gwKeys = ks
+	s.onUnknownKey = onUnknownKey
+}
+
+// SetMetrics enables counting of rejected gateway call tokens.
+func (s *Server) SetMetrics(m *telemetry.Metrics) {
+	s.metrics = m
 }
 
 // SetReadinessProvider supplies live signals for readiness evaluation.
@@ -77,7 +102,7 @@ func (s *Server) SetDropService(service *drop.Service) {
 	s.drop = service
 }
 
-// SetStatus updates the public status field (online | draining).
+// SetStatus updates the public status field (online | draining | drained).
 func (s *Server) SetStatus(status string) {
 	if status == "" {
 		status = "online"
@@ -85,34 +110,57 @@ func (s *Server) SetStatus(status string) {
 	s.status = status
 }
 
-// Router returns the configured Gin engine.
+// Surface is one of the node's HTTP listeners. Each can be bound separately
+// (see config.Listener); surfaces that share an address share one engine.
+type Surface string
+
+const (
+	SurfacePublic     Surface = "public"     // dashboard, /healthz, public status
+	SurfaceMetrics    Surface = "metrics"    // Prometheus /metrics
+	SurfaceManagement Surface = "management" // gateway-only peer and Drop APIs
+)
+
+// Router returns a Gin engine serving every surface on one listener.
 func (s *Server) Router() *gin.Engine {
-	if s.cfg.RunType == "debug" {
+	return s.RouterFor(SurfacePublic, SurfaceMetrics, SurfaceManagement)
+}
+
+// RouterFor returns a Gin engine serving only the given surfaces.
+func (s *Server) RouterFor(surfaces ...Surface) *gin.Engine {
+	if s.cfg.Load().RunType == "debug" {
 		gin.SetMode(gin.DebugMode)
 	} else {
 		gin.SetMode(gin.ReleaseMode)
 	}
 	r := gin.New()
 	r.Use(gin.Recovery())
-
-	// Local dashboard (intro, docs, live stats).
-	r.GET("/", func(c *gin.Context) { c.Data(http.StatusOK, "text/html; charset=utf-8", indexHTML) })
-
-	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 	r.GET("/healthz", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"status": "ok"}) })
+	r.GET("/livez", s.healthHandler("livez", readiness.Live))
+	r.GET("/readyz", s.healthHandler("readyz", readiness.Evaluate))
+	r.GET("/startupz", s.healthHandler("startupz", readiness.Startup))
 
 	v2 := r.Group("/api/v2")
-	v2.GET("/status", s.handleStatus)
-	v2.GET("/stats", s.handleStats) // coarse public aggregates for the dashboard
-
-	authed := v2.Group("")
-	authed.Use(s.gatewayAuth())
-	{
-		authed.GET("/peers", s.handleListPeers)
-		authed.PUT("/peers/:id", s.handlePutPeer)
-		authed.DELETE("/peers/:id", s.handleDeletePeer)
-		authed.GET("/peers/:id/credentials", s.handleCredentials)
+	for _, surface := range surfaces {
+		switch surface {
+		case SurfacePublic:
+			// Local dashboard (intro, docs, live stats).
+			r.GET("/", func(c *gin.Context) { c.Data(http.StatusOK, "text/html; charset=utf-8", indexHTML) })
+			v2.GET("/status", s.handleStatus)
+			v2.GET("/stats", s.handleStats) // coarse public aggregates for the dashboard
+		case SurfaceMetrics:
+			r.GET("/metrics", s.metricsAuth(), gin.WrapH(promhttp.Handler()))
+		case SurfaceManagement:
+			s.managementRoutes(v2)
+		}
 	}
+	return r
+}
+
+func (s *Server) managementRoutes(v2 *gin.RouterGroup) {
+	v2.GET("/peers", s.peerAuth(purposePeerList), s.handleListPeers)
+	v2.PUT("/peers/:id", s.peerAuth(purposePeerUpsert), s.handlePutPeer)
+	v2.DELETE("/peers/:id", s.peerAuth(purposePeerDelete), s.handleDeletePeer)
+	v2.GET("/peers/:id/credentials", s.peerAuth(purposePeerCredentials), s.handleCredentials)
 	if s.drop != nil {
 		dropAPI := v2.Group("/drop")
 		dropAPI.GET("/status", s.gatewayAuthForPurpose("drop_status"), s.handleDropStatus)
@@ -123,37 +171,39 @@ func (s *Server) Router() *gin.Engine {
 		dropAPI.Any("/webui", s.gatewayAuthForPurpose("drop_webui"), s.handleDropWebUI)
 		dropAPI.Any("/webui/*path", s.gatewayAuthForPurpose("drop_webui"), s.handleDropWebUI)
 	}
-	return r
 }
 
 func (s *Server) handleStatus(c *gin.Context) {
+	cfg := s.cfg.Load()
 	protocols := []string{"wireguard"}
-	if s.cfg.EnableStealth {
+	if cfg.EnableStealth {
 		protocols = append(protocols, "vless-reality", "hysteria2")
 	}
-	in := readiness.Input{Cfg: s.cfg, IdentityConfigured: s.id.PeerID != ""}
-	if s.readinessFn != nil {
-		in = s.readinessFn()
-		in.Cfg = s.cfg
-		if in.IdentityConfigured == false && s.id.PeerID != "" {
-			in.IdentityConfigured = true
-		}
+	if cfg.TUICCarrierEnabled() {
+		protocols = append(protocols, "tuic")
+	}
+	if cfg.WebSocketCarrierEnabled() {
+		protocols = append(protocols, "vless-ws")
+	}
+	if cfg.HTTPSConnectCarrierEnabled() {
+		protocols = append(protocols, "https-connect")
 	}
+	in := s.readinessInput()
 	rep := readiness.Evaluate(in)
-	chain := wallet.CanonicalChain(s.cfg.WalletChain)
+	chain := wallet.CanonicalChain(cfg.WalletChain)
 	idStatus := IdentityStatus{
-		Configured:  in.IdentityConfigured && s.cfg.Mnemonic != "",
+		Configured:  in.IdentityConfigured && cfg.Mnemonic != "",
 		PeerID:      s.id.PeerID,
 		DID:         s.id.DID,
 		WalletChain: chain,
 		WalletLabel: wallet.ChainLabel(chain),
 	}
-	if s.cfg.Mnemonic != "" {
-		if addr, err := wallet.AddressFromMnemonic(s.cfg.Mnemonic, chain); err == nil {
+	if cfg.Mnemonic != "" {
+		if addr, err := wallet.AddressFromMnemonic(cfg.Mnemonic, chain); err == nil {
 			idStatus.WalletAddress = addr
 		}
 	}
-	wgPort, _ := strconv.Atoi(s.cfg.WGEndpointPort)
+	wgPort, _ := strconv.Atoi(cfg.WGEndpointPort)
 	if wgPort == 0 {
 		wgPort = 51820
 	}
@@ -161,14 +211,14 @@ func (s *Server) handleStatus(c *gin.Context) {
 	if s.wireGuardPublicKey != nil {
 		wgPub = s.wireGuardPublicKey()
 	}
-	wgHost := s.cfg.WGEndpointHost
+	wgHost := cfg.WGEndpointHost
 	c.JSON(http.StatusOK, StatusResponse{
-		Version:    s.cfg.Version,
-		NodeName:   s.cfg.NodeName,
-		Region:     s.cfg.Region,
-		Zone:       s.cfg.Zone,
+		Version:    cfg.Version,
+		NodeName:   cfg.NodeName,
+		Region:     cfg.Region,
+		Zone:       cfg.Zone,
 		Status:     s.status,
-		AccessMode: string(s.cfg.Mode.RuntimeMode),
+		AccessMode: string(cfg.Mode.RuntimeMode),
 		PeerID:     s.id.PeerID,
 		DID:        s.id.DID,
 		Identity:   idStatus,
@@ -180,24 +230,37 @@ func (s *Server) handleStatus(c *gin.Context) {
 			},
 		},
 		Capabilities: map[string]any{
-			"access_mode":        s.cfg.Mode.RuntimeMode,
-			"access_label":       readiness.AccessModeLabel(s.cfg.Mode.RuntimeMode),
-			"access_hint":        readiness.AccessModeHint(s.cfg.Mode.RuntimeMode),
-			"region_label":       readiness.RegionLabel(s.cfg.Region),
-			"zone_label":         readiness.ZoneLabel(s.cfg.Zone),
-			"network_profile":    s.cfg.Mode.NetworkProfile,
-			"deployment_profile": s.cfg.ErebrusProfile,
-			"firewall_provider":  s.cfg.FirewallProvider,
-			"stealth":            s.cfg.EnableStealth,
-			"public_api_url":     readiness.PublicAPIURL(s.cfg),
+			"access_mode":        cfg.Mode.RuntimeMode,
+			"access_label":       readiness.AccessModeLabel(cfg.Mode.RuntimeMode),
+			"access_hint":        readiness.AccessModeHint(cfg.Mode.RuntimeMode),
+			"region_label":       readiness.RegionLabel(cfg.Region),
+			"zone_label":         readiness.ZoneLabel(cfg.Zone),
+			"network_profile":    cfg.Mode.NetworkProfile,
+			"deployment_profile": cfg.ErebrusProfile,
+			"firewall_provider":  cfg.FirewallProvider,
+			"stealth":            cfg.EnableStealth,
+			"public_api_url":     readiness.PublicAPIURL(cfg),
 			"services":           s.servicesSnapshot(),
 			"drop":               s.publicDropCapability(),
 		},
-		Protocols: protocols,
-		Readiness: rep,
+		Protocols:  protocols,
+		Readiness:  rep,
+		Components: in.Components,
 	})
 }
 
+func (s *Server) readinessInput() readiness.Input {
+	in := readiness.Input{Cfg: s.cfg.Load(), IdentityConfigured: s.id.PeerID != ""}
+	if s.readinessFn != nil {
+		in = s.readinessFn()
+		in.Cfg = s.cfg.Load()
+		if in.IdentityConfigured == false && s.id.PeerID != "" {
+			in.IdentityConfigured = true
+		}
+	}
+	return in
+}
+
 func (s *Server) servicesSnapshot() map[string]string {
 	services := map[string]string{"vpn": "active"}
 	if s.serviceSnapshotFn != nil {
@@ -1,5 +1,7 @@
 package api
 
+import "github.com/NetSepio/erebrus/internal/supervisor"
+
 const BundleVersion = 2
 
 // TransportEntry describes one carrier in a v2 credential bundle.
@@ -103,4 +105,7 @@ type StatusResponse struct {
 	Capabilities map[string]any  `json:"capabilities"`
 	Protocols    []string        `json:"protocols"`
 	Readiness    any             `json:"readiness"`
+	// Components lists supervised subsystems (DNS, carriers, libp2p, Drop,
+	// gateway client) with their lifecycle state.
+	Components []supervisor.Status `json:"components,omitempty"`
 }
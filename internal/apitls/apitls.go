@@ -0,0 +1,190 @@
+// Package apitls provides the certificate served by the node's management API.
+// By default it is a long-lived self-signed certificate persisted in
+// node_settings, whose SHA-256 fingerprint the node advertises at registration
+// and in hello so the gateway can pin it. Operator-supplied files and ACME
+// (autocert) are also supported.
+package apitls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/config"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// settings keys for the self-signed management API certificate.
+const (
+	keyCertPEM = "api_tls_cert_pem"
+	keyKeyPEM  = "api_tls_key_pem"
+)
+
+// SettingsStore is the subset of the node store apitls needs.
+type SettingsStore interface {
+	GetSetting(ctx context.Context, key string) (string, error)
+	SetSetting(ctx context.Context, key, value string) error
+}
+
+// Bundle is a ready-to-serve TLS configuration plus the pin advertised to the
+// gateway. Fingerprint is empty for ACME, whose leaf rotates on renewal.
+type Bundle struct {
+	Config      *tls.Config
+	Fingerprint string // hex SHA-256 of the leaf certificate DER
+}
+
+// Load builds the TLS configuration for a listener with TLS enabled.
+func Load(ctx context.Context, cfg *config.Config, st SettingsStore, l config.Listener) (*Bundle, error) {
+	switch {
+	case l.HasCertFiles():
+		cert, err := tls.LoadX509KeyPair(l.TLSCertFile, l.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load API TLS files: %w", err)
+		}
+		return bundleFor(cert)
+	case l.AutoTLS == config.APITLSACME:
+		return acmeBundle(ctx, cfg), nil
+	case l.AutoTLS == config.APITLSSelfSigned:
+		certPEM, keyPEM, err := LoadOrCreate(ctx, st, hostsFor(cfg))
+		if err != nil {
+			return nil, err
+		}
+		cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("parse API TLS cert: %w", err)
+		}
+		return bundleFor(cert)
+	default:
+		return nil, fmt.Errorf("listener %s has no TLS configured", l.Addr())
+	}
+}
+
+// LoadOrCreate returns the persisted self-signed PEM pair, generating it on
+// first use. The certificate is not re-issued when hosts change: the gateway
+// pins the fingerprint, not the name.
+func LoadOrCreate(ctx context.Context, st SettingsStore, hosts []string) (certPEM, keyPEM string, err error) {
+	if certPEM, err = st.GetSetting(ctx, keyCertPEM); err != nil {
+		return "", "", err
+	}
+	if keyPEM, err = st.GetSetting(ctx, keyKeyPEM); err != nil {
+		return "", "", err
+	}
+	if certPEM != "" && keyPEM != "" {
+		return certPEM, keyPEM, nil
+	}
+	if certPEM, keyPEM, err = generateSelfSigned(hosts); err != nil {
+		return "", "", err
+	}
+	if err = st.SetSetting(ctx, keyCertPEM, certPEM); err != nil {
+		return "", "", err
+	}
+	if err = st.SetSetting(ctx, keyKeyPEM, keyPEM); err != nil {
+		return "", "", err
+	}
+	return certPEM, keyPEM, nil
+}
+
+// Fingerprint returns the hex SHA-256 of a DER-encoded certificate.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+func bundleFor(cert tls.Certificate) (*Bundle, error) {
+	if len(cert.Certificate) == 0 {
+		return nil, fmt.Errorf("API TLS certificate is empty")
+	}
+	return &Bundle{
+		Config: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		},
+		Fingerprint: Fingerprint(cert.Certificate[0]),
+	}, nil
+}
+
+// acmeBundle obtains certificates for API_TLS_ACME_DOMAIN via TLS-ALPN-01 on
+// the management listener, or HTTP-01 when API_TLS_ACME_HTTP_ADDR is set.
+func acmeBundle(ctx context.Context, cfg *config.Config) *Bundle {
+	m := &autocert.Manager{
+		Prompt:     autocert.AcceptTOS,
+		HostPolicy: autocert.HostWhitelist(cfg.APITLSACMEDomain),
+		Cache:      autocert.DirCache(filepath.Join(cfg.StateDir, "acme")),
+		Email:      cfg.APITLSACMEEmail,
+	}
+	if addr := cfg.APITLSACMEHTTP; addr != "" {
+		srv := &http.Server{Addr: addr, Handler: m.HTTPHandler(nil), ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			<-ctx.Done()
+			_ = srv.Close()
+		}()
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Warn("ACME HTTP-01 listener stopped", "addr", addr, "err", err)
+			}
+		}()
+	}
+	tlsCfg := m.TLSConfig()
+	tlsCfg.MinVersion = tls.VersionTLS12
+	return &Bundle{Config: tlsCfg}
+}
+
+func hostsFor(cfg *config.Config) []string {
+	hosts := []string{"localhost", "127.0.0.1"}
+	if cfg.WGEndpointHost != "" {
+		hosts = append(hosts, cfg.WGEndpointHost)
+	}
+	return hosts
+}
+
+func generateSelfSigned(hosts []string) (certPEM, keyPEM string, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "erebrus-node-api"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}))
+	return certPEM, keyPEM, nil
+}
@@ -0,0 +1,43 @@
+package apitls
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/NetSepio/erebrus/internal/config"
+)
+
+type memStore struct{ m map[string]string }
+
+func (s *memStore) GetSetting(_ context.Context, k string) (string, error) { return s.m[k], nil }
+func (s *memStore) SetSetting(_ context.Context, k, v string) error        { s.m[k] = v; return nil }
+
+func TestSelfSignedStableFingerprint(t *testing.T) {
+	ctx := context.Background()
+	st := &memStore{m: map[string]string{}}
+	cfg := &config.Config{WGEndpointHost: "203.0.113.1", APITLS: config.APITLSSelfSigned}
+	l := config.Listener{BindAddr: "0.0.0.0", Port: "9080", AutoTLS: config.APITLSSelfSigned}
+
+	b1, err := Load(ctx, cfg, st, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := Load(ctx, cfg, st, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b1.Fingerprint == "" || b1.Fingerprint != b2.Fingerprint {
+		t.Fatalf("fingerprint not stable: %q vs %q", b1.Fingerprint, b2.Fingerprint)
+	}
+	if len(b1.Fingerprint) != 64 {
+		t.Fatalf("fingerprint should be hex SHA-256, got %q", b1.Fingerprint)
+	}
+	leaf := b1.Config.Certificates[0].Certificate[0]
+	if Fingerprint(leaf) != b1.Fingerprint {
+		t.Fatal("fingerprint does not match served leaf")
+	}
+	if b1.Config.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("min version = %x", b1.Config.MinVersion)
+	}
+}
@@ -0,0 +1,37 @@
+package carriers
+
+import (
+	"context"
+
+	"github.com/NetSepio/erebrus/internal/stealth"
+	"github.com/NetSepio/erebrus/internal/store"
+)
+
+// RecordPeer records hashes of a new peer's own carrier credentials under
+// the "peer" scope.
+func RecordPeer(ctx context.Context, st *store.Store, u stealth.User) error {
+	for _, item := range []struct{ transport, material string }{
+		{"vless_reality", u.UUID},
+		{"hysteria2", u.Password},
+	} {
+		if item.material == "" {
+			continue
+		}
+		if err := st.InsertCarrierCredential(ctx, store.CarrierCredential{
+			Transport:  item.transport,
+			SecretHash: hashSecret(item.material),
+			Active:     true,
+			Scope:      "peer",
+			PeerID:     u.Name,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RevokePeer marks a removed peer's carrier credentials inactive.
+func RevokePeer(ctx context.Context, st *store.Store, peerID string) error {
+	_, err := st.DeactivatePeerCarrierCredentials(ctx, peerID)
+	return err
+}
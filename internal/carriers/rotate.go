@@ -13,6 +13,10 @@ import (
 	"github.com/NetSepio/erebrus/internal/store"
 )
 
+// expiryInterval is how often a running node retires credentials whose
+// grace period has ended.
+const expiryInterval = time.Minute
+
 // Rotator rotates node-wide carrier secrets.
 type Rotator struct {
 	St      *store.Store
@@ -25,8 +29,11 @@ type Options struct {
 	PeerID      string // optional scope label for audit
 }
 
-// Rotate generates new carrier credentials, archives hashes of the previous
-// secrets with a grace expiry, and restarts stealth listeners.
+// Rotate generates new carrier credentials and archives hashes of the
+// previous secrets with a grace expiry. It does not restart the stealth
+// listeners; a running node restarts them through its supervisor. The carriers
+// keep accepting the previous VLESS UUID, Hysteria2 password and REALITY
+// short-id until that expiry; Expire retires them.
 func (r *Rotator) Rotate(ctx context.Context, opt Options) error {
 	if r.St == nil || r.Stealth == nil {
 		return fmt.Errorf("rotator not configured")
@@ -48,7 +55,7 @@ func (r *Rotator) Rotate(ctx context.Context, opt Options) error {
 		return err
 	}
 
-	if err := r.Stealth.RotateAllSecrets(ctx); err != nil {
+	if err := r.Stealth.RotateAllSecrets(ctx, time.Unix(expires, 0)); err != nil {
 		return fmt.Errorf("rotate secrets: %w", err)
 	}
 
@@ -56,7 +63,10 @@ func (r *Rotator) Rotate(ctx context.Context, opt Options) error {
 	for _, item := range []struct{ transport, material string }{
 		{"vless_reality", r.Stealth.Params().VLESSUUID},
 		{"hysteria2", r.Stealth.Params().Hysteria2Password},
+		{"tuic", r.Stealth.Params().TUICPassword},
 		{"reality_short_id", r.Stealth.Params().RealityShortID},
+		{"vless_ws_path", r.Stealth.Params().WSPath},
+		{"https_connect", r.Stealth.Params().ConnectPassword},
 	} {
 		if item.material == "" {
 			continue
@@ -73,14 +83,43 @@ func (r *Rotator) Rotate(ctx context.Context, opt Options) error {
 		}
 	}
 
-	n, _ := r.St.DeactivateExpiredCarrierCredentials(ctx, now)
-	if n > 0 {
-		slog.Info("carrier credentials expired", "count", n)
+	if err := r.Expire(ctx); err != nil {
+		slog.Warn("expire carrier credentials failed", "err", err)
 	}
 	slog.Info("carrier rotation complete", "grace_period", opt.GracePeriod.String(), "scope", scope)
 	return nil
 }
 
+// Expire retires credentials whose grace period has ended: their records go
+// inactive and the running carriers stop accepting them.
+func (r *Rotator) Expire(ctx context.Context) error {
+	now := time.Now()
+	n, err := r.St.DeactivateExpiredCarrierCredentials(ctx, now.Unix())
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		slog.Info("carrier credentials expired", "count", n)
+	}
+	return r.Stealth.ExpireGrace(ctx, now)
+}
+
+// RunExpiry calls Expire every expiryInterval until ctx is done.
+func (r *Rotator) RunExpiry(ctx context.Context) {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := r.Expire(ctx); err != nil {
+			slog.Warn("expire carrier credentials failed", "err", err)
+		}
+	}
+}
+
 func (r *Rotator) archiveCurrent(ctx context.Context, scope, peerID string, expiresAt int64) error {
 	p := r.Stealth.Params()
 	if !p.Enabled {
@@ -90,7 +129,10 @@ func (r *Rotator) archiveCurrent(ctx context.Context, scope, peerID string, expi
 	for _, item := range []struct{ transport, material string }{
 		{"vless_reality", p.VLESSUUID},
 		{"hysteria2", p.Hysteria2Password},
+		{"tuic", p.TUICPassword},
 		{"reality_short_id", p.RealityShortID},
+		{"vless_ws_path", p.WSPath},
+		{"https_connect", p.ConnectPassword},
 	} {
 		if item.material == "" {
 			continue
@@ -4,9 +4,11 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Config holds the full node configuration.
@@ -24,11 +26,24 @@ type Config struct {
 	Mode            ModeSettings
 	UnsafePublicAPI bool
 
+	// HTTP listeners. The public listener is BindAddr:HTTPPort; metrics and
+	// the management API share it unless their own port is set.
+	PublicTLSCertFile string   // PUBLIC_TLS_CERT_FILE
+	PublicTLSKeyFile  string   // PUBLIC_TLS_KEY_FILE
+	Metrics           Listener // METRICS_BIND_ADDR / METRICS_PORT / METRICS_TLS_*
+	MetricsToken      string   // METRICS_BEARER_TOKEN — optional bearer for /metrics
+	Management        Listener // MANAGEMENT_BIND_ADDR / MANAGEMENT_PORT / MANAGEMENT_TLS_*
+	APITLS            string   // API_TLS — off | self-signed | acme (management listener)
+	APITLSACMEDomain  string   // API_TLS_ACME_DOMAIN
+	APITLSACMEEmail   string   // API_TLS_ACME_EMAIL
+	APITLSACMEHTTP    string   // API_TLS_ACME_HTTP_ADDR — optional HTTP-01 listener, e.g. :80
+
 	// identity
 	Mnemonic string
 
 	// gateway
-	GatewayURL            string
+	GatewayURL            string   // primary; GATEWAY_URLS[0] when that is set
+	GatewayURLs           []string // GATEWAY_URLS — ordered failover list, primary first
 	GatewayPeerMultiaddr  string
 	P2PListenPort         string
 	NodeID                string // canonical peer_id; persisted in SQLite when registered
@@ -39,6 +54,14 @@ type Config struct {
 	GatewayAutoRegister   bool
 	GatewayPublicKey      string // gateway Ed25519 public key (hex) for verifying API calls
 
+	// gateway call token checks
+	GatewayTokenMaxTTL    time.Duration // longest exp-iat accepted
+	GatewayTokenClockSkew time.Duration
+	GatewayTokenStrict    bool // require jti and method/path binding
+	// GatewayLegacyPeerTokens accepts purpose-less tokens on peer routes
+	// from gateways that predate per-route purposes.
+	GatewayLegacyPeerTokens bool
+
 	// NodeKey is the per-node bearer (NODE_KEY). NODE_API_TOKEN is a legacy alias.
 	NodeKey      string
 	NodeAPIToken string // deprecated alias for NodeKey
@@ -67,10 +90,37 @@ type Config struct {
 	RealityServerNames     []string // SNIs the REALITY handshake borrows; first is the dial target
 	RealityHandshakeServer string   // host:port the node proxies the real TLS handshake to
 	Hysteria2ObfsPassword  string
-	EnableTUIC             bool
+	EnableTUIC             bool   // TUIC v5 over QUIC on StealthTUICPort; needs EnableStealth
+	StealthTUICPort        string // STEALTH_TUIC_PORT (udp)
+
+	// VLESS over WebSocket+TLS, for networks where only CDN ranges are
+	// reachable: clients dial StealthWSHost through the CDN, which forwards
+	// to StealthWSPort here. Off while StealthWSHost is empty.
+	StealthWSHost     string // STEALTH_WS_HOST — CDN hostname clients dial
+	StealthWSPort     string // STEALTH_WS_PORT — origin port the CDN forwards to
+	StealthWSCertFile string // STEALTH_WS_TLS_CERT_FILE — origin certificate; self-signed when empty
+	StealthWSKeyFile  string // STEALTH_WS_TLS_KEY_FILE
+
+	// HTTPS CONNECT (NaïveProxy-style) carrier: padded HTTP/2 CONNECT behind
+	// ordinary TLS, for networks that pass little besides HTTPS. Clients dial
+	// StealthConnectHost:StealthConnectPort. Off while StealthConnectHost is
+	// empty.
+	StealthConnectHost     string // STEALTH_CONNECT_HOST — hostname clients dial and verify
+	StealthConnectPort     string // STEALTH_CONNECT_PORT
+	StealthConnectCertFile string // STEALTH_CONNECT_TLS_CERT_FILE — certificate for the host; self-signed when empty
+	StealthConnectKeyFile  string // STEALTH_CONNECT_TLS_KEY_FILE
 
 	// node-local state
-	StateDir string
+	StateDir         string
+	AdminSocket      string // ADMIN_SOCKET — local admin API socket; "off" disables it
+	AdminSocketGroup string // ADMIN_SOCKET_GROUP — group allowed to use it besides the node user
+
+	// self-update (erebrus-node upgrade / the upgrade gateway command)
+	UpgradeManifestURL   string        // UPGRADE_MANIFEST_URL — signed release manifest
+	UpgradeReleaseKey    string        // UPGRADE_RELEASE_KEY — Ed25519 key (hex or base64); overrides the built-in key
+	UpgradeRestart       string        // UPGRADE_RESTART — exec | systemd
+	UpgradeSystemdUnit   string        // UPGRADE_SYSTEMD_UNIT
+	UpgradeHealthTimeout time.Duration // UPGRADE_HEALTH_TIMEOUT — readiness deadline before rollback
 
 
 	// Drop storage
@@ -108,6 +158,12 @@ type Config struct {
 	SentinelLicensed bool
 }
 
+// Restart strategies after a self-update (UPGRADE_RESTART).
+const (
+	UpgradeRestartExec    = "exec"    // re-exec the new binary in place (containers)
+	UpgradeRestartSystemd = "systemd" // systemctl restart UPGRADE_SYSTEMD_UNIT
+)
+
 // Load reads configuration from the environment, applying sane defaults.
 func Load() *Config {
 	bindAddr := env("API_BIND_ADDR", "")
@@ -119,12 +175,20 @@ func Load() *Config {
 		BindAddr:                bindAddr,
 		HTTPPort:                env("HTTP_PORT", "9080"),
 		UnsafePublicAPI:         boolEnv("UNSAFE_PUBLIC_API", false),
+		PublicTLSCertFile:       os.Getenv("PUBLIC_TLS_CERT_FILE"),
+		PublicTLSKeyFile:        os.Getenv("PUBLIC_TLS_KEY_FILE"),
+		MetricsToken:            os.Getenv("METRICS_BEARER_TOKEN"),
+		APITLS:                  strings.ToLower(env("API_TLS", APITLSSelfSigned)),
+		APITLSACMEDomain:        os.Getenv("API_TLS_ACME_DOMAIN"),
+		APITLSACMEEmail:         os.Getenv("API_TLS_ACME_EMAIL"),
+		APITLSACMEHTTP:          os.Getenv("API_TLS_ACME_HTTP_ADDR"),
 		NodeName:                env("NODE_NAME", hostnameOr("erebrus-node")),
 		Region:                  env("REGION", "unknown"),
 		Zone:                    env("ZONE", ""),
 		Version:                 Version,
 		Mnemonic:                os.Getenv("MNEMONIC"),
 		GatewayURL:              env("GATEWAY_URL", ""),
+		GatewayURLs:             splitCSV(env("GATEWAY_URLS", "")),
 		GatewayPeerMultiaddr:    env("GATEWAY_PEER_MULTIADDR", ""),
 		P2PListenPort:           env("P2P_LISTEN_PORT", "9002"),
 		NodeID:                  os.Getenv("NODE_ID"),
@@ -134,6 +198,10 @@ func Load() *Config {
 		APIPublicURL:            os.Getenv("API_PUBLIC_URL"),
 		GatewayAutoRegister:     boolEnv("GATEWAY_AUTO_REGISTER", true),
 		GatewayPublicKey:        os.Getenv("GATEWAY_PUBLIC_KEY"),
+		GatewayTokenMaxTTL:      durationEnv("GATEWAY_TOKEN_MAX_TTL", 5*time.Minute),
+		GatewayTokenClockSkew:   durationEnv("GATEWAY_TOKEN_CLOCK_SKEW", 30*time.Second),
+		GatewayTokenStrict:      boolEnv("GATEWAY_TOKEN_STRICT", false),
+		GatewayLegacyPeerTokens: boolEnv("GATEWAY_LEGACY_PEER_TOKENS", false),
 		NodeKey:                 firstEnv("NODE_KEY", "NODE_API_TOKEN", ""),
 		NodeAPIToken:            firstEnv("NODE_KEY", "NODE_API_TOKEN", ""),
 		WGConfDir:               env("WG_CONF_DIR", "/etc/wireguard"),
@@ -155,7 +223,23 @@ func Load() *Config {
 		RealityHandshakeServer:  env("REALITY_HANDSHAKE_SERVER", ""),
 		Hysteria2ObfsPassword:   os.Getenv("HYSTERIA2_OBFS_PASSWORD"),
 		EnableTUIC:              boolEnv("ENABLE_TUIC", false),
+		StealthTUICPort:         env("STEALTH_TUIC_PORT", "8443"),
+		StealthWSHost:           os.Getenv("STEALTH_WS_HOST"),
+		StealthWSPort:           env("STEALTH_WS_PORT", "8443"),
+		StealthWSCertFile:       os.Getenv("STEALTH_WS_TLS_CERT_FILE"),
+		StealthWSKeyFile:        os.Getenv("STEALTH_WS_TLS_KEY_FILE"),
+		StealthConnectHost:      os.Getenv("STEALTH_CONNECT_HOST"),
+		StealthConnectPort:      env("STEALTH_CONNECT_PORT", "8444"),
+		StealthConnectCertFile:  os.Getenv("STEALTH_CONNECT_TLS_CERT_FILE"),
+		StealthConnectKeyFile:   os.Getenv("STEALTH_CONNECT_TLS_KEY_FILE"),
 		StateDir:                env("STATE_DIR", "/var/lib/erebrus"),
+		AdminSocket:             os.Getenv("ADMIN_SOCKET"),
+		AdminSocketGroup:        os.Getenv("ADMIN_SOCKET_GROUP"),
+		UpgradeManifestURL:      os.Getenv("UPGRADE_MANIFEST_URL"),
+		UpgradeReleaseKey:       os.Getenv("UPGRADE_RELEASE_KEY"),
+		UpgradeRestart:          strings.ToLower(env("UPGRADE_RESTART", UpgradeRestartExec)),
+		UpgradeSystemdUnit:      env("UPGRADE_SYSTEMD_UNIT", "erebrus-node"),
+		UpgradeHealthTimeout:    durationEnv("UPGRADE_HEALTH_TIMEOUT", 2*time.Minute),
 		DropEnabled:             boolEnv("DROP_ENABLED", false),
 		DropStorageMax:          env("DROP_STORAGE_MAX", "10GB"),
 		DropSwarmPort:           env("DROP_SWARM_PORT", "4001"),
@@ -176,6 +260,22 @@ func Load() *Config {
 		SentinelAPIURL:          os.Getenv("SENTINEL_API_URL"),
 		SentinelImage:           env("SENTINEL_IMAGE", "ghcr.io/netsepio/erebrus-sentinel:latest"),
 	}
+	c.Metrics = Listener{
+		BindAddr:    env("METRICS_BIND_ADDR", "127.0.0.1"),
+		Port:        os.Getenv("METRICS_PORT"),
+		TLSCertFile: os.Getenv("METRICS_TLS_CERT_FILE"),
+		TLSKeyFile:  os.Getenv("METRICS_TLS_KEY_FILE"),
+	}
+	c.Management = Listener{
+		BindAddr:    env("MANAGEMENT_BIND_ADDR", bindAddr),
+		Port:        os.Getenv("MANAGEMENT_PORT"),
+		TLSCertFile: os.Getenv("MANAGEMENT_TLS_CERT_FILE"),
+		TLSKeyFile:  os.Getenv("MANAGEMENT_TLS_KEY_FILE"),
+	}
+	c.GatewayURLs = gatewayURLs(c.GatewayURL, c.GatewayURLs)
+	if len(c.GatewayURLs) > 0 {
+		c.GatewayURL = c.GatewayURLs[0]
+	}
 	c.ApplyProfileDefaults()
 	if mode, err := ParseModeSettingsFromEnv(); err == nil {
 		c.Mode = mode
@@ -183,15 +283,23 @@ func Load() *Config {
 	c.VLESSPort = c.StealthTCPPort
 	c.Hysteria2Port = c.StealthUDPPort
 	c.DropStorageMaxBytes, _ = parseByteSize(c.DropStorageMax)
-	// The management peer API shares the HTTP listener. When it is bound to a
-	// non-loopback address it is reachable off-host (token-gated, fail-closed),
-	// so always surface that as a conscious decision — not just under the
-	// UNSAFE_PUBLIC_API flag.
-	if !isLoopbackAddr(c.BindAddr) {
+	// When the management API is bound to a non-loopback address it is
+	// reachable off-host (token-gated, fail-closed), so always surface that as
+	// a conscious decision — not just under the UNSAFE_PUBLIC_API flag.
+	if mgmt := c.ManagementListener(); !mgmt.Loopback() {
+		hint := "set MANAGEMENT_BIND_ADDR to a private address"
+		if c.Management.Port == "" {
+			hint = "set MANAGEMENT_PORT to give it a separate listener"
+		}
+		c.Mode.Warnings = append(c.Mode.Warnings, fmt.Sprintf(
+			"WARNING: management API bound to %s — the token-gated peer API is reachable off-host. "+
+				"Firewall this port to the gateway/trusted sources, or %s.",
+			mgmt.Addr(), hint))
+	}
+	if m := c.MetricsListener(); !m.Loopback() && c.MetricsToken == "" {
 		c.Mode.Warnings = append(c.Mode.Warnings, fmt.Sprintf(
-			"WARNING: management API bound to %s:%s — the token-gated peer API is reachable off-host. "+
-				"Firewall this port to the gateway/trusted sources, or set API_BIND_ADDR=127.0.0.1.",
-			c.BindAddr, c.HTTPPort))
+			"WARNING: /metrics is served unauthenticated on %s. Set METRICS_PORT (loopback by default) or METRICS_BEARER_TOKEN.",
+			m.Addr()))
 	}
 	return c
 }
@@ -226,6 +334,36 @@ func (c *Config) Validate() error {
 		c.Mode.Warnings = append(c.Mode.Warnings,
 			"WARNING: Stealth should expose 443/tcp and 443/udp (STEALTH_TCP_PORT/STEALTH_UDP_PORT) for reachability through restrictive networks.")
 	}
+	if err := c.validateListeners(); err != nil {
+		return err
+	}
+	if c.WebSocketCarrierEnabled() {
+		if (c.StealthWSCertFile == "") != (c.StealthWSKeyFile == "") {
+			return fmt.Errorf("STEALTH_WS_TLS_CERT_FILE and STEALTH_WS_TLS_KEY_FILE must be set together")
+		}
+		if c.StealthWSPortInt() == c.VLESSPortInt() {
+			return fmt.Errorf("STEALTH_WS_PORT must differ from STEALTH_TCP_PORT (both are %s/tcp)", c.StealthWSPort)
+		}
+	}
+	if c.TUICCarrierEnabled() && c.StealthTUICPortInt() == c.Hysteria2PortInt() {
+		return fmt.Errorf("STEALTH_TUIC_PORT must differ from STEALTH_UDP_PORT (both are %s/udp)", c.StealthTUICPort)
+	}
+	if c.HTTPSConnectCarrierEnabled() {
+		if (c.StealthConnectCertFile == "") != (c.StealthConnectKeyFile == "") {
+			return fmt.Errorf("STEALTH_CONNECT_TLS_CERT_FILE and STEALTH_CONNECT_TLS_KEY_FILE must be set together")
+		}
+		if c.StealthConnectPortInt() == c.VLESSPortInt() {
+			return fmt.Errorf("STEALTH_CONNECT_PORT must differ from STEALTH_TCP_PORT (both are %s/tcp)", c.StealthConnectPort)
+		}
+		if c.WebSocketCarrierEnabled() && c.StealthConnectPortInt() == c.StealthWSPortInt() {
+			return fmt.Errorf("STEALTH_CONNECT_PORT must differ from STEALTH_WS_PORT (both are %s/tcp)", c.StealthConnectPort)
+		}
+	}
+	for _, u := range c.GatewayURLs {
+		if p, err := url.Parse(u); err != nil || p.Scheme == "" || p.Host == "" {
+			return fmt.Errorf("GATEWAY_URLS entry %q is not an absolute URL", u)
+		}
+	}
 	if c.DropEnabled {
 		if c.DropStorageMaxBytes <= 0 {
 			return fmt.Errorf("DROP_STORAGE_MAX must be a positive byte size")
@@ -244,7 +382,19 @@ func (c *Config) Validate() error {
 // DBPath is the SQLite file path.
 func (c *Config) DBPath() string { return c.StateDir + "/erebrus.db" }
 
+// AdminSocketPath is the local admin API socket, "" when it is disabled.
+func (c *Config) AdminSocketPath() string {
+	switch strings.ToLower(c.AdminSocket) {
+	case "":
+		return c.StateDir + "/admin.sock"
+	case "off", "false", "0":
+		return ""
+	}
+	return c.AdminSocket
+}
+
 // PublicAPIBaseURL returns the URL the gateway should use for peer provisioning.
+// It points at the management listener, which may differ from the public one.
 func (c *Config) PublicAPIBaseURL() string {
 	if c.APIPublicURL != "" {
 		return strings.TrimRight(c.APIPublicURL, "/")
@@ -253,12 +403,34 @@ func (c *Config) PublicAPIBaseURL() string {
 	if host == "" {
 		host = "127.0.0.1"
 	}
-	return fmt.Sprintf("http://%s:%s", host, c.HTTPPort)
+	mgmt := c.ManagementListener()
+	if mgmt.AutoTLS == APITLSACME {
+		host = c.APITLSACMEDomain // the ACME certificate only covers this name
+	}
+	return fmt.Sprintf("%s://%s:%s", mgmt.Scheme(), host, mgmt.Port)
 }
 
 // GatewayEnabled reports whether the node should connect to the gateway control plane.
 func (c *Config) GatewayEnabled() bool { return strings.TrimSpace(c.GatewayURL) != "" }
 
+// gatewayURLs is GATEWAY_URLS, or just GATEWAY_URL when the list is unset,
+// without trailing slashes or repeats.
+func gatewayURLs(primary string, list []string) []string {
+	if len(list) == 0 && strings.TrimSpace(primary) != "" {
+		list = []string{strings.TrimSpace(primary)}
+	}
+	var out []string
+	seen := map[string]bool{}
+	for _, u := range list {
+		u = strings.TrimRight(u, "/")
+		if u != "" && !seen[u] {
+			seen[u] = true
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
 // EffectiveRegistrationToken returns the scoped node registration token.
 func (c *Config) EffectiveRegistrationToken() string {
 	return strings.TrimSpace(c.NodeRegistrationToken)
@@ -284,6 +456,31 @@ func (c *Config) VLESSPortInt() int { n, _ := strconv.Atoi(c.VLESSPort); return
 // Hysteria2PortInt parses the Hysteria2 listen port.
 func (c *Config) Hysteria2PortInt() int { n, _ := strconv.Atoi(c.Hysteria2Port); return n }
 
+// StealthWSPortInt parses the VLESS over WebSocket+TLS listen port.
+func (c *Config) StealthWSPortInt() int { n, _ := strconv.Atoi(c.StealthWSPort); return n }
+
+// WebSocketCarrierEnabled reports whether the CDN-frontable WebSocket carrier
+// runs: stealth is on and STEALTH_WS_HOST names the CDN hostname.
+func (c *Config) WebSocketCarrierEnabled() bool {
+	return c.EnableStealth && c.StealthWSHost != ""
+}
+
+// StealthTUICPortInt parses the TUIC listen port.
+func (c *Config) StealthTUICPortInt() int { n, _ := strconv.Atoi(c.StealthTUICPort); return n }
+
+// TUICCarrierEnabled reports whether the TUIC carrier runs: stealth and
+// ENABLE_TUIC are both on.
+func (c *Config) TUICCarrierEnabled() bool { return c.EnableStealth && c.EnableTUIC }
+
+// StealthConnectPortInt parses the HTTPS CONNECT carrier listen port.
+func (c *Config) StealthConnectPortInt() int { n, _ := strconv.Atoi(c.StealthConnectPort); return n }
+
+// HTTPSConnectCarrierEnabled reports whether the HTTPS CONNECT carrier runs:
+// stealth is on and STEALTH_CONNECT_HOST names the host clients dial.
+func (c *Config) HTTPSConnectCarrierEnabled() bool {
+	return c.EnableStealth && c.StealthConnectHost != ""
+}
+
 // DropSwarmPortInt parses the Kubo swarm port.
 func (c *Config) DropSwarmPortInt() int { n, _ := strconv.Atoi(c.DropSwarmPort); return n }
 
@@ -347,6 +544,18 @@ func boolEnv(key string, def bool) bool {
 	return b
 }
 
+func durationEnv(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return def
+	}
+	return d
+}
+
 func parseByteSize(value string) (int64, error) {
 	s := strings.ToUpper(strings.TrimSpace(value))
 	if s == "" {
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -107,6 +108,37 @@ func TestLoadRegistrationTokenAlias(t *testing.T) {
 	}
 }
 
+func TestLoadGatewayURLs(t *testing.T) {
+	t.Setenv("GATEWAY_URLS", "")
+	t.Setenv("GATEWAY_URL", "https://gw1.example/")
+	c := Load()
+	if !reflect.DeepEqual(c.GatewayURLs, []string{"https://gw1.example"}) {
+		t.Fatalf("GatewayURLs = %v, want GATEWAY_URL alone", c.GatewayURLs)
+	}
+	t.Setenv("GATEWAY_URLS", "https://gw2.example, https://gw3.example/,https://gw2.example")
+	c = Load()
+	if !reflect.DeepEqual(c.GatewayURLs, []string{"https://gw2.example", "https://gw3.example"}) {
+		t.Fatalf("GatewayURLs = %v", c.GatewayURLs)
+	}
+	if c.GatewayURL != "https://gw2.example" {
+		t.Fatalf("GatewayURL = %q, want the first GATEWAY_URLS entry", c.GatewayURL)
+	}
+}
+
+func TestAdminSocketPath(t *testing.T) {
+	t.Setenv("STATE_DIR", "/srv/erebrus")
+	for in, want := range map[string]string{
+		"":                    "/srv/erebrus/admin.sock",
+		"/run/erebrus/a.sock": "/run/erebrus/a.sock",
+		"off":                 "",
+	} {
+		t.Setenv("ADMIN_SOCKET", in)
+		if got := Load().AdminSocketPath(); got != want {
+			t.Errorf("ADMIN_SOCKET=%q: path = %q, want %q", in, got, want)
+		}
+	}
+}
+
 func TestLoadDropDefaultsAndOverrides(t *testing.T) {
 	t.Setenv("DROP_ENABLED", "")
 	t.Setenv("DROP_STORAGE_MAX", "")
@@ -162,3 +194,176 @@ func TestLoadAPIBindOverride(t *testing.T) {
 		t.Fatalf("bind addr = %q, want 127.0.0.1 from API_BIND_ADDR", c.BindAddr)
 	}
 }
+
+func TestListenersShareByDefault(t *testing.T) {
+	t.Setenv("API_BIND_ADDR", "0.0.0.0")
+	t.Setenv("HTTP_PORT", "9080")
+	t.Setenv("METRICS_PORT", "")
+	t.Setenv("MANAGEMENT_PORT", "")
+	t.Setenv("API_PUBLIC_URL", "")
+	t.Setenv("API_TLS", "")
+	t.Setenv("WG_ENDPOINT_HOST", "203.0.113.1")
+	c := Load()
+	if c.MetricsListener() != c.PublicListener() || c.ManagementListener() != c.PublicListener() {
+		t.Fatalf("expected shared listener, got metrics=%+v management=%+v", c.MetricsListener(), c.ManagementListener())
+	}
+	if got := c.PublicAPIBaseURL(); got != "https://203.0.113.1:9080" {
+		t.Fatalf("api base url = %q, want self-signed HTTPS by default", got)
+	}
+
+	t.Setenv("API_TLS", "off")
+	c = Load()
+	if got := c.PublicAPIBaseURL(); got != "http://203.0.113.1:9080" {
+		t.Fatalf("api base url = %q with API_TLS=off", got)
+	}
+}
+
+func TestAPITLSACMEUsesDomain(t *testing.T) {
+	t.Setenv("MANAGEMENT_PORT", "9443")
+	t.Setenv("MANAGEMENT_TLS_CERT_FILE", "")
+	t.Setenv("MANAGEMENT_TLS_KEY_FILE", "")
+	t.Setenv("API_PUBLIC_URL", "")
+	t.Setenv("API_TLS", "acme")
+	t.Setenv("API_TLS_ACME_DOMAIN", "")
+	c := Load()
+	if err := c.validateListeners(); err == nil || !strings.Contains(err.Error(), "API_TLS_ACME_DOMAIN") {
+		t.Fatalf("expected ACME domain error, got %v", err)
+	}
+	t.Setenv("API_TLS_ACME_DOMAIN", "node1.example.net")
+	c = Load()
+	if got := c.PublicAPIBaseURL(); got != "https://node1.example.net:9443" {
+		t.Fatalf("api base url = %q", got)
+	}
+	if c.PublicListener().TLSEnabled() {
+		t.Fatal("public listener should not inherit API_TLS when management has its own port")
+	}
+}
+
+func TestSeparateManagementListener(t *testing.T) {
+	t.Setenv("API_BIND_ADDR", "0.0.0.0")
+	t.Setenv("HTTP_PORT", "9080")
+	t.Setenv("METRICS_PORT", "9091")
+	t.Setenv("METRICS_BIND_ADDR", "")
+	t.Setenv("MANAGEMENT_PORT", "9443")
+	t.Setenv("MANAGEMENT_BIND_ADDR", "10.1.2.3")
+	t.Setenv("MANAGEMENT_TLS_CERT_FILE", "/etc/erebrus/api.crt")
+	t.Setenv("MANAGEMENT_TLS_KEY_FILE", "/etc/erebrus/api.key")
+	t.Setenv("API_PUBLIC_URL", "")
+	t.Setenv("WG_ENDPOINT_HOST", "203.0.113.1")
+	c := Load()
+	if m := c.MetricsListener(); m.Addr() != "127.0.0.1:9091" || !m.Loopback() {
+		t.Fatalf("metrics listener = %+v", m)
+	}
+	if m := c.ManagementListener(); m.Addr() != "10.1.2.3:9443" || m.Scheme() != "https" {
+		t.Fatalf("management listener = %+v", m)
+	}
+	if got := c.PublicAPIBaseURL(); got != "https://203.0.113.1:9443" {
+		t.Fatalf("api base url = %q", got)
+	}
+	if err := c.validateListeners(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateListenersRejectsHalfTLS(t *testing.T) {
+	t.Setenv("MANAGEMENT_PORT", "9443")
+	t.Setenv("MANAGEMENT_TLS_CERT_FILE", "/etc/erebrus/api.crt")
+	t.Setenv("MANAGEMENT_TLS_KEY_FILE", "")
+	c := Load()
+	if err := c.validateListeners(); err == nil || !strings.Contains(err.Error(), "MANAGEMENT_PORT") {
+		t.Fatalf("expected TLS pair error, got %v", err)
+	}
+}
+
+func TestWebSocketCarrierValidation(t *testing.T) {
+	c := &Config{EnableStealth: true, StealthTCPPort: "443", VLESSPort: "443", StealthWSPort: "8443"}
+	if c.WebSocketCarrierEnabled() {
+		t.Fatal("enabled without STEALTH_WS_HOST")
+	}
+	c.StealthWSHost = "cdn.example.com"
+	if !c.WebSocketCarrierEnabled() || c.StealthWSPortInt() != 8443 {
+		t.Fatalf("enabled = %v port = %d", c.WebSocketCarrierEnabled(), c.StealthWSPortInt())
+	}
+
+	t.Setenv("MNEMONIC", "test words")
+	t.Setenv("WG_ENDPOINT_HOST", "203.0.113.1")
+	t.Setenv("STEALTH_WS_HOST", "cdn.example.com")
+	t.Setenv("STEALTH_WS_PORT", "443")
+	if err := Load().Validate(); err == nil || !strings.Contains(err.Error(), "STEALTH_WS_PORT") {
+		t.Fatalf("expected port clash error, got %v", err)
+	}
+	t.Setenv("STEALTH_WS_PORT", "")
+	t.Setenv("STEALTH_WS_TLS_CERT_FILE", "/etc/erebrus/origin.pem")
+	if err := Load().Validate(); err == nil || !strings.Contains(err.Error(), "STEALTH_WS_TLS_CERT_FILE") {
+		t.Fatalf("expected cert pair error, got %v", err)
+	}
+}
+
+func TestTUICCarrierValidation(t *testing.T) {
+	c := &Config{EnableTUIC: true, StealthTUICPort: "8443"}
+	if c.TUICCarrierEnabled() {
+		t.Fatal("enabled without stealth")
+	}
+	c.EnableStealth = true
+	if !c.TUICCarrierEnabled() || c.StealthTUICPortInt() != 8443 {
+		t.Fatalf("enabled = %v port = %d", c.TUICCarrierEnabled(), c.StealthTUICPortInt())
+	}
+
+	t.Setenv("MNEMONIC", "test words")
+	t.Setenv("WG_ENDPOINT_HOST", "203.0.113.1")
+	t.Setenv("ENABLE_TUIC", "true")
+	t.Setenv("STEALTH_TUIC_PORT", "443")
+	if err := Load().Validate(); err == nil || !strings.Contains(err.Error(), "STEALTH_TUIC_PORT") {
+		t.Fatalf("expected port clash error, got %v", err)
+	}
+	t.Setenv("STEALTH_TUIC_PORT", "")
+	if err := Load().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHTTPSConnectCarrierValidation(t *testing.T) {
+	c := &Config{EnableStealth: true, StealthConnectPort: "8444"}
+	if c.HTTPSConnectCarrierEnabled() {
+		t.Fatal("enabled without STEALTH_CONNECT_HOST")
+	}
+	c.StealthConnectHost = "www.example.com"
+	if !c.HTTPSConnectCarrierEnabled() || c.StealthConnectPortInt() != 8444 {
+		t.Fatalf("enabled = %v port = %d", c.HTTPSConnectCarrierEnabled(), c.StealthConnectPortInt())
+	}
+
+	t.Setenv("MNEMONIC", "test words")
+	t.Setenv("WG_ENDPOINT_HOST", "203.0.113.1")
+	t.Setenv("STEALTH_CONNECT_HOST", "www.example.com")
+	t.Setenv("STEALTH_WS_HOST", "cdn.example.com")
+	t.Setenv("STEALTH_CONNECT_PORT", "8443")
+	if err := Load().Validate(); err == nil || !strings.Contains(err.Error(), "STEALTH_WS_PORT") {
+		t.Fatalf("expected port clash error, got %v", err)
+	}
+	t.Setenv("STEALTH_CONNECT_PORT", "")
+	t.Setenv("STEALTH_CONNECT_TLS_KEY_FILE", "/etc/erebrus/connect.key")
+	if err := Load().Validate(); err == nil || !strings.Contains(err.Error(), "STEALTH_CONNECT_TLS_CERT_FILE") {
+		t.Fatalf("expected cert pair error, got %v", err)
+	}
+}
+
+func TestDiffAndCopyFields(t *testing.T) {
+	t.Setenv("REALITY_SERVER_NAMES", "www.microsoft.com")
+	t.Setenv("WG_DNS", "1.1.1.1")
+	a := Load()
+	t.Setenv("REALITY_SERVER_NAMES", "www.apple.com,www.icloud.com")
+	t.Setenv("WG_DNS", "9.9.9.9")
+	b := Load()
+
+	got := Diff(a, b)
+	if strings.Join(got, ",") != "WGDNS,RealityServerNames" {
+		t.Fatalf("diff = %v", got)
+	}
+	CopyFields(a, b, got...)
+	if d := Diff(a, b); len(d) != 0 {
+		t.Fatalf("diff after copy = %v", d)
+	}
+	if a.RealitySNI() != "www.apple.com" {
+		t.Fatalf("sni = %q", a.RealitySNI())
+	}
+}
@@ -0,0 +1,32 @@
+package config
+
+import "reflect"
+
+// Diff returns the names of the Config fields that differ between a and b, in
+// declaration order. Struct-valued fields (listeners, access mode) are
+// compared as a whole.
+func Diff(a, b *Config) []string {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	t := va.Type()
+	var changed []string
+	for i := 0; i < t.NumField(); i++ {
+		if !t.Field(i).IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			changed = append(changed, t.Field(i).Name)
+		}
+	}
+	return changed
+}
+
+// CopyFields sets the named fields of dst to their values in src. Unknown
+// names are ignored.
+func CopyFields(dst, src *Config, names ...string) {
+	vd, vs := reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem()
+	for _, name := range names {
+		if f := vd.FieldByName(name); f.IsValid() && f.CanSet() {
+			f.Set(vs.FieldByName(name))
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// FilePath is the optional config file named by EREBRUS_CONFIG.
+func FilePath() string { return os.Getenv("EREBRUS_CONFIG") }
+
+// FileLayer is a config file applied underneath the environment.
+type FileLayer struct {
+	Path   string
+	Values map[string]string // env name -> value, as written in the file
+	// Applied holds the env names the file supplied; the rest were
+	// overridden by the environment.
+	Applied map[string]bool
+}
+
+// ReadFile parses a YAML (.yaml/.yml) or TOML (.toml) config file. Keys are
+// setting names in lower case (http_port, wg_dns, ...); lists may be written
+// as arrays. Unknown keys and deprecated aliases are errors.
+func ReadFile(path string) (map[string]string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(raw))
+		if err := dec.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		if err := toml.Unmarshal(raw, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: config file must be .yaml, .yml or .toml", path)
+	}
+
+	out := map[string]string{}
+	var problems []string
+	for key, v := range doc {
+		s, ok := LookupSetting(key)
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("unknown key %q", key))
+			continue
+		case !strings.EqualFold(key, s.Env):
+			problems = append(problems, fmt.Sprintf("key %q is an alias; use %q", key, s.FileKey()))
+			continue
+		}
+		val, err := scalar(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		out[s.Env] = val
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("%s: %s", path, strings.Join(problems, "; "))
+	}
+	return out, nil
+}
+
+// ApplyFile reads path and exports each value to the environment unless the
+// environment (or one of the setting's aliases) already sets it, so env
+// always overrides the file. Call before Load.
+func ApplyFile(path string) (*FileLayer, error) {
+	vals, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	layer := &FileLayer{Path: path, Values: vals, Applied: map[string]bool{}}
+	for key, v := range vals {
+		s, _ := LookupSetting(key)
+		if _, from := s.Raw(os.LookupEnv); from != "" {
+			continue
+		}
+		if err := os.Setenv(key, v); err != nil {
+			return nil, err
+		}
+		layer.Applied[key] = true
+	}
+	return layer, nil
+}
+
+func scalar(v any) (string, error) {
+	switch x := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return x, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(x), nil
+	case []any:
+		parts := make([]string, 0, len(x))
+		for _, item := range x {
+			s, err := scalar(item)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, s)
+		}
+		return strings.Join(parts, ","), nil
+	default:
+		return "", fmt.Errorf("expected a scalar or list, got %T", v)
+	}
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, name, body string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestReadFileYAMLAndTOML(t *testing.T) {
+	y := writeFile(t, "node.yaml", "http_port: 9443\nenable_stealth: false\nreality_server_names:\n  - www.apple.com\n  - www.icloud.com\n")
+	vals, err := ReadFile(y)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vals["HTTP_PORT"] != "9443" || vals["ENABLE_STEALTH"] != "false" || vals["REALITY_SERVER_NAMES"] != "www.apple.com,www.icloud.com" {
+		t.Fatalf("yaml values = %v", vals)
+	}
+
+	tm := writeFile(t, "node.toml", "wg_ipv4_subnet = \"10.8.0.1/24\"\ndrop_swarm_port = 4002\n")
+	vals, err = ReadFile(tm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vals["WG_IPv4_SUBNET"] != "10.8.0.1/24" || vals["DROP_SWARM_PORT"] != "4002" {
+		t.Fatalf("toml values = %v", vals)
+	}
+}
+
+func TestReadFileRejectsUnknownAndAliasKeys(t *testing.T) {
+	p := writeFile(t, "node.yaml", "http_prot: 9080\nnode_api_token: x\n")
+	_, err := ReadFile(p)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{`unknown key "http_prot"`, `"node_api_token" is an alias; use "node_key"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q missing %q", err, want)
+		}
+	}
+}
+
+func TestApplyFileEnvWins(t *testing.T) {
+	t.Setenv("HTTP_PORT", "7000")
+	t.Setenv("VLESS_PORT", "8443")
+	for _, k := range []string{"WG_DNS", "STEALTH_TCP_PORT"} {
+		t.Setenv(k, "") // restored after the test
+		os.Unsetenv(k)
+	}
+	p := writeFile(t, "node.yaml", "http_port: 9443\nwg_dns: 9.9.9.9\nstealth_tcp_port: 443\n")
+	layer, err := ApplyFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Load()
+	if c.HTTPPort != "7000" || c.WGDNS != "9.9.9.9" || c.StealthTCPPort != "8443" {
+		t.Fatalf("http=%s dns=%s stealth=%s", c.HTTPPort, c.WGDNS, c.StealthTCPPort)
+	}
+	if !layer.Applied["WG_DNS"] || layer.Applied["HTTP_PORT"] || layer.Applied["STEALTH_TCP_PORT"] {
+		t.Fatalf("applied = %v", layer.Applied)
+	}
+	s, _ := LookupSetting("stealth_tcp_port")
+	if got := s.Source(layer); got != "env VLESS_PORT (deprecated)" {
+		t.Fatalf("source = %q", got)
+	}
+	s, _ = LookupSetting("WG_DNS")
+	if got := s.Source(layer); got != "file "+p {
+		t.Fatalf("source = %q", got)
+	}
+}
+
+func TestCheckSchema(t *testing.T) {
+	env := map[string]string{
+		"HTTP_PORT":             "90800",
+		"GATEWAY_TOKEN_MAX_TTL": "five minutes",
+		"ENABLE_STEALTH":        "yes please",
+		"FIREWALL_PROVIDER":     "pihole",
+		"NODE_API_TOKEN":        "secret",
+	}
+	errs, deprecations := CheckSchema(func(k string) (string, bool) { v, ok := env[k]; return v, ok })
+	if len(errs) != 4 {
+		t.Fatalf("errs = %v", errs)
+	}
+	if len(deprecations) != 1 || !strings.Contains(deprecations[0], "NODE_API_TOKEN is deprecated; use NODE_KEY") {
+		t.Fatalf("deprecations = %v", deprecations)
+	}
+}
+
+// Every variable Load reads must be described by the schema, and every
+// setting must point at a real Config field.
+func TestSchemaCoversLoad(t *testing.T) {
+	src, err := os.ReadFile("config.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, m := range regexp.MustCompile(`\b(env|boolEnv|durationEnv|os\.Getenv)\("([A-Za-z0-9_]+)"`).FindAllStringSubmatch(string(src), -1) {
+		keys = append(keys, m[2])
+	}
+	for _, m := range regexp.MustCompile(`firstEnv\(([^)]*)\)`).FindAllStringSubmatch(string(src), -1) {
+		args := strings.Split(m[1], ",")
+		for _, a := range args[:len(args)-1] { // last is the default
+			keys = append(keys, strings.Trim(strings.TrimSpace(a), `"`))
+		}
+	}
+	if len(keys) < 50 {
+		t.Fatalf("only found %d keys in config.go", len(keys))
+	}
+	for _, k := range keys {
+		if _, ok := LookupSetting(k); !ok {
+			t.Errorf("%s is read by Load but missing from Settings", k)
+		}
+	}
+
+	for _, s := range Settings {
+		typ := reflect.TypeOf(Config{})
+		for _, name := range strings.Split(s.Field, ".") {
+			f, ok := typ.FieldByName(name)
+			if !ok {
+				t.Errorf("%s: Config has no field %s", s.Env, s.Field)
+				break
+			}
+			typ = f.Type
+		}
+	}
+}
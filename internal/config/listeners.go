@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Listener is one HTTP surface the node serves: the public dashboard/status,
+// the metrics endpoint, or the gateway-only management API. A surface whose
+// port is unset shares the public listener (the single-port v2.0 layout).
+type Listener struct {
+	BindAddr    string
+	Port        string
+	TLSCertFile string
+	TLSKeyFile  string
+	// AutoTLS is set on the management listener (and anything sharing it)
+	// when no cert files are given: APITLSSelfSigned or APITLSACME.
+	AutoTLS string
+}
+
+// Addr returns host:port for net.Listen.
+func (l Listener) Addr() string { return net.JoinHostPort(l.BindAddr, l.Port) }
+
+// TLSEnabled reports whether the listener serves HTTPS.
+func (l Listener) TLSEnabled() bool { return l.HasCertFiles() || l.AutoTLS != "" }
+
+// HasCertFiles reports whether an operator-supplied cert/key pair is set.
+func (l Listener) HasCertFiles() bool { return l.TLSCertFile != "" && l.TLSKeyFile != "" }
+
+// Scheme returns "https" or "http".
+func (l Listener) Scheme() string {
+	if l.TLSEnabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// Loopback reports whether the listener is reachable only from this host.
+func (l Listener) Loopback() bool { return isLoopbackAddr(l.BindAddr) }
+
+// API TLS modes for the management listener (API_TLS).
+const (
+	APITLSOff        = "off"
+	APITLSSelfSigned = "self-signed" // persisted in node_settings, pinned by the gateway
+	APITLSACME       = "acme"
+)
+
+// PublicListener serves the dashboard, /healthz and the public status API.
+// When the management API shares it, it also inherits API_TLS.
+func (c *Config) PublicListener() Listener {
+	l := Listener{
+		BindAddr: c.BindAddr, Port: c.HTTPPort,
+		TLSCertFile: c.PublicTLSCertFile, TLSKeyFile: c.PublicTLSKeyFile,
+	}
+	if c.Management.Port == "" {
+		l = c.withAPITLS(l)
+	}
+	return l
+}
+
+// MetricsListener serves /metrics. Falls back to the public listener when
+// METRICS_PORT is unset.
+func (c *Config) MetricsListener() Listener {
+	if c.Metrics.Port == "" {
+		return c.PublicListener()
+	}
+	return c.Metrics
+}
+
+// ManagementListener serves the gateway-only peer and Drop APIs. Falls back to
+// the public listener when MANAGEMENT_PORT is unset. This is the listener the
+// gateway must reach (see PublicAPIBaseURL).
+func (c *Config) ManagementListener() Listener {
+	if c.Management.Port == "" {
+		return c.PublicListener()
+	}
+	return c.withAPITLS(c.Management)
+}
+
+// withAPITLS applies API_TLS to a listener without operator cert files.
+func (c *Config) withAPITLS(l Listener) Listener {
+	if !l.HasCertFiles() && c.APITLS != "" && c.APITLS != APITLSOff {
+		l.AutoTLS = c.APITLS
+	}
+	return l
+}
+
+// validateListeners checks ports, TLS pairs, and that surfaces sharing one
+// address agree on TLS.
+func (c *Config) validateListeners() error {
+	switch c.APITLS {
+	case APITLSOff, APITLSSelfSigned:
+	case APITLSACME:
+		if c.APITLSACMEDomain == "" {
+			return fmt.Errorf("API_TLS_ACME_DOMAIN is required when API_TLS=acme")
+		}
+	default:
+		return fmt.Errorf("API_TLS must be off, self-signed, or acme (got %q)", c.APITLS)
+	}
+	named := []struct {
+		name string
+		l    Listener
+	}{
+		{"HTTP_PORT", c.PublicListener()},
+		{"METRICS_PORT", c.MetricsListener()},
+		{"MANAGEMENT_PORT", c.ManagementListener()},
+	}
+	byAddr := map[string]Listener{}
+	for _, n := range named {
+		port, err := strconv.Atoi(n.l.Port)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("%s must be a valid port (got %q)", n.name, n.l.Port)
+		}
+		if (n.l.TLSCertFile == "") != (n.l.TLSKeyFile == "") {
+			return fmt.Errorf("%s: TLS cert and key files must be set together", n.name)
+		}
+		if prev, ok := byAddr[n.l.Addr()]; ok && prev.TLSEnabled() != n.l.TLSEnabled() {
+			return fmt.Errorf("%s shares %s with another listener but has different TLS settings", n.name, n.l.Addr())
+		}
+		byAddr[n.l.Addr()] = n.l
+	}
+	return nil
+}
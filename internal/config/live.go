@@ -0,0 +1,35 @@
+package config
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Live is the running node's configuration. Components take the current
+// *Config with Load and treat it as read-only; a reload publishes an edited
+// copy with Update instead of changing a Config other goroutines are reading.
+type Live struct {
+	mu  sync.Mutex // one Update at a time
+	cur atomic.Pointer[Config]
+}
+
+// NewLive publishes c as the initial configuration.
+func NewLive(c *Config) *Live {
+	l := &Live{}
+	l.cur.Store(c)
+	return l
+}
+
+// Load returns the current configuration.
+func (l *Live) Load() *Config { return l.cur.Load() }
+
+// Update publishes a copy of the current configuration with fn applied and
+// returns it.
+func (l *Live) Update(fn func(c *Config)) *Config {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	next := *l.cur.Load()
+	fn(&next)
+	l.cur.Store(&next)
+	return &next
+}
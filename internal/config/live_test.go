@@ -0,0 +1,31 @@
+package config
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestLiveUpdatePublishesCopy(t *testing.T) {
+	first := &Config{Region: "US", Zone: "east"}
+	l := NewLive(first)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if c := l.Load(); c.Region == "" {
+					t.Error("empty region")
+				}
+			}
+		}()
+	}
+	next := l.Update(func(c *Config) { c.Region = "NO" })
+	wg.Wait()
+	if first.Region != "US" {
+		t.Fatalf("update edited the published config: %q", first.Region)
+	}
+	if l.Load() != next || next.Region != "NO" || next.Zone != "east" {
+		t.Fatalf("load = %+v, want the updated copy", l.Load())
+	}
+}
@@ -0,0 +1,287 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind is the value type a setting accepts.
+type Kind string
+
+const (
+	KindString   Kind = "string"
+	KindBool     Kind = "bool"
+	KindPort     Kind = "port"
+	KindDuration Kind = "duration"
+	KindBytes    Kind = "bytes"
+	KindURL      Kind = "url"
+	KindCIDR     Kind = "cidr"
+	KindEnum     Kind = "enum"
+	KindList     Kind = "list" // comma-separated
+)
+
+// Setting describes one configuration key: its env name, where it lands in
+// Config, and how it is validated and displayed.
+type Setting struct {
+	Env     string
+	Field   string // Config field path, e.g. "Metrics.Port"
+	Kind    Kind
+	Values  []string // KindEnum
+	Default string
+	Secret  bool
+	// Aliases are read when Env is unset; Deprecated ones are reported.
+	Aliases    []string
+	Deprecated []string
+	Help       string
+}
+
+// FileKey is the setting's key in a config file: the env name in lower case.
+func (s Setting) FileKey() string { return strings.ToLower(s.Env) }
+
+// Settings is the schema of every key Load reads, in display order.
+var Settings = []Setting{
+	{Env: "RUNTYPE", Field: "RunType", Kind: KindEnum, Values: []string{"release", "debug"}, Default: "release", Help: "debug opens the peer API without a node key and enables debug logs"},
+	{Env: "STATE_DIR", Field: "StateDir", Default: "/var/lib/erebrus", Help: "node database and caches"},
+	{Env: "ADMIN_SOCKET", Field: "AdminSocket", Default: "<STATE_DIR>/admin.sock", Help: "Unix socket the operator CLI uses to reach the running node; off disables it"},
+	{Env: "ADMIN_SOCKET_GROUP", Field: "AdminSocketGroup", Help: "group (name or gid) allowed to use the admin socket besides the node user"},
+	{Env: "UPGRADE_MANIFEST_URL", Field: "UpgradeManifestURL", Kind: KindURL, Help: "signed release manifest for erebrus-node upgrade"},
+	{Env: "UPGRADE_RELEASE_KEY", Field: "UpgradeReleaseKey", Default: "<built-in>", Help: "Ed25519 release key (hex or base64) upgrades must be signed with"},
+	{Env: "UPGRADE_RESTART", Field: "UpgradeRestart", Kind: KindEnum, Values: []string{UpgradeRestartExec, UpgradeRestartSystemd}, Default: UpgradeRestartExec, Help: "how the node restarts into an upgraded binary"},
+	{Env: "UPGRADE_SYSTEMD_UNIT", Field: "UpgradeSystemdUnit", Default: "erebrus-node"},
+	{Env: "UPGRADE_HEALTH_TIMEOUT", Field: "UpgradeHealthTimeout", Kind: KindDuration, Default: "2m", Help: "how long an upgraded node has to become ready before it rolls back"},
+
+	{Env: "MNEMONIC", Field: "Mnemonic", Secret: true, Help: "node identity recovery phrase (required)"},
+	{Env: "NODE_NAME", Field: "NodeName", Default: "<hostname>", Help: "operator-facing label"},
+	{Env: "REGION", Field: "Region", Default: "unknown", Help: "country or broad geography"},
+	{Env: "ZONE", Field: "Zone", Help: "optional sub-region"},
+	{Env: "WALLET_CHAIN", Field: "WalletChain", Default: "SOLANA", Help: "chain the identity wallet address is derived for"},
+	{Env: "EREBRUS_ACCESS", Field: "Mode.RuntimeMode", Kind: KindEnum, Values: []string{"private", "public", "gateway"}, Default: "public", Deprecated: []string{"gateway"}, Help: "who may use the node (gateway is a deprecated spelling of public)"},
+	{Env: "EREBRUS_NETWORK_PROFILE", Field: "Mode.NetworkProfile", Kind: KindEnum, Values: []string{"bridge", "host-network", "native", "private", "public", "gateway"}, Default: "bridge", Deprecated: []string{"private", "public", "gateway"}, Help: "container networking; access values here are a deprecated EREBRUS_MODE leftover"},
+	{Env: "EREBRUS_PROFILE", Field: "ErebrusProfile", Kind: KindEnum, Values: []string{ProfileStandard, ProfileShield, ProfileSentinel}, Default: ProfileStandard, Help: "deployment profile"},
+
+	{Env: "SERVER", Field: "BindAddr", Default: "0.0.0.0", Aliases: []string{"API_BIND_ADDR"}, Help: "public API bind address; API_BIND_ADDR overrides it"},
+	{Env: "HTTP_PORT", Field: "HTTPPort", Kind: KindPort, Default: "9080", Help: "public API port"},
+	{Env: "UNSAFE_PUBLIC_API", Field: "UnsafePublicAPI", Kind: KindBool, Default: "false"},
+	{Env: "PUBLIC_TLS_CERT_FILE", Field: "PublicTLSCertFile"},
+	{Env: "PUBLIC_TLS_KEY_FILE", Field: "PublicTLSKeyFile"},
+	{Env: "METRICS_BIND_ADDR", Field: "Metrics.BindAddr", Default: "127.0.0.1"},
+	{Env: "METRICS_PORT", Field: "Metrics.Port", Kind: KindPort, Help: "separate /metrics listener; empty shares the public one"},
+	{Env: "METRICS_TLS_CERT_FILE", Field: "Metrics.TLSCertFile"},
+	{Env: "METRICS_TLS_KEY_FILE", Field: "Metrics.TLSKeyFile"},
+	{Env: "METRICS_BEARER_TOKEN", Field: "MetricsToken", Secret: true},
+	{Env: "MANAGEMENT_BIND_ADDR", Field: "Management.BindAddr", Default: "<SERVER>"},
+	{Env: "MANAGEMENT_PORT", Field: "Management.Port", Kind: KindPort, Help: "separate gateway-only management listener"},
+	{Env: "MANAGEMENT_TLS_CERT_FILE", Field: "Management.TLSCertFile"},
+	{Env: "MANAGEMENT_TLS_KEY_FILE", Field: "Management.TLSKeyFile"},
+	{Env: "API_TLS", Field: "APITLS", Kind: KindEnum, Values: []string{APITLSOff, APITLSSelfSigned, APITLSACME}, Default: APITLSSelfSigned, Help: "management API certificate when no TLS files are set"},
+	{Env: "API_TLS_ACME_DOMAIN", Field: "APITLSACMEDomain"},
+	{Env: "API_TLS_ACME_EMAIL", Field: "APITLSACMEEmail"},
+	{Env: "API_TLS_ACME_HTTP_ADDR", Field: "APITLSACMEHTTP"},
+	{Env: "API_PUBLIC_URL", Field: "APIPublicURL", Kind: KindURL, Help: "overrides the api_base_url sent to the gateway"},
+
+	{Env: "GATEWAY_URL", Field: "GatewayURL", Kind: KindURL},
+	{Env: "GATEWAY_URLS", Field: "GatewayURLs", Kind: KindList, Help: "ordered gateway endpoints for failover, primary first; replaces GATEWAY_URL"},
+	{Env: "GATEWAY_PEER_MULTIADDR", Field: "GatewayPeerMultiaddr"},
+	{Env: "P2P_LISTEN_PORT", Field: "P2PListenPort", Kind: KindPort, Default: "9002"},
+	{Env: "EREBRUS_NODE_REGISTRATION_TOKEN", Field: "NodeRegistrationToken", Secret: true, Aliases: []string{"EREBRUS_ORG_ENROLLMENT_SECRET", "ORG_ENROLLMENT_SECRET"}, Deprecated: []string{"EREBRUS_ORG_ENROLLMENT_SECRET", "ORG_ENROLLMENT_SECRET"}},
+	{Env: "GATEWAY_AUTO_REGISTER", Field: "GatewayAutoRegister", Kind: KindBool, Default: "true"},
+	{Env: "NODE_ID", Field: "NodeID", Help: "persisted after registration"},
+	{Env: "NODE_TOKEN", Field: "NodeToken", Secret: true, Help: "persisted after registration"},
+	{Env: "NODE_KEY", Field: "NodeKey", Secret: true, Aliases: []string{"NODE_API_TOKEN"}, Deprecated: []string{"NODE_API_TOKEN"}, Help: "per-node bearer for the peer API"},
+	{Env: "GATEWAY_PUBLIC_KEY", Field: "GatewayPublicKey"},
+	{Env: "GATEWAY_TOKEN_MAX_TTL", Field: "GatewayTokenMaxTTL", Kind: KindDuration, Default: "5m"},
+	{Env: "GATEWAY_TOKEN_CLOCK_SKEW", Field: "GatewayTokenClockSkew", Kind: KindDuration, Default: "30s"},
+	{Env: "GATEWAY_TOKEN_STRICT", Field: "GatewayTokenStrict", Kind: KindBool, Default: "false"},
+	{Env: "GATEWAY_LEGACY_PEER_TOKENS", Field: "GatewayLegacyPeerTokens", Kind: KindBool, Default: "false"},
+	{Env: "CHAIN_REGISTRATION", Field: "ChainRegistration", Default: "off"},
+
+	{Env: "WG_CONF_DIR", Field: "WGConfDir", Default: "/etc/wireguard"},
+	{Env: "WG_INTERFACE_NAME", Field: "WGInterface", Default: "wg0"},
+	{Env: "WG_ENDPOINT_HOST", Field: "WGEndpointHost", Help: "public IP or hostname clients dial (required)"},
+	{Env: "WG_ENDPOINT_PORT", Field: "WGEndpointPort", Kind: KindPort, Default: "51820", Aliases: []string{"WG_PORT"}, Help: "WG_PORT overrides it"},
+	{Env: "WG_IPv4_SUBNET", Field: "WGIPv4Subnet", Kind: KindCIDR, Default: "10.0.0.1/16"},
+	{Env: "WG_DNS", Field: "WGDNS", Default: "1.1.1.1", Help: "DNS server written into client configs"},
+	{Env: "WG_PRE_UP", Field: "WGPreUp"},
+	{Env: "WG_POST_UP", Field: "WGPostUp"},
+	{Env: "WG_PRE_DOWN", Field: "WGPreDown"},
+	{Env: "WG_POST_DOWN", Field: "WGPostDown"},
+
+	{Env: "ENABLE_STEALTH", Field: "EnableStealth", Kind: KindBool, Default: "true"},
+	{Env: "STEALTH_TCP_PORT", Field: "StealthTCPPort", Kind: KindPort, Default: "443", Aliases: []string{"VLESS_PORT"}, Deprecated: []string{"VLESS_PORT"}},
+	{Env: "STEALTH_UDP_PORT", Field: "StealthUDPPort", Kind: KindPort, Default: "443", Aliases: []string{"HYSTERIA2_PORT"}, Deprecated: []string{"HYSTERIA2_PORT"}},
+	{Env: "REALITY_SERVER_NAMES", Field: "RealityServerNames", Kind: KindList, Default: "www.microsoft.com"},
+	{Env: "REALITY_HANDSHAKE_SERVER", Field: "RealityHandshakeServer"},
+	{Env: "HYSTERIA2_OBFS_PASSWORD", Field: "Hysteria2ObfsPassword", Secret: true},
+	{Env: "ENABLE_TUIC", Field: "EnableTUIC", Kind: KindBool, Default: "false", Help: "serve the TUIC v5 carrier (needs ENABLE_STEALTH)"},
+	{Env: "STEALTH_TUIC_PORT", Field: "StealthTUICPort", Kind: KindPort, Default: "8443", Help: "udp port of the TUIC carrier"},
+	{Env: "STEALTH_WS_HOST", Field: "StealthWSHost", Help: "CDN hostname for the VLESS over WebSocket+TLS carrier; empty disables it"},
+	{Env: "STEALTH_WS_PORT", Field: "StealthWSPort", Kind: KindPort, Default: "8443", Help: "origin port the CDN forwards WebSocket traffic to"},
+	{Env: "STEALTH_WS_TLS_CERT_FILE", Field: "StealthWSCertFile", Help: "origin certificate for the WebSocket carrier; self-signed when empty"},
+	{Env: "STEALTH_WS_TLS_KEY_FILE", Field: "StealthWSKeyFile"},
+	{Env: "STEALTH_CONNECT_HOST", Field: "StealthConnectHost", Help: "hostname for the HTTPS CONNECT (naive) carrier; empty disables it"},
+	{Env: "STEALTH_CONNECT_PORT", Field: "StealthConnectPort", Kind: KindPort, Default: "8444", Help: "tcp port of the HTTPS CONNECT carrier"},
+	{Env: "STEALTH_CONNECT_TLS_CERT_FILE", Field: "StealthConnectCertFile", Help: "certificate for STEALTH_CONNECT_HOST; self-signed when empty"},
+	{Env: "STEALTH_CONNECT_TLS_KEY_FILE", Field: "StealthConnectKeyFile"},
+
+	{Env: "DROP_ENABLED", Field: "DropEnabled", Kind: KindBool, Default: "false"},
+	{Env: "DROP_STORAGE_MAX", Field: "DropStorageMax", Kind: KindBytes, Default: "10GB"},
+	{Env: "DROP_SWARM_PORT", Field: "DropSwarmPort", Kind: KindPort, Default: "4001"},
+	{Env: "DROP_WEBUI_ENABLED", Field: "DropWebUIEnabled", Kind: KindBool, Default: "false"},
+
+	{Env: "PRIVATE_DNS_ENABLED", Field: "PrivateDNSEnabled", Kind: KindBool, Default: "false"},
+	{Env: "PRIVATE_DNS_DOMAIN", Field: "PrivateDNSDomain", Default: "ere"},
+	{Env: "PRIVATE_DNS_ADDR", Field: "PrivateDNSAddr"},
+	{Env: "UPSTREAM_DNS", Field: "UpstreamDNS", Default: "1.1.1.1"},
+	{Env: "DNS_QUERY_LOGS", Field: "DNSQueryLogs", Kind: KindBool, Default: "false"},
+	{Env: "FIREWALL_PROVIDER", Field: "FirewallProvider", Kind: KindEnum, Values: []string{FirewallNone, FirewallAdGuardHome, FirewallUnboundErebrus}, Default: "<profile>"},
+	{Env: "FIREWALL_DNS_ADDR", Field: "FirewallDNSAddr", Default: "<profile>"},
+	{Env: "SHIELD_ADMIN_URL", Field: "ShieldAdminURL", Kind: KindURL, Default: "<profile>"},
+	{Env: "SHIELD_ADMIN_USER", Field: "ShieldAdminUser", Default: "admin"},
+	{Env: "SHIELD_ADMIN_PASSWORD", Field: "ShieldAdminPassword", Secret: true},
+	{Env: "SHIELD_UPSTREAM_DNS", Field: "ShieldUpstreamDNS", Kind: KindList, Default: "1.1.1.1,1.0.0.1"},
+	{Env: "SENTINEL_API_URL", Field: "SentinelAPIURL", Kind: KindURL, Default: "<profile>"},
+	{Env: "SENTINEL_IMAGE", Field: "SentinelImage", Default: "ghcr.io/netsepio/erebrus-sentinel:latest"},
+}
+
+// LookupSetting finds a setting by env name, file key or alias.
+func LookupSetting(key string) (Setting, bool) {
+	upper := strings.ToUpper(strings.TrimSpace(key))
+	for _, s := range Settings {
+		if strings.ToUpper(s.Env) == upper {
+			return s, true
+		}
+		for _, a := range s.Aliases {
+			if a == upper {
+				return s, true
+			}
+		}
+	}
+	return Setting{}, false
+}
+
+// Raw returns the value Load reads for s from the environment, and the
+// variable it came from ("" when unset and the default applies).
+func (s Setting) Raw(lookup func(string) (string, bool)) (value, from string) {
+	names := append([]string{s.Env}, s.Aliases...)
+	// API_BIND_ADDR and WG_PORT win over the canonical name, as in Load.
+	if s.Env == "SERVER" || s.Env == "WG_ENDPOINT_PORT" {
+		names = append(append([]string{}, s.Aliases...), s.Env)
+	}
+	for _, n := range names {
+		if v, ok := lookup(n); ok && v != "" {
+			return v, n
+		}
+	}
+	return "", ""
+}
+
+// Source describes where s's value comes from: "default", "env", "env
+// <ALIAS>" or "file <path>".
+func (s Setting) Source(layer *FileLayer) string {
+	_, from := s.Raw(os.LookupEnv)
+	switch {
+	case from == "":
+		return "default"
+	case layer != nil && layer.Applied[from]:
+		return "file " + layer.Path
+	case from == s.Env:
+		return "env"
+	}
+	for _, d := range s.Deprecated {
+		if d == from {
+			return "env " + from + " (deprecated)"
+		}
+	}
+	return "env " + from
+}
+
+// Effective returns the value Load produced for s in c, formatted like env.
+func (s Setting) Effective(c *Config) string {
+	v := reflect.ValueOf(c).Elem()
+	for _, name := range strings.Split(s.Field, ".") {
+		v = v.FieldByName(name)
+		if !v.IsValid() {
+			return ""
+		}
+	}
+	switch x := v.Interface().(type) {
+	case []string:
+		return strings.Join(x, ",")
+	case time.Duration:
+		return x.String()
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// Check validates a raw value against the setting's kind. Empty values are
+// left to Validate, which knows which settings are required.
+func (s Setting) Check(value string) error {
+	if value == "" {
+		return nil
+	}
+	switch s.Kind {
+	case KindBool:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%s must be true or false (got %q)", s.Env, value)
+		}
+	case KindPort:
+		if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("%s must be a port 1-65535 (got %q)", s.Env, value)
+		}
+	case KindDuration:
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			return fmt.Errorf("%s must be a duration like 30s or 5m (got %q)", s.Env, value)
+		}
+	case KindBytes:
+		if n, err := parseByteSize(value); err != nil || n <= 0 {
+			return fmt.Errorf("%s must be a byte size like 10GB (got %q)", s.Env, value)
+		}
+	case KindURL:
+		if u, err := url.Parse(value); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("%s must be an absolute URL (got %q)", s.Env, value)
+		}
+	case KindCIDR:
+		if _, _, err := net.ParseCIDR(value); err != nil {
+			return fmt.Errorf("%s must be a CIDR like 10.0.0.1/16 (got %q)", s.Env, value)
+		}
+	case KindEnum:
+		v := strings.ToLower(strings.TrimSpace(value))
+		for _, allowed := range s.Values {
+			if v == allowed {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s must be one of %s (got %q)", s.Env, strings.Join(s.Values, ", "), value)
+	}
+	return nil
+}
+
+// CheckSchema validates every setting's raw value against its kind and
+// reports deprecated names and values in use. It complements Validate, which
+// checks required settings and cross-field rules.
+func CheckSchema(lookup func(string) (string, bool)) (errs []error, deprecations []string) {
+	for _, s := range Settings {
+		v, from := s.Raw(lookup)
+		if err := s.Check(v); err != nil {
+			errs = append(errs, err)
+		}
+		for _, d := range s.Deprecated {
+			switch {
+			case from == d:
+				deprecations = append(deprecations, fmt.Sprintf("%s is deprecated; use %s", d, s.Env))
+			case from != "" && strings.EqualFold(v, d):
+				deprecations = append(deprecations, fmt.Sprintf("%s=%s is deprecated", from, v))
+			}
+		}
+	}
+	sort.Strings(deprecations)
+	return errs, deprecations
+}
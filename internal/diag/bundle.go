@@ -0,0 +1,118 @@
+package diag
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/config"
+)
+
+const (
+	redacted = "<redacted>"
+	// keepBundles is how many bundles Save leaves in the output directory.
+	keepBundles = 5
+	// minSecretLen keeps short values (e.g. "1") from being scrubbed
+	// everywhere they happen to appear.
+	minSecretLen = 6
+)
+
+// Result describes a saved bundle.
+type Result struct {
+	ID       string `json:"id"`
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	Uploaded bool   `json:"uploaded,omitempty"`
+}
+
+// Redact replaces every configured secret value in each file's contents.
+// Sections already avoid secrets; this catches any that reach logs or error
+// text.
+func Redact(cfg *config.Config, files []File) {
+	var secrets []string
+	for _, s := range config.Settings {
+		if v := s.Effective(cfg); s.Secret && len(v) >= minSecretLen {
+			secrets = append(secrets, v)
+		}
+	}
+	if len(secrets) == 0 {
+		return
+	}
+	// Longest first so a secret containing another is replaced whole.
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, v := range secrets {
+		pairs = append(pairs, v, redacted)
+	}
+	r := strings.NewReplacer(pairs...)
+	for i := range files {
+		files[i].Data = []byte(r.Replace(string(files[i].Data)))
+	}
+}
+
+// Write packs files as a gzipped tar under a top-level directory named id.
+func Write(w io.Writer, id string, files []File) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name: id + "/" + f.Name, Mode: 0o600, Size: int64(len(f.Data)), ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Save collects, redacts and writes a bundle into dir, keeping only the most
+// recent keepBundles bundles there.
+func Save(ctx context.Context, src Sources, dir string) (Result, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return Result{}, err
+	}
+	files := Collect(ctx, src)
+	Redact(src.Cfg, files)
+
+	id := "erebrus-diag-" + time.Now().UTC().Format("20060102T150405Z")
+	var buf bytes.Buffer
+	if err := Write(&buf, id, files); err != nil {
+		return Result{}, fmt.Errorf("pack bundle: %w", err)
+	}
+	path := filepath.Join(dir, id+".tar.gz")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		return Result{}, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	prune(dir)
+	return Result{ID: id, Path: path, Size: int64(buf.Len()), SHA256: hex.EncodeToString(sum[:])}, nil
+}
+
+func prune(dir string) {
+	old, _ := filepath.Glob(filepath.Join(dir, "erebrus-diag-*.tar.gz"))
+	if len(old) <= keepBundles {
+		return
+	}
+	sort.Strings(old) // timestamped names sort chronologically
+	for _, p := range old[:len(old)-keepBundles] {
+		_ = os.Remove(p)
+	}
+}
@@ -0,0 +1,349 @@
+// Package diag assembles the redacted support bundle behind `erebrus-node
+// diag` and the collect_diagnostics gateway command: effective config,
+// readiness, WireGuard and carrier state, recent logs, DNS and port checks,
+// and store integrity, packed as a tar.gz.
+package diag
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/config"
+	dnspkg "github.com/NetSepio/erebrus/internal/dns"
+	"github.com/NetSepio/erebrus/internal/readiness"
+	"github.com/NetSepio/erebrus/internal/stealth"
+	"github.com/NetSepio/erebrus/internal/store"
+	"github.com/NetSepio/erebrus/internal/wg"
+	"github.com/miekg/dns"
+)
+
+const checkTimeout = 2 * time.Second
+
+// Sources is what a bundle is built from. Nil fields are sections this
+// process cannot see (e.g. logs and carrier state when the CLI runs without
+// a live node); they are recorded as unavailable rather than failing.
+type Sources struct {
+	Cfg       *config.Config
+	Store     *store.Store
+	Readiness func() readiness.Report
+	WG        wg.Controller
+	Inbounds  func() []stealth.Inbound
+	Logs      func() []string
+	// Live is true when collected inside the running node.
+	Live bool
+}
+
+// File is one entry in the bundle.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Manifest is manifest.json: what was collected and what failed.
+type Manifest struct {
+	NodeVersion string            `json:"node_version"`
+	CollectedAt time.Time         `json:"collected_at"`
+	Live        bool              `json:"live"`
+	Hostname    string            `json:"hostname,omitempty"`
+	Sections    map[string]string `json:"sections"` // name -> ok | unavailable | error text
+}
+
+// Collect gathers every section. It never fails as a whole: a section that
+// cannot be collected is noted in the manifest.
+func Collect(ctx context.Context, src Sources) []File {
+	man := Manifest{
+		NodeVersion: src.Cfg.Version,
+		CollectedAt: time.Now().UTC(),
+		Live:        src.Live,
+		Sections:    map[string]string{},
+	}
+	man.Hostname, _ = os.Hostname()
+
+	sections := []struct {
+		name    string
+		collect func() (any, error)
+	}{
+		{"config.env", func() (any, error) { return effectiveConfig(src.Cfg), nil }},
+		{"readiness.json", func() (any, error) { return readinessReport(src), nil }},
+		{"wireguard.json", func() (any, error) { return wireguardSummary(ctx, src) }},
+		{"stealth.json", func() (any, error) { return inbounds(src) }},
+		{"logs.jsonl", func() (any, error) { return recentLogs(src) }},
+		{"dns.json", func() (any, error) { return dnsChecks(ctx, src.Cfg), nil }},
+		{"ports.json", func() (any, error) { return portChecks(src.Cfg), nil }},
+		{"store.json", func() (any, error) { return storeIntegrity(ctx, src) }},
+	}
+	var files []File
+	for _, sec := range sections {
+		v, err := sec.collect()
+		switch {
+		case errors.Is(err, errUnavailable):
+			man.Sections[sec.name] = "unavailable"
+			continue
+		case err != nil:
+			man.Sections[sec.name] = err.Error()
+		default:
+			man.Sections[sec.name] = "ok"
+		}
+		if v == nil {
+			continue
+		}
+		raw, ok := v.([]byte)
+		if !ok {
+			raw, _ = json.MarshalIndent(v, "", "  ")
+			raw = append(raw, '\n')
+		}
+		files = append(files, File{Name: sec.name, Data: raw})
+	}
+
+	raw, _ := json.MarshalIndent(man, "", "  ")
+	return append([]File{{Name: "manifest.json", Data: append(raw, '\n')}}, files...)
+}
+
+var errUnavailable = errors.New("unavailable")
+
+// effectiveConfig renders every setting as ENV=value, secrets shown only as
+// set or unset.
+func effectiveConfig(cfg *config.Config) []byte {
+	var b strings.Builder
+	for _, s := range config.Settings {
+		v := s.Effective(cfg)
+		if s.Secret && v != "" {
+			v = redacted
+		}
+		fmt.Fprintf(&b, "%s=%s\n", s.Env, v)
+	}
+	return []byte(b.String())
+}
+
+func readinessReport(src Sources) readiness.Report {
+	if src.Readiness != nil {
+		return src.Readiness()
+	}
+	return readiness.Preboot(src.Cfg)
+}
+
+// WireGuardSummary is the device state with peer keys hashed.
+type WireGuardSummary struct {
+	Interface string          `json:"interface"`
+	PeersInDB int             `json:"peers_in_db"`
+	RxBytes   int64           `json:"rx_bytes"`
+	TxBytes   int64           `json:"tx_bytes"`
+	Connected int             `json:"connected"`
+	Peers     []WireGuardPeer `json:"peers"`
+}
+
+// WireGuardPeer is one device peer; KeyHash is the first 16 hex digits of
+// the SHA-256 of its public key.
+type WireGuardPeer struct {
+	KeyHash       string `json:"key_hash"`
+	RxBytes       int64  `json:"rx_bytes"`
+	TxBytes       int64  `json:"tx_bytes"`
+	LastHandshake int64  `json:"last_handshake,omitempty"`
+}
+
+func wireguardSummary(ctx context.Context, src Sources) (any, error) {
+	if src.WG == nil {
+		return nil, errUnavailable
+	}
+	iface := src.Cfg.WGInterface
+	out := WireGuardSummary{Interface: iface, Peers: []WireGuardPeer{}}
+	if src.Store != nil {
+		if peers, err := src.Store.ListPeers(ctx); err == nil {
+			out.PeersInDB = len(peers)
+		}
+	}
+	stats, err := src.WG.Stats(iface)
+	if err != nil {
+		return out, fmt.Errorf("read device %s: %w", iface, err)
+	}
+	out.RxBytes, out.TxBytes, out.Connected = stats.RxBytes, stats.TxBytes, stats.Connected
+	transfers, err := src.WG.PeerTransfers(iface)
+	if err != nil {
+		return out, fmt.Errorf("read peers on %s: %w", iface, err)
+	}
+	for _, t := range transfers {
+		out.Peers = append(out.Peers, WireGuardPeer{
+			KeyHash: hashKey(t.WGPublicKey), RxBytes: t.RxBytes, TxBytes: t.TxBytes, LastHandshake: t.LastHandshake,
+		})
+	}
+	return out, nil
+}
+
+func hashKey(k string) string {
+	sum := sha256.Sum256([]byte(k))
+	return hex.EncodeToString(sum[:8])
+}
+
+func inbounds(src Sources) (any, error) {
+	if src.Inbounds == nil {
+		return nil, errUnavailable
+	}
+	in := src.Inbounds()
+	if in == nil {
+		in = []stealth.Inbound{}
+	}
+	return in, nil
+}
+
+func recentLogs(src Sources) (any, error) {
+	if src.Logs == nil {
+		return nil, errUnavailable
+	}
+	lines := src.Logs()
+	if len(lines) == 0 {
+		return []byte{}, nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+// Check is one DNS or port probe.
+type Check struct {
+	Name   string `json:"name"`
+	Addr   string `json:"addr"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// dnsChecks queries each DNS server the node depends on. Any answer, even
+// NXDOMAIN, means the listener is serving.
+func dnsChecks(ctx context.Context, cfg *config.Config) []Check {
+	var targets [][2]string
+	if cfg.PrivateDNSEnabled || cfg.HasFirewallService() {
+		targets = append(targets, [2]string{"tunnel_dns", dnspkg.DefaultListenAddr(cfg.WGIPv4Subnet, cfg.PrivateDNSAddr)})
+	}
+	if cfg.HasFirewallService() && cfg.FirewallDNSAddr != "" {
+		targets = append(targets, [2]string{"firewall_dns", withPort(cfg.FirewallDNSAddr, "53")})
+	}
+	if cfg.UpstreamDNS != "" {
+		targets = append(targets, [2]string{"upstream_dns", withPort(cfg.UpstreamDNS, "53")})
+	}
+	out := []Check{}
+	for _, t := range targets {
+		out = append(out, queryDNS(ctx, t[0], t[1]))
+	}
+	return out
+}
+
+func queryDNS(ctx context.Context, name, addr string) Check {
+	c := Check{Name: name, Addr: addr}
+	msg := new(dns.Msg)
+	msg.SetQuestion("erebrus-diag.invalid.", dns.TypeA)
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	resp, rtt, err := (&dns.Client{Timeout: checkTimeout}).ExchangeContext(ctx, msg, addr)
+	if err != nil {
+		c.Detail = err.Error()
+		return c
+	}
+	c.OK = true
+	c.Detail = fmt.Sprintf("%s in %s", dns.RcodeToString[resp.Rcode], rtt.Round(time.Millisecond))
+	return c
+}
+
+func withPort(addr, port string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(addr, port)
+}
+
+// portChecks reports, for each port the node should serve, whether something
+// is bound to it on this host. OK means bound: on a running node a free
+// port is a listener that failed to start.
+func portChecks(cfg *config.Config) []Check {
+	type port struct {
+		name, network, port string
+	}
+	ports := []port{{"public_api", "tcp", cfg.PublicListener().Port}}
+	if m := cfg.ManagementListener(); m.Port != cfg.PublicListener().Port {
+		ports = append(ports, port{"management_api", "tcp", m.Port})
+	}
+	if m := cfg.MetricsListener(); m.Port != cfg.PublicListener().Port {
+		ports = append(ports, port{"metrics", "tcp", m.Port})
+	}
+	ports = append(ports, port{"wireguard", "udp", strconv.Itoa(cfg.WGEndpointPortInt())})
+	if cfg.EnableStealth {
+		ports = append(ports,
+			port{"vless_reality", "tcp", strconv.Itoa(cfg.VLESSPortInt())},
+			port{"hysteria2", "udp", strconv.Itoa(cfg.Hysteria2PortInt())})
+	}
+	if cfg.TUICCarrierEnabled() {
+		ports = append(ports, port{"tuic", "udp", strconv.Itoa(cfg.StealthTUICPortInt())})
+	}
+	if cfg.WebSocketCarrierEnabled() {
+		ports = append(ports, port{"vless_ws", "tcp", strconv.Itoa(cfg.StealthWSPortInt())})
+	}
+	if cfg.HTTPSConnectCarrierEnabled() {
+		ports = append(ports, port{"https_connect", "tcp", strconv.Itoa(cfg.StealthConnectPortInt())})
+	}
+	out := []Check{}
+	for _, p := range ports {
+		if p.port == "" || p.port == "0" {
+			continue
+		}
+		out = append(out, portBound(p.name, p.network, p.port))
+	}
+	return out
+}
+
+func portBound(name, network, port string) Check {
+	c := Check{Name: name, Addr: network + "/" + port}
+	var err error
+	if network == "tcp" {
+		var l net.Listener
+		if l, err = net.Listen("tcp", ":"+port); err == nil {
+			_ = l.Close()
+		}
+	} else {
+		var pc net.PacketConn
+		if pc, err = net.ListenPacket("udp", ":"+port); err == nil {
+			_ = pc.Close()
+		}
+	}
+	switch {
+	case err == nil:
+		c.Detail = "free: nothing is bound to this port"
+	case errors.Is(err, syscall.EADDRINUSE):
+		c.OK = true
+		c.Detail = "bound"
+	default:
+		c.Detail = err.Error()
+	}
+	return c
+}
+
+// StoreReport is store.json.
+type StoreReport struct {
+	Path      string   `json:"path"`
+	SizeBytes int64    `json:"size_bytes"`
+	Integrity []string `json:"integrity"`
+}
+
+func storeIntegrity(ctx context.Context, src Sources) (any, error) {
+	if src.Store == nil {
+		return nil, errUnavailable
+	}
+	rep := StoreReport{Path: src.Cfg.DBPath()}
+	if fi, err := os.Stat(rep.Path); err == nil {
+		rep.SizeBytes = fi.Size()
+	}
+	lines, err := src.Store.IntegrityCheck(ctx)
+	if err != nil {
+		return rep, err
+	}
+	rep.Integrity = lines
+	if len(lines) != 1 || lines[0] != "ok" {
+		return rep, fmt.Errorf("integrity check reported %d problem(s)", len(lines))
+	}
+	return rep, nil
+}
@@ -0,0 +1,103 @@
+package diag
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/NetSepio/erebrus/internal/config"
+	"github.com/NetSepio/erebrus/internal/store"
+	"github.com/NetSepio/erebrus/internal/wg"
+)
+
+type fakeWG struct{ wg.Controller }
+
+func (fakeWG) Stats(string) (wg.DeviceStats, error) {
+	return wg.DeviceStats{RxBytes: 10, TxBytes: 20, Connected: 1}, nil
+}
+
+func (fakeWG) PeerTransfers(string) ([]wg.PeerTransfer, error) {
+	return []wg.PeerTransfer{{WGPublicKey: "wOLuwnTGzkkCC1WiV2t5HpJ56FftZyXTK0WnWxSDFkI=", RxBytes: 10, TxBytes: 20}}, nil
+}
+
+func TestSaveRedactsAndPacksSections(t *testing.T) {
+	cfg := config.Load()
+	cfg.StateDir = t.TempDir()
+	cfg.Mnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	cfg.NodeToken = "v4.public.node-token-value"
+	cfg.UpstreamDNS = ""
+	cfg.EnableStealth = false
+
+	st, err := store.Open(cfg.DBPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	src := Sources{
+		Cfg: cfg, Store: st, WG: fakeWG{},
+		Logs: func() []string { return []string{`{"msg":"refreshed","token":"v4.public.node-token-value"}`} },
+	}
+	res, err := Save(context.Background(), src, cfg.StateDir+"/diagnostics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := readBundle(t, res.Path)
+
+	for _, name := range []string{"manifest.json", "config.env", "readiness.json", "wireguard.json",
+		"logs.jsonl", "dns.json", "ports.json", "store.json"} {
+		if _, ok := files[res.ID+"/"+name]; !ok {
+			t.Errorf("bundle missing %s", name)
+		}
+	}
+	for name, data := range files {
+		if strings.Contains(data, cfg.NodeToken) || strings.Contains(data, cfg.Mnemonic) {
+			t.Errorf("%s leaks a secret", name)
+		}
+		if strings.Contains(data, "wOLuwnTGzkkCC1WiV2t5HpJ56FftZyXTK0WnWxSDFkI=") {
+			t.Errorf("%s contains a raw WireGuard key", name)
+		}
+	}
+	if !strings.Contains(files[res.ID+"/config.env"], "MNEMONIC="+redacted) {
+		t.Error("config.env does not mark the mnemonic as set")
+	}
+
+	var man Manifest
+	if err := json.Unmarshal([]byte(files[res.ID+"/manifest.json"]), &man); err != nil {
+		t.Fatal(err)
+	}
+	if man.Sections["stealth.json"] != "unavailable" || man.Sections["store.json"] != "ok" {
+		t.Errorf("sections = %v", man.Sections)
+	}
+}
+
+func readBundle(t *testing.T, path string) map[string]string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	out := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		out[hdr.Name] = string(data)
+	}
+}
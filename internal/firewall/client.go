@@ -40,13 +40,13 @@ type SyncRule struct {
 
 // Client applies firewall operations for the active profile.
 type Client struct {
-	cfg      *config.Config
+	cfg      *config.Live
 	http     *http.Client
 	licensed bool
 }
 
 // New constructs a Client.
-func New(cfg *config.Config) *Client {
+func New(cfg *config.Live) *Client {
 	return &Client{cfg: cfg, licensed: true, http: &http.Client{Timeout: 10 * time.Second}}
 }
 
@@ -58,7 +58,8 @@ func (c *Client) Licensed() bool { return c.licensed }
 
 // Sync applies a gateway policy payload.
 func (c *Client) Sync(ctx context.Context, raw json.RawMessage) error {
-	if !c.cfg.HasFirewallService() {
+	cfg := c.cfg.Load()
+	if !cfg.HasFirewallService() {
 		return fmt.Errorf("firewall service not configured")
 	}
 	var p SyncPayload
@@ -68,17 +69,18 @@ func (c *Client) Sync(ctx context.Context, raw json.RawMessage) error {
 		}
 	}
 	c.SetLicensed(p.Licensed)
-	switch c.cfg.FirewallProvider {
+	switch cfg.FirewallProvider {
 	case config.FirewallUnboundErebrus:
 		return c.syncSentinel(ctx, p)
 	case config.FirewallAdGuardHome:
 		return c.syncShield(ctx, p)
 	default:
-		return fmt.Errorf("unsupported firewall provider %q", c.cfg.FirewallProvider)
+		return fmt.Errorf("unsupported firewall provider %q", cfg.FirewallProvider)
 	}
 }
 
 func (c *Client) syncSentinel(ctx context.Context, p SyncPayload) error {
+	cfg := c.cfg.Load()
 	if !c.licensed {
 		return fmt.Errorf("sentinel unlicensed")
 	}
@@ -95,18 +97,18 @@ func (c *Client) syncSentinel(ctx context.Context, p SyncPayload) error {
 		return err
 	}
 	licBody, _ := json.Marshal(map[string]bool{"licensed": c.licensed})
-	_ = c.post(ctx, c.cfg.SentinelAPIURL+"/license/check", licBody)
+	_ = c.post(ctx, cfg.SentinelAPIURL+"/license/check", licBody)
 	if !c.licensed {
 		return fmt.Errorf("sentinel unlicensed")
 	}
-	if err := c.post(ctx, c.cfg.SentinelAPIURL+"/policy/apply", body); err != nil {
+	if err := c.post(ctx, cfg.SentinelAPIURL+"/policy/apply", body); err != nil {
 		return err
 	}
-	return c.post(ctx, c.cfg.SentinelAPIURL+"/reload", nil)
+	return c.post(ctx, cfg.SentinelAPIURL+"/reload", nil)
 }
 
 func (c *Client) syncShield(ctx context.Context, _ SyncPayload) error {
-	base := strings.TrimRight(c.cfg.ShieldAdminURL, "/")
+	base := strings.TrimRight(c.cfg.Load().ShieldAdminURL, "/")
 	if base == "" {
 		return nil
 	}
@@ -115,11 +117,12 @@ func (c *Client) syncShield(ctx context.Context, _ SyncPayload) error {
 
 // Restart reloads the local firewall sidecar.
 func (c *Client) Restart(ctx context.Context) error {
-	switch c.cfg.FirewallProvider {
+	cfg := c.cfg.Load()
+	switch cfg.FirewallProvider {
 	case config.FirewallUnboundErebrus:
-		return c.post(ctx, c.cfg.SentinelAPIURL+"/reload", nil)
+		return c.post(ctx, cfg.SentinelAPIURL+"/reload", nil)
 	case config.FirewallAdGuardHome:
-		base := strings.TrimRight(c.cfg.ShieldAdminURL, "/")
+		base := strings.TrimRight(cfg.ShieldAdminURL, "/")
 		if base == "" {
 			return nil
 		}
@@ -130,15 +133,17 @@ func (c *Client) Restart(ctx context.Context) error {
 }
 
 func (c *Client) adminUser() string {
-	if c.cfg.ShieldAdminUser != "" {
-		return c.cfg.ShieldAdminUser
+	cfg := c.cfg.Load()
+	if cfg.ShieldAdminUser != "" {
+		return cfg.ShieldAdminUser
 	}
 	return "admin"
 }
 
 // AdminCredentials returns the configured Shield (AdGuard) admin login.
 func (c *Client) AdminCredentials() (user, password, url string) {
-	return c.adminUser(), c.cfg.ShieldAdminPassword, strings.TrimRight(c.cfg.ShieldAdminURL, "/")
+	cfg := c.cfg.Load()
+	return c.adminUser(), cfg.ShieldAdminPassword, strings.TrimRight(cfg.ShieldAdminURL, "/")
 }
 
 // installConfigure body for AdGuard's initial-setup API.
@@ -157,19 +162,20 @@ func (c *Client) configureBody(user, password string) []byte {
 // resolvers. No-op for non-Shield or when no password is set. Best-effort: an
 // already-configured AdGuard rejects the install call, which is ignored.
 func (c *Client) ConfigureAdmin(ctx context.Context) error {
-	if c.cfg.FirewallProvider != config.FirewallAdGuardHome || c.cfg.ShieldAdminPassword == "" {
+	cfg := c.cfg.Load()
+	if cfg.FirewallProvider != config.FirewallAdGuardHome || cfg.ShieldAdminPassword == "" {
 		return nil
 	}
-	base := strings.TrimRight(c.cfg.ShieldAdminURL, "/")
+	base := strings.TrimRight(cfg.ShieldAdminURL, "/")
 	if base == "" {
 		return nil
 	}
-	_ = c.post(ctx, base+"/control/install/configure", c.configureBody(c.adminUser(), c.cfg.ShieldAdminPassword))
+	_ = c.post(ctx, base+"/control/install/configure", c.configureBody(c.adminUser(), cfg.ShieldAdminPassword))
 	return c.ensureShieldUpstreams(ctx)
 }
 
 func (c *Client) shieldUpstreams() []string {
-	raw := strings.TrimSpace(c.cfg.ShieldUpstreamDNS)
+	raw := strings.TrimSpace(c.cfg.Load().ShieldUpstreamDNS)
 	if raw == "" {
 		return append([]string(nil), defaultShieldUpstreams...)
 	}
@@ -190,7 +196,7 @@ func (c *Client) shieldUpstreams() []string {
 // clients wait for tunnel DNS, so the stock default degrades every peer on the
 // node. Upstreams an operator changed by hand are left untouched.
 func (c *Client) ensureShieldUpstreams(ctx context.Context) error {
-	base := strings.TrimRight(c.cfg.ShieldAdminURL, "/")
+	base := strings.TrimRight(c.cfg.Load().ShieldAdminURL, "/")
 	if base == "" {
 		return nil
 	}
@@ -233,27 +239,31 @@ func isStockUpstreams(v any) bool {
 // password-change API on a configured instance, so this attempts the install API;
 // the gateway stays the source of truth for the stored value.
 func (c *Client) SetAdminPassword(ctx context.Context, user, password string) error {
-	if c.cfg.FirewallProvider != config.FirewallAdGuardHome || password == "" {
+	cfg := c.cfg.Load()
+	if cfg.FirewallProvider != config.FirewallAdGuardHome || password == "" {
 		return nil
 	}
-	base := strings.TrimRight(c.cfg.ShieldAdminURL, "/")
+	base := strings.TrimRight(cfg.ShieldAdminURL, "/")
 	if base == "" {
 		return nil
 	}
 	if user == "" {
 		user = c.adminUser()
 	}
-	c.cfg.ShieldAdminUser = user
-	c.cfg.ShieldAdminPassword = password
+	c.cfg.Update(func(cfg *config.Config) {
+		cfg.ShieldAdminUser = user
+		cfg.ShieldAdminPassword = password
+	})
 	return c.post(ctx, base+"/control/install/configure", c.configureBody(user, password))
 }
 
 // ResetCredentials clears Shield admin credentials reference (AdGuard re-setup).
 func (c *Client) ResetCredentials(ctx context.Context) error {
-	if c.cfg.FirewallProvider != config.FirewallAdGuardHome {
+	cfg := c.cfg.Load()
+	if cfg.FirewallProvider != config.FirewallAdGuardHome {
 		return nil
 	}
-	base := strings.TrimRight(c.cfg.ShieldAdminURL, "/")
+	base := strings.TrimRight(cfg.ShieldAdminURL, "/")
 	if base == "" {
 		return nil
 	}
@@ -264,10 +274,11 @@ func (c *Client) ResetCredentials(ctx context.Context) error {
 
 // CheckLicense queries Sentinel license state.
 func (c *Client) CheckLicense(ctx context.Context) (bool, error) {
-	if c.cfg.FirewallProvider != config.FirewallUnboundErebrus {
+	cfg := c.cfg.Load()
+	if cfg.FirewallProvider != config.FirewallUnboundErebrus {
 		return true, nil
 	}
-	base := strings.TrimRight(c.cfg.SentinelAPIURL, "/")
+	base := strings.TrimRight(cfg.SentinelAPIURL, "/")
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+"/license/check", bytes.NewReader([]byte(`{}`)))
 	if err != nil {
 		return false, err
@@ -299,7 +310,7 @@ func (c *Client) getAuth(ctx context.Context, url string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	req.SetBasicAuth(c.adminUser(), c.cfg.ShieldAdminPassword)
+	req.SetBasicAuth(c.adminUser(), c.cfg.Load().ShieldAdminPassword)
 	resp, err := c.http.Do(req)
 	if err != nil {
 		return nil, err
@@ -328,7 +339,7 @@ func (c *Client) postAuth(ctx context.Context, url string, body []byte) error {
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
-	req.SetBasicAuth(c.adminUser(), c.cfg.ShieldAdminPassword)
+	req.SetBasicAuth(c.adminUser(), c.cfg.Load().ShieldAdminPassword)
 	resp, err := c.http.Do(req)
 	if err != nil {
 		return err
@@ -11,7 +11,7 @@ import (
 )
 
 func TestShieldUpstreamsDefaults(t *testing.T) {
-	c := New(&config.Config{})
+	c := New(config.NewLive(&config.Config{}))
 	got := c.shieldUpstreams()
 	want := []string{"1.1.1.1", "1.0.0.1"}
 	if len(got) != len(want) {
@@ -25,7 +25,7 @@ func TestShieldUpstreamsDefaults(t *testing.T) {
 }
 
 func TestShieldUpstreamsFromEnv(t *testing.T) {
-	c := New(&config.Config{ShieldUpstreamDNS: "9.9.9.9, 149.112.112.112"})
+	c := New(config.NewLive(&config.Config{ShieldUpstreamDNS: "9.9.9.9, 149.112.112.112"}))
 	got := c.shieldUpstreams()
 	want := []string{"9.9.9.9", "149.112.112.112"}
 	if len(got) != len(want) {
@@ -115,12 +115,12 @@ func fakeAdGuard(t *testing.T, upstreams []string, gotConfig *[]string, calls ma
 }
 
 func shieldClient(url string) *Client {
-	return New(&config.Config{
+	return New(config.NewLive(&config.Config{
 		FirewallProvider:    config.FirewallAdGuardHome,
 		ShieldAdminURL:      url,
 		ShieldAdminUser:     "admin",
 		ShieldAdminPassword: "secret",
-	})
+	}))
 }
 
 func TestConfigureAdminReplacesStockUpstreams(t *testing.T) {
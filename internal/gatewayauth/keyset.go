@@ -0,0 +1,230 @@
+package gatewayauth
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vk-rv/pvx"
+)
+
+const roleGatewayKeys = "gateway_keys"
+
+// Key is one trusted gateway signing key. NotBefore/NotAfter bound its use so
+// a rotating gateway can publish the next key ahead of time and retire the
+// previous one after an overlap window.
+type Key struct {
+	ID        string     `json:"kid,omitempty"`
+	PublicKey string     `json:"public_key"` // hex Ed25519
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	NotAfter  *time.Time `json:"not_after,omitempty"`
+}
+
+func (k Key) activeAt(now time.Time, skew time.Duration) bool {
+	if k.NotBefore != nil && now.Add(skew).Before(*k.NotBefore) {
+		return false
+	}
+	if k.NotAfter != nil && now.After(k.NotAfter.Add(skew)) {
+		return false
+	}
+	return true
+}
+
+func (k Key) ed25519() (ed25519.PublicKey, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(k.PublicKey, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("decode gateway public key %q: %w", k.ID, err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("gateway public key %q must be %d bytes", k.ID, ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// KeySet is the node's trusted gateway keys. Tokens name their key with a
+// kid in the PASETO footer; tokens without one are tried against every
+// active key, which covers the single GATEWAY_PUBLIC_KEY of older gateways.
+// Keys without an ID also verify tokens whose kid no key in the set carries.
+type KeySet struct {
+	mu       sync.RWMutex
+	keys     []Key
+	issuedAt time.Time
+}
+
+// NewKeySet builds a set, dropping keys that do not decode.
+func NewKeySet(keys ...Key) *KeySet {
+	s := &KeySet{}
+	for _, k := range keys {
+		if _, err := k.ed25519(); err == nil {
+			s.keys = append(s.keys, k)
+		}
+	}
+	return s
+}
+
+// Keys returns a copy of the trusted keys.
+func (s *KeySet) Keys() []Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Key(nil), s.keys...)
+}
+
+// IssuedAt is the iat of the signed update the set came from (zero for keys
+// from configuration or registration).
+func (s *KeySet) IssuedAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.issuedAt
+}
+
+// Empty reports whether no key is trusted.
+func (s *KeySet) Empty() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.keys) == 0
+}
+
+// Replace swaps in keys from a verified update.
+func (s *KeySet) Replace(keys []Key, issuedAt time.Time) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("empty gateway key set")
+	}
+	for _, k := range keys {
+		if _, err := k.ed25519(); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	s.keys = append([]Key(nil), keys...)
+	s.issuedAt = issuedAt
+	s.mu.Unlock()
+	return nil
+}
+
+// candidates returns the active keys a token with kid may be verified with.
+func (s *KeySet) candidates(kid string, now time.Time, skew time.Duration) ([]ed25519.PublicKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	named := false
+	for _, k := range s.keys {
+		if kid != "" && k.ID == kid {
+			named = true
+			break
+		}
+	}
+	var out []ed25519.PublicKey
+	known := false
+	for _, k := range s.keys {
+		// A key without an ID (GATEWAY_PUBLIC_KEY or registration) stands in
+		// for a kid no other key carries, so a node that only has that key can
+		// verify the first kid-signed key set.
+		if kid != "" && k.ID != kid && (named || k.ID != "") {
+			continue
+		}
+		known = true
+		if !k.activeAt(now, skew) {
+			continue
+		}
+		if pk, err := k.ed25519(); err == nil {
+			out = append(out, pk)
+		}
+	}
+	switch {
+	case !known && kid != "":
+		return nil, fail(ReasonUnknownKey, "unknown kid %q", kid)
+	case !known:
+		return nil, fail(ReasonUnknownKey, "no gateway key configured")
+	case len(out) == 0:
+		return nil, fail(ReasonUnknownKey, "gateway key %q is outside its validity window", kid)
+	}
+	return out, nil
+}
+
+// verify checks token against the key its footer names and returns the
+// verified token for scanning.
+func (s *KeySet) verify(token string, now time.Time, skew time.Duration) (*pvx.Token, error) {
+	keys, err := s.candidates(footerKeyID(token), now, skew)
+	if err != nil {
+		return nil, err
+	}
+	pv4 := pvx.NewPV4Public()
+	var last error
+	for _, pk := range keys {
+		tok := pv4.Verify(token, pvx.NewAsymmetricPublicKey(pk, pvx.Version4))
+		if last = tok.Err(); last == nil {
+			return tok, nil
+		}
+	}
+	return nil, &Error{Reason: ReasonSignature, Err: last}
+}
+
+// footerKeyID reads the kid from a v4.public token footer. The footer is
+// covered by the signature, so an attacker can only steer key selection, not
+// bypass it.
+func footerKeyID(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 {
+		return ""
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return ""
+	}
+	var footer struct {
+		KeyID string `json:"kid"`
+	}
+	if json.Unmarshal(raw, &footer) != nil {
+		return ""
+	}
+	return footer.KeyID
+}
+
+// keySetClaims is the payload of a signed gateway key set update.
+type keySetClaims struct {
+	Role string `json:"role"`
+	Keys []Key  `json:"keys"`
+	pvx.RegisteredClaims
+}
+
+func (*keySetClaims) Valid() error { return nil }
+
+// VerifyKeySetUpdate checks a gateway-signed key set against the currently
+// trusted keys and returns the new keys and their issue time. Updates older
+// than the current set are rejected so a captured update cannot roll back a
+// rotation.
+func VerifyKeySetUpdate(token string, trusted *KeySet, now time.Time) ([]Key, time.Time, error) {
+	tok, err := trusted.verify(token, now, 0)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var c keySetClaims
+	if err := tok.ScanClaims(&c); err != nil {
+		return nil, time.Time{}, &Error{Reason: ReasonMalformed, Err: err}
+	}
+	if c.Role != roleGatewayKeys {
+		return nil, time.Time{}, fail(ReasonRole, "unexpected role %q", c.Role)
+	}
+	if c.Expiration != nil && now.After(*c.Expiration) {
+		return nil, time.Time{}, fail(ReasonExpired, "key set update expired")
+	}
+	if c.IssuedAt == nil {
+		return nil, time.Time{}, fail(ReasonMalformed, "key set update has no iat")
+	}
+	if !c.IssuedAt.After(trusted.IssuedAt()) {
+		return nil, time.Time{}, fail(ReasonReplay, "key set update is not newer than the current set")
+	}
+	if len(c.Keys) == 0 {
+		return nil, time.Time{}, fail(ReasonMalformed, "key set update has no keys")
+	}
+	for _, k := range c.Keys {
+		if _, err := k.ed25519(); err != nil {
+			return nil, time.Time{}, &Error{Reason: ReasonMalformed, Err: err}
+		}
+	}
+	return c.Keys, *c.IssuedAt, nil
+}
@@ -0,0 +1,138 @@
+package gatewayauth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/vk-rv/pvx"
+)
+
+func newKey(t *testing.T, kid string) (Key, ed25519.PrivateKey) {
+	t.Helper()
+	pub, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Key{ID: kid, PublicKey: hex.EncodeToString(pub)}, sk
+}
+
+func signWithKID(t *testing.T, sk ed25519.PrivateKey, kid string, claims pvx.Claims) string {
+	t.Helper()
+	tok, err := pvx.NewPV4Public().Sign(pvx.NewAsymmetricSecretKey(sk, pvx.Version4), claims,
+		pvx.WithFooter(map[string]string{"kid": kid}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+func TestKeySetSelectsKeyByKID(t *testing.T) {
+	oldKey, oldSK := newKey(t, "k1")
+	newK, newSK := newKey(t, "k2")
+	retired := time.Now().Add(-time.Hour)
+	oldKey.NotAfter = &retired
+	ks := NewKeySet(oldKey, newK)
+	v := NewVerifier(Options{MaxTTL: 5 * time.Minute})
+	req := Request{NodeID: "n"}
+
+	c := &Claims{Role: roleGatewayCall, NodeID: "n", RegisteredClaims: window(time.Now(), time.Minute)}
+	if _, err := v.Verify(signWithKID(t, newSK, "k2", c), ks, req); err != nil {
+		t.Fatalf("current key rejected: %v", err)
+	}
+	if _, err := v.Verify(signWithKID(t, oldSK, "k1", c), ks, req); ReasonOf(err) != ReasonUnknownKey {
+		t.Fatalf("retired key err = %v", err)
+	}
+	if _, err := v.Verify(signWithKID(t, oldSK, "k2", c), ks, req); ReasonOf(err) != ReasonSignature {
+		t.Fatalf("wrong key for kid err = %v", err)
+	}
+	if _, err := v.Verify(signWithKID(t, newSK, "k9", c), ks, req); ReasonOf(err) != ReasonUnknownKey {
+		t.Fatalf("unknown kid err = %v", err)
+	}
+}
+
+func TestVerifyKeySetUpdate(t *testing.T) {
+	cur, curSK := newKey(t, "k1")
+	next, _ := newKey(t, "k2")
+	ks := NewKeySet(cur)
+	now := time.Now()
+
+	iat := now.Add(-time.Second)
+	update := &keySetClaims{Role: roleGatewayKeys, Keys: []Key{cur, next}}
+	update.IssuedAt = &iat
+	tok := signWithKID(t, curSK, "k1", update)
+
+	keys, issued, err := VerifyKeySetUpdate(tok, ks, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[1].ID != "k2" {
+		t.Fatalf("keys = %+v", keys)
+	}
+	if err := ks.Replace(keys, issued); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := VerifyKeySetUpdate(tok, ks, now); ReasonOf(err) != ReasonReplay {
+		t.Fatalf("replayed update err = %v", err)
+	}
+
+	_, rogueSK := newKey(t, "k1")
+	later := now.Add(time.Minute)
+	update.IssuedAt = &later
+	if _, _, err := VerifyKeySetUpdate(signWithKID(t, rogueSK, "k1", update), ks, now); ReasonOf(err) != ReasonSignature {
+		t.Fatalf("untrusted signer err = %v", err)
+	}
+}
+
+func TestKeySetUpdateFromUnnamedKey(t *testing.T) {
+	// Before its first rotation a node only has the registration key, which
+	// has no ID; the gateway already signs with a kid.
+	cur, curSK := newKey(t, "")
+	ks := NewKeySet(cur)
+	now := time.Now()
+
+	first := cur
+	first.ID = "k1"
+	next, nextSK := newKey(t, "k2")
+	iat := now.Add(-time.Second)
+	update := &keySetClaims{Role: roleGatewayKeys, Keys: []Key{first, next}}
+	update.IssuedAt = &iat
+	keys, issued, err := VerifyKeySetUpdate(signWithKID(t, curSK, "k1", update), ks, now)
+	if err != nil {
+		t.Fatalf("kid-signed update from the registration key: %v", err)
+	}
+	if err := ks.Replace(keys, issued); err != nil {
+		t.Fatal(err)
+	}
+
+	v := NewVerifier(Options{MaxTTL: 5 * time.Minute})
+	c := &Claims{Role: roleGatewayCall, NodeID: "n", RegisteredClaims: window(now, time.Minute)}
+	for _, tc := range []struct {
+		sk  ed25519.PrivateKey
+		kid string
+	}{{curSK, "k1"}, {nextSK, "k2"}} {
+		if _, err := v.Verify(signWithKID(t, tc.sk, tc.kid, c), ks, Request{NodeID: "n"}); err != nil {
+			t.Fatalf("call token with kid %s: %v", tc.kid, err)
+		}
+	}
+	// Once every key is named, an unknown kid no longer falls back.
+	if _, err := v.Verify(signWithKID(t, curSK, "k9", c), ks, Request{NodeID: "n"}); ReasonOf(err) != ReasonUnknownKey {
+		t.Fatalf("unknown kid err = %v", err)
+	}
+}
+
+func TestKeySetUnnamedKeyVerifiesKIDToken(t *testing.T) {
+	cur, curSK := newKey(t, "")
+	ks := NewKeySet(cur)
+	v := NewVerifier(Options{MaxTTL: 5 * time.Minute})
+	c := &Claims{Role: roleGatewayCall, NodeID: "n", RegisteredClaims: window(time.Now(), time.Minute)}
+	if _, err := v.Verify(signWithKID(t, curSK, "k1", c), ks, Request{NodeID: "n"}); err != nil {
+		t.Fatalf("kid-signed call token with only the registration key: %v", err)
+	}
+	_, rogueSK := newKey(t, "")
+	if _, err := v.Verify(signWithKID(t, rogueSK, "k1", c), ks, Request{NodeID: "n"}); ReasonOf(err) != ReasonSignature {
+		t.Fatalf("untrusted signer err = %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package gatewayauth
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options tunes a Verifier.
+type Options struct {
+	// MaxTTL rejects tokens whose exp is further than this from iat (or now).
+	MaxTTL time.Duration
+	// ClockSkew tolerates drift between gateway and node clocks.
+	ClockSkew time.Duration
+	// Strict requires jti and method/path binding claims. Without it, tokens
+	// carrying them are still enforced, so older gateways keep working.
+	Strict bool
+	// ReplayCacheSize bounds the number of remembered jti values.
+	ReplayCacheSize int
+}
+
+// Request is what a token must match to authorize one HTTP call.
+type Request struct {
+	NodeID  string
+	Purpose string // "" accepts any purpose
+	// AllowUnscoped also accepts tokens with no purpose claim, as minted by
+	// gateways that predate per-route purposes.
+	AllowUnscoped bool
+	// PeerID is the route's :id; a peer-scoped token must name it.
+	PeerID string
+	Method string
+	Path   string
+}
+
+// Verifier checks gateway call tokens and rejects replays of the same jti.
+type Verifier struct {
+	opts   Options
+	now    func() time.Time
+	replay *replayCache
+}
+
+// NewVerifier builds a verifier with a bounded replay cache.
+func NewVerifier(opts Options) *Verifier {
+	if opts.ReplayCacheSize <= 0 {
+		opts.ReplayCacheSize = 10000
+	}
+	return &Verifier{opts: opts, now: time.Now, replay: newReplayCache(opts.ReplayCacheSize)}
+}
+
+// Verify checks signature (against the footer's kid), role, lifetime, node/purpose target, request
+// binding and one-time use, in that order. Errors carry a Reason.
+func (v *Verifier) Verify(token string, keys *KeySet, req Request) (*Claims, error) {
+	now := v.now()
+	c, err := verifyGatewayCall(token, keys, now, v.opts.ClockSkew)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTimes(c, now, v.opts.ClockSkew, v.opts.MaxTTL); err != nil {
+		return nil, err
+	}
+	if req.Purpose != "" && !(req.AllowUnscoped && c.Purpose == "") {
+		err = validatePurposeClaims(c, req.NodeID, req.Purpose)
+	} else if req.NodeID != "" && c.NodeID != "" && c.NodeID != req.NodeID {
+		err = fail(ReasonNodeID, "node_id mismatch")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if scope := c.peerScope(); scope != "" && scope != req.PeerID {
+		return nil, fail(ReasonPeerID, "token scoped to peer %q", scope)
+	}
+	if err := v.checkBinding(c, req); err != nil {
+		return nil, err
+	}
+	if c.TokenID == "" {
+		if v.opts.Strict {
+			return nil, fail(ReasonMissingJTI, "token has no jti")
+		}
+		return c, nil
+	}
+	expiry := now.Add(v.opts.MaxTTL)
+	if c.Expiration != nil {
+		expiry = *c.Expiration
+	}
+	if !v.replay.add(c.TokenID, expiry.Add(v.opts.ClockSkew), now) {
+		return nil, fail(ReasonReplay, "jti already used")
+	}
+	return c, nil
+}
+
+func (v *Verifier) checkBinding(c *Claims, req Request) error {
+	if c.Method == "" && c.Path == "" {
+		if v.opts.Strict {
+			return fail(ReasonBinding, "token is not bound to a request")
+		}
+		return nil
+	}
+	if !strings.EqualFold(c.Method, req.Method) {
+		return fail(ReasonBinding, "token bound to method %q", c.Method)
+	}
+	if c.Path != req.Path {
+		return fail(ReasonBinding, "token bound to path %q", c.Path)
+	}
+	return nil
+}
+
+// replayCache remembers jti values until their token expires. When full it
+// drops the oldest entries; tokens are short-lived, so insertion order is
+// close to expiry order.
+type replayCache struct {
+	mu    sync.Mutex
+	max   int
+	seen  map[string]time.Time
+	order []string
+}
+
+func newReplayCache(max int) *replayCache {
+	return &replayCache{max: max, seen: map[string]time.Time{}}
+}
+
+// add records jti and reports false if it was already present and unexpired.
+func (r *replayCache) add(jti string, expiry, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if exp, ok := r.seen[jti]; ok && now.Before(exp) {
+		return false
+	}
+	r.prune(now)
+	for len(r.order) >= r.max {
+		delete(r.seen, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.seen[jti] = expiry
+	r.order = append(r.order, jti)
+	return true
+}
+
+func (r *replayCache) prune(now time.Time) {
+	i := 0
+	for ; i < len(r.order); i++ {
+		exp, ok := r.seen[r.order[i]]
+		if ok && now.Before(exp) {
+			break
+		}
+		delete(r.seen, r.order[i])
+	}
+	r.order = r.order[i:]
+}
@@ -0,0 +1,139 @@
+package gatewayauth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/vk-rv/pvx"
+)
+
+func signCall(t *testing.T, sk ed25519.PrivateKey, c Claims) string {
+	t.Helper()
+	c.Role = roleGatewayCall
+	tok, err := pvx.NewPV4Public().Sign(pvx.NewAsymmetricSecretKey(sk, pvx.Version4), &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+func testKey(t *testing.T) (*KeySet, ed25519.PrivateKey) {
+	t.Helper()
+	pub, sk, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewKeySet(Key{PublicKey: hex.EncodeToString(pub)}), sk
+}
+
+func window(iat time.Time, ttl time.Duration) pvx.RegisteredClaims {
+	exp := iat.Add(ttl)
+	return pvx.RegisteredClaims{IssuedAt: &iat, Expiration: &exp}
+}
+
+func TestVerifierRejectsReplay(t *testing.T) {
+	pub, sk := testKey(t)
+	v := NewVerifier(Options{MaxTTL: 5 * time.Minute, ClockSkew: 30 * time.Second})
+	rc := window(time.Now(), time.Minute)
+	rc.TokenID = "jti-1"
+	tok := signCall(t, sk, Claims{NodeID: "12D3node", Method: "DELETE", Path: "/api/v2/peers/p1", RegisteredClaims: rc})
+	req := Request{NodeID: "12D3node", Method: "DELETE", Path: "/api/v2/peers/p1"}
+
+	if _, err := v.Verify(tok, pub, req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.Verify(tok, pub, req); ReasonOf(err) != ReasonReplay {
+		t.Fatalf("second use err = %v, want replay", err)
+	}
+}
+
+func TestVerifierBindingAndTTL(t *testing.T) {
+	pub, sk := testKey(t)
+	v := NewVerifier(Options{MaxTTL: 5 * time.Minute, ClockSkew: 30 * time.Second})
+	now := time.Now()
+
+	bound := signCall(t, sk, Claims{NodeID: "n", Method: "DELETE", Path: "/api/v2/peers/p1", RegisteredClaims: window(now, time.Minute)})
+	if _, err := v.Verify(bound, pub, Request{NodeID: "n", Method: "DELETE", Path: "/api/v2/peers/p2"}); ReasonOf(err) != ReasonBinding {
+		t.Fatalf("path mismatch err = %v", err)
+	}
+
+	long := signCall(t, sk, Claims{NodeID: "n", RegisteredClaims: window(now, time.Hour)})
+	if _, err := v.Verify(long, pub, Request{NodeID: "n", Method: "GET", Path: "/api/v2/peers"}); ReasonOf(err) != ReasonTTL {
+		t.Fatalf("long ttl err = %v", err)
+	}
+
+	skewed := signCall(t, sk, Claims{NodeID: "n", RegisteredClaims: window(now.Add(20*time.Second), time.Minute)})
+	if _, err := v.Verify(skewed, pub, Request{NodeID: "n", Method: "GET", Path: "/api/v2/peers"}); err != nil {
+		t.Fatalf("iat within skew rejected: %v", err)
+	}
+
+	expired := signCall(t, sk, Claims{NodeID: "n", RegisteredClaims: window(now.Add(-3*time.Minute), time.Minute)})
+	if _, err := v.Verify(expired, pub, Request{NodeID: "n"}); ReasonOf(err) != ReasonExpired {
+		t.Fatalf("expired err = %v", err)
+	}
+}
+
+func TestVerifierStrictRequiresJTIAndBinding(t *testing.T) {
+	pub, sk := testKey(t)
+	v := NewVerifier(Options{MaxTTL: 5 * time.Minute, Strict: true})
+	tok := signCall(t, sk, Claims{NodeID: "n", RegisteredClaims: window(time.Now(), time.Minute)})
+	if _, err := v.Verify(tok, pub, Request{NodeID: "n", Method: "GET", Path: "/api/v2/peers"}); ReasonOf(err) != ReasonBinding {
+		t.Fatalf("unbound err = %v", err)
+	}
+	tok = signCall(t, sk, Claims{NodeID: "n", Method: "GET", Path: "/api/v2/peers", RegisteredClaims: window(time.Now(), time.Minute)})
+	if _, err := v.Verify(tok, pub, Request{NodeID: "n", Method: "GET", Path: "/api/v2/peers"}); ReasonOf(err) != ReasonMissingJTI {
+		t.Fatalf("missing jti err = %v", err)
+	}
+}
+
+func TestReplayCacheBounded(t *testing.T) {
+	r := newReplayCache(2)
+	now := time.Now()
+	exp := now.Add(time.Minute)
+	for _, id := range []string{"a", "b", "c"} {
+		if !r.add(id, exp, now) {
+			t.Fatalf("fresh jti %q rejected", id)
+		}
+	}
+	if len(r.seen) != 2 {
+		t.Fatalf("cache size = %d, want 2", len(r.seen))
+	}
+	if !r.add("x", now.Add(time.Second), now) || !r.add("x", exp, now.Add(2*time.Second)) {
+		t.Fatal("expired jti should be accepted again")
+	}
+}
+
+func TestVerifierPeerPurposeAndScope(t *testing.T) {
+	ks, sk := testKey(t)
+	v := NewVerifier(Options{MaxTTL: 5 * time.Minute})
+	now := time.Now()
+	del := Request{NodeID: "node", Purpose: "peer_delete", PeerID: "p1"}
+
+	unscoped := signCall(t, sk, Claims{NodeID: "node", RegisteredClaims: window(now, time.Minute)})
+	if _, err := v.Verify(unscoped, ks, del); ReasonOf(err) != ReasonPurpose {
+		t.Fatalf("purpose-less token err = %v", err)
+	}
+	legacy := del
+	legacy.AllowUnscoped = true
+	if _, err := v.Verify(unscoped, ks, legacy); err != nil {
+		t.Fatalf("legacy token rejected: %v", err)
+	}
+
+	list := signCall(t, sk, Claims{NodeID: "node", Purpose: "peer_list", RegisteredClaims: window(now, time.Minute)})
+	if _, err := v.Verify(list, ks, legacy); ReasonOf(err) != ReasonPurpose {
+		t.Fatalf("wrong purpose accepted in legacy mode: %v", err)
+	}
+
+	scoped := signCall(t, sk, Claims{NodeID: "node", PeerID: "p1", Purpose: "peer_delete", RegisteredClaims: window(now, time.Minute)})
+	if _, err := v.Verify(scoped, ks, del); err != nil {
+		t.Fatalf("scoped token rejected: %v", err)
+	}
+	other := del
+	other.PeerID = "p2"
+	if _, err := v.Verify(scoped, ks, other); ReasonOf(err) != ReasonPeerID {
+		t.Fatalf("scoped token on other peer err = %v", err)
+	}
+}
@@ -2,10 +2,9 @@
 package gatewayauth
 
 import (
-	"crypto/ed25519"
-	"encoding/hex"
+	"errors"
 	"fmt"
-	"strings"
+	"time"
 
 	"github.com/vk-rv/pvx"
 )
@@ -14,57 +13,116 @@ const roleGatewayCall = "gateway_call"
 
 // Claims is the gateway call token payload.
 type Claims struct {
-	Role    string `json:"role,omitempty"`
-	NodeID  string `json:"node_id,omitempty"`
+	Role   string `json:"role,omitempty"`
+	NodeID string `json:"node_id,omitempty"`
+	// PeerID is the node's peer_id on tokens without node_id. Alongside a
+	// different node_id it names the one VPN peer the token may act on.
 	PeerID  string `json:"peer_id,omitempty"`
 	Purpose string `json:"purpose,omitempty"`
+	// Method and Path bind the token to one request (e.g. DELETE
+	// /api/v2/peers/abc). Empty on tokens from gateways that predate binding.
+	Method string `json:"htm,omitempty"`
+	Path   string `json:"htu,omitempty"`
 	pvx.RegisteredClaims
 }
 
-// VerifyGatewayCall parses a gateway PASETO and checks it is a valid short-lived
-// gateway→node call for this node.
-func VerifyGatewayCall(token, gatewayPublicKeyHex, expectNodeID string) (*Claims, error) {
-	c, err := verifyGatewayCall(token, gatewayPublicKeyHex)
-	if err != nil {
-		return nil, err
-	}
-	if expectNodeID != "" && c.NodeID != "" && c.NodeID != expectNodeID {
-		return nil, fmt.Errorf("node_id mismatch")
+// Reason classifies a verification failure for metrics.
+type Reason string
+
+const (
+	ReasonMalformed   Reason = "malformed"
+	ReasonSignature   Reason = "signature"
+	ReasonUnknownKey  Reason = "unknown_key"
+	ReasonRole        Reason = "role"
+	ReasonNodeID      Reason = "node_id"
+	ReasonPurpose     Reason = "purpose"
+	ReasonPeerID      Reason = "peer_id"
+	ReasonExpired     Reason = "expired"
+	ReasonNotYetValid Reason = "not_yet_valid"
+	ReasonTTL         Reason = "ttl"
+	ReasonMissingJTI  Reason = "missing_jti"
+	ReasonReplay      Reason = "replay"
+	ReasonBinding     Reason = "binding"
+)
+
+// Error is a verification failure with its Reason.
+type Error struct {
+	Reason Reason
+	Err    error
+}
+
+func (e *Error) Error() string { return string(e.Reason) + ": " + e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+func fail(r Reason, format string, args ...any) error {
+	return &Error{Reason: r, Err: fmt.Errorf(format, args...)}
+}
+
+// ReasonOf returns the failure reason of err, or ReasonMalformed for errors
+// not produced by this package.
+func ReasonOf(err error) Reason {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Reason
 	}
-	return c, nil
+	return ReasonMalformed
 }
 
-// VerifyGatewayCallPurpose requires an exact purpose and exact node target.
-func VerifyGatewayCallPurpose(token, gatewayPublicKeyHex, expectNodeID, expectPurpose string) (*Claims, error) {
-	c, err := verifyGatewayCall(token, gatewayPublicKeyHex)
+// unvalidated defers time checks from pvx's ScanClaims to checkTimes, which
+// applies the configured clock skew.
+type unvalidated struct{ Claims }
+
+func (*unvalidated) Valid() error { return nil }
+
+func verifyGatewayCall(token string, keys *KeySet, now time.Time, skew time.Duration) (*Claims, error) {
+	tok, err := keys.verify(token, now, skew)
 	if err != nil {
 		return nil, err
 	}
-	if err := validatePurposeClaims(c, expectNodeID, expectPurpose); err != nil {
-		return nil, err
+	var c unvalidated
+	if err := tok.ScanClaims(&c); err != nil {
+		return nil, &Error{Reason: ReasonMalformed, Err: err}
 	}
-	return c, nil
+	if c.Role != roleGatewayCall {
+		return nil, fail(ReasonRole, "unexpected role %q", c.Role)
+	}
+	return &c.Claims, nil
 }
 
-func verifyGatewayCall(token, gatewayPublicKeyHex string) (*Claims, error) {
-	raw, err := hex.DecodeString(strings.TrimPrefix(gatewayPublicKeyHex, "0x"))
-	if err != nil {
-		return nil, fmt.Errorf("decode gateway public key: %w", err)
+// checkTimes enforces exp/nbf/iat within skew and, when maxTTL > 0, that the
+// token was not minted to outlive maxTTL.
+func checkTimes(c *Claims, now time.Time, skew, maxTTL time.Duration) error {
+	if c.Expiration != nil && now.After(c.Expiration.Add(skew)) {
+		return fail(ReasonExpired, "token expired at %s", c.Expiration.UTC().Format(time.RFC3339))
 	}
-	if len(raw) != ed25519.PublicKeySize {
-		return nil, fmt.Errorf("gateway public key must be %d bytes", ed25519.PublicKeySize)
+	if c.NotBefore != nil && now.Add(skew).Before(*c.NotBefore) {
+		return fail(ReasonNotYetValid, "token not valid before %s", c.NotBefore.UTC().Format(time.RFC3339))
 	}
-	pk := pvx.NewAsymmetricPublicKey(ed25519.PublicKey(raw), pvx.Version4)
-	pv4 := pvx.NewPV4Public()
-
-	var c Claims
-	if err := pv4.Verify(token, pk).ScanClaims(&c); err != nil {
-		return nil, err
+	if c.IssuedAt != nil && now.Add(skew).Before(*c.IssuedAt) {
+		return fail(ReasonNotYetValid, "token issued in the future")
 	}
-	if c.Role != roleGatewayCall {
-		return nil, fmt.Errorf("unexpected role %q", c.Role)
+	if maxTTL <= 0 {
+		return nil
+	}
+	if c.Expiration == nil {
+		return fail(ReasonTTL, "token has no exp")
+	}
+	start := now
+	if c.IssuedAt != nil {
+		start = *c.IssuedAt
+	}
+	if ttl := c.Expiration.Sub(start); ttl > maxTTL+skew {
+		return fail(ReasonTTL, "token lifetime %s exceeds %s", ttl.Round(time.Second), maxTTL)
+	}
+	return nil
+}
+
+// peerScope returns the VPN peer a token is restricted to, or "".
+func (c *Claims) peerScope() string {
+	if c.NodeID == "" || c.PeerID == "" || c.PeerID == c.NodeID {
+		return ""
 	}
-	return &c, nil
+	return c.PeerID
 }
 
 func validatePurposeClaims(c *Claims, expectNodeID, expectPurpose string) error {
@@ -73,10 +131,10 @@ func validatePurposeClaims(c *Claims, expectNodeID, expectPurpose string) error
 		nodeID = c.PeerID
 	}
 	if expectNodeID == "" || nodeID != expectNodeID {
-		return fmt.Errorf("node_id mismatch")
+		return fail(ReasonNodeID, "node_id mismatch")
 	}
 	if expectPurpose == "" || c.Purpose != expectPurpose {
-		return fmt.Errorf("purpose mismatch")
+		return fail(ReasonPurpose, "purpose mismatch")
 	}
 	return nil
 }
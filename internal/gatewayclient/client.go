@@ -3,7 +3,7 @@ package gatewayclient
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log/slog"
 	"math/rand"
 	"net/http"
@@ -37,10 +37,10 @@ type CommandHandler interface {
 
 // Client maintains the node→gateway WebSocket control plane.
 type Client struct {
-	gatewayURL string
-	nodeToken  string
-	nodeID     string
-	log        *slog.Logger
+	gateways  *Gateways
+	nodeToken string
+	nodeID    string
+	log       *slog.Logger
 
 	snap   SnapshotProvider
 	cmds   CommandHandler
@@ -52,6 +52,36 @@ type Client struct {
 	onReconnect  func()
 	refreshToken func(context.Context) (string, error)
 	connected    atomic.Bool
+	heartbeatNow chan struct{}
+	journal      *Journal
+	protocol     string // negotiated with the current session's gateway
+
+	queue      chan commandJob // state-changing commands, one at a time
+	concurrent chan commandJob // concurrentActions
+	connMu     sync.Mutex
+	conn       *wsConn // current session; nil while disconnected
+}
+
+// wsConn serialises writes: gorilla/websocket allows one writer at a time,
+// and command workers write alongside the write pump.
+type wsConn struct {
+	mu sync.Mutex
+	ws *websocket.Conn
+}
+
+func (w *wsConn) send(msgType string, payload any) error {
+	frame, err := wrap(msgType, payload)
+	if err != nil {
+		return err
+	}
+	return w.write(websocket.TextMessage, frame)
+}
+
+func (w *wsConn) write(messageType int, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_ = w.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return w.ws.WriteMessage(messageType, data)
 }
 
 type peerCounters struct {
@@ -62,15 +92,19 @@ type peerCounters struct {
 // New constructs a gateway WebSocket client.
 func New(gatewayURL, nodeID, nodeToken string, snap SnapshotProvider, cmds CommandHandler, status func() string) *Client {
 	return &Client{
-		gatewayURL:   strings.TrimRight(gatewayURL, "/"),
+		gateways:     NewGateways([]string{gatewayURL}),
 		nodeID:       nodeID,
 		nodeToken:    nodeToken,
 		snap:         snap,
 		cmds:         cmds,
 		status:       status,
 		heartbeatSec: defaultHeartbeatSec,
+		protocol:     legacyProtocolVersion,
 		lastUsage:    map[string]peerCounters{},
 		log:          slog.Default(),
+		heartbeatNow: make(chan struct{}, 1),
+		queue:        make(chan commandJob, commandQueueLen),
+		concurrent:   make(chan commandJob, commandQueueLen),
 	}
 }
 
@@ -81,6 +115,10 @@ func (c *Client) SetLogger(log *slog.Logger) {
 	}
 }
 
+// SetGateways replaces the single gateway URL given to New with an ordered
+// failover list.
+func (c *Client) SetGateways(g *Gateways) { c.gateways = g }
+
 // SetOnReconnect is called after each successful reconnect (e.g. to re-send hello).
 func (c *Client) SetOnReconnect(fn func()) { c.onReconnect = fn }
 
@@ -90,11 +128,52 @@ func (c *Client) SetTokenRefresher(fn func(context.Context) (string, error)) {
 	c.refreshToken = fn
 }
 
+// SetJournal makes commands idempotent by request_id and re-sends results
+// the gateway missed. Without one, every command frame is executed.
+func (c *Client) SetJournal(j *Journal) { c.journal = j }
+
+// HeartbeatNow sends a heartbeat without waiting for the next tick (e.g. on a
+// drain status change). No-op while disconnected.
+func (c *Client) HeartbeatNow() {
+	select {
+	case c.heartbeatNow <- struct{}{}:
+	default:
+	}
+}
+
+// ProtocolVersion is the protocol version negotiated in the last hello_ack;
+// 2.0 until the gateway says otherwise.
+func (c *Client) ProtocolVersion() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.protocol
+}
+
+func (c *Client) protocolAtLeast(min string) bool {
+	return protocolAtLeast(c.ProtocolVersion(), min)
+}
+
 // Connected reports whether the gateway WebSocket session is active.
 func (c *Client) Connected() bool { return c.connected.Load() }
 
+func (c *Client) currentConn() *wsConn {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	return c.conn
+}
+
+func (c *Client) setConn(wc *wsConn) {
+	c.connMu.Lock()
+	c.conn = wc
+	c.connMu.Unlock()
+}
+
 // Run dials the gateway and maintains the connection until ctx is cancelled.
+// It may be called again after it returns; commands queued in between run
+// once it does.
 func (c *Client) Run(ctx context.Context) {
+	wait := c.startWorkers(ctx)
+	defer wait()
 	backoff := time.Second
 	for {
 		if ctx.Err() != nil {
@@ -104,6 +183,19 @@ func (c *Client) Run(ctx context.Context) {
 		if ctx.Err() != nil {
 			return
 		}
+		if errors.Is(err, errPrimaryRecovered) {
+			c.log.Info("primary gateway reachable again; switching back", "url", c.gateways.Active())
+			backoff = time.Second
+			continue
+		}
+		var de *dialError
+		if errors.As(err, &de) && !de.auth() {
+			if next := c.gateways.dialFailed(); next != "" {
+				c.log.Warn("gateway unreachable; failing over", "err", err, "next", next)
+				backoff = time.Second
+				continue
+			}
+		}
 		if err != nil && c.refreshToken != nil && isAuthDialError(err) {
 			if tok, rerr := c.refreshToken(ctx); rerr == nil && tok != "" {
 				c.mu.Lock()
@@ -130,6 +222,23 @@ func (c *Client) Run(ctx context.Context) {
 	}
 }
 
+// dialError marks a session that never connected, as opposed to one that
+// dropped; only these count towards failover. status is the handshake
+// response code, 0 when the gateway was not reached at all.
+type dialError struct {
+	err    error
+	status int
+}
+
+func (e *dialError) Error() string { return "ws dial: " + e.err.Error() }
+func (e *dialError) Unwrap() error { return e.err }
+
+// auth reports a rejected token: the gateway is up, so the fix is a token
+// refresh rather than another endpoint.
+func (e *dialError) auth() bool {
+	return e.status == http.StatusUnauthorized || e.status == http.StatusForbidden
+}
+
 func isAuthDialError(err error) bool {
 	if err == nil {
 		return false
@@ -141,7 +250,7 @@ func isAuthDialError(err error) bool {
 }
 
 func (c *Client) session(ctx context.Context) error {
-	wsURL := strings.Replace(c.gatewayURL, "https://", "wss://", 1)
+	wsURL := strings.Replace(c.gateways.Active(), "https://", "wss://", 1)
 	wsURL = strings.Replace(wsURL, "http://", "ws://", 1)
 	wsURL += "/api/v2/nodes/ws"
 
@@ -152,44 +261,70 @@ func (c *Client) session(ctx context.Context) error {
 	header := http.Header{}
 	header.Set("Authorization", "Bearer "+nodeToken)
 	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second}
-	ws, _, err := dialer.DialContext(ctx, wsURL, header)
+	ws, resp, err := dialer.DialContext(ctx, wsURL, header)
 	if err != nil {
-		return fmt.Errorf("ws dial: %w", err)
+		de := &dialError{err: err}
+		if resp != nil {
+			de.status = resp.StatusCode
+		}
+		return de
 	}
 	defer ws.Close()
+	c.gateways.connected()
 
 	c.log.Info("gateway connected", "url", wsURL)
 	c.connected.Store(true)
 	defer c.connected.Store(false)
 
-	if err := c.sendHello(ws); err != nil {
+	c.mu.Lock()
+	c.protocol = legacyProtocolVersion
+	c.mu.Unlock()
+
+	wc := &wsConn{ws: ws}
+	if err := c.sendHello(wc); err != nil {
+		return err
+	}
+	c.setConn(wc)
+	defer c.setConn(nil)
+	if err := c.resendResults(ctx, wc); err != nil {
 		return err
 	}
 
-	errCh := make(chan error, 2)
-	go func() { errCh <- c.readPump(ctx, ws) }()
-	go func() { errCh <- c.writePump(ctx, ws) }()
+	errCh := make(chan error, 3)
+	go func() { errCh <- c.readPump(wc) }()
+	go func() { errCh <- c.writePump(ctx, wc) }()
+	if !c.gateways.OnPrimary() {
+		watchCtx, stopWatch := context.WithCancel(ctx)
+		defer stopWatch()
+		go func() { errCh <- c.gateways.watchPrimary(watchCtx) }()
+	}
 
 	select {
 	case <-ctx.Done():
-		_ = ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		_ = wc.write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 		return ctx.Err()
 	case err := <-errCh:
 		return err
 	}
 }
 
-func (c *Client) sendHello(ws *websocket.Conn) error {
+func (c *Client) sendHello(wc *wsConn) error {
 	hello := c.snap.BuildHello(c.nodeID)
-	frame, err := wrap(TypeHello, hello)
-	if err != nil {
-		return err
+	hello.Protocol.Version = ProtocolVersion
+	hello.Protocol.MessageTypes = MessageTypes
+	commands := []string{"async", "progress"}
+	if c.journal != nil {
+		commands = append(commands, "idempotent")
+	}
+	if hello.Protocol.Features == nil {
+		hello.Protocol.Features = map[string][]string{}
 	}
-	_ = ws.SetWriteDeadline(time.Now().Add(writeWait))
-	return ws.WriteMessage(websocket.TextMessage, frame)
+	hello.Protocol.Features["commands"] = commands
+	return wc.send(TypeHello, hello)
 }
 
-func (c *Client) readPump(ctx context.Context, ws *websocket.Conn) error {
+func (c *Client) readPump(wc *wsConn) error {
+	ws := wc.ws
 	ws.SetReadLimit(1 << 20)
 	_ = ws.SetReadDeadline(time.Now().Add(pongWait))
 	ws.SetPongHandler(func(string) error {
@@ -201,13 +336,13 @@ func (c *Client) readPump(ctx context.Context, ws *websocket.Conn) error {
 			return err
 		}
 		_ = ws.SetReadDeadline(time.Now().Add(pongWait))
-		if err := c.handleFrame(ctx, ws, raw); err != nil {
+		if err := c.handleFrame(wc, raw); err != nil {
 			c.log.Warn("handle gateway frame", "err", err)
 		}
 	}
 }
 
-func (c *Client) handleFrame(ctx context.Context, ws *websocket.Conn, raw []byte) error {
+func (c *Client) handleFrame(wc *wsConn, raw []byte) error {
 	var env Envelope
 	if err := json.Unmarshal(raw, &env); err != nil {
 		return err
@@ -218,11 +353,17 @@ func (c *Client) handleFrame(ctx context.Context, ws *websocket.Conn, raw []byte
 		if err := json.Unmarshal(env.Data, &ack); err != nil {
 			return err
 		}
+		version, ok := Negotiate(ack.ProtocolVersion)
+		if !ok {
+			c.log.Warn("gateway protocol version incompatible; using 2.0", "gateway", ack.ProtocolVersion, "node", ProtocolVersion)
+		}
+		c.mu.Lock()
 		if ack.HeartbeatIntervalSec > 0 {
-			c.mu.Lock()
 			c.heartbeatSec = ack.HeartbeatIntervalSec
-			c.mu.Unlock()
 		}
+		c.protocol = version
+		c.mu.Unlock()
+		c.log.Info("gateway protocol negotiated", "version", version)
 		if c.onReconnect != nil {
 			c.onReconnect()
 		}
@@ -231,20 +372,94 @@ func (c *Client) handleFrame(ctx context.Context, ws *websocket.Conn, raw []byte
 		if err := json.Unmarshal(env.Data, &cmd); err != nil {
 			return err
 		}
-		res := c.cmds.HandleCommand(ctx, cmd)
-		frame, err := wrap(TypeCommandResult, res)
-		if err != nil {
-			return err
-		}
-		_ = ws.SetWriteDeadline(time.Now().Add(writeWait))
-		return ws.WriteMessage(websocket.TextMessage, frame)
+		return c.enqueue(wc, cmd)
 	default:
 		c.log.Debug("ignore gateway message", "type", env.Type)
 	}
 	return nil
 }
 
-func (c *Client) writePump(ctx context.Context, ws *websocket.Conn) error {
+// runCommand executes cmd once per request ID. ok is false when there is
+// nothing to send yet: a duplicate of a command that is still executing.
+func (c *Client) runCommand(ctx context.Context, cmd Command) (CommandResult, bool) {
+	if c.journal == nil || cmd.RequestID == "" {
+		return c.handle(ctx, cmd), true
+	}
+	prev, run, err := c.journal.begin(ctx, cmd)
+	switch {
+	case err != nil:
+		// Executing unjournaled risks a duplicate on retry; refusing would
+		// stall the control plane on a database error.
+		c.log.Warn("command journal unavailable", "request_id", cmd.RequestID, "err", err)
+		return c.handle(ctx, cmd), true
+	case prev != nil:
+		c.log.Info("duplicate gateway command; returning stored result", "action", cmd.Action, "request_id", cmd.RequestID)
+		return *prev, true
+	case !run:
+		c.log.Info("duplicate gateway command still executing", "action", cmd.Action, "request_id", cmd.RequestID)
+		return CommandResult{}, false
+	}
+	res := c.handle(ctx, cmd)
+	res.RequestID = cmd.RequestID
+	if err := c.journal.finish(ctx, res); err != nil {
+		c.log.Warn("journal command result failed", "request_id", cmd.RequestID, "err", err)
+	}
+	return res, true
+}
+
+// sendResult writes a command result and marks it delivered in the journal.
+func (c *Client) sendResult(ctx context.Context, wc *wsConn, res CommandResult) error {
+	if err := wc.send(TypeCommandResult, res); err != nil {
+		return err
+	}
+	if c.journal != nil && res.RequestID != "" {
+		if err := c.journal.delivered(ctx, res.RequestID); err != nil {
+			c.log.Warn("mark command result delivered failed", "request_id", res.RequestID, "err", err)
+		}
+	}
+	return nil
+}
+
+// resendResults re-sends results that were journaled but never written to a
+// live connection (the WS dropped mid-command, or the node restarted).
+func (c *Client) resendResults(ctx context.Context, wc *wsConn) error {
+	if c.journal == nil {
+		return nil
+	}
+	pending, err := c.journal.pending(ctx)
+	if err != nil {
+		c.log.Warn("load undelivered command results", "err", err)
+	}
+	for _, res := range pending {
+		if err := c.sendResult(ctx, wc, res); err != nil {
+			return err
+		}
+		c.log.Info("re-sent gateway command result", "request_id", res.RequestID)
+	}
+	return nil
+}
+
+func (c *Client) sendHeartbeat(wc *wsConn) error {
+	status := "online"
+	if c.status != nil {
+		status = c.status()
+	}
+	hb := c.snap.BuildHeartbeat(status)
+	if err := wc.send(TypeHeartbeat, hb); err != nil {
+		return err
+	}
+	// Best-effort REST heartbeat keeps org_nodes.last_seen_at in sync when WS is up.
+	go func(h Heartbeat) {
+		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+		defer cancel()
+		if err := PostRESTHeartbeat(ctx, c.gateways.Active(), c.nodeID, c.nodeToken, h); err != nil {
+			c.log.Debug("rest heartbeat failed", "err", err)
+		}
+	}(hb)
+	return nil
+}
+
+func (c *Client) writePump(ctx context.Context, wc *wsConn) error {
 	c.mu.Lock()
 	hbSec := c.heartbeatSec
 	c.mu.Unlock()
@@ -263,40 +478,19 @@ func (c *Client) writePump(ctx context.Context, ws *websocket.Conn) error {
 		case <-ctx.Done():
 			return ctx.Err()
 		case <-hbTicker.C:
-			status := "online"
-			if c.status != nil {
-				status = c.status()
-			}
-			hb := c.snap.BuildHeartbeat(status)
-			frame, err := wrap(TypeHeartbeat, hb)
-			if err != nil {
+			if err := c.sendHeartbeat(wc); err != nil {
 				return err
 			}
-			_ = ws.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := ws.WriteMessage(websocket.TextMessage, frame); err != nil {
+		case <-c.heartbeatNow:
+			if err := c.sendHeartbeat(wc); err != nil {
 				return err
 			}
-			// Best-effort REST heartbeat keeps org_nodes.last_seen_at in sync when WS is up.
-			go func(h Heartbeat) {
-				ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
-				defer cancel()
-				if err := PostRESTHeartbeat(ctx, c.gatewayURL, c.nodeID, c.nodeToken, h); err != nil {
-					c.log.Debug("rest heartbeat failed", "err", err)
-				}
-			}(hb)
 		case <-usageTicker.C:
-			ur := c.snap.BuildUsageReport()
-			frame, err := wrap(TypeUsageReport, ur)
-			if err != nil {
-				return err
-			}
-			_ = ws.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := ws.WriteMessage(websocket.TextMessage, frame); err != nil {
+			if err := wc.send(TypeUsageReport, c.snap.BuildUsageReport()); err != nil {
 				return err
 			}
 		case <-pingTicker.C:
-			_ = ws.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := wc.write(websocket.PingMessage, nil); err != nil {
 				return err
 			}
 		}
@@ -0,0 +1,164 @@
+package gatewayclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	commandWorkers        = 4
+	commandQueueLen       = 32
+	defaultCommandTimeout = 2 * time.Minute
+)
+
+// concurrentActions only read node state, so they run on the worker pool
+// beside other commands. Every other action changes the node and runs on the
+// single ordered worker, in the order the gateway sent it: a drain and the
+// undrain after it, or a resync_peers and a rotation, must not interleave.
+var concurrentActions = map[string]bool{
+	ActionCollectDiagnostics: true,
+}
+
+// commandTimeouts overrides defaultCommandTimeout per action.
+var commandTimeouts = map[string]time.Duration{
+	ActionDrain:                    30 * time.Second,
+	ActionUndrain:                  30 * time.Second,
+	ActionRotateReality:            time.Minute,
+	ActionSyncApps:                 10 * time.Second,
+	ActionSyncFirewall:             3 * time.Minute,
+	ActionResetFirewallCredentials: time.Minute,
+	ActionSetFirewallCredentials:   time.Minute,
+	ActionUpdateGatewayKeys:        30 * time.Second,
+	ActionUpgrade:                  10 * time.Minute,
+}
+
+func commandTimeout(action string) time.Duration {
+	if d, ok := commandTimeouts[action]; ok {
+		return d
+	}
+	return defaultCommandTimeout
+}
+
+type commandJob struct {
+	cmd      Command
+	accepted chan struct{} // closed once command_accepted is written
+}
+
+type progressKey struct{}
+
+// ReportProgress sends a command_progress frame for the command ctx belongs
+// to. Handlers call it between slow stages; it is a no-op outside a command,
+// while the gateway is disconnected, or when it negotiated protocol 2.0.
+func ReportProgress(ctx context.Context, stage string, percent int) {
+	if fn, ok := ctx.Value(progressKey{}).(func(string, int)); ok {
+		fn(stage, percent)
+	}
+}
+
+// startWorkers starts the ordered worker and the worker pool for one Run.
+// They stop with ctx, and the returned wait blocks until they have, so the
+// next Run never has two ordered workers; commands still queued go to its
+// workers. Within a Run workers outlive a session: a result finished after a
+// reconnect goes to the new connection.
+func (c *Client) startWorkers(ctx context.Context) (wait func()) {
+	var wg sync.WaitGroup
+	start := func(queue <-chan commandJob) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.worker(ctx, queue)
+		}()
+	}
+	start(c.queue)
+	for i := 0; i < commandWorkers; i++ {
+		start(c.concurrent)
+	}
+	return wg.Wait
+}
+
+// enqueue hands cmd to its worker and acknowledges it (protocol 2.1+), so a
+// slow command never holds up the read pump. A full queue fails the command
+// at once.
+func (c *Client) enqueue(wc *wsConn, cmd Command) error {
+	job := commandJob{cmd: cmd, accepted: make(chan struct{})}
+	queue := c.queue
+	if concurrentActions[cmd.Action] {
+		queue = c.concurrent
+	}
+	select {
+	case queue <- job:
+	default:
+		c.log.Warn("gateway command queue full", "action", cmd.Action, "request_id", cmd.RequestID)
+		return wc.send(TypeCommandResult, CommandResult{RequestID: cmd.RequestID, Error: "node busy: command queue full"})
+	}
+	defer close(job.accepted)
+	if !c.protocolAtLeast("2.1") {
+		return nil // 2.0 gateways only understand command_result
+	}
+	return wc.send(TypeCommandAccepted, CommandAccepted{
+		RequestID:  cmd.RequestID,
+		Action:     cmd.Action,
+		TimeoutSec: int(commandTimeout(cmd.Action) / time.Second),
+	})
+}
+
+// worker executes the commands on queue until ctx is done.
+func (c *Client) worker(ctx context.Context, queue <-chan commandJob) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-queue:
+			<-job.accepted
+			res, ok := c.runCommand(ctx, job.cmd)
+			if !ok {
+				continue
+			}
+			wc := c.currentConn()
+			if wc == nil {
+				// Journaled results are re-sent after the next hello.
+				c.log.Warn("gateway disconnected; command result not sent", "request_id", res.RequestID)
+				continue
+			}
+			if err := c.sendResult(ctx, wc, res); err != nil {
+				c.log.Warn("send command result failed", "request_id", res.RequestID, "err", err)
+			}
+		}
+	}
+}
+
+// handle runs cmd under its action timeout with progress reporting wired
+// into ctx. A handler still running at the deadline has its context cancelled
+// and the command fails, but only once the handler has returned: until then
+// it may still be changing the node, so neither the journal nor the next
+// ordered command may treat it as finished. Its own result is discarded.
+func (c *Client) handle(ctx context.Context, cmd Command) CommandResult {
+	timeout := commandTimeout(cmd.Action)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, progressKey{}, func(stage string, percent int) {
+		if wc := c.currentConn(); wc != nil && c.protocolAtLeast("2.1") {
+			p := CommandProgress{RequestID: cmd.RequestID, Stage: stage, Percent: percent}
+			if err := wc.send(TypeCommandProgress, p); err != nil {
+				c.log.Debug("send command progress failed", "request_id", cmd.RequestID, "err", err)
+			}
+		}
+	})
+
+	done := make(chan CommandResult, 1)
+	go func() { done <- c.cmds.HandleCommand(ctx, cmd) }()
+	select {
+	case res := <-done:
+		return res
+	case <-ctx.Done():
+		<-done
+		c.log.Warn("gateway command finished after its timeout", "action", cmd.Action, "request_id", cmd.RequestID)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return CommandResult{RequestID: cmd.RequestID, Error: fmt.Sprintf("timed out after %s", timeout)}
+		}
+		return CommandResult{RequestID: cmd.RequestID, Error: "cancelled: node shutting down"}
+	}
+}
@@ -0,0 +1,189 @@
+package gatewayclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type stubSnapshot struct{}
+
+func (stubSnapshot) BuildHello(nodeID string) Hello         { return Hello{NodeID: nodeID} }
+func (stubSnapshot) BuildHeartbeat(status string) Heartbeat { return Heartbeat{Status: status} }
+func (stubSnapshot) BuildUsageReport() UsageReport          { return UsageReport{} }
+
+type handlerFunc func(ctx context.Context, cmd Command) CommandResult
+
+func (f handlerFunc) HandleCommand(ctx context.Context, cmd Command) CommandResult {
+	return f(ctx, cmd)
+}
+
+func TestCommandAcceptedProgressResult(t *testing.T) {
+	frames := make(chan Envelope, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		_, _, _ = ws.ReadMessage() // hello
+		ack, _ := wrap(TypeHelloAck, HelloAck{HeartbeatIntervalSec: 30, ProtocolVersion: "2.1"})
+		_ = ws.WriteMessage(websocket.TextMessage, ack)
+		cmd, _ := wrap(TypeCommand, Command{Action: ActionSyncFirewall, RequestID: "req-1"})
+		_ = ws.WriteMessage(websocket.TextMessage, cmd)
+		for {
+			_, raw, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			var env Envelope
+			_ = json.Unmarshal(raw, &env)
+			frames <- env
+		}
+	}))
+	defer srv.Close()
+
+	h := handlerFunc(func(ctx context.Context, cmd Command) CommandResult {
+		ReportProgress(ctx, "applying policy", 50)
+		return CommandResult{RequestID: cmd.RequestID, OK: true}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := New(srv.URL, "node", "tok", stubSnapshot{}, h, nil)
+	go c.Run(ctx)
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case env := <-frames:
+			if strings.HasPrefix(env.Type, "command_") {
+				got = append(got, env.Type)
+			}
+			if env.Type == TypeCommandProgress {
+				var p CommandProgress
+				if err := json.Unmarshal(env.Data, &p); err != nil || p.RequestID != "req-1" || p.Percent != 50 {
+					t.Fatalf("progress = %+v, %v", p, err)
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out; frames so far %v", got)
+		}
+	}
+	want := []string{TypeCommandAccepted, TypeCommandProgress, TypeCommandResult}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("frames = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	const action = "test_slow"
+	commandTimeouts[action] = 20 * time.Millisecond
+	defer delete(commandTimeouts, action)
+
+	var stopped atomic.Bool
+	h := handlerFunc(func(ctx context.Context, cmd Command) CommandResult {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond) // winding down
+		stopped.Store(true)
+		return CommandResult{RequestID: cmd.RequestID, OK: true}
+	})
+	c := New("http://gw", "node", "tok", nil, h, nil)
+	res := c.handle(context.Background(), Command{Action: action, RequestID: "req-2"})
+	if res.OK || !strings.HasPrefix(res.Error, "timed out") {
+		t.Fatalf("result = %+v", res)
+	}
+	if !stopped.Load() {
+		t.Fatal("timeout reported while the handler was still running")
+	}
+}
+
+func TestStateChangingCommandsRunInOrder(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		running int
+		order   []string
+	)
+	done := make(chan struct{}, 8)
+	h := handlerFunc(func(ctx context.Context, cmd Command) CommandResult {
+		mu.Lock()
+		running++
+		overlap := running > 1
+		order = append(order, cmd.RequestID)
+		mu.Unlock()
+		if overlap {
+			t.Errorf("%s ran alongside another command", cmd.RequestID)
+		}
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		done <- struct{}{}
+		return CommandResult{RequestID: cmd.RequestID, OK: true}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := New("http://gw", "node", "tok", nil, h, nil)
+	c.startWorkers(ctx)
+
+	want := []string{"drain", "undrain", "resync", "rotate"}
+	actions := []string{ActionDrain, ActionUndrain, ActionResyncPeers, ActionRotateReality}
+	for i, id := range want {
+		// A 2.0 session needs no connection to accept a command.
+		if err := c.enqueue(nil, Command{Action: actions[i], RequestID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range want {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("commands did not finish")
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("ran %v, want %v", order, want)
+		}
+	}
+}
+
+func TestWorkersRestartWithRun(t *testing.T) {
+	done := make(chan string, 1)
+	h := handlerFunc(func(_ context.Context, cmd Command) CommandResult {
+		done <- cmd.RequestID
+		return CommandResult{RequestID: cmd.RequestID, OK: true}
+	})
+	c := New("http://gw", "node", "tok", nil, h, nil)
+
+	// The supervisor stops the gateway component, then starts it again.
+	first, stop := context.WithCancel(context.Background())
+	wait := c.startWorkers(first)
+	stop()
+	wait()
+	if err := c.enqueue(nil, Command{Action: ActionDrain, RequestID: "queued"}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.startWorkers(ctx)
+	select {
+	case id := <-done:
+		if id != "queued" {
+			t.Fatalf("ran %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command queued between runs never ran")
+	}
+}
@@ -0,0 +1,39 @@
+package gatewayclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// UploadDiagnostics posts a diagnostics bundle (tar.gz) to the gateway with
+// the node's control-plane token. id and sha256 identify the bundle so the
+// gateway can match it to the collect_diagnostics result.
+func (c *Client) UploadDiagnostics(ctx context.Context, id, sha256 string, bundle io.Reader) error {
+	c.mu.Lock()
+	token := c.nodeToken
+	c.mu.Unlock()
+	url := c.gateways.Active() + "/api/v2/nodes/" + c.nodeID + "/diagnostics"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bundle)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/gzip")
+	req.Header.Set("X-Erebrus-Bundle-Id", id)
+	req.Header.Set("X-Erebrus-Bundle-Sha256", sha256)
+	client := &http.Client{Timeout: 2 * time.Minute}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("upload diagnostics: %d %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	return nil
+}
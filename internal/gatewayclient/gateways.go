@@ -0,0 +1,159 @@
+package gatewayclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// failoverAfter is how many consecutive dial failures move the client to
+	// the next gateway endpoint.
+	failoverAfter = 3
+	// primaryProbeInterval is how often a session on a fallback endpoint
+	// checks whether the primary is back.
+	primaryProbeInterval = time.Minute
+)
+
+// errPrimaryRecovered ends a session on a fallback endpoint so the client
+// reconnects to the primary.
+var errPrimaryRecovered = errors.New("primary gateway recovered")
+
+// Gateways is the ordered list of gateway endpoints, primary first. The WS
+// client moves down the list after failoverAfter consecutive dial failures
+// (wrapping around to the primary) and back to the primary once it answers
+// again. Node credentials are issued for the node, not the endpoint, so one
+// registration and token work on every entry. REST calls follow Active.
+type Gateways struct {
+	urls []string
+
+	mu       sync.Mutex
+	active   int
+	failures int
+}
+
+// NewGateways returns the endpoint list. Empty entries and trailing slashes
+// are dropped.
+func NewGateways(urls []string) *Gateways {
+	g := &Gateways{}
+	for _, u := range urls {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			g.urls = append(g.urls, u)
+		}
+	}
+	return g
+}
+
+// URLs returns every endpoint, primary first.
+func (g *Gateways) URLs() []string { return append([]string(nil), g.urls...) }
+
+// Active is the endpoint currently in use ("" when the list is empty).
+func (g *Gateways) Active() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.urls) == 0 {
+		return ""
+	}
+	return g.urls[g.active]
+}
+
+// OnPrimary reports whether the active endpoint is the primary.
+func (g *Gateways) OnPrimary() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.active == 0
+}
+
+// dialFailed records a failed dial of the active endpoint and fails over
+// once failoverAfter have happened in a row. It returns the endpoint
+// switched to, or "" when the client should keep retrying the same one.
+func (g *Gateways) dialFailed() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.failures++
+	if g.failures < failoverAfter || len(g.urls) < 2 {
+		return ""
+	}
+	g.failures = 0
+	g.active = (g.active + 1) % len(g.urls)
+	return g.urls[g.active]
+}
+
+// connected resets the failure count after a successful dial.
+func (g *Gateways) connected() {
+	g.mu.Lock()
+	g.failures = 0
+	g.mu.Unlock()
+}
+
+func (g *Gateways) use(i int) {
+	g.mu.Lock()
+	g.active, g.failures = i, 0
+	g.mu.Unlock()
+}
+
+// Try runs fn against the active endpoint, then each other endpoint in
+// list order, until one succeeds; that endpoint becomes active. It is for
+// one-shot calls made before the control plane is up, such as registration.
+func (g *Gateways) Try(ctx context.Context, fn func(base string) error) error {
+	if len(g.urls) == 0 {
+		return errors.New("no gateway URL configured")
+	}
+	g.mu.Lock()
+	start := g.active
+	g.mu.Unlock()
+	var errs []error
+	for n := 0; n < len(g.urls); n++ {
+		i := (start + n) % len(g.urls)
+		err := fn(g.urls[i])
+		if err == nil {
+			g.use(i)
+			return nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", g.urls[i], err))
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// probe reports whether base is serving: any non-5xx answer to a plain GET
+// of the WS path (which the gateway rejects without an upgrade) counts as
+// up, while a 5xx from a proxy in front of it or a dial error does not.
+func probe(ctx context.Context, base string) bool {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/api/v2/nodes/ws", nil)
+	if err != nil {
+		return false
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode < http.StatusInternalServerError
+}
+
+// watchPrimary returns errPrimaryRecovered once the primary answers, after
+// which Active is the primary again. It only runs while on a fallback.
+func (g *Gateways) watchPrimary(ctx context.Context) error {
+	t := time.NewTicker(primaryProbeInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			if probe(ctx, g.urls[0]) {
+				g.use(0)
+				return errPrimaryRecovered
+			}
+		}
+	}
+}
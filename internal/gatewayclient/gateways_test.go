@@ -0,0 +1,131 @@
+package gatewayclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestGatewaysFailoverOrder(t *testing.T) {
+	g := NewGateways([]string{"https://a/", "", "https://b", "https://c"})
+	if got := g.URLs(); len(got) != 3 || got[0] != "https://a" {
+		t.Fatalf("URLs = %v", got)
+	}
+	for _, want := range []string{"https://b", "https://c", "https://a"} {
+		for i := 1; i < failoverAfter; i++ {
+			if next := g.dialFailed(); next != "" {
+				t.Fatalf("failed over after %d failures", i)
+			}
+		}
+		if next := g.dialFailed(); next != want || g.Active() != want {
+			t.Fatalf("failed over to %q (active %q), want %q", next, g.Active(), want)
+		}
+	}
+
+	// A successful dial resets the count.
+	g.dialFailed()
+	g.connected()
+	for i := 1; i < failoverAfter; i++ {
+		if g.dialFailed() != "" {
+			t.Fatal("failure count not reset by connected")
+		}
+	}
+
+	single := NewGateways([]string{"https://a"})
+	for i := 0; i < 2*failoverAfter; i++ {
+		if single.dialFailed() != "" {
+			t.Fatal("single endpoint failed over")
+		}
+	}
+}
+
+func TestGatewaysTry(t *testing.T) {
+	g := NewGateways([]string{"https://a", "https://b", "https://c"})
+	var tried []string
+	err := g.Try(context.Background(), func(base string) error {
+		tried = append(tried, base)
+		if base == "https://c" {
+			return nil
+		}
+		return errors.New("down")
+	})
+	if err != nil || len(tried) != 3 || g.Active() != "https://c" {
+		t.Fatalf("err = %v, tried %v, active %q", err, tried, g.Active())
+	}
+
+	// The next call starts from the endpoint that worked.
+	tried = nil
+	err = g.Try(context.Background(), func(base string) error {
+		tried = append(tried, base)
+		return errors.New("down")
+	})
+	if err == nil || len(tried) != 3 || tried[0] != "https://c" {
+		t.Fatalf("err = %v, tried %v", err, tried)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "upgrade required", http.StatusBadRequest)
+	}))
+	defer up.Close()
+	proxied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer proxied.Close()
+
+	if !probe(context.Background(), up.URL) {
+		t.Error("gateway rejecting a plain GET reported down")
+	}
+	if probe(context.Background(), proxied.URL) {
+		t.Error("502 from a proxy reported up")
+	}
+	if probe(context.Background(), "http://127.0.0.1:1") {
+		t.Error("closed port reported up")
+	}
+}
+
+func TestClientFailsOverToSecondary(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	hellos := make(chan struct{}, 1)
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		if _, _, err := ws.ReadMessage(); err == nil {
+			hellos <- struct{}{}
+		}
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer secondary.Close()
+
+	g := NewGateways([]string{primary.URL, secondary.URL})
+	c := New(primary.URL, "node", "tok", stubSnapshot{}, handlerFunc(nil), nil)
+	c.SetGateways(g)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+
+	select {
+	case <-hellos:
+	case <-time.After(15 * time.Second):
+		t.Fatal("client never reached the secondary gateway")
+	}
+	if g.Active() != secondary.URL || g.OnPrimary() {
+		t.Fatalf("active = %q, want secondary", g.Active())
+	}
+}
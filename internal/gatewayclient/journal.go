@@ -0,0 +1,96 @@
+package gatewayclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/store"
+)
+
+// commandRetention is how long finished command results are kept for
+// duplicate request IDs.
+const commandRetention = 24 * time.Hour
+
+// Journal persists gateway command request IDs and results so a retried
+// RequestID returns the stored result instead of executing again, and results
+// lost with a dropped connection are re-sent after reconnect.
+type Journal struct {
+	st        *store.Store
+	retention time.Duration
+}
+
+// NewJournal returns a journal backed by the node database.
+func NewJournal(st *store.Store) *Journal {
+	return &Journal{st: st, retention: commandRetention}
+}
+
+// Recover fails commands a previous process left running: whether they took
+// effect is unknown, so the gateway gets an explicit error to act on rather
+// than silence. Call once before the client connects.
+func (j *Journal) Recover(ctx context.Context) error {
+	running, err := j.st.ListGatewayCommands(ctx, store.CommandRunning, false)
+	if err != nil {
+		return err
+	}
+	for _, c := range running {
+		res := CommandResult{RequestID: c.RequestID, Error: "interrupted: node restarted while executing " + c.Action}
+		if err := j.finish(ctx, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// begin journals cmd. run is false when the request ID was seen before; prev
+// is then its stored result, or nil while it is still executing.
+func (j *Journal) begin(ctx context.Context, cmd Command) (prev *CommandResult, run bool, err error) {
+	existing, started, err := j.st.BeginGatewayCommand(ctx, cmd.RequestID, cmd.Action)
+	if err != nil || started {
+		return nil, started, err
+	}
+	if existing.Status != store.CommandDone {
+		return nil, false, nil
+	}
+	var res CommandResult
+	if err := json.Unmarshal([]byte(existing.Result), &res); err != nil {
+		return nil, false, err
+	}
+	return &res, false, nil
+}
+
+func (j *Journal) finish(ctx context.Context, res CommandResult) error {
+	raw, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	return j.st.FinishGatewayCommand(ctx, res.RequestID, string(raw))
+}
+
+func (j *Journal) delivered(ctx context.Context, requestID string) error {
+	return j.st.MarkGatewayCommandDelivered(ctx, requestID)
+}
+
+// pending returns finished results the gateway has not received, oldest
+// first, after dropping results past the retention window.
+func (j *Journal) pending(ctx context.Context) ([]CommandResult, error) {
+	if _, err := j.st.PruneGatewayCommands(ctx, time.Now().Add(-j.retention)); err != nil {
+		return nil, err
+	}
+	rows, err := j.st.ListGatewayCommands(ctx, store.CommandDone, true)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]CommandResult, 0, len(rows))
+	var errs []error
+	for _, c := range rows {
+		var res CommandResult
+		if err := json.Unmarshal([]byte(c.Result), &res); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		out = append(out, res)
+	}
+	return out, errors.Join(errs...)
+}
@@ -0,0 +1,74 @@
+package gatewayclient
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/NetSepio/erebrus/internal/store"
+)
+
+type countingHandler struct{ calls map[string]int }
+
+func (h *countingHandler) HandleCommand(_ context.Context, cmd Command) CommandResult {
+	h.calls[cmd.RequestID]++
+	return CommandResult{RequestID: cmd.RequestID, OK: true}
+}
+
+func TestJournalReturnsStoredResultForDuplicate(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	ctx := context.Background()
+	h := &countingHandler{calls: map[string]int{}}
+	c := New("http://gw", "node", "tok", nil, h, nil)
+	c.SetJournal(NewJournal(st))
+
+	cmd := Command{Action: ActionResyncPeers, RequestID: "req-1"}
+	first, ok := c.runCommand(ctx, cmd)
+	if !ok || !first.OK {
+		t.Fatalf("first = %+v, %v", first, ok)
+	}
+	again, ok := c.runCommand(ctx, cmd)
+	if !ok || !reflect.DeepEqual(again, first) {
+		t.Fatalf("duplicate = %+v, %v", again, ok)
+	}
+	if h.calls["req-1"] != 1 {
+		t.Fatalf("executed %d times", h.calls["req-1"])
+	}
+
+	// Never written to a connection: still pending for the next session.
+	pending, err := c.journal.pending(ctx)
+	if err != nil || len(pending) != 1 || pending[0].RequestID != "req-1" {
+		t.Fatalf("pending = %+v, %v", pending, err)
+	}
+	if err := c.journal.delivered(ctx, "req-1"); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := c.journal.pending(ctx); len(pending) != 0 {
+		t.Fatalf("pending after delivery = %+v", pending)
+	}
+}
+
+func TestJournalRecoverFailsInterruptedCommands(t *testing.T) {
+	st, err := store.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	ctx := context.Background()
+	if _, _, err := st.BeginGatewayCommand(ctx, "req-2", ActionResyncPeers); err != nil {
+		t.Fatal(err)
+	}
+	j := NewJournal(st)
+	if err := j.Recover(ctx); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := j.pending(ctx)
+	if err != nil || len(pending) != 1 || pending[0].OK || pending[0].Error == "" {
+		t.Fatalf("pending = %+v, %v", pending, err)
+	}
+}
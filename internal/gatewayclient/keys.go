@@ -0,0 +1,90 @@
+package gatewayclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/gatewayauth"
+)
+
+const settingGatewayKeys = "gateway_public_keys"
+
+// storedKeySet is the persisted form of the trusted gateway keys.
+type storedKeySet struct {
+	IssuedAt time.Time         `json:"issued_at"`
+	Keys     []gatewayauth.Key `json:"keys"`
+}
+
+// LoadGatewayKeys builds the trusted key set: the last verified update if one
+// was persisted, otherwise the single key saved at registration (fallback).
+func LoadGatewayKeys(ctx context.Context, st SettingsStore, fallback string) (*gatewayauth.KeySet, error) {
+	raw, err := st.GetSetting(ctx, settingGatewayKeys)
+	if err != nil {
+		return nil, err
+	}
+	if raw != "" {
+		var stored storedKeySet
+		if err := json.Unmarshal([]byte(raw), &stored); err != nil {
+			return nil, fmt.Errorf("parse %s: %w", settingGatewayKeys, err)
+		}
+		ks := gatewayauth.NewKeySet()
+		if err := ks.Replace(stored.Keys, stored.IssuedAt); err == nil {
+			return ks, nil
+		}
+	}
+	if fallback == "" {
+		return gatewayauth.NewKeySet(), nil
+	}
+	return gatewayauth.NewKeySet(gatewayauth.Key{PublicKey: fallback}), nil
+}
+
+// ApplyGatewayKeyUpdate verifies a gateway-signed key set against the keys
+// currently trusted, persists it and swaps it into ks.
+func ApplyGatewayKeyUpdate(ctx context.Context, st SettingsStore, ks *gatewayauth.KeySet, token string) error {
+	keys, issuedAt, err := gatewayauth.VerifyKeySetUpdate(token, ks, time.Now())
+	if err != nil {
+		return err
+	}
+	raw, _ := json.Marshal(storedKeySet{IssuedAt: issuedAt, Keys: keys})
+	if err := st.SetSetting(ctx, settingGatewayKeys, string(raw)); err != nil {
+		return err
+	}
+	return ks.Replace(keys, issuedAt)
+}
+
+// FetchGatewayKeys downloads the gateway's current signed key set.
+func FetchGatewayKeys(ctx context.Context, gatewayURL string) (string, error) {
+	base := strings.TrimRight(strings.TrimSpace(gatewayURL), "/")
+	if base == "" {
+		return "", fmt.Errorf("gateway URL is required")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/api/v2/gateway/keys", nil)
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetch gateway keys: %d: %s", resp.StatusCode, truncate(raw))
+	}
+	var out struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return "", fmt.Errorf("parse gateway keys: %w", err)
+	}
+	if out.Token == "" {
+		return "", fmt.Errorf("gateway returned empty key set")
+	}
+	return out.Token, nil
+}
@@ -8,6 +8,10 @@ package gatewayclient
 
 import "encoding/json"
 
+// ProtocolVersion is the newest control-plane protocol revision this node
+// speaks. Minor revisions are additive; see Negotiate.
+const ProtocolVersion = "2.1"
+
 // Message types.
 const (
 	TypeHello         = "hello"
@@ -16,8 +20,17 @@ const (
 	TypeUsageReport   = "usage_report"
 	TypeCommand       = "command"
 	TypeCommandResult = "command_result"
+
+	TypeCommandAccepted = "command_accepted"
+	TypeCommandProgress = "command_progress"
 )
 
+// MessageTypes lists every frame type this node sends or understands.
+var MessageTypes = []string{
+	TypeHello, TypeHelloAck, TypeHeartbeat, TypeUsageReport,
+	TypeCommand, TypeCommandResult, TypeCommandAccepted, TypeCommandProgress,
+}
+
 // Command actions (v2.0).
 const (
 	ActionDrain                    = "drain"
@@ -29,8 +42,15 @@ const (
 	ActionRestartFirewall          = "restart_firewall"
 	ActionResetFirewallCredentials = "reset_firewall_credentials"
 	ActionSetFirewallCredentials   = "set_firewall_credentials"
+	ActionUpdateGatewayKeys        = "update_gateway_keys"
+	ActionCollectDiagnostics       = "collect_diagnostics"
+	ActionUpgrade                  = "upgrade"
 )
 
+// CodeUnsupportedAction marks a command_result for an action the node does
+// not implement or cannot run in its current configuration.
+const CodeUnsupportedAction = "unsupported_action"
+
 // Envelope wraps every WebSocket frame: {"type": "...", "data": {...}}.
 type Envelope struct {
 	Type string          `json:"type"`
@@ -68,9 +88,21 @@ type DropCapability struct {
 
 // Endpoints describes the connection endpoints clients dial.
 type Endpoints struct {
-	WireGuard    WireGuardEndpoint `json:"wireguard"`
-	VLESSReality VLESSEndpoint     `json:"vless_reality"`
-	Hysteria2    Hysteria2Endpoint `json:"hysteria2"`
+	WireGuard    WireGuardEndpoint  `json:"wireguard"`
+	VLESSReality VLESSEndpoint      `json:"vless_reality"`
+	Hysteria2    Hysteria2Endpoint  `json:"hysteria2"`
+	TUIC         *TUICEndpoint      `json:"tuic,omitempty"`
+	WebSocketTLS *WebSocketEndpoint `json:"websocket_tls,omitempty"`
+	HTTPSConnect *ConnectEndpoint   `json:"https_connect,omitempty"`
+	API          *APIEndpoint       `json:"api,omitempty"`
+}
+
+// APIEndpoint is the node management API. CertSHA256 is the hex SHA-256 of
+// the served leaf certificate; the gateway pins it when set (self-signed and
+// operator certificates) and falls back to WebPKI validation when empty (ACME).
+type APIEndpoint struct {
+	BaseURL    string `json:"base_url"`
+	CertSHA256 string `json:"cert_sha256,omitempty"`
 }
 
 type WireGuardEndpoint struct {
@@ -91,6 +123,29 @@ type Hysteria2Endpoint struct {
 	Obfs string `json:"obfs"`
 }
 
+// TUICEndpoint is the TUIC v5 carrier, on the node's host and the Hysteria2
+// SNI. The UUID and password are in each peer's credential bundle.
+type TUICEndpoint struct {
+	Port              int    `json:"port"`
+	CongestionControl string `json:"congestion_control"`
+}
+
+// WebSocketEndpoint is the CDN-fronted VLESS over WebSocket+TLS carrier.
+// Clients dial Host (the CDN hostname, also the TLS SNI and HTTP Host) on
+// Port and upgrade on Path.
+type WebSocketEndpoint struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	Path string `json:"path"`
+}
+
+// ConnectEndpoint is the HTTPS CONNECT (naive) carrier. Clients dial Host,
+// also the TLS SNI, on Port.
+type ConnectEndpoint struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
 // Hello is sent by the node on every (re)connect.
 type Hello struct {
 	NodeID            string            `json:"node_id"`
@@ -101,11 +156,24 @@ type Hello struct {
 	Endpoints         Endpoints         `json:"endpoints"`
 	DeploymentProfile string            `json:"deployment_profile,omitempty"`
 	Services          map[string]string `json:"services,omitempty"`
+	Protocol          Protocol          `json:"protocol"`
 }
 
-// HelloAck is the gateway's response to hello.
+// Protocol advertises what the node implements so the gateway can send only
+// actions and frames the node understands. Features maps an area (stealth,
+// drop, commands) to the flags the node supports in it.
+type Protocol struct {
+	Version      string              `json:"version"`
+	Actions      []string            `json:"actions,omitempty"`
+	MessageTypes []string            `json:"message_types,omitempty"`
+	Features     map[string][]string `json:"features,omitempty"`
+}
+
+// HelloAck is the gateway's response to hello. ProtocolVersion is the
+// version the gateway negotiated; gateways older than 2.1 omit it.
 type HelloAck struct {
-	HeartbeatIntervalSec int `json:"heartbeat_interval_sec"`
+	HeartbeatIntervalSec int    `json:"heartbeat_interval_sec"`
+	ProtocolVersion      string `json:"protocol_version,omitempty"`
 }
 
 // Load is the node's coarse load snapshot.
@@ -130,12 +198,22 @@ type Speedtest struct {
 // Heartbeat is sent every heartbeat_interval_sec.
 type Heartbeat struct {
 	TS        int64             `json:"ts"`
-	Status    string            `json:"status"` // online | draining
+	Status    string            `json:"status"` // online | draining | drained
 	Load      Load              `json:"load"`
 	Speedtest Speedtest         `json:"speedtest"`
 	Versions  map[string]string `json:"versions"`
 	Services  map[string]string `json:"services,omitempty"`
 	Drop      *DropStatus       `json:"drop,omitempty"`
+	Drain     *DrainStatus      `json:"drain,omitempty"`
+}
+
+// DrainStatus details an in-progress or finished drain so the gateway can
+// steer remaining clients to the target node.
+type DrainStatus struct {
+	Deadline     int64  `json:"deadline,omitempty"` // unix seconds; 0 = no deadline
+	TargetNodeID string `json:"target_node_id,omitempty"`
+	Remaining    int    `json:"remaining"`
+	DrainedAt    int64  `json:"drained_at,omitempty"`
 }
 
 // DropStatus reports Kubo health and capacity to the gateway.
@@ -168,11 +246,31 @@ type Command struct {
 	Args      json.RawMessage `json:"args,omitempty"`
 }
 
-// CommandResult is node → gateway.
+// CommandResult is node → gateway. Code is a machine-readable reason for
+// failures the gateway may act on, such as CodeUnsupportedAction. Data is
+// the action's structured output, if it has any.
 type CommandResult struct {
+	RequestID string          `json:"request_id"`
+	OK        bool            `json:"ok"`
+	Error     string          `json:"error"`
+	Code      string          `json:"code,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// CommandAccepted is node → gateway, sent as soon as a command is queued.
+// The final command_result follows within TimeoutSec.
+type CommandAccepted struct {
+	RequestID  string `json:"request_id"`
+	Action     string `json:"action"`
+	TimeoutSec int    `json:"timeout_sec"`
+}
+
+// CommandProgress is node → gateway while a command runs. Percent is 0 when
+// the handler cannot estimate it.
+type CommandProgress struct {
 	RequestID string `json:"request_id"`
-	OK        bool   `json:"ok"`
-	Error     string `json:"error"`
+	Stage     string `json:"stage"`
+	Percent   int    `json:"percent,omitempty"`
 }
 
 func wrap(msgType string, payload any) ([]byte, error) {
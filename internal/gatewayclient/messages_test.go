@@ -133,3 +133,27 @@ func TestDropCapabilityRoundTrip(t *testing.T) {
 		t.Fatalf("drop capability = %+v", got.Capabilities.Drop)
 	}
 }
+
+func TestNegotiateProtocol(t *testing.T) {
+	cases := []struct {
+		gateway string
+		want    string
+		ok      bool
+	}{
+		{"", "2.0", true},
+		{"2.0", "2.0", true},
+		{"2.1", "2.1", true},
+		{"2.7", ProtocolVersion, true},
+		{"3.0", "2.0", false},
+		{"garbage", "2.0", false},
+	}
+	for _, tc := range cases {
+		got, ok := Negotiate(tc.gateway)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("Negotiate(%q) = %q, %v; want %q, %v", tc.gateway, got, ok, tc.want, tc.ok)
+		}
+	}
+	if !protocolAtLeast("2.1", "2.1") || protocolAtLeast("2.0", "2.1") || !protocolAtLeast("3.0", "2.1") {
+		t.Error("protocolAtLeast ordering wrong")
+	}
+}
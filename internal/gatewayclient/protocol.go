@@ -0,0 +1,49 @@
+package gatewayclient
+
+import (
+	"strconv"
+	"strings"
+)
+
+// legacyProtocolVersion is assumed for gateways whose hello_ack carries no
+// protocol_version.
+const legacyProtocolVersion = "2.0"
+
+// Negotiate returns the protocol version node and gateway share given the
+// version from hello_ack: the lower of the two, or 2.0 when the gateway
+// predates negotiation. ok is false when the major versions differ or the
+// gateway's version does not parse; callers then stay on 2.0 behaviour.
+func Negotiate(gateway string) (version string, ok bool) {
+	if gateway == "" {
+		return legacyProtocolVersion, true
+	}
+	gMajor, gMinor, gok := parseProtocolVersion(gateway)
+	nMajor, nMinor, _ := parseProtocolVersion(ProtocolVersion)
+	if !gok || gMajor != nMajor {
+		return legacyProtocolVersion, false
+	}
+	if gMinor < nMinor {
+		return gateway, true
+	}
+	return ProtocolVersion, true
+}
+
+// protocolAtLeast reports whether version v includes revision min.
+func protocolAtLeast(v, min string) bool {
+	vMajor, vMinor, ok1 := parseProtocolVersion(v)
+	mMajor, mMinor, ok2 := parseProtocolVersion(min)
+	if !ok1 || !ok2 {
+		return false
+	}
+	return vMajor > mMajor || vMajor == mMajor && vMinor >= mMinor
+}
+
+func parseProtocolVersion(v string) (major, minor int, ok bool) {
+	maj, min, found := strings.Cut(strings.TrimPrefix(v, "v"), ".")
+	if !found {
+		return 0, 0, false
+	}
+	major, err1 := strconv.Atoi(maj)
+	minor, err2 := strconv.Atoi(min)
+	return major, minor, err1 == nil && err2 == nil
+}
@@ -39,6 +39,7 @@ type RegistrationInput struct {
 	Region              string
 	Zone                string
 	APIBaseURL          string
+	APICertSHA256       string // pin for APIBaseURL; empty when WebPKI-validated
 	NodeKey             string // optional; gateway mints if empty
 	AccessMode          string // public | private
 	DeploymentProfile   string // standard | shield | sentinel
@@ -181,6 +182,7 @@ func Register(ctx context.Context, in RegistrationInput) (*RegistrationResult, e
 		"region":             in.Region,
 		"zone":               in.Zone,
 		"api_base_url":       in.APIBaseURL,
+		"api_cert_sha256":    in.APICertSHA256,
 		"node_key":           in.NodeKey,
 		"access_mode":        access,
 		"deployment_profile": strings.TrimSpace(in.DeploymentProfile),
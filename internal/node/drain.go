@@ -0,0 +1,185 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// Drain states. draining refuses new peers and waits for connected ones to
+// leave; drained has disconnected everyone that remained.
+const (
+	StatusOnline   = "online"
+	StatusDraining = "draining"
+	StatusDrained  = "drained"
+)
+
+const (
+	settingDrainState = "drain_state"
+	drainPollInterval = 5 * time.Second
+)
+
+// DrainState is the persisted drain lifecycle. It lives in node_settings so
+// it survives restarts and can be set by the drain CLI while the node runs.
+type DrainState struct {
+	Status    string    `json:"status"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+	// Deadline is when remaining peers are disconnected; zero waits for all
+	// peers to leave on their own.
+	Deadline time.Time `json:"deadline,omitempty"`
+	// Target is the node peer_id clients should move to, if any.
+	Target string `json:"target,omitempty"`
+	// Remaining is the number of peers with a recent WireGuard handshake.
+	Remaining int       `json:"remaining"`
+	DrainedAt time.Time `json:"drained_at,omitempty"`
+}
+
+// Active reports whether the node is refusing new peers.
+func (d DrainState) Active() bool {
+	return d.Status == StatusDraining || d.Status == StatusDrained
+}
+
+// LoadDrainState reads the persisted drain state; a missing row is online.
+func LoadDrainState(ctx context.Context, st SettingsStore) (DrainState, error) {
+	raw, err := st.GetSetting(ctx, settingDrainState)
+	if err != nil {
+		return DrainState{Status: StatusOnline}, err
+	}
+	return parseDrainState(raw)
+}
+
+func parseDrainState(raw string) (DrainState, error) {
+	if raw == "" {
+		return DrainState{Status: StatusOnline}, nil
+	}
+	var d DrainState
+	if err := json.Unmarshal([]byte(raw), &d); err != nil {
+		return DrainState{Status: StatusOnline}, err
+	}
+	if d.Status == "" {
+		d.Status = StatusOnline
+	}
+	return d, nil
+}
+
+// SaveDrainState persists the drain state.
+func SaveDrainState(ctx context.Context, st SettingsStore, d DrainState) error {
+	raw, _ := json.Marshal(d)
+	return st.SetSetting(ctx, settingDrainState, string(raw))
+}
+
+// SettingsStore is the node_settings subset drain persistence needs.
+type SettingsStore interface {
+	GetSetting(ctx context.Context, key string) (string, error)
+	SetSetting(ctx context.Context, key, value string) error
+}
+
+// DrainState returns the current in-memory drain state.
+func (s *Service) DrainState() DrainState {
+	s.drainMu.RLock()
+	defer s.drainMu.RUnlock()
+	return s.drain
+}
+
+// SetDrainHook is called after every drain status change (e.g. to push a
+// heartbeat to the gateway immediately).
+func (s *Service) SetDrainHook(fn func(DrainState)) { s.onDrain = fn }
+
+// Drain starts draining with an optional deadline and target node.
+func (s *Service) Drain(ctx context.Context, deadline time.Time, target string) error {
+	s.drainOp.Lock()
+	defer s.drainOp.Unlock()
+	d := DrainState{Status: StatusDraining, StartedAt: time.Now().UTC(), Deadline: deadline, Target: target}
+	if err := SaveDrainState(ctx, s.st, d); err != nil {
+		return err
+	}
+	return s.applyDrain(ctx, d)
+}
+
+// Undrain returns the node to service and reconnects suspended peers.
+func (s *Service) Undrain(ctx context.Context) error {
+	s.drainOp.Lock()
+	defer s.drainOp.Unlock()
+	d := DrainState{Status: StatusOnline}
+	if err := SaveDrainState(ctx, s.st, d); err != nil {
+		return err
+	}
+	return s.applyDrain(ctx, d)
+}
+
+// RunDrain restores the persisted drain state, then follows it until ctx is
+// done: counting connected peers, disconnecting them at the deadline (or
+// once none remain) and picking up changes made by the drain CLI.
+func (s *Service) RunDrain(ctx context.Context) {
+	s.drainTick(ctx)
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.drainTick(ctx)
+		}
+	}
+}
+
+// drainTick adopts the persisted drain state and advances a drain in
+// progress. The advance is written only if the row is unchanged since it was
+// read, so a concurrent `drain --cancel` from the CLI or a gateway undrain is
+// never overwritten; the next tick follows it instead.
+func (s *Service) drainTick(ctx context.Context) {
+	s.drainOp.Lock()
+	defer s.drainOp.Unlock()
+	raw, err := s.st.GetSetting(ctx, settingDrainState)
+	if err != nil {
+		slog.Warn("load drain state failed", "err", err)
+		return
+	}
+	d, err := parseDrainState(raw)
+	if err != nil {
+		slog.Warn("load drain state failed", "err", err)
+		return
+	}
+	if d.Status == StatusDraining {
+		d.Remaining = s.wg.Stats().Connected
+		if d.Remaining == 0 || (!d.Deadline.IsZero() && time.Now().After(d.Deadline)) {
+			d.Status = StatusDrained
+			d.DrainedAt = time.Now().UTC()
+		}
+		next, _ := json.Marshal(d)
+		switch ok, err := s.st.SwapSetting(ctx, settingDrainState, raw, string(next)); {
+		case err != nil:
+			slog.Warn("persist drain state failed", "err", err)
+		case !ok:
+			slog.Info("drain state changed while advancing it; following the new state")
+			return
+		}
+	}
+	if err := s.applyDrain(ctx, d); err != nil {
+		slog.Warn("apply drain state failed", "status", d.Status, "err", err)
+	}
+}
+
+// applyDrain adopts d in memory and, on a status change, suspends or resumes
+// live WireGuard peers and notifies the hooks.
+func (s *Service) applyDrain(ctx context.Context, d DrainState) error {
+	s.drainMu.Lock()
+	prev := s.drain.Status
+	s.drain = d
+	s.drainMu.Unlock()
+	if prev == d.Status {
+		return nil
+	}
+	slog.Info("drain status changed", "from", prev, "to", d.Status,
+		"remaining", d.Remaining, "deadline", d.Deadline, "target", d.Target)
+	err := s.wg.SetSuspended(ctx, d.Status == StatusDrained)
+	if s.apiStatus != nil {
+		s.apiStatus(d.Status)
+	}
+	if s.onDrain != nil {
+		s.onDrain(d)
+	}
+	return err
+}
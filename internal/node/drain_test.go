@@ -0,0 +1,147 @@
+package node
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/config"
+	"github.com/NetSepio/erebrus/internal/store"
+	"github.com/NetSepio/erebrus/internal/wg"
+)
+
+// fakeWG is a WireGuard device with a settable number of connected peers
+// that records the live peer set.
+type fakeWG struct {
+	mu        sync.Mutex
+	connected int
+	live      []string // peer ids on the device
+}
+
+func (f *fakeWG) BringUp(string, string) error { return nil }
+
+func (f *fakeWG) SyncPeers(_ string, peers []*store.Peer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.live = f.live[:0]
+	for _, p := range peers {
+		f.live = append(f.live, p.ID)
+	}
+	return nil
+}
+
+func (f *fakeWG) Stats(string) (wg.DeviceStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return wg.DeviceStats{Connected: f.connected}, nil
+}
+
+func (f *fakeWG) PeerTransfers(string) ([]wg.PeerTransfer, error) { return nil, nil }
+
+func (f *fakeWG) setConnected(n int) {
+	f.mu.Lock()
+	f.connected = n
+	f.mu.Unlock()
+}
+
+func (f *fakeWG) livePeers() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.live...)
+}
+
+func newTestService(t *testing.T) (*Service, *store.Store, *fakeWG) {
+	t.Helper()
+	dir := t.TempDir()
+	st, err := store.Open(filepath.Join(dir, "node.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	live := config.NewLive(&config.Config{
+		WGConfDir: filepath.Join(dir, "wg"), WGInterface: "wg0",
+		WGIPv4Subnet: "10.8.0.1/24", WGEndpointHost: "vpn.example.com", WGEndpointPort: "51820",
+	})
+	dev := &fakeWG{}
+	wgm := wg.New(live, st, dev)
+	if err := wgm.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return New(live, st, wgm, nil, nil), st, dev
+}
+
+func TestDrainWaitsForPeersThenDeadline(t *testing.T) {
+	ctx := context.Background()
+	s, st, dev := newTestService(t)
+	dev.setConnected(2)
+
+	if err := s.Drain(ctx, time.Now().Add(time.Hour), "node-b"); err != nil {
+		t.Fatal(err)
+	}
+	s.drainTick(ctx)
+	if d := s.DrainState(); d.Status != StatusDraining || d.Remaining != 2 || d.Target != "node-b" {
+		t.Fatalf("before the deadline: %+v", d)
+	}
+
+	// Past the deadline the remaining peers are cut off.
+	if err := s.Drain(ctx, time.Now().Add(-time.Second), ""); err != nil {
+		t.Fatal(err)
+	}
+	s.drainTick(ctx)
+	d, err := LoadDrainState(ctx, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Status != StatusDrained || d.DrainedAt.IsZero() || s.DrainState().Status != StatusDrained {
+		t.Fatalf("after the deadline: stored %+v, live %+v", d, s.DrainState())
+	}
+}
+
+func TestDrainEndsWhenPeersLeave(t *testing.T) {
+	ctx := context.Background()
+	s, _, dev := newTestService(t)
+	dev.setConnected(1)
+	if err := s.Drain(ctx, time.Time{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	s.drainTick(ctx)
+	if got := s.DrainState().Status; got != StatusDraining {
+		t.Fatalf("status with a peer left = %s", got)
+	}
+	dev.setConnected(0)
+	s.drainTick(ctx)
+	if got := s.DrainState().Status; got != StatusDrained {
+		t.Fatalf("status once peers left = %s", got)
+	}
+	if err := s.Undrain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.DrainState().Status; got != StatusOnline {
+		t.Fatalf("status after undrain = %s", got)
+	}
+}
+
+func TestDrainCancelDuringDrain(t *testing.T) {
+	ctx := context.Background()
+	s, st, dev := newTestService(t)
+	dev.setConnected(3)
+	if err := s.Drain(ctx, time.Now().Add(-time.Second), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// `erebrus-node drain --cancel` from another process writes the row
+	// directly; the running node follows it instead of finishing the drain.
+	if err := SaveDrainState(ctx, st, DrainState{Status: StatusOnline}); err != nil {
+		t.Fatal(err)
+	}
+	s.drainTick(ctx)
+	d, err := LoadDrainState(ctx, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Status != StatusOnline || s.DrainState().Status != StatusOnline {
+		t.Fatalf("after cancel: stored %+v, live %+v", d, s.DrainState())
+	}
+}
@@ -8,12 +8,15 @@ import (
 	"sync"
 	"time"
 
+	"github.com/NetSepio/erebrus/internal/diag"
 	droppkg "github.com/NetSepio/erebrus/internal/drop"
 	"github.com/NetSepio/erebrus/internal/firewall"
+	"github.com/NetSepio/erebrus/internal/gatewayauth"
 	"github.com/NetSepio/erebrus/internal/gatewayclient"
 	"github.com/NetSepio/erebrus/internal/registrar"
 	"github.com/NetSepio/erebrus/internal/serviceagent"
 	"github.com/NetSepio/erebrus/internal/speedtest"
+	"github.com/NetSepio/erebrus/internal/upgrade"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
 )
@@ -29,8 +32,14 @@ type GatewayBridge struct {
 	fw        *firewall.Client
 	drop      *droppkg.Service
 
-	mu     sync.RWMutex
-	status string
+	mu sync.RWMutex
+
+	apiBaseURL    string
+	apiCertSHA256 string
+
+	gatewayKeys *gatewayauth.KeySet
+	diagnostics func(ctx context.Context, upload bool) (diag.Result, error)
+	upgrader    func(ctx context.Context, manifestURL string) (*upgrade.State, error)
 
 	lastUsage map[string]usageCounters
 }
@@ -51,30 +60,42 @@ func NewGatewayBridge(svc *Service, peerID, did, nodeID string, speedtestCache *
 		agent:     agent,
 		fw:        fw,
 		drop:      dropService,
-		status:    "online",
 		lastUsage: map[string]usageCounters{},
 	}
 }
 
-// Status returns the node's operational status for heartbeats.
+// Status returns the node's drain status (online | draining | drained) for
+// heartbeats.
 func (g *GatewayBridge) Status() string {
-	g.mu.RLock()
-	defer g.mu.RUnlock()
-	return g.status
+	return g.svc.DrainState().Status
 }
 
-// SetStatus sets online/draining and updates the public API status mirror.
-func (g *GatewayBridge) SetStatus(status string) {
+// SetAPIEndpoint records the management API URL and certificate pin
+// advertised in hello.
+func (g *GatewayBridge) SetAPIEndpoint(baseURL, certSHA256 string) {
 	g.mu.Lock()
-	g.status = status
+	g.apiBaseURL, g.apiCertSHA256 = baseURL, certSHA256
 	g.mu.Unlock()
-	if g.svc.apiStatus != nil {
-		g.svc.apiStatus(status)
-	}
+}
+
+// SetGatewayKeys supplies the trusted key set update_gateway_keys rotates.
+func (g *GatewayBridge) SetGatewayKeys(ks *gatewayauth.KeySet) {
+	g.gatewayKeys = ks
+}
+
+// SetDiagnostics supplies the bundle collector collect_diagnostics runs.
+func (g *GatewayBridge) SetDiagnostics(fn func(ctx context.Context, upload bool) (diag.Result, error)) {
+	g.diagnostics = fn
+}
+
+// SetUpgrader supplies the self-update upgrade runs. It must only install
+// releases newer than the running one.
+func (g *GatewayBridge) SetUpgrader(fn func(ctx context.Context, manifestURL string) (*upgrade.State, error)) {
+	g.upgrader = fn
 }
 
 func (g *GatewayBridge) BuildHello(_ string) gatewayclient.Hello {
-	cfg := g.svc.cfg
+	cfg := g.svc.cfg.Load()
 	eps := gatewayclient.Endpoints{
 		WireGuard: gatewayclient.WireGuardEndpoint{
 			Host:      cfg.WGEndpointHost,
@@ -98,7 +119,21 @@ func (g *GatewayBridge) BuildHello(_ string) gatewayclient.Hello {
 			Port: cfg.Hysteria2PortInt(),
 			Obfs: obfs,
 		}
+		if p.TUICPort != 0 {
+			eps.TUIC = &gatewayclient.TUICEndpoint{Port: p.TUICPort, CongestionControl: "bbr"}
+		}
+		if p.WSHost != "" {
+			eps.WebSocketTLS = &gatewayclient.WebSocketEndpoint{Host: p.WSHost, Port: p.WSPort, Path: p.WSPath}
+		}
+		if p.ConnectHost != "" {
+			eps.HTTPSConnect = &gatewayclient.ConnectEndpoint{Host: p.ConnectHost, Port: p.ConnectPort}
+		}
+	}
+	g.mu.RLock()
+	if g.apiBaseURL != "" {
+		eps.API = &gatewayclient.APIEndpoint{BaseURL: g.apiBaseURL, CertSHA256: g.apiCertSHA256}
 	}
+	g.mu.RUnlock()
 	return gatewayclient.Hello{
 		NodeID:  g.peerID,
 		Version: cfg.Version,
@@ -121,14 +156,76 @@ func (g *GatewayBridge) BuildHello(_ string) gatewayclient.Hello {
 		Endpoints:         eps,
 		DeploymentProfile: cfg.ErebrusProfile,
 		Services:          g.serviceSnapshot(),
+		Protocol: gatewayclient.Protocol{
+			Actions:  g.supportedActions(),
+			Features: g.features(),
+		},
 	}
 }
 
+// supportedActions lists the command actions this node can run as
+// configured; anything else is answered with CodeUnsupportedAction.
+func (g *GatewayBridge) supportedActions() []string {
+	actions := []string{
+		gatewayclient.ActionDrain, gatewayclient.ActionUndrain,
+		gatewayclient.ActionResyncPeers, gatewayclient.ActionSyncApps,
+	}
+	if g.gatewayKeys != nil {
+		actions = append(actions, gatewayclient.ActionUpdateGatewayKeys)
+	}
+	if g.svc.stealth != nil {
+		actions = append(actions, gatewayclient.ActionRotateReality)
+	}
+	if g.diagnostics != nil {
+		actions = append(actions, gatewayclient.ActionCollectDiagnostics)
+	}
+	if g.upgrader != nil {
+		actions = append(actions, gatewayclient.ActionUpgrade)
+	}
+	if g.fw != nil {
+		actions = append(actions,
+			gatewayclient.ActionSyncFirewall, gatewayclient.ActionRestartFirewall,
+			gatewayclient.ActionResetFirewallCredentials, gatewayclient.ActionSetFirewallCredentials)
+	}
+	return actions
+}
+
+// features advertises the stealth carriers and Drop operations the node
+// serves. Areas the node does not serve are omitted.
+func (g *GatewayBridge) features() map[string][]string {
+	out := map[string][]string{}
+	if g.svc.stealth != nil && g.svc.stealth.Enabled() {
+		cfg := g.svc.cfg.Load()
+		stealth := []string{"vless_reality", "hysteria2"}
+		if cfg.TUICCarrierEnabled() {
+			stealth = append(stealth, "tuic")
+		}
+		if cfg.WebSocketCarrierEnabled() {
+			stealth = append(stealth, "websocket_tls")
+		}
+		if cfg.HTTPSConnectCarrierEnabled() {
+			stealth = append(stealth, "https_connect")
+		}
+		out["stealth"] = stealth
+	}
+	if g.drop != nil && g.drop.Enabled() {
+		ops := []string{"status", "upload", "read", "pin_check", "unpin"}
+		if g.drop.AcceptsPublicUploads() {
+			ops = append(ops, "public_upload")
+		}
+		if g.drop.WebUIAvailable() {
+			ops = append(ops, "webui")
+		}
+		out["drop"] = ops
+	}
+	return out
+}
+
 func (g *GatewayBridge) BuildHeartbeat(status string) gatewayclient.Heartbeat {
 	live := g.svc.wg.Stats()
 	peers, _ := g.svc.st.ListPeers(context.Background())
 	versions := map[string]string{
-		"node":    g.svc.cfg.Version,
+		"node":    g.svc.cfg.Load().Version,
 		"singbox": "1.11.15",
 	}
 	var dropStatus *gatewayclient.DropStatus
@@ -159,6 +256,7 @@ func (g *GatewayBridge) BuildHeartbeat(status string) gatewayclient.Heartbeat {
 		Versions:  versions,
 		Services:  g.serviceSnapshot(),
 		Drop:      dropStatus,
+		Drain:     g.drainStatus(),
 	}
 }
 
@@ -243,15 +341,38 @@ func (g *GatewayBridge) HandleCommand(ctx context.Context, cmd gatewayclient.Com
 	res := gatewayclient.CommandResult{RequestID: cmd.RequestID, OK: true}
 	switch cmd.Action {
 	case gatewayclient.ActionDrain:
-		g.SetStatus("draining")
+		var args struct {
+			DeadlineSec  int64  `json:"deadline_sec"`
+			TargetNodeID string `json:"target_node_id"`
+		}
+		if len(cmd.Args) > 0 {
+			if err := json.Unmarshal(cmd.Args, &args); err != nil || args.DeadlineSec < 0 {
+				res.OK = false
+				res.Error = "invalid args"
+				return res
+			}
+		}
+		var deadline time.Time
+		if args.DeadlineSec > 0 {
+			deadline = time.Now().Add(time.Duration(args.DeadlineSec) * time.Second).UTC()
+		}
+		if err := g.svc.Drain(ctx, deadline, args.TargetNodeID); err != nil {
+			res.OK = false
+			res.Error = err.Error()
+		}
 	case gatewayclient.ActionUndrain:
-		g.SetStatus("online")
+		if err := g.svc.Undrain(ctx); err != nil {
+			res.OK = false
+			res.Error = err.Error()
+		}
 	case gatewayclient.ActionRotateReality:
 		if g.svc.stealth == nil {
 			res.OK = false
 			res.Error = "stealth not enabled"
+			res.Code = gatewayclient.CodeUnsupportedAction
 			return res
 		}
+		gatewayclient.ReportProgress(ctx, "rotating reality keys", 0)
 		if _, err := g.svc.stealth.RotateReality(ctx); err != nil {
 			res.OK = false
 			res.Error = err.Error()
@@ -281,8 +402,10 @@ func (g *GatewayBridge) HandleCommand(ctx context.Context, cmd gatewayclient.Com
 		if g.fw == nil {
 			res.OK = false
 			res.Error = "firewall not configured"
+			res.Code = gatewayclient.CodeUnsupportedAction
 			return res
 		}
+		gatewayclient.ReportProgress(ctx, "applying firewall policy", 0)
 		if err := g.fw.Sync(ctx, cmd.Args); err != nil {
 			res.OK = false
 			res.Error = err.Error()
@@ -291,8 +414,10 @@ func (g *GatewayBridge) HandleCommand(ctx context.Context, cmd gatewayclient.Com
 		if g.fw == nil {
 			res.OK = false
 			res.Error = "firewall not configured"
+			res.Code = gatewayclient.CodeUnsupportedAction
 			return res
 		}
+		gatewayclient.ReportProgress(ctx, "reloading firewall", 0)
 		if err := g.fw.Restart(ctx); err != nil {
 			res.OK = false
 			res.Error = err.Error()
@@ -301,6 +426,7 @@ func (g *GatewayBridge) HandleCommand(ctx context.Context, cmd gatewayclient.Com
 		if g.fw == nil {
 			res.OK = false
 			res.Error = "firewall not configured"
+			res.Code = gatewayclient.CodeUnsupportedAction
 			return res
 		}
 		if err := g.fw.ResetCredentials(ctx); err != nil {
@@ -311,6 +437,7 @@ func (g *GatewayBridge) HandleCommand(ctx context.Context, cmd gatewayclient.Com
 		if g.fw == nil {
 			res.OK = false
 			res.Error = "firewall not configured"
+			res.Code = gatewayclient.CodeUnsupportedAction
 			return res
 		}
 		var args struct {
@@ -326,13 +453,107 @@ func (g *GatewayBridge) HandleCommand(ctx context.Context, cmd gatewayclient.Com
 			res.OK = false
 			res.Error = err.Error()
 		}
+	case gatewayclient.ActionUpdateGatewayKeys:
+		if g.gatewayKeys == nil {
+			res.OK = false
+			res.Error = "gateway keys not configured"
+			return res
+		}
+		var args struct {
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal(cmd.Args, &args); err != nil || args.Token == "" {
+			res.OK = false
+			res.Error = "invalid args"
+			return res
+		}
+		if err := gatewayclient.ApplyGatewayKeyUpdate(ctx, g.svc.st, g.gatewayKeys, args.Token); err != nil {
+			res.OK = false
+			res.Error = err.Error()
+		}
+	case gatewayclient.ActionCollectDiagnostics:
+		if g.diagnostics == nil {
+			res.OK = false
+			res.Error = "diagnostics not available"
+			res.Code = gatewayclient.CodeUnsupportedAction
+			return res
+		}
+		args := struct {
+			Upload *bool `json:"upload"`
+		}{}
+		if len(cmd.Args) > 0 {
+			if err := json.Unmarshal(cmd.Args, &args); err != nil {
+				res.OK = false
+				res.Error = "invalid args"
+				return res
+			}
+		}
+		upload := args.Upload == nil || *args.Upload
+		bundle, err := g.diagnostics(ctx, upload)
+		if err != nil {
+			res.OK = false
+			res.Error = err.Error()
+		}
+		if bundle.ID != "" {
+			res.Data, _ = json.Marshal(bundle)
+		}
+	case gatewayclient.ActionUpgrade:
+		if g.upgrader == nil {
+			res.OK = false
+			res.Error = "self-update not available"
+			res.Code = gatewayclient.CodeUnsupportedAction
+			return res
+		}
+		var args struct {
+			ManifestURL string `json:"manifest_url"`
+			Force       bool   `json:"force"`
+		}
+		if len(cmd.Args) > 0 {
+			if err := json.Unmarshal(cmd.Args, &args); err != nil {
+				res.OK = false
+				res.Error = "invalid args"
+				return res
+			}
+		}
+		// A signed release is not necessarily a current one: the gateway may
+		// only move the node forward. Downgrades stay a local decision
+		// (`erebrus-node upgrade --force`).
+		if args.Force {
+			res.OK = false
+			res.Error = "force is not accepted from the gateway; downgrade locally with erebrus-node upgrade --force"
+			return res
+		}
+		state, err := g.upgrader(ctx, args.ManifestURL)
+		if err != nil {
+			res.OK = false
+			res.Error = err.Error()
+		}
+		if state != nil {
+			res.Data, _ = json.Marshal(state)
+		}
 	default:
 		res.OK = false
-		res.Error = "unknown action"
+		res.Error = fmt.Sprintf("unsupported action %q", cmd.Action)
+		res.Code = gatewayclient.CodeUnsupportedAction
 	}
 	return res
 }
 
+func (g *GatewayBridge) drainStatus() *gatewayclient.DrainStatus {
+	d := g.svc.DrainState()
+	if !d.Active() {
+		return nil
+	}
+	out := &gatewayclient.DrainStatus{TargetNodeID: d.Target, Remaining: d.Remaining}
+	if !d.Deadline.IsZero() {
+		out.Deadline = d.Deadline.Unix()
+	}
+	if !d.DrainedAt.IsZero() {
+		out.DrainedAt = d.DrainedAt.Unix()
+	}
+	return out
+}
+
 func hostMemMB() int {
 	vm, err := mem.VirtualMemory()
 	if err != nil {
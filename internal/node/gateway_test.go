@@ -0,0 +1,56 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/NetSepio/erebrus/internal/diag"
+	"github.com/NetSepio/erebrus/internal/gatewayauth"
+	"github.com/NetSepio/erebrus/internal/gatewayclient"
+	"github.com/NetSepio/erebrus/internal/upgrade"
+)
+
+func TestSupportedActions(t *testing.T) {
+	s, _, _ := newTestService(t)
+	g := NewGatewayBridge(s, "peer", "did:example", "node", nil, nil, nil, nil)
+	optional := []string{
+		gatewayclient.ActionUpdateGatewayKeys, gatewayclient.ActionCollectDiagnostics,
+		gatewayclient.ActionRotateReality, gatewayclient.ActionUpgrade, gatewayclient.ActionSyncFirewall,
+	}
+	for _, a := range optional {
+		if slices.Contains(g.supportedActions(), a) {
+			t.Errorf("%s advertised without its dependency", a)
+		}
+	}
+
+	g.SetGatewayKeys(gatewayauth.NewKeySet())
+	g.SetDiagnostics(func(context.Context, bool) (diag.Result, error) { return diag.Result{}, nil })
+	for _, a := range optional[:2] {
+		if !slices.Contains(g.supportedActions(), a) {
+			t.Errorf("%s not advertised once configured", a)
+		}
+	}
+}
+
+func TestGatewayUpgradeRefusesForce(t *testing.T) {
+	s, _, _ := newTestService(t)
+	g := NewGatewayBridge(s, "peer", "did:example", "node", nil, nil, nil, nil)
+	var calls []string
+	g.SetUpgrader(func(_ context.Context, manifestURL string) (*upgrade.State, error) {
+		calls = append(calls, manifestURL)
+		return &upgrade.State{Status: upgrade.StatusPending}, nil
+	})
+	ctx := context.Background()
+
+	res := g.HandleCommand(ctx, gatewayclient.Command{Action: gatewayclient.ActionUpgrade, Args: json.RawMessage(`{"manifest_url":"https://old.example/m.json","force":true}`)})
+	if res.OK || !strings.Contains(res.Error, "force") || len(calls) != 0 {
+		t.Fatalf("forced upgrade = %+v, upgrader calls %v", res, calls)
+	}
+	res = g.HandleCommand(ctx, gatewayclient.Command{Action: gatewayclient.ActionUpgrade, Args: json.RawMessage(`{"manifest_url":"https://new.example/m.json"}`)})
+	if !res.OK || len(calls) != 1 || calls[0] != "https://new.example/m.json" {
+		t.Fatalf("upgrade = %+v, upgrader calls %v", res, calls)
+	}
+}
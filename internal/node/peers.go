@@ -0,0 +1,120 @@
+package node
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/stealth"
+	"github.com/NetSepio/erebrus/internal/store"
+)
+
+const (
+	settingPeersChanged = "peers_changed"
+	settingPeersApplied = "peers_applied"
+	peerSyncInterval    = 2 * time.Second
+)
+
+// SetPeerEnabled suspends or resumes a peer. A suspended peer keeps its
+// address and credentials but is left off the live interface, and its
+// carrier credentials stop working.
+func (s *Service) SetPeerEnabled(ctx context.Context, id string, enabled bool) error {
+	if err := s.st.SetPeerEnabled(ctx, id, enabled); err != nil {
+		return err
+	}
+	return s.applyPeers(ctx)
+}
+
+// applyPeers pushes the stored peers to the carrier users and the live
+// WireGuard interface.
+func (s *Service) applyPeers(ctx context.Context) error {
+	if err := s.SyncCarrierUsers(ctx); err != nil {
+		return err
+	}
+	return s.wg.Apply(ctx)
+}
+
+// SyncCarrierUsers gives the stealth carriers one user per enabled peer,
+// carrying the peer's own VLESS UUID and Hysteria2 password. No-op without
+// stealth.
+func (s *Service) SyncCarrierUsers(ctx context.Context) error {
+	if s.stealth == nil {
+		return nil
+	}
+	peers, err := s.st.ListPeers(ctx)
+	if err != nil {
+		return err
+	}
+	users := make([]stealth.User, 0, len(peers))
+	for _, p := range peers {
+		if p.Enabled {
+			users = append(users, peerUser(p))
+		}
+	}
+	s.stealth.SetUsers(users)
+	return nil
+}
+
+func peerUser(p *store.Peer) stealth.User {
+	return stealth.User{Name: p.ID, UUID: p.ProxyUUID, Password: p.ProxyPassword}
+}
+
+// MarkPeersChanged records that peers were edited in the store by another
+// process (the peers CLI). The running node applies them to the live
+// interface within peerSyncInterval; the returned token is what
+// PeersApplied waits for.
+func MarkPeersChanged(ctx context.Context, st SettingsStore) (string, error) {
+	token := strconv.FormatInt(time.Now().UnixNano(), 10)
+	return token, st.SetSetting(ctx, settingPeersChanged, token)
+}
+
+// PeersApplied reports whether the running node has applied the change
+// MarkPeersChanged returned token for.
+func PeersApplied(ctx context.Context, st SettingsStore, token string) (bool, error) {
+	applied, err := st.GetSetting(ctx, settingPeersApplied)
+	if err != nil || applied == "" {
+		return false, err
+	}
+	// Applying a newer change applies this one too.
+	a, _ := strconv.ParseInt(applied, 10, 64)
+	t, _ := strconv.ParseInt(token, 10, 64)
+	return a >= t, nil
+}
+
+// RunPeerSync re-applies WireGuard and the carrier users whenever MarkPeersChanged is called,
+// until ctx is done.
+func (s *Service) RunPeerSync(ctx context.Context) {
+	seen, _ := s.st.GetSetting(ctx, settingPeersChanged)
+	ticker := time.NewTicker(peerSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			seen = s.peerSyncTick(ctx, seen)
+		}
+	}
+}
+
+// peerSyncTick applies the peers if MarkPeersChanged was called since seen,
+// and returns the change token it has now applied.
+func (s *Service) peerSyncTick(ctx context.Context, seen string) string {
+	token, err := s.st.GetSetting(ctx, settingPeersChanged)
+	if err != nil || token == seen {
+		return seen
+	}
+	if err := s.applyPeers(ctx); err != nil {
+		slog.Warn("apply peer changes failed", "err", err)
+		return seen
+	}
+	if s.metrics != nil {
+		s.updatePeerGauge(ctx)
+	}
+	slog.Info("applied peer changes from the peers CLI")
+	if err := s.st.SetSetting(ctx, settingPeersApplied, token); err != nil {
+		slog.Warn("persist peer sync state failed", "err", err)
+	}
+	return token
+}
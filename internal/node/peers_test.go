@@ -0,0 +1,118 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/NetSepio/erebrus/internal/api"
+	"github.com/NetSepio/erebrus/internal/store"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// addPeer provisions a peer with a fresh WireGuard key and returns the key.
+func addPeer(t *testing.T, s *Service, id string) string {
+	t.Helper()
+	key, err := wgtypes.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := key.PublicKey().String()
+	if _, err := s.UpsertPeer(context.Background(), id, api.PeerRequest{Name: id, WGPublicKey: pub}); err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+func TestSetPeerEnabled(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newTestService(t)
+	alice, bob := addPeer(t, s, "alice"), addPeer(t, s, "bob")
+	if err := s.SetPeerEnabled(ctx, "ghost", false); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("unknown peer: %v", err)
+	}
+
+	rendered := func() string {
+		t.Helper()
+		b, err := os.ReadFile(filepath.Join(s.cfg.Load().WGConfDir, "wg0.conf"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	if err := s.SetPeerEnabled(ctx, "bob", false); err != nil {
+		t.Fatal(err)
+	}
+	if conf := rendered(); !strings.Contains(conf, alice) || strings.Contains(conf, bob) {
+		t.Fatalf("config with bob suspended:\n%s", conf)
+	}
+	if err := s.SetPeerEnabled(ctx, "bob", true); err != nil {
+		t.Fatal(err)
+	}
+	if conf := rendered(); !strings.Contains(conf, alice) || !strings.Contains(conf, bob) {
+		t.Fatalf("config with bob resumed:\n%s", conf)
+	}
+}
+
+func TestPeersApplied(t *testing.T) {
+	ctx := context.Background()
+	s, st, dev := newTestService(t)
+	seen, _ := st.GetSetting(ctx, settingPeersChanged)
+
+	// The peers CLI writes the store directly, then marks the change.
+	if _, err := st.UpsertPeer(ctx, &store.Peer{ID: "alice", Name: "alice", Enabled: true}, "10.8.0.1/24", store.GeneratedCreds{}); err != nil {
+		t.Fatal(err)
+	}
+	first, err := MarkPeersChanged(ctx, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := PeersApplied(ctx, st, first); err != nil || ok {
+		t.Fatalf("applied before any sync = %v, %v", ok, err)
+	}
+	if seen = s.peerSyncTick(ctx, seen); seen != first {
+		t.Fatalf("tick applied %q, want %q", seen, first)
+	}
+	if ok, _ := PeersApplied(ctx, st, first); !ok {
+		t.Fatal("change not reported applied")
+	}
+	if !slices.Contains(dev.livePeers(), "alice") {
+		t.Fatalf("live peers = %v", dev.livePeers())
+	}
+
+	// A later change is pending until the next tick; applying it covers the
+	// earlier token too.
+	second, err := MarkPeersChanged(ctx, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second <= first {
+		t.Fatalf("tokens out of order: %q then %q", first, second)
+	}
+	if ok, _ := PeersApplied(ctx, st, second); ok {
+		t.Fatal("later change reported applied before the tick")
+	}
+	if seen = s.peerSyncTick(ctx, seen); seen != second {
+		t.Fatalf("tick applied %q, want %q", seen, second)
+	}
+	for _, tok := range []string{first, second} {
+		if ok, _ := PeersApplied(ctx, st, tok); !ok {
+			t.Fatalf("token %q not reported applied", tok)
+		}
+	}
+
+	// Nothing new: the tick leaves the applied token alone.
+	if err := st.SetSetting(ctx, settingPeersApplied, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.peerSyncTick(ctx, seen); got != second {
+		t.Fatalf("idle tick returned %q", got)
+	}
+	if v, _ := st.GetSetting(ctx, settingPeersApplied); v != "" {
+		t.Fatalf("idle tick wrote %q", v)
+	}
+}
@@ -8,9 +8,12 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/NetSepio/erebrus/internal/api"
+	"github.com/NetSepio/erebrus/internal/carriers"
 	"github.com/NetSepio/erebrus/internal/config"
 	"github.com/NetSepio/erebrus/internal/stealth"
 	"github.com/NetSepio/erebrus/internal/store"
@@ -21,22 +24,30 @@ import (
 
 // Service provisions peers across all protocols and renders credential bundles.
 type Service struct {
-	cfg       *config.Config
+	cfg       *config.Live
 	st        *store.Store
 	wg        *wg.Manager
 	stealth   *stealth.Manager
 	metrics   *telemetry.Metrics
 	startedAt time.Time
 	apiStatus func(string)
+	onDrain   func(DrainState)
+
+	drainOp sync.Mutex // serializes drain transitions: Drain, Undrain, drainTick
+	drainMu sync.RWMutex
+	drain   DrainState
 }
 
 // New constructs the node service. stealthMgr may be nil when the stealth
 // carriers are not in use.
-func New(cfg *config.Config, st *store.Store, wgm *wg.Manager, stealthMgr *stealth.Manager, m *telemetry.Metrics) *Service {
-	return &Service{cfg: cfg, st: st, wg: wgm, stealth: stealthMgr, metrics: m, startedAt: time.Now()}
+func New(cfg *config.Live, st *store.Store, wgm *wg.Manager, stealthMgr *stealth.Manager, m *telemetry.Metrics) *Service {
+	return &Service{
+		cfg: cfg, st: st, wg: wgm, stealth: stealthMgr, metrics: m, startedAt: time.Now(),
+		drain: DrainState{Status: StatusOnline},
+	}
 }
 
-// SetAPIStatusHook mirrors drain/online state to the HTTP /api/v2/status field.
+// SetAPIStatusHook mirrors online/draining/drained state to the HTTP /api/v2/status field.
 func (s *Service) SetAPIStatusHook(fn func(string)) { s.apiStatus = fn }
 
 // ResyncPeers deletes local peers not present in the authoritative peer_ids list
@@ -71,20 +82,30 @@ func (s *Service) ResyncPeers(ctx context.Context, keep []string) ([]string, err
 // Stats returns coarse public aggregates for the local dashboard. It exposes
 // only totals — never per-client rows.
 func (s *Service) Stats(ctx context.Context) (*api.NodeStats, error) {
+	cfg := s.cfg.Load()
 	peers, err := s.st.ListPeers(ctx)
 	if err != nil {
 		return nil, err
 	}
 	live := s.wg.Stats()
 	protocols := []string{"wireguard"}
-	if s.cfg.EnableStealth {
+	if cfg.EnableStealth {
 		protocols = append(protocols, "vless-reality", "hysteria2")
 	}
+	if cfg.TUICCarrierEnabled() {
+		protocols = append(protocols, "tuic")
+	}
+	if cfg.WebSocketCarrierEnabled() {
+		protocols = append(protocols, "vless-ws")
+	}
+	if cfg.HTTPSConnectCarrierEnabled() {
+		protocols = append(protocols, "https-connect")
+	}
 	return &api.NodeStats{
 		Status:         "online",
-		Version:        s.cfg.Version,
-		Region:         s.cfg.Region,
-		Zone:           s.cfg.Zone,
+		Version:        cfg.Version,
+		Region:         cfg.Region,
+		Zone:           cfg.Zone,
 		Protocols:      protocols,
 		TotalPeers:     len(peers),
 		ConnectedPeers: live.Connected,
@@ -96,7 +117,7 @@ func (s *Service) Stats(ctx context.Context) (*api.NodeStats, error) {
 
 // UpsertPeer creates or updates a peer and returns its credential bundle. The
 // store allocates the WireGuard IP and persists generated proxy credentials
-// atomically; the WireGuard interface is then synced live.
+// atomically; the WireGuard interface and carrier users are then synced live.
 func (s *Service) UpsertPeer(ctx context.Context, id string, req api.PeerRequest) (*api.CredentialBundle, error) {
 	if id == "" {
 		id = uuid.NewString()
@@ -118,7 +139,12 @@ func (s *Service) UpsertPeer(ctx context.Context, id string, req api.PeerRequest
 	if err != nil {
 		return nil, err
 	}
-	if err := s.wg.Apply(ctx); err != nil {
+	if s.stealth != nil && peer.ProxyUUID == gen.ProxyUUID {
+		if err := carriers.RecordPeer(ctx, s.st, peerUser(peer)); err != nil {
+			slog.Warn("record peer carrier credentials failed", "peer", peer.ID, "err", err)
+		}
+	}
+	if err := s.applyPeers(ctx); err != nil {
 		return nil, err
 	}
 	if s.metrics != nil {
@@ -128,12 +154,16 @@ func (s *Service) UpsertPeer(ctx context.Context, id string, req api.PeerRequest
 	return s.buildBundle(peer)
 }
 
-// DeletePeer removes a peer and re-syncs WireGuard. Idempotent.
+// DeletePeer removes a peer and re-syncs WireGuard and the carrier users,
+// which ends its carrier sessions. Idempotent.
 func (s *Service) DeletePeer(ctx context.Context, id string) error {
 	if err := s.st.DeletePeer(ctx, id); err != nil {
 		return err
 	}
-	if err := s.wg.Apply(ctx); err != nil {
+	if err := carriers.RevokePeer(ctx, s.st, id); err != nil {
+		slog.Warn("revoke peer carrier credentials failed", "peer", id, "err", err)
+	}
+	if err := s.applyPeers(ctx); err != nil {
 		return err
 	}
 	if s.metrics != nil {
@@ -169,13 +199,14 @@ func (s *Service) ListPeers(ctx context.Context) ([]api.PeerInfo, error) {
 }
 
 func (s *Service) buildBundle(p *store.Peer) (*api.CredentialBundle, error) {
+	cfg := s.cfg.Load()
 	conf, err := s.wg.ClientConfig(p)
 	if err != nil {
 		return nil, err
 	}
 	bundle := &api.CredentialBundle{
 		BundleVersion: api.BundleVersion,
-		NodeID:        s.cfg.NodeID,
+		NodeID:        cfg.NodeID,
 		ID:            p.ID,
 		IssuedAt:      time.Now().Unix(),
 		ExpiresAt:     p.ExpiresAt,
@@ -184,7 +215,7 @@ func (s *Service) buildBundle(p *store.Peer) (*api.CredentialBundle, error) {
 			ServerPublicKey: s.wg.ServerPublicKey(),
 			Endpoint:        s.wg.Endpoint(),
 			Address:         p.WGAllowedIP,
-			DNS:             s.cfg.WGDNS,
+			DNS:             cfg.WGDNS,
 		},
 	}
 	// Stealth carriers (when enabled): the same WireGuard tunnel, wrapped in a
@@ -192,9 +223,9 @@ func (s *Service) buildBundle(p *store.Peer) (*api.CredentialBundle, error) {
 	if s.stealth != nil && s.stealth.Enabled() {
 		label := p.Name
 		if label == "" {
-			label = s.cfg.NodeName
+			label = cfg.NodeName
 		}
-		ps := s.stealth.BuildPeer(label, s.wg.ServerPublicKey(), p.WGAllowedIP, p.WGPresharedKey)
+		ps := s.stealth.BuildPeer(peerUser(p), label, s.wg.ServerPublicKey(), p.WGAllowedIP, p.WGPresharedKey)
 		bundle.VLESSURI = ps.VLESSURI
 		bundle.Hysteria2URI = ps.Hysteria2URI
 		bundle.SingboxProfile = ps.SingboxProfile
@@ -203,6 +234,15 @@ func (s *Service) buildBundle(p *store.Peer) (*api.CredentialBundle, error) {
 			{Kind: "vless_reality_tcp", URI: ps.VLESSURI},
 			{Kind: "hysteria2_quic_udp", URI: ps.Hysteria2URI},
 		}
+		if ps.TUICURI != "" {
+			bundle.Transports = append(bundle.Transports, api.TransportEntry{Kind: "tuic_quic_udp", URI: ps.TUICURI})
+		}
+		if ps.WebSocketURI != "" {
+			bundle.Transports = append(bundle.Transports, api.TransportEntry{Kind: "websocket_tls_tcp", URI: ps.WebSocketURI})
+		}
+		if ps.NaiveURI != "" {
+			bundle.Transports = append(bundle.Transports, api.TransportEntry{Kind: "https_connect_tcp", URI: ps.NaiveURI})
+		}
 	}
 	return bundle, nil
 }
@@ -0,0 +1,423 @@
+package nodeapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/api"
+	"github.com/NetSepio/erebrus/internal/carriers"
+	"github.com/NetSepio/erebrus/internal/config"
+	"github.com/NetSepio/erebrus/internal/node"
+	"github.com/NetSepio/erebrus/internal/store"
+	"github.com/NetSepio/erebrus/internal/wg"
+)
+
+// adminServer is the local admin API: JSON over a Unix socket that only the
+// node user (and ADMIN_SOCKET_GROUP) can open. The operator CLI uses it to
+// act on the running node directly instead of editing its database.
+type adminServer struct {
+	cfg    *config.Config
+	st     *store.Store
+	svc    *node.Service
+	wg     *wg.Manager
+	status http.Handler // public API engine, serves /api/v2/status
+	reload *reloader
+	diags  *diagnostics
+	rotate func(context.Context, carriers.Options) error
+
+	srv *http.Server
+}
+
+// peerRow is one peer as `peers list` shows it: the API's metadata plus the
+// last WireGuard handshake.
+type peerRow struct {
+	api.PeerInfo
+	LastHandshake int64 `json:"last_handshake,omitempty"`
+}
+
+type adminPeerRequest struct {
+	ID string `json:"id,omitempty"`
+	api.PeerRequest
+}
+
+type adminDrainRequest struct {
+	Deadline time.Time `json:"deadline,omitzero"`
+	Target   string    `json:"target,omitempty"`
+}
+
+type adminRotateRequest struct {
+	GracePeriod string `json:"grace_period,omitempty"`
+	PeerID      string `json:"peer_id,omitempty"`
+}
+
+var errDraining = errors.New("node is draining; new peers are refused (erebrus-node drain --cancel)")
+
+func (a *adminServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/status", a.handleStatus)
+	mux.HandleFunc("GET /v1/peers", a.handleListPeers)
+	mux.HandleFunc("POST /v1/peers", a.handleAddPeer)
+	mux.HandleFunc("GET /v1/peers/{id}", a.handleShowPeer)
+	mux.HandleFunc("DELETE /v1/peers/{id}", a.handleRemovePeer)
+	mux.HandleFunc("POST /v1/peers/{id}/suspend", a.handleSetPeerEnabled(false))
+	mux.HandleFunc("POST /v1/peers/{id}/resume", a.handleSetPeerEnabled(true))
+	mux.HandleFunc("GET /v1/drain", a.handleDrainStatus)
+	mux.HandleFunc("POST /v1/drain", a.handleDrain)
+	mux.HandleFunc("DELETE /v1/drain", a.handleUndrain)
+	mux.HandleFunc("POST /v1/carriers/rotate", a.handleRotate)
+	mux.HandleFunc("POST /v1/reload", a.handleReload)
+	mux.HandleFunc("POST /v1/diagnostics", a.handleDiagnostics)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			slog.Info("admin request", "method", r.Method, "path", r.URL.Path)
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (a *adminServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	r = r.Clone(r.Context())
+	r.URL.Path = "/api/v2/status"
+	a.status.ServeHTTP(w, r)
+}
+
+func (a *adminServer) handleListPeers(w http.ResponseWriter, r *http.Request) {
+	rows, err := peerRows(r.Context(), a.st, a.wg.PeerTransfers())
+	adminReply(w, rows, err)
+}
+
+func (a *adminServer) handleAddPeer(w http.ResponseWriter, r *http.Request) {
+	var req adminPeerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		adminError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if a.svc.DrainState().Active() {
+		adminReply(w, nil, errDraining)
+		return
+	}
+	bundle, err := a.svc.UpsertPeer(r.Context(), req.ID, req.PeerRequest)
+	adminReply(w, bundle, err)
+}
+
+func (a *adminServer) handleShowPeer(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	bundle, err := a.svc.Credentials(r.Context(), id)
+	peerReply(w, id, bundle, err)
+}
+
+func (a *adminServer) handleRemovePeer(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if _, err := a.st.GetPeer(r.Context(), id); err != nil {
+		peerReply(w, id, nil, err)
+		return
+	}
+	adminReply(w, nil, a.svc.DeletePeer(r.Context(), id))
+}
+
+func (a *adminServer) handleSetPeerEnabled(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		peerReply(w, id, nil, a.svc.SetPeerEnabled(r.Context(), id, enabled))
+	}
+}
+
+func (a *adminServer) handleDrainStatus(w http.ResponseWriter, r *http.Request) {
+	d, err := node.LoadDrainState(r.Context(), a.st)
+	adminReply(w, d, err)
+}
+
+func (a *adminServer) handleDrain(w http.ResponseWriter, r *http.Request) {
+	var req adminDrainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		adminError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if err := a.svc.Drain(r.Context(), req.Deadline, req.Target); err != nil {
+		adminReply(w, nil, err)
+		return
+	}
+	adminReply(w, a.svc.DrainState(), nil)
+}
+
+func (a *adminServer) handleUndrain(w http.ResponseWriter, r *http.Request) {
+	adminReply(w, nil, a.svc.Undrain(r.Context()))
+}
+
+func (a *adminServer) handleRotate(w http.ResponseWriter, r *http.Request) {
+	var req adminRotateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		adminError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	opt := carriers.Options{PeerID: req.PeerID}
+	if req.GracePeriod != "" {
+		d, err := time.ParseDuration(req.GracePeriod)
+		if err != nil {
+			adminError(w, http.StatusBadRequest, "invalid grace_period")
+			return
+		}
+		opt.GracePeriod = d
+	}
+	adminReply(w, nil, a.rotate(r.Context(), opt))
+}
+
+func (a *adminServer) handleReload(w http.ResponseWriter, r *http.Request) {
+	adminReply(w, a.reload.apply(r.Context()), nil)
+}
+
+func (a *adminServer) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	var req diagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		adminError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	res, err := a.diags.collect(r.Context(), req.Upload)
+	out := diagOutcome{At: time.Now().UTC(), Result: res}
+	if err != nil {
+		out.Error = err.Error()
+	}
+	adminReply(w, out, nil)
+}
+
+// adminReply writes v as JSON, or err with a status that matches it. The
+// socket is operator-only, so error details are returned as they are.
+func adminReply(w http.ResponseWriter, v any, err error) {
+	switch {
+	case err == nil && v == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case err == nil:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	case errors.Is(err, store.ErrNotFound):
+		adminError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, errDraining):
+		adminError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, store.ErrSubnetExhausted):
+		adminError(w, http.StatusConflict, "address pool exhausted")
+	default:
+		adminError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// peerReply is adminReply for requests naming a peer.
+func peerReply(w http.ResponseWriter, id string, v any, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		adminError(w, http.StatusNotFound, "unknown peer "+id)
+		return
+	}
+	adminReply(w, v, err)
+}
+
+func adminError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+// listen binds the admin socket and serves it in the background. A stale
+// socket left by a crashed node is replaced; a live one is an error.
+func (a *adminServer) listen(path, group string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&fs.ModeSocket == 0 {
+			return fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if c, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			c.Close()
+			return fmt.Errorf("%s is in use by another process", path)
+		}
+		_ = os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+	mode := os.FileMode(0o600)
+	if group != "" {
+		gid, err := lookupGID(group)
+		if err == nil {
+			err = os.Chown(path, -1, gid)
+		}
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("ADMIN_SOCKET_GROUP: %w", err)
+		}
+		mode = 0o660
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return err
+	}
+	a.srv = &http.Server{Handler: a.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		slog.Info("admin socket listening", "path", path)
+		if err := a.srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("admin socket error", "path", path, "err", err)
+		}
+	}()
+	return nil
+}
+
+func (a *adminServer) shutdown(ctx context.Context) error {
+	if a.srv == nil {
+		return nil
+	}
+	return a.srv.Shutdown(ctx)
+}
+
+func lookupGID(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
+
+// peerRows joins the stored peers with their last handshake.
+func peerRows(ctx context.Context, st *store.Store, transfers []wg.PeerTransfer) ([]peerRow, error) {
+	peers, err := st.ListPeers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	handshakes := map[string]int64{}
+	for _, t := range transfers {
+		handshakes[t.WGPublicKey] = t.LastHandshake
+	}
+	rows := make([]peerRow, 0, len(peers))
+	for _, p := range peers {
+		rows = append(rows, peerRow{
+			PeerInfo: api.PeerInfo{
+				ID: p.ID, Name: p.Name, WGAllowedIP: p.WGAllowedIP,
+				Enabled: p.Enabled, CreatedAt: p.CreatedAt, ExpiresAt: p.ExpiresAt,
+			},
+			LastHandshake: handshakes[p.WGPublicKey],
+		})
+	}
+	return rows, nil
+}
+
+// adminClient talks to the running node's admin socket.
+type adminClient struct {
+	hc *http.Client
+}
+
+// dialAdmin returns a client for the running node's admin socket, or nil
+// when the socket is disabled or nothing is listening on it; the CLI then
+// falls back to working on the database. Lacking permission is an error.
+func dialAdmin(cfg *config.Config) (*adminClient, error) {
+	path := cfg.AdminSocketPath()
+	if path == "" {
+		return nil, nil
+	}
+	c, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			return nil, fmt.Errorf("admin socket %s: permission denied; run as the node user or a member of ADMIN_SOCKET_GROUP", path)
+		}
+		return nil, nil
+	}
+	c.Close()
+	return &adminClient{hc: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}}, nil
+}
+
+// call sends in as JSON and decodes the reply into out (either may be nil).
+// Error replies come back as their message.
+func (c *adminClient) call(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://erebrus-node"+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return fmt.Errorf("admin socket: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&e) != nil || e.Error == "" {
+			e.Error = resp.Status
+		}
+		return errors.New(e.Error)
+	}
+	switch out := out.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*out, err = io.ReadAll(resp.Body)
+		return err
+	default:
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+}
+
+func (c *adminClient) addPeer(ctx context.Context, id string, req api.PeerRequest) (*api.CredentialBundle, error) {
+	var bundle api.CredentialBundle
+	if err := c.call(ctx, http.MethodPost, "/v1/peers", adminPeerRequest{ID: id, PeerRequest: req}, &bundle); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+func (c *adminClient) removePeer(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, "/v1/peers/"+url.PathEscape(id), nil, nil)
+}
+
+func (c *adminClient) setPeerEnabled(ctx context.Context, id string, enabled bool) error {
+	action := "suspend"
+	if enabled {
+		action = "resume"
+	}
+	return c.call(ctx, http.MethodPost, "/v1/peers/"+url.PathEscape(id)+"/"+action, nil, nil)
+}
+
+func (c *adminClient) peerBundle(ctx context.Context, id string) (*api.CredentialBundle, error) {
+	var bundle api.CredentialBundle
+	if err := c.call(ctx, http.MethodGet, "/v1/peers/"+url.PathEscape(id), nil, &bundle); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+func (c *adminClient) listPeers(ctx context.Context) ([]peerRow, error) {
+	var rows []peerRow
+	err := c.call(ctx, http.MethodGet, "/v1/peers", nil, &rows)
+	return rows, err
+}
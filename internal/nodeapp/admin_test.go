@@ -0,0 +1,255 @@
+package nodeapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/api"
+	"github.com/NetSepio/erebrus/internal/carriers"
+	"github.com/NetSepio/erebrus/internal/config"
+	"github.com/NetSepio/erebrus/internal/diag"
+	"github.com/NetSepio/erebrus/internal/node"
+	"github.com/NetSepio/erebrus/internal/store"
+	"github.com/NetSepio/erebrus/internal/wg"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// newTestAdmin wires an adminServer to a scratch store and an offline
+// WireGuard manager.
+func newTestAdmin(t *testing.T) (*adminServer, *store.Store) {
+	t.Helper()
+	dir := t.TempDir()
+	st, err := store.Open(filepath.Join(dir, "node.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	cfg := &config.Config{
+		StateDir: dir, WGConfDir: filepath.Join(dir, "wg"), WGInterface: "wg0",
+		WGIPv4Subnet: "10.8.0.1/24", WGEndpointHost: "vpn.example.com", WGEndpointPort: "51820",
+	}
+	live := config.NewLive(cfg)
+	wgm := wg.New(live, st, wg.NewOfflineController())
+	if err := wgm.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	a := &adminServer{
+		cfg: cfg, st: st, svc: node.New(live, st, wgm, nil, nil), wg: wgm,
+		status: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			adminReply(w, map[string]string{"path": r.URL.Path}, nil)
+		}),
+		reload: &reloader{cfg: live, st: st},
+		diags:  &diagnostics{cfg: cfg, st: st, sources: func() diag.Sources { return diag.Sources{Cfg: cfg, Store: st} }},
+		rotate: func(context.Context, carriers.Options) error { return nil },
+	}
+	return a, st
+}
+
+// do sends one request through the admin handler and decodes a JSON reply
+// into out when given.
+func do(t *testing.T, h http.Handler, method, path, body string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil && rec.Code < http.StatusMultipleChoices {
+		if err := json.NewDecoder(rec.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decode: %v", method, path, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestAdminRoutes(t *testing.T) {
+	t.Setenv("EREBRUS_CONFIG", "")
+	t.Setenv("MNEMONIC", "")
+	a, st := newTestAdmin(t)
+	var rotated carriers.Options
+	a.rotate = func(_ context.Context, opt carriers.Options) error {
+		rotated = opt
+		return nil
+	}
+	h := a.handler()
+	ctx := context.Background()
+
+	var status map[string]string
+	if code := do(t, h, "GET", "/v1/status", "", &status); code != http.StatusOK || status["path"] != "/api/v2/status" {
+		t.Fatalf("status = %d %v", code, status)
+	}
+
+	key, _ := wgtypes.GeneratePrivateKey()
+	var bundle api.CredentialBundle
+	body := `{"id":"alice","name":"alice","wg_public_key":"` + key.PublicKey().String() + `"}`
+	if code := do(t, h, "POST", "/v1/peers", body, &bundle); code != http.StatusOK {
+		t.Fatalf("add peer = %d", code)
+	}
+	var rows []peerRow
+	if code := do(t, h, "GET", "/v1/peers", "", &rows); code != http.StatusOK || len(rows) != 1 || rows[0].ID != "alice" {
+		t.Fatalf("list peers = %d %+v", code, rows)
+	}
+	if code := do(t, h, "GET", "/v1/peers/alice", "", &bundle); code != http.StatusOK {
+		t.Fatalf("show peer = %d", code)
+	}
+
+	if code := do(t, h, "POST", "/v1/peers/alice/suspend", "", nil); code != http.StatusNoContent {
+		t.Fatalf("suspend = %d", code)
+	}
+	if p, _ := st.GetPeer(ctx, "alice"); p == nil || p.Enabled {
+		t.Fatalf("suspended peer = %+v", p)
+	}
+	if code := do(t, h, "POST", "/v1/peers/alice/resume", "", nil); code != http.StatusNoContent {
+		t.Fatalf("resume = %d", code)
+	}
+	if p, _ := st.GetPeer(ctx, "alice"); p == nil || !p.Enabled {
+		t.Fatalf("resumed peer = %+v", p)
+	}
+
+	var d node.DrainState
+	if code := do(t, h, "POST", "/v1/drain", `{"target":"node-b"}`, &d); code != http.StatusOK || d.Status != node.StatusDraining || d.Target != "node-b" {
+		t.Fatalf("drain = %d %+v", code, d)
+	}
+	if code := do(t, h, "GET", "/v1/drain", "", &d); code != http.StatusOK || d.Status != node.StatusDraining {
+		t.Fatalf("drain status = %d %+v", code, d)
+	}
+	if code := do(t, h, "DELETE", "/v1/drain", "", nil); code != http.StatusNoContent {
+		t.Fatalf("undrain = %d", code)
+	}
+	if got := a.svc.DrainState().Status; got != node.StatusOnline {
+		t.Fatalf("status after undrain = %s", got)
+	}
+
+	if code := do(t, h, "POST", "/v1/carriers/rotate", `{"grace_period":"1h","peer_id":"alice"}`, nil); code != http.StatusNoContent {
+		t.Fatalf("rotate = %d", code)
+	}
+	if rotated.GracePeriod != time.Hour || rotated.PeerID != "alice" {
+		t.Fatalf("rotate options = %+v", rotated)
+	}
+	if code := do(t, h, "POST", "/v1/carriers/rotate", `{"grace_period":"soon"}`, nil); code != http.StatusBadRequest {
+		t.Fatalf("rotate with a bad grace period = %d", code)
+	}
+
+	// Without MNEMONIC the reload is refused but still answered.
+	var res ReloadResult
+	if code := do(t, h, "POST", "/v1/reload", "", &res); code != http.StatusOK || len(res.Errors) == 0 {
+		t.Fatalf("reload = %d %+v", code, res)
+	}
+
+	var out diagOutcome
+	if code := do(t, h, "POST", "/v1/diagnostics", `{}`, &out); code != http.StatusOK || out.Error != "" || out.Path == "" {
+		t.Fatalf("diagnostics = %d %+v", code, out)
+	}
+
+	if code := do(t, h, "DELETE", "/v1/peers/alice", "", nil); code != http.StatusNoContent {
+		t.Fatalf("remove peer = %d", code)
+	}
+	if _, err := st.GetPeer(ctx, "alice"); !errors.Is(err, store.ErrNotFound) {
+		t.Fatalf("removed peer still stored: %v", err)
+	}
+
+	for _, path := range []string{"/v1/peers", "/v1/drain", "/v1/carriers/rotate", "/v1/diagnostics"} {
+		if code := do(t, h, "POST", path, "{", nil); code != http.StatusBadRequest {
+			t.Errorf("POST %s with a bad body = %d", path, code)
+		}
+	}
+}
+
+func TestAdminErrorStatus(t *testing.T) {
+	a, _ := newTestAdmin(t)
+	h := a.handler()
+
+	for _, r := range []struct{ method, path string }{
+		{"GET", "/v1/peers/ghost"},
+		{"DELETE", "/v1/peers/ghost"},
+		{"POST", "/v1/peers/ghost/suspend"},
+		{"POST", "/v1/peers/ghost/resume"},
+	} {
+		req := httptest.NewRequest(r.method, r.path, nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound || !strings.Contains(rec.Body.String(), "unknown peer ghost") {
+			t.Errorf("%s %s = %d %s", r.method, r.path, rec.Code, rec.Body)
+		}
+	}
+
+	if err := a.svc.Drain(context.Background(), time.Time{}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if code := do(t, h, "POST", "/v1/peers", `{"name":"late"}`, nil); code != http.StatusConflict {
+		t.Fatalf("add peer while draining = %d", code)
+	}
+
+	for err, want := range map[error]int{
+		nil:                      http.StatusNoContent,
+		store.ErrNotFound:        http.StatusNotFound,
+		errDraining:              http.StatusConflict,
+		store.ErrSubnetExhausted: http.StatusConflict,
+		errors.New("disk full"):  http.StatusInternalServerError,
+	} {
+		rec := httptest.NewRecorder()
+		adminReply(rec, nil, err)
+		if rec.Code != want {
+			t.Errorf("adminReply(%v) = %d, want %d", err, rec.Code, want)
+		}
+	}
+}
+
+func TestAdminSocketPermissions(t *testing.T) {
+	// Unix socket paths are short; keep them out of the long test temp dir.
+	dir, err := os.MkdirTemp("", "erebrus-admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for _, tc := range []struct {
+		group string
+		want  fs.FileMode
+	}{
+		{"", 0o600},
+		{strconv.Itoa(os.Getgid()), 0o660},
+	} {
+		a, _ := newTestAdmin(t)
+		path := filepath.Join(dir, "admin"+tc.group+".sock")
+		if err := a.listen(path, tc.group); err != nil {
+			t.Fatalf("group %q: %v", tc.group, err)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode()&fs.ModeSocket == 0 || fi.Mode().Perm() != tc.want {
+			t.Errorf("group %q: socket mode = %v, want %v", tc.group, fi.Mode(), tc.want)
+		}
+		if err := (&adminServer{}).listen(path, ""); err == nil || !strings.Contains(err.Error(), "in use") {
+			t.Errorf("second listener on a live socket: %v", err)
+		}
+		c, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Close()
+		if err := a.shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Anything but a socket at the path is left alone.
+	plain := filepath.Join(dir, "plain")
+	if err := os.WriteFile(plain, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&adminServer{}).listen(plain, ""); err == nil || !strings.Contains(err.Error(), "not a socket") {
+		t.Fatalf("listen over a regular file: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package nodeapp
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/NetSepio/erebrus/internal/config"
+)
+
+const configUsage = "usage: erebrus-node config validate | print [--redacted] | explain <key>   [--config <file>]"
+
+// runConfigCLI inspects the effective configuration the node would start
+// with: env file, config file (EREBRUS_CONFIG) and environment combined.
+func runConfigCLI(args []string) error {
+	var (
+		cmd      string
+		key      string
+		redacted bool
+		path     = config.FilePath()
+	)
+	for i := 0; i < len(args); i++ {
+		switch a := args[i]; {
+		case a == "--config":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--config requires a value")
+			}
+			path = args[i+1]
+			i++
+		case a == "--redacted":
+			redacted = true
+		case cmd == "":
+			cmd = a
+		case cmd == "explain" && key == "":
+			key = a
+		default:
+			return fmt.Errorf("unexpected argument %s\n%s", a, configUsage)
+		}
+	}
+
+	layer, err := loadConfigLayers(path)
+	if err != nil {
+		return err
+	}
+	switch cmd {
+	case "validate":
+		return validateConfig()
+	case "print":
+		cfg := config.Load()
+		for _, s := range config.Settings {
+			fmt.Printf("%s=%s  # %s\n", s.Env, displayValue(s, s.Effective(cfg), redacted), s.Source(layer))
+		}
+		return nil
+	case "explain":
+		if key == "" {
+			return fmt.Errorf("explain requires a key\n%s", configUsage)
+		}
+		s, ok := config.LookupSetting(key)
+		if !ok {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		explainSetting(s, config.Load(), layer)
+		return nil
+	}
+	return fmt.Errorf("%s", configUsage)
+}
+
+// loadConfigLayers exports the env file and then the config file underneath
+// the process environment, so config.Load sees env > env file > config file
+// > defaults.
+func loadConfigLayers(path string) (*config.FileLayer, error) {
+	if p := envFilePath(); p != "" {
+		startupEnvKeys, _ = applyEnvFile(p, nil)
+	}
+	if path == "" {
+		return nil, nil
+	}
+	return config.ApplyFile(path)
+}
+
+// loadCLIConfig is config.Load for operator subcommands, with the same layers
+// the node starts with. A broken config file is reported, not fatal, so
+// commands like drain --cancel still work.
+func loadCLIConfig() *config.Config {
+	if _, err := loadConfigLayers(config.FilePath()); err != nil {
+		fmt.Fprintln(os.Stderr, "warning:", err)
+	}
+	return config.Load()
+}
+
+func validateConfig() error {
+	errs, deprecations := config.CheckSchema(os.LookupEnv)
+	for _, d := range deprecations {
+		fmt.Println("deprecated:", d)
+	}
+	cfg := config.Load()
+	// Cross-field rules only make sense once every value parses.
+	if len(errs) == 0 {
+		if err := cfg.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, w := range cfg.Mode.Warnings {
+		fmt.Println("warning:", w)
+	}
+	for _, err := range errs {
+		fmt.Println("error:", err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d error(s)", len(errs))
+	}
+	fmt.Println("configuration is valid")
+	return nil
+}
+
+func explainSetting(s config.Setting, cfg *config.Config, layer *config.FileLayer) {
+	kind := s.Kind
+	if kind == "" {
+		kind = config.KindString
+	}
+	fmt.Printf("setting:    %s (file key %s)\n", s.Env, s.FileKey())
+	fmt.Printf("value:      %s\n", displayValue(s, s.Effective(cfg), false))
+	fmt.Printf("source:     %s\n", s.Source(layer))
+	fmt.Printf("default:    %s\n", orNone(s.Default))
+	if len(s.Values) > 0 {
+		fmt.Printf("type:       %s (%s)\n", kind, strings.Join(s.Values, ", "))
+	} else {
+		fmt.Printf("type:       %s\n", kind)
+	}
+	if len(s.Aliases) > 0 {
+		fmt.Printf("aliases:    %s\n", strings.Join(s.Aliases, ", "))
+	}
+	if len(s.Deprecated) > 0 {
+		fmt.Printf("deprecated: %s\n", strings.Join(s.Deprecated, ", "))
+	}
+	if s.Secret {
+		fmt.Println("secret:     yes (hidden by print --redacted)")
+	}
+	if s.Help != "" {
+		fmt.Printf("about:      %s\n", s.Help)
+	}
+}
+
+func displayValue(s config.Setting, v string, redacted bool) string {
+	if redacted && s.Secret && v != "" {
+		return "<redacted>"
+	}
+	return v
+}
+
+func orNone(v string) string {
+	if v == "" {
+		return "(none)"
+	}
+	return v
+}
@@ -0,0 +1,242 @@
+package nodeapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/config"
+	"github.com/NetSepio/erebrus/internal/diag"
+	"github.com/NetSepio/erebrus/internal/gatewayclient"
+	"github.com/NetSepio/erebrus/internal/store"
+	"github.com/NetSepio/erebrus/internal/wg"
+)
+
+const (
+	settingDiagRequest = "diag_request"
+	settingDiagResult  = "diag_result"
+	diagDirName        = "diagnostics"
+)
+
+const diagUsage = "usage: erebrus-node diag [--out <file>] [--upload] [--offline]"
+
+// diagRequest is what `erebrus-node diag` asks the running node for before
+// sending SIGUSR1.
+type diagRequest struct {
+	At     time.Time `json:"at"`
+	Upload bool      `json:"upload"`
+}
+
+// diagOutcome is the running node's answer, persisted for the diag CLI.
+type diagOutcome struct {
+	At time.Time `json:"at"`
+	diag.Result
+	Error string `json:"error,omitempty"`
+}
+
+func diagDir(cfg *config.Config) string { return filepath.Join(cfg.StateDir, diagDirName) }
+
+// diagnostics builds bundles inside the running node, where recent logs and
+// live component state are visible.
+type diagnostics struct {
+	cfg     *config.Config
+	st      *store.Store
+	sources func() diag.Sources
+	gw      *gatewayclient.Client // nil without a control plane
+}
+
+// collect saves a bundle under the state dir and optionally uploads it. A
+// failed upload still returns the saved bundle.
+func (d *diagnostics) collect(ctx context.Context, upload bool) (diag.Result, error) {
+	gatewayclient.ReportProgress(ctx, "collecting diagnostics", 0)
+	res, err := diag.Save(ctx, d.sources(), diagDir(d.cfg))
+	if err != nil {
+		return res, err
+	}
+	slog.Info("diagnostics bundle saved", "path", res.Path, "size", res.Size)
+	if !upload {
+		return res, nil
+	}
+	if d.gw == nil {
+		return res, fmt.Errorf("bundle saved to %s; upload needs the gateway control plane", res.Path)
+	}
+	gatewayclient.ReportProgress(ctx, "uploading diagnostics", 50)
+	f, err := os.Open(res.Path)
+	if err != nil {
+		return res, err
+	}
+	defer f.Close()
+	if err := d.gw.UploadDiagnostics(ctx, res.ID, res.SHA256, f); err != nil {
+		return res, fmt.Errorf("bundle saved to %s; %w", res.Path, err)
+	}
+	res.Uploaded = true
+	return res, nil
+}
+
+// watch serves `erebrus-node diag` requests, signalled with SIGUSR1.
+func (d *diagnostics) watch(ctx context.Context) {
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	defer signal.Stop(usr1)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-usr1:
+			var req diagRequest
+			if raw, err := d.st.GetSetting(ctx, settingDiagRequest); err == nil && raw != "" {
+				_ = json.Unmarshal([]byte(raw), &req)
+			}
+			res, err := d.collect(ctx, req.Upload)
+			out := diagOutcome{At: time.Now().UTC(), Result: res}
+			if err != nil {
+				out.Error = err.Error()
+				slog.Warn("diagnostics bundle", "err", err)
+			}
+			raw, _ := json.Marshal(out)
+			if err := d.st.SetSetting(ctx, settingDiagResult, string(raw)); err != nil {
+				slog.Warn("persist diagnostics result failed", "err", err)
+			}
+		}
+	}
+}
+
+// runDiagCLI asks the running node for a bundle, over the admin socket or
+// with SIGUSR1, or collects what it can itself when the node is not running
+// (or with --offline).
+func runDiagCLI(args []string) error {
+	var (
+		out     string
+		upload  bool
+		offline bool
+	)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--out":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--out requires a value")
+			}
+			out = args[i+1]
+			i++
+		case "--upload":
+			upload = true
+		case "--offline":
+			offline = true
+		default:
+			return fmt.Errorf("unexpected argument %s\n%s", args[i], diagUsage)
+		}
+	}
+
+	cfg := loadCLIConfig()
+	ctx := context.Background()
+	var admin *adminClient
+	if !offline {
+		var err error
+		if admin, err = dialAdmin(cfg); err != nil {
+			return err
+		}
+	}
+
+	var res diag.Result
+	var err error
+	if admin != nil {
+		res, err = requestAdminDiag(ctx, admin, upload)
+	} else {
+		st, serr := store.Open(cfg.DBPath())
+		if serr != nil {
+			return serr
+		}
+		defer st.Close()
+		pid, running := nodePID(cfg)
+		switch {
+		case running && !offline:
+			res, err = requestLiveDiag(ctx, st, pid, upload)
+		case upload:
+			return fmt.Errorf("--upload needs the running node")
+		default:
+			fmt.Fprintln(os.Stderr, "node not running; collecting without logs or carrier state")
+			res, err = diag.Save(ctx, diag.Sources{Cfg: cfg, Store: st, WG: wg.NewController()}, diagDir(cfg))
+		}
+	}
+	if res.Path == "" {
+		return err
+	}
+	if out != "" {
+		if cerr := copyFile(res.Path, out); cerr != nil {
+			return cerr
+		}
+		res.Path = out
+	}
+	fmt.Printf("bundle:   %s\n", res.Path)
+	fmt.Printf("size:     %d bytes\n", res.Size)
+	fmt.Printf("sha256:   %s\n", res.SHA256)
+	if res.Uploaded {
+		fmt.Println("uploaded: yes")
+	}
+	return err
+}
+
+func requestAdminDiag(ctx context.Context, admin *adminClient, upload bool) (diag.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Minute)
+	defer cancel()
+	var out diagOutcome
+	if err := admin.call(ctx, http.MethodPost, "/v1/diagnostics", diagRequest{At: time.Now().UTC(), Upload: upload}, &out); err != nil {
+		return diag.Result{}, err
+	}
+	if out.Error != "" {
+		return out.Result, fmt.Errorf("%s", out.Error)
+	}
+	return out.Result, nil
+}
+
+func requestLiveDiag(ctx context.Context, st *store.Store, pid int, upload bool) (diag.Result, error) {
+	sent := time.Now().UTC()
+	raw, _ := json.Marshal(diagRequest{At: sent, Upload: upload})
+	if err := st.SetSetting(ctx, settingDiagRequest, string(raw)); err != nil {
+		return diag.Result{}, err
+	}
+	if err := syscall.Kill(pid, syscall.SIGUSR1); err != nil {
+		return diag.Result{}, fmt.Errorf("signal node (pid %d): %w", pid, err)
+	}
+	for deadline := sent.Add(3 * time.Minute); time.Now().Before(deadline); {
+		time.Sleep(500 * time.Millisecond)
+		raw, err := st.GetSetting(ctx, settingDiagResult)
+		if err != nil || raw == "" {
+			continue
+		}
+		var out diagOutcome
+		if json.Unmarshal([]byte(raw), &out) != nil || out.At.Before(sent) {
+			continue
+		}
+		if out.Error != "" {
+			return out.Result, fmt.Errorf("%s", out.Error)
+		}
+		return out.Result, nil
+	}
+	return diag.Result{}, fmt.Errorf("no diagnostics from pid %d within 3m; check the node logs", pid)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,208 @@
+package nodeapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/node"
+	"github.com/NetSepio/erebrus/internal/store"
+)
+
+const drainUsage = "usage: erebrus-node drain [--deadline 30m] [--target <node-peer-id>] [--wait [--timeout 1h]] | drain --cancel | drain --status"
+
+const (
+	drainWaitPoll = 2 * time.Second
+	// drainWaitMargin is how long --wait gives the node past the deadline to
+	// cut the remaining peers off and report drained.
+	drainWaitMargin = time.Minute
+	// drainWaitDefault bounds --wait for a drain without a deadline, which
+	// only ends when the last peer leaves.
+	drainWaitDefault = time.Hour
+)
+
+var errNodeNotRunning = errors.New("node not running; drain applies at next start")
+
+// runDrainCLI drains the running node over its admin socket. Without one it
+// records the request in the node database, which the running node picks up
+// within a few seconds; like carrier rotation it never binds ports.
+func runDrainCLI(args []string) error {
+	var (
+		deadline time.Duration
+		timeout  time.Duration
+		target   string
+		wait     bool
+		cancel   bool
+		status   bool
+	)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--deadline":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--deadline requires a value")
+			}
+			d, err := time.ParseDuration(args[i+1])
+			if err != nil || d < 0 {
+				return fmt.Errorf("invalid deadline %q", args[i+1])
+			}
+			deadline = d
+			i++
+		case "--timeout":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--timeout requires a value")
+			}
+			d, err := time.ParseDuration(args[i+1])
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid timeout %q", args[i+1])
+			}
+			timeout = d
+			i++
+		case "--target":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--target requires a value")
+			}
+			target = args[i+1]
+			i++
+		case "--wait":
+			wait = true
+		case "--cancel":
+			cancel = true
+		case "--status":
+			status = true
+		default:
+			return fmt.Errorf("unknown flag %s\n%s", args[i], drainUsage)
+		}
+	}
+
+	ctx := context.Background()
+	cfg := loadCLIConfig()
+	admin, err := dialAdmin(cfg)
+	if err != nil {
+		return err
+	}
+	var st *store.Store
+	if admin == nil {
+		if st, err = store.Open(cfg.DBPath()); err != nil {
+			return err
+		}
+		defer st.Close()
+	}
+	load := func() (node.DrainState, error) {
+		if admin == nil {
+			return node.LoadDrainState(ctx, st)
+		}
+		var d node.DrainState
+		err := admin.call(ctx, http.MethodGet, "/v1/drain", nil, &d)
+		return d, err
+	}
+
+	switch {
+	case status:
+		d, err := load()
+		if err != nil {
+			return err
+		}
+		printDrainState(d)
+		return nil
+	case cancel:
+		if admin != nil {
+			err = admin.call(ctx, http.MethodDelete, "/v1/drain", nil, nil)
+		} else {
+			err = node.SaveDrainState(ctx, st, node.DrainState{Status: node.StatusOnline})
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println("drain cancelled; the node resumes accepting peers and reconnects suspended ones.")
+		return nil
+	}
+
+	d := node.DrainState{Status: node.StatusDraining, StartedAt: time.Now().UTC(), Target: target}
+	if deadline > 0 {
+		d.Deadline = d.StartedAt.Add(deadline)
+	}
+	if admin != nil {
+		err = admin.call(ctx, http.MethodPost, "/v1/drain", adminDrainRequest{Deadline: d.Deadline, Target: target}, nil)
+	} else {
+		err = node.SaveDrainState(ctx, st, d)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("drain requested; new peers are refused.")
+	if !wait {
+		return nil
+	}
+	// Without a running node the request only sits in the store; nothing
+	// would ever advance it.
+	alive := func() bool {
+		if admin != nil {
+			return true
+		}
+		_, running := nodePID(cfg)
+		return running
+	}
+	if timeout == 0 {
+		timeout = drainWaitDefault
+		if deadline > 0 {
+			timeout = deadline + drainWaitMargin
+		}
+	}
+	d, err = waitDrained(load, alive, timeout, drainWaitPoll)
+	if err != nil {
+		return err
+	}
+	printDrainState(d)
+	return nil
+}
+
+// waitDrained polls the drain state until the node reports drained, giving
+// up when the drain is cancelled, the node is not running, or timeout
+// passes; the drain itself carries on after a timeout.
+func waitDrained(load func() (node.DrainState, error), alive func() bool, timeout, poll time.Duration) (node.DrainState, error) {
+	until := time.Now().Add(timeout)
+	last := -1
+	for {
+		if !alive() {
+			return node.DrainState{}, errNodeNotRunning
+		}
+		time.Sleep(poll)
+		d, err := load()
+		if err != nil {
+			return d, err
+		}
+		switch d.Status {
+		case node.StatusDrained:
+			return d, nil
+		case node.StatusOnline:
+			return d, fmt.Errorf("drain was cancelled")
+		}
+		if time.Now().After(until) {
+			return d, fmt.Errorf("still draining after %s with %d peer(s) connected; the node keeps draining (see drain --status)", timeout, d.Remaining)
+		}
+		if d.Remaining != last {
+			fmt.Printf("waiting: %d peer(s) still connected\n", d.Remaining)
+			last = d.Remaining
+		}
+	}
+}
+
+func printDrainState(d node.DrainState) {
+	fmt.Printf("status:    %s\n", d.Status)
+	if !d.Active() {
+		return
+	}
+	fmt.Printf("started:   %s\n", d.StartedAt.Format(time.RFC3339))
+	if !d.Deadline.IsZero() {
+		fmt.Printf("deadline:  %s\n", d.Deadline.Format(time.RFC3339))
+	}
+	if d.Target != "" {
+		fmt.Printf("target:    %s\n", d.Target)
+	}
+	fmt.Printf("remaining: %d\n", d.Remaining)
+	if !d.DrainedAt.IsZero() {
+		fmt.Printf("drained:   %s\n", d.DrainedAt.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,47 @@
+package nodeapp
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/node"
+)
+
+func TestWaitDrained(t *testing.T) {
+	alive := func() bool { return true }
+	states := func(s ...node.DrainState) func() (node.DrainState, error) {
+		return func() (node.DrainState, error) {
+			d := s[0]
+			if len(s) > 1 {
+				s = s[1:]
+			}
+			return d, nil
+		}
+	}
+	draining := node.DrainState{Status: node.StatusDraining, Remaining: 2}
+
+	// No node to advance the stored request: give up at once.
+	if _, err := waitDrained(states(draining), func() bool { return false }, time.Hour, time.Millisecond); !errors.Is(err, errNodeNotRunning) {
+		t.Fatalf("without a node: %v", err)
+	}
+
+	d, err := waitDrained(states(draining, draining, node.DrainState{Status: node.StatusDrained}), alive, time.Hour, time.Millisecond)
+	if err != nil || d.Status != node.StatusDrained {
+		t.Fatalf("drained = %+v, %v", d, err)
+	}
+
+	if _, err := waitDrained(states(draining, node.DrainState{Status: node.StatusOnline}), alive, time.Hour, time.Millisecond); err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Fatalf("cancelled drain: %v", err)
+	}
+
+	// Peers that never leave a drain without a deadline: the wait is bounded.
+	start := time.Now()
+	if _, err := waitDrained(states(draining), alive, 20*time.Millisecond, time.Millisecond); err == nil || !strings.Contains(err.Error(), "still draining") {
+		t.Fatalf("timed out wait: %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("wait outlived its timeout")
+	}
+}
@@ -2,6 +2,7 @@
 package nodeapp
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -9,9 +10,13 @@ import (
 	"github.com/NetSepio/erebrus/internal/config"
 	"github.com/NetSepio/erebrus/internal/p2p"
 	"github.com/NetSepio/erebrus/internal/telemetry"
-	"github.com/joho/godotenv"
 )
 
+// startupFileKeys are the settings Main took from the EREBRUS_CONFIG file; a
+// reload clears them before re-reading the file. startupEnvKeys are the ones
+// it took from the env file, which a reload may update.
+var startupFileKeys, startupEnvKeys map[string]bool
+
 // Main is the shared entrypoint for erebrus-node and the legacy erebrus binary.
 func Main(args []string) {
 	if len(args) > 1 {
@@ -55,6 +60,48 @@ func Main(args []string) {
 				os.Exit(1)
 			}
 			return
+		case "peers":
+			if err := runPeersCLI(args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "peers:", err)
+				os.Exit(1)
+			}
+			return
+		case "drain":
+			if err := runDrainCLI(args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "drain:", err)
+				os.Exit(1)
+			}
+			return
+		case "config":
+			if err := runConfigCLI(args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "config:", err)
+				os.Exit(1)
+			}
+			return
+		case "reload":
+			if err := runReloadCLI(args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "reload:", err)
+				os.Exit(1)
+			}
+			return
+		case "diag":
+			if err := runDiagCLI(args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "diag:", err)
+				os.Exit(1)
+			}
+			return
+		case "upgrade":
+			if err := runUpgradeCLI(args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "upgrade:", err)
+				os.Exit(1)
+			}
+			return
+		case "probe":
+			if err := runProbeCLI(args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "probe:", err)
+				os.Exit(1)
+			}
+			return
 		case "status":
 			if err := runStatusCLI(args[2:]); err != nil {
 				fmt.Fprintln(os.Stderr, "status:", err)
@@ -64,13 +111,29 @@ func Main(args []string) {
 		}
 	}
 
-	if os.Getenv("LOAD_CONFIG_FILE") == "" {
-		_ = godotenv.Load()
+	layer, fileErr := loadConfigLayers(config.FilePath())
+	if layer != nil {
+		startupFileKeys = layer.Applied
 	}
 
 	cfg := config.Load()
 	telemetry.InitLogger(cfg.RunType == "debug")
 
+	if fileErr != nil {
+		slog.Error("invalid config file", "err", fileErr)
+		os.Exit(1)
+	}
+	schemaErrs, deprecations := config.CheckSchema(os.LookupEnv)
+	for _, d := range deprecations {
+		slog.Warn("deprecated setting", "detail", d)
+	}
+	for _, err := range schemaErrs {
+		slog.Error("invalid setting", "err", err)
+	}
+	if len(schemaErrs) > 0 {
+		os.Exit(1)
+	}
+
 	if err := cfg.Validate(); err != nil {
 		slog.Error("invalid configuration", "err", err)
 		os.Exit(1)
@@ -83,10 +146,20 @@ func Main(args []string) {
 		"access", cfg.Mode.RuntimeMode,
 		"network_profile", cfg.Mode.NetworkProfile,
 		"firewall_provider", cfg.FirewallProvider,
-		"api_bind", fmt.Sprintf("%s:%s", cfg.BindAddr, cfg.HTTPPort),
+		"api_bind", cfg.PublicListener().Addr(),
+		"management_bind", cfg.ManagementListener().Addr(),
+		"metrics_bind", cfg.MetricsListener().Addr(),
 	)
 
-	if err := Run(cfg); err != nil {
+	err := Run(cfg)
+	if errors.Is(err, errRestart) {
+		if err := restartNode(cfg); err != nil {
+			slog.Error("restart failed", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err != nil {
 		slog.Error("node exited with error", "err", err)
 		os.Exit(1)
 	}
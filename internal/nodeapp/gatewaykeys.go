@@ -0,0 +1,65 @@
+package nodeapp
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/gatewayauth"
+	"github.com/NetSepio/erebrus/internal/gatewayclient"
+)
+
+const (
+	gatewayKeyRefreshInterval = 6 * time.Hour
+	gatewayKeyMinRefresh      = time.Minute
+)
+
+// startGatewayKeyRefresher fetches the gateway's signed key set now, every
+// six hours, and when the returned trigger is called (a call token named an
+// unknown kid). Triggers closer than a minute apart are coalesced.
+func startGatewayKeyRefresher(ctx context.Context, gateways *gatewayclient.Gateways, st gatewayclient.SettingsStore, keys *gatewayauth.KeySet) func() {
+	kick := make(chan struct{}, 1)
+	refresh := func() {
+		reqCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+		defer cancel()
+		token, err := gatewayclient.FetchGatewayKeys(reqCtx, gateways.Active())
+		if err != nil {
+			slog.Warn("fetch gateway keys failed", "err", err)
+			return
+		}
+		err = gatewayclient.ApplyGatewayKeyUpdate(reqCtx, st, keys, token)
+		switch {
+		case err == nil:
+			slog.Info("gateway key set updated", "keys", len(keys.Keys()))
+		case gatewayauth.ReasonOf(err) == gatewayauth.ReasonReplay:
+			// Already current.
+		default:
+			slog.Warn("gateway key set rejected", "err", err)
+		}
+	}
+	go func() {
+		refresh()
+		last := time.Now()
+		ticker := time.NewTicker(gatewayKeyRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-kick:
+				if time.Since(last) < gatewayKeyMinRefresh {
+					continue
+				}
+			}
+			refresh()
+			last = time.Now()
+		}
+	}()
+	return func() {
+		select {
+		case kick <- struct{}{}:
+		default:
+		}
+	}
+}
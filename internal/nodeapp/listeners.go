@@ -0,0 +1,109 @@
+package nodeapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/api"
+	"github.com/NetSepio/erebrus/internal/apitls"
+	"github.com/NetSepio/erebrus/internal/config"
+)
+
+// httpListener is one bound address and the API surfaces it serves.
+type httpListener struct {
+	cfg      config.Listener
+	surfaces []api.Surface
+	tls      *apitls.Bundle
+	srv      *http.Server
+}
+
+// planListeners groups the public, metrics and management surfaces by bind
+// address, so surfaces without their own port share the public listener.
+func planListeners(cfg *config.Config) []*httpListener {
+	var out []*httpListener
+	byAddr := map[string]*httpListener{}
+	for _, item := range []struct {
+		surface api.Surface
+		l       config.Listener
+	}{
+		{api.SurfacePublic, cfg.PublicListener()},
+		{api.SurfaceMetrics, cfg.MetricsListener()},
+		{api.SurfaceManagement, cfg.ManagementListener()},
+	} {
+		if hl, ok := byAddr[item.l.Addr()]; ok {
+			hl.surfaces = append(hl.surfaces, item.surface)
+			continue
+		}
+		hl := &httpListener{cfg: item.l, surfaces: []api.Surface{item.surface}}
+		byAddr[item.l.Addr()] = hl
+		out = append(out, hl)
+	}
+	return out
+}
+
+// prepareListenerTLS loads the certificate for every TLS listener and returns
+// the fingerprint of the one serving the management surface ("" when it is
+// plain HTTP or ACME-issued).
+func prepareListenerTLS(ctx context.Context, cfg *config.Config, st apitls.SettingsStore, listeners []*httpListener) (string, error) {
+	fingerprint := ""
+	for _, hl := range listeners {
+		if !hl.cfg.TLSEnabled() {
+			continue
+		}
+		bundle, err := apitls.Load(ctx, cfg, st, hl.cfg)
+		if err != nil {
+			return "", fmt.Errorf("listener %s: %w", hl.cfg.Addr(), err)
+		}
+		hl.tls = bundle
+		if slices.Contains(hl.surfaces, api.SurfaceManagement) {
+			fingerprint = bundle.Fingerprint
+		}
+	}
+	return fingerprint, nil
+}
+
+// startListeners builds an http.Server per planned listener and serves it in
+// the background. onFail is called if any listener exits unexpectedly.
+func startListeners(listeners []*httpListener, apiServer *api.Server, onFail func()) {
+	for _, hl := range listeners {
+		hl.srv = &http.Server{
+			Addr: hl.cfg.Addr(), Handler: apiServer.RouterFor(hl.surfaces...),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		if hl.tls != nil {
+			hl.srv.TLSConfig = hl.tls.Config
+		}
+		go func(hl *httpListener) {
+			slog.Info("HTTP API listening", "addr", hl.srv.Addr, "scheme", hl.cfg.Scheme(), "surfaces", hl.surfaces)
+			var err error
+			if hl.srv.TLSConfig != nil {
+				err = hl.srv.ListenAndServeTLS("", "")
+			} else {
+				err = hl.srv.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("http server error", "addr", hl.srv.Addr, "err", err)
+				onFail()
+			}
+		}(hl)
+	}
+}
+
+// shutdownListeners gracefully stops every listener, returning the first error.
+func shutdownListeners(ctx context.Context, listeners []*httpListener) error {
+	var first error
+	for _, hl := range listeners {
+		if hl.srv == nil {
+			continue
+		}
+		if err := hl.srv.Shutdown(ctx); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,421 @@
+package nodeapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/api"
+	"github.com/NetSepio/erebrus/internal/config"
+	"github.com/NetSepio/erebrus/internal/node"
+	"github.com/NetSepio/erebrus/internal/stealth"
+	"github.com/NetSepio/erebrus/internal/store"
+	"github.com/NetSepio/erebrus/internal/wg"
+	"github.com/google/uuid"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const peersUsage = `usage: erebrus-node peers <command>
+  add     [--name <name>] [--wallet <addr>] (--public-key <key> | --generate-keys) [--psk] [--expires 720h] [--id <id>] [--qr | --json]
+  list    [--json]
+  show    <id> [--qr | --json]
+  rm      <id>
+  suspend <id>
+  resume  <id>
+  export  [--out <file>]`
+
+// peerOps is where `erebrus-node peers` makes its changes: the running
+// node's admin socket, or the store directly (localPeers) otherwise.
+type peerOps interface {
+	addPeer(ctx context.Context, id string, req api.PeerRequest) (*api.CredentialBundle, error)
+	removePeer(ctx context.Context, id string) error
+	setPeerEnabled(ctx context.Context, id string, enabled bool) error
+	peerBundle(ctx context.Context, id string) (*api.CredentialBundle, error)
+	listPeers(ctx context.Context) ([]peerRow, error)
+}
+
+// peersCLI manages peers for nodes run without a gateway.
+type peersCLI struct {
+	ops peerOps
+}
+
+func runPeersCLI(args []string) error {
+	if len(args) == 0 {
+		return errors.New(peersUsage)
+	}
+	ctx := context.Background()
+	cfg := loadCLIConfig()
+	admin, err := dialAdmin(cfg)
+	if err != nil {
+		return err
+	}
+	pc := &peersCLI{ops: admin}
+	if admin == nil {
+		lp, err := openLocalPeers(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		defer lp.st.Close()
+		pc.ops = lp
+	}
+
+	cmd, rest := args[0], args[1:]
+	switch cmd {
+	case "add":
+		return pc.add(ctx, rest)
+	case "list", "ls":
+		return pc.list(ctx, rest)
+	case "show":
+		return pc.show(ctx, rest)
+	case "export":
+		return pc.export(ctx, rest)
+	case "rm", "suspend", "resume":
+		if len(rest) != 1 {
+			return fmt.Errorf("%s takes one peer id\n%s", cmd, peersUsage)
+		}
+		id := rest[0]
+		if cmd == "rm" {
+			err = pc.ops.removePeer(ctx, id)
+		} else {
+			err = pc.ops.setPeerEnabled(ctx, id, cmd == "resume")
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("peer %s %s\n", id, map[string]string{"rm": "removed", "suspend": "suspended", "resume": "resumed"}[cmd])
+		return nil
+	default:
+		return fmt.Errorf("unknown peers command %q\n%s", cmd, peersUsage)
+	}
+}
+
+// localPeers edits the store through node.Service with an offline WireGuard
+// controller, then asks the running node (if any) to apply the change to the
+// live interface. It is used when the admin socket is not available.
+type localPeers struct {
+	cfg *config.Config
+	st  *store.Store
+	svc *node.Service
+}
+
+func openLocalPeers(ctx context.Context, cfg *config.Config) (*localPeers, error) {
+	st, err := store.Open(cfg.DBPath())
+	if err != nil {
+		return nil, err
+	}
+	live := config.NewLive(cfg)
+	// The running node owns the device; this process only renders configs.
+	wgm := wg.New(live, st, wg.NewOfflineController())
+	if err := wgm.Init(ctx); err != nil {
+		st.Close()
+		return nil, fmt.Errorf("load WireGuard keys: %w", err)
+	}
+	var stealthMgr *stealth.Manager
+	if cfg.EnableStealth {
+		stealthMgr = stealth.New(live, st)
+		if err := stealthMgr.Init(ctx); err != nil { // loads secrets, no listeners
+			fmt.Fprintln(os.Stderr, "warning: stealth secrets unavailable; bundles omit stealth carriers:", err)
+			stealthMgr = nil
+		}
+	}
+	return &localPeers{cfg: cfg, st: st, svc: node.New(live, st, wgm, stealthMgr, nil)}, nil
+}
+
+func (lp *localPeers) addPeer(ctx context.Context, id string, req api.PeerRequest) (*api.CredentialBundle, error) {
+	if d, err := node.LoadDrainState(ctx, lp.st); err == nil && d.Active() {
+		return nil, errDraining
+	}
+	bundle, err := lp.svc.UpsertPeer(ctx, id, req)
+	if err != nil {
+		return nil, err
+	}
+	return bundle, lp.applyLive(ctx)
+}
+
+func (lp *localPeers) removePeer(ctx context.Context, id string) error {
+	if _, err := lp.st.GetPeer(ctx, id); err != nil {
+		return peerErr(id, err)
+	}
+	if err := lp.svc.DeletePeer(ctx, id); err != nil {
+		return err
+	}
+	return lp.applyLive(ctx)
+}
+
+func (lp *localPeers) setPeerEnabled(ctx context.Context, id string, enabled bool) error {
+	if err := lp.svc.SetPeerEnabled(ctx, id, enabled); err != nil {
+		return peerErr(id, err)
+	}
+	return lp.applyLive(ctx)
+}
+
+func (lp *localPeers) peerBundle(ctx context.Context, id string) (*api.CredentialBundle, error) {
+	bundle, err := lp.svc.Credentials(ctx, id)
+	return bundle, peerErr(id, err)
+}
+
+func (lp *localPeers) listPeers(ctx context.Context) ([]peerRow, error) {
+	// Handshakes are read-only, so the live device is fine to query here.
+	transfers, _ := wg.NewController().PeerTransfers(lp.cfg.WGInterface)
+	return peerRows(ctx, lp.st, transfers)
+}
+
+func (pc *peersCLI) add(ctx context.Context, args []string) error {
+	var (
+		req           api.PeerRequest
+		id            string
+		generate, psk bool
+		qr, asJSON    bool
+		expires       time.Duration
+	)
+	for i := 0; i < len(args); i++ {
+		flag := args[i]
+		needsValue := map[string]bool{"--name": true, "--wallet": true, "--public-key": true, "--expires": true, "--id": true}
+		if needsValue[flag] && i+1 >= len(args) {
+			return fmt.Errorf("%s requires a value", flag)
+		}
+		switch flag {
+		case "--name":
+			req.Name = args[i+1]
+			i++
+		case "--wallet":
+			req.Wallet = args[i+1]
+			i++
+		case "--public-key":
+			req.WGPublicKey = args[i+1]
+			i++
+		case "--id":
+			id = args[i+1]
+			i++
+		case "--expires":
+			d, err := time.ParseDuration(args[i+1])
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid --expires %q", args[i+1])
+			}
+			expires = d
+			i++
+		case "--generate-keys":
+			generate = true
+		case "--psk":
+			psk = true
+		case "--qr":
+			qr = true
+		case "--json":
+			asJSON = true
+		default:
+			return fmt.Errorf("unknown flag %s\n%s", flag, peersUsage)
+		}
+	}
+	if generate == (req.WGPublicKey != "") {
+		return errors.New("pass exactly one of --public-key or --generate-keys")
+	}
+	var privateKey string
+	if generate {
+		priv, err := wgtypes.GeneratePrivateKey()
+		if err != nil {
+			return err
+		}
+		privateKey, req.WGPublicKey = priv.String(), priv.PublicKey().String()
+	} else if _, err := wgtypes.ParseKey(req.WGPublicKey); err != nil {
+		return fmt.Errorf("invalid --public-key: %w", err)
+	}
+	if psk {
+		k, err := wgtypes.GenerateKey()
+		if err != nil {
+			return err
+		}
+		req.WGPresharedKey = k.String()
+	}
+	if id == "" {
+		id = uuid.NewString()
+	}
+	if req.Name == "" {
+		req.Name = "peer-" + id[:min(8, len(id))]
+	}
+	if expires > 0 {
+		req.ExpiresAt = time.Now().Add(expires).Unix()
+	}
+
+	bundle, err := pc.ops.addPeer(ctx, id, req)
+	if err != nil {
+		return err
+	}
+	if privateKey != "" {
+		bundle.WireGuard.ClientConf = strings.Replace(bundle.WireGuard.ClientConf, wg.PrivateKeyPlaceholder, privateKey, 1)
+	}
+	fmt.Fprintf(os.Stderr, "peer %s (%s) added at %s\n", bundle.ID, req.Name, bundle.WireGuard.Address)
+	return printBundle(bundle, qr, asJSON, privateKey != "")
+}
+
+func (pc *peersCLI) list(ctx context.Context, args []string) error {
+	asJSON := len(args) == 1 && args[0] == "--json"
+	if len(args) > 0 && !asJSON {
+		return fmt.Errorf("unexpected argument %s\n%s", args[0], peersUsage)
+	}
+	peers, err := pc.ops.listPeers(ctx)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(peers)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tADDRESS\tSTATUS\tEXPIRES\tLAST HANDSHAKE")
+	for _, p := range peers {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", p.ID, p.Name, p.WGAllowedIP,
+			peerStatus(p.PeerInfo), unixOr(p.ExpiresAt, "never"), unixOr(p.LastHandshake, "-"))
+	}
+	return tw.Flush()
+}
+
+func (pc *peersCLI) show(ctx context.Context, args []string) error {
+	var id string
+	var qr, asJSON bool
+	for _, a := range args {
+		switch {
+		case a == "--qr":
+			qr = true
+		case a == "--json":
+			asJSON = true
+		case id == "" && !strings.HasPrefix(a, "-"):
+			id = a
+		default:
+			return fmt.Errorf("unexpected argument %s\n%s", a, peersUsage)
+		}
+	}
+	if id == "" {
+		return fmt.Errorf("show takes a peer id\n%s", peersUsage)
+	}
+	bundle, err := pc.ops.peerBundle(ctx, id)
+	if err != nil {
+		return err
+	}
+	return printBundle(bundle, qr, asJSON, false)
+}
+
+// export writes every peer's credential bundle as a JSON array.
+func (pc *peersCLI) export(ctx context.Context, args []string) error {
+	out := ""
+	switch {
+	case len(args) == 2 && args[0] == "--out":
+		out = args[1]
+	case len(args) != 0:
+		return fmt.Errorf("usage: erebrus-node peers export [--out <file>]")
+	}
+	peers, err := pc.ops.listPeers(ctx)
+	if err != nil {
+		return err
+	}
+	bundles := make([]*api.CredentialBundle, 0, len(peers))
+	for _, p := range peers {
+		b, err := pc.ops.peerBundle(ctx, p.ID)
+		if err != nil {
+			return fmt.Errorf("peer %s: %w", p.ID, err)
+		}
+		bundles = append(bundles, b)
+	}
+	raw, _ := json.MarshalIndent(bundles, "", "  ")
+	raw = append(raw, '\n')
+	if out == "" {
+		_, err := os.Stdout.Write(raw)
+		return err
+	}
+	if err := os.WriteFile(out, raw, 0o600); err != nil {
+		return err
+	}
+	fmt.Printf("exported %d peer(s) to %s\n", len(bundles), out)
+	return nil
+}
+
+// applyLive asks the running node to push the store's peers to WireGuard
+// and waits briefly for it to confirm.
+func (lp *localPeers) applyLive(ctx context.Context) error {
+	token, err := node.MarkPeersChanged(ctx, lp.st)
+	if err != nil {
+		return err
+	}
+	if _, running := nodePID(lp.cfg); !running {
+		fmt.Fprintln(os.Stderr, "node not running; the change applies when it starts")
+		return nil
+	}
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+		time.Sleep(500 * time.Millisecond)
+		if ok, err := node.PeersApplied(ctx, lp.st, token); err == nil && ok {
+			fmt.Fprintln(os.Stderr, "applied to the running node")
+			return nil
+		}
+	}
+	return errors.New("saved, but the running node has not applied it within 10s; check its logs")
+}
+
+func printBundle(b *api.CredentialBundle, qr, asJSON, hasPrivateKey bool) error {
+	conf := b.WireGuard.ClientConf
+	switch {
+	case asJSON:
+		return printJSON(b)
+	case qr:
+		if !hasPrivateKey {
+			fmt.Fprintln(os.Stderr, "note: the node never stores client private keys; the QR code carries "+wg.PrivateKeyPlaceholder)
+		}
+		return printQR(conf)
+	}
+	fmt.Print(conf)
+	if !hasPrivateKey {
+		fmt.Fprintf(os.Stderr, "note: replace %s with the client's private key\n", wg.PrivateKeyPlaceholder)
+	}
+	for _, t := range b.Transports {
+		if t.Kind != "direct_wireguard_udp" {
+			fmt.Printf("# %s: %s\n", t.Kind, t.URI)
+		}
+	}
+	return nil
+}
+
+// printQR renders conf as a terminal QR code with qrencode, as wg-quick
+// users already do.
+func printQR(conf string) error {
+	path, err := exec.LookPath("qrencode")
+	if err != nil {
+		return errors.New("--qr needs qrencode on PATH (apk add libqrencode-tools, apt install qrencode)")
+	}
+	cmd := exec.Command(path, "-t", "ansiutf8")
+	cmd.Stdin = strings.NewReader(conf)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func peerStatus(p api.PeerInfo) string {
+	switch {
+	case !p.Enabled:
+		return "suspended"
+	case p.ExpiresAt > 0 && p.ExpiresAt < time.Now().Unix():
+		return "expired"
+	}
+	return "active"
+}
+
+func unixOr(ts int64, zero string) string {
+	if ts <= 0 {
+		return zero
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
+
+func peerErr(id string, err error) error {
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("unknown peer %s", id)
+	}
+	return err
+}
@@ -0,0 +1,135 @@
+package nodeapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/NetSepio/erebrus/transport"
+	"github.com/NetSepio/erebrus/transport/probe"
+)
+
+const probeUsage = "usage: erebrus-node probe <bundle.json|-> [--private-key-file <file>] [--count 5] [--timeout 30s] [--json]"
+
+// runProbeCLI measures every transport in a credential bundle from this
+// host, as the bundle's client would reach the node.
+func runProbeCLI(args []string) error {
+	var (
+		path, keyFile string
+		asJSON        bool
+		count         = 5
+		timeout       = 30 * time.Second
+	)
+	for i := 0; i < len(args); i++ {
+		flag := args[i]
+		needsValue := map[string]bool{"--private-key-file": true, "--count": true, "--timeout": true}
+		if needsValue[flag] && i+1 >= len(args) {
+			return fmt.Errorf("%s requires a value", flag)
+		}
+		switch flag {
+		case "--private-key-file":
+			keyFile = args[i+1]
+			i++
+		case "--count":
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid --count %q", args[i+1])
+			}
+			count = n
+			i++
+		case "--timeout":
+			d, err := time.ParseDuration(args[i+1])
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid --timeout %q", args[i+1])
+			}
+			timeout = d
+			i++
+		case "--json":
+			asJSON = true
+		default:
+			if strings.HasPrefix(flag, "--") || path != "" {
+				return fmt.Errorf("unexpected argument %s\n%s", flag, probeUsage)
+			}
+			path = flag
+		}
+	}
+	if path == "" {
+		return errors.New(probeUsage)
+	}
+
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	target, err := probe.ParseBundle(data)
+	if err != nil {
+		return err
+	}
+	if keyFile != "" {
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return err
+		}
+		if err := target.SetClientKey(string(key)); err != nil {
+			return fmt.Errorf("%s: %w", keyFile, err)
+		}
+	}
+	if target.WGClientKey == nil {
+		fmt.Fprintln(os.Stderr, "no client private key: direct WireGuard is skipped and carriers are timed by session setup only (use --private-key-file)")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	p := &probe.NetworkProber{Target: target, Count: count}
+	results := p.Probe(ctx, target.Kinds())
+	best, ok := transport.SelectBest(results)
+
+	if asJSON {
+		out := struct {
+			Results []transport.ProbeResult `json:"results"`
+			Best    transport.Kind          `json:"best,omitempty"`
+		}{Results: results}
+		if ok {
+			out.Best = best.Kind
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TRANSPORT\tRESULT\tLATENCY\tLOSS\tSCORE")
+		for _, r := range results {
+			if !r.Success {
+				fmt.Fprintf(tw, "%s\tfailed: %s\t-\t-\t-\n", r.Kind, r.Error)
+				continue
+			}
+			fmt.Fprintf(tw, "%s\tok\t%dms\t%.0f%%\t%d\n", r.Kind, r.LatencyMs, r.PacketLossPct, r.Score)
+		}
+		tw.Flush()
+		if ok {
+			fmt.Printf("best: %s\n", best.Kind)
+		}
+	}
+	if !ok {
+		return errors.New("no transport reachable")
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package nodeapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/config"
+	"github.com/NetSepio/erebrus/internal/readiness"
+	"github.com/NetSepio/erebrus/internal/stealth"
+	"github.com/NetSepio/erebrus/internal/wg"
+	"github.com/NetSepio/erebrus/transport/naive"
+	"github.com/NetSepio/erebrus/transport/probe"
+	"github.com/miekg/dns"
+	"github.com/sagernet/sing/common/uot"
+)
+
+// Readiness probes run once a minute. Each REALITY probe shows up in the
+// sing-box log as a connection closed after the handshake, so the interval
+// stays coarse.
+const (
+	probeInterval = time.Minute
+	probeTimeout  = 10 * time.Second
+)
+
+// nodeProbes returns the active readiness probes for this node. tunnelDNS is
+// the tunnel resolver's address, or "" when the node serves no DNS.
+func nodeProbes(live *config.Live, wgm *wg.Manager, sm *stealth.Manager, tunnelDNS string) []readiness.Probe {
+	cfg := live.Load()
+	probes := []readiness.Probe{{ID: "wireguard", Run: func(context.Context) (string, error) {
+		return probeWireGuard(wgm, cfg.WGEndpointPortInt())
+	}}}
+	if cfg.EnableStealth {
+		probes = append(probes,
+			readiness.Probe{ID: "stealth_vless_reality", Run: func(ctx context.Context) (string, error) {
+				return probeVLESS(ctx, sm.Params())
+			}},
+			readiness.Probe{ID: "stealth_hysteria2", Run: func(ctx context.Context) (string, error) {
+				return probeHysteria2(ctx, sm.Params())
+			}},
+			readiness.Probe{ID: "reality_target", Run: func(ctx context.Context) (string, error) {
+				cfg := live.Load() // the target and SNI follow a reload
+				target := cfg.RealityHandshakeTarget()
+				if err := probe.TLSHandshake(ctx, target, cfg.RealitySNI()); err != nil {
+					return "", fmt.Errorf("%s: %w", target, err)
+				}
+				return "TLS 1.3 from " + target, nil
+			}},
+		)
+	}
+	if cfg.TUICCarrierEnabled() {
+		probes = append(probes, readiness.Probe{ID: "stealth_tuic", Run: func(ctx context.Context) (string, error) {
+			return probeTUIC(ctx, sm.Params())
+		}})
+	}
+	if cfg.WebSocketCarrierEnabled() {
+		probes = append(probes, readiness.Probe{ID: "stealth_websocket_tls", Run: func(ctx context.Context) (string, error) {
+			return probeWebSocket(ctx, sm.Params())
+		}})
+	}
+	if cfg.HTTPSConnectCarrierEnabled() {
+		probes = append(probes, readiness.Probe{ID: "stealth_https_connect", Run: func(ctx context.Context) (string, error) {
+			return probeConnect(ctx, sm.Params())
+		}})
+	}
+	if tunnelDNS != "" {
+		probes = append(probes, readiness.Probe{ID: "tunnel_dns", Run: func(ctx context.Context) (string, error) {
+			return probeDNS(ctx, tunnelDNS)
+		}})
+	}
+	return probes
+}
+
+func probeWireGuard(wgm *wg.Manager, port int) (string, error) {
+	d, err := wgm.Device()
+	if err != nil {
+		return "", fmt.Errorf("device unavailable: %w", err)
+	}
+	if d.ListenPort != port {
+		return "", fmt.Errorf("listening on %d, expected %d", d.ListenPort, port)
+	}
+	return fmt.Sprintf("listening on %d, %d peers connected", d.ListenPort, d.Connected), nil
+}
+
+func probeVLESS(ctx context.Context, p stealth.Params) (string, error) {
+	if !p.Enabled {
+		return "", errors.New("carrier secrets not loaded")
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(p.VLESSPort))
+	conn, err := probe.RealityHandshake(ctx, addr, probe.RealityParams{
+		ServerName: p.SNI, PublicKey: p.RealityPublicKey, ShortID: p.RealityShortID,
+	})
+	if errors.Is(err, probe.ErrNoRealityClient) {
+		// Still proves the listener is up and reaches its handshake target.
+		if err := probe.TLSHandshake(ctx, addr, p.SNI); err != nil {
+			return "", err
+		}
+		return "TLS fallback ok (REALITY client not built in)", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	conn.Close()
+	return "REALITY handshake ok", nil
+}
+
+func probeHysteria2(ctx context.Context, p stealth.Params) (string, error) {
+	if !p.Enabled {
+		return "", errors.New("carrier secrets not loaded")
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(p.Hysteria2Port))
+	if err := probe.QUICHandshake(ctx, addr, p.SNI, p.Hysteria2Obfs); err != nil {
+		return "", err
+	}
+	return "QUIC handshake ok", nil
+}
+
+func probeTUIC(ctx context.Context, p stealth.Params) (string, error) {
+	if p.TUICPort == 0 {
+		return "", errors.New("carrier secrets not loaded")
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(p.TUICPort))
+	if err := probe.QUICHandshake(ctx, addr, p.SNI, ""); err != nil {
+		return "", err
+	}
+	return "QUIC handshake ok", nil
+}
+
+// probeWebSocket upgrades on the secret path at the origin, as the CDN would.
+// The origin certificate is not verified: CDNs accept self-signed ones.
+func probeWebSocket(ctx context.Context, p stealth.Params) (string, error) {
+	if p.WSPath == "" {
+		return "", errors.New("carrier secrets not loaded")
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(p.WSPort))
+	conn, err := probe.WebSocketHandshake(ctx, addr, probe.WebSocketParams{Host: p.WSHost, Path: p.WSPath, Insecure: true})
+	if err != nil {
+		return "", err
+	}
+	conn.Close()
+	return "WebSocket upgrade ok for " + p.WSHost, nil
+}
+
+// probeConnect opens an authenticated, padded CONNECT tunnel to the
+// UDP-over-TCP host, the only one the carrier accepts. The certificate is not
+// verified: a self-signed node has nothing to verify it against.
+func probeConnect(ctx context.Context, p stealth.Params) (string, error) {
+	if p.ConnectPassword == "" {
+		return "", errors.New("carrier secrets not loaded")
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(p.ConnectPort))
+	conn, err := naive.Dial(ctx, addr, naive.Params{
+		ServerName: p.ConnectHost, Username: p.ConnectUsername, Password: p.ConnectPassword, Insecure: true,
+	}, net.JoinHostPort(uot.MagicAddress, "443"))
+	if err != nil {
+		return "", err
+	}
+	conn.Close()
+	return "CONNECT tunnel ok for " + p.ConnectHost, nil
+}
+
+// probeDNS asks the tunnel resolver for the root NS set, which needs both
+// the listener and its upstream.
+func probeDNS(ctx context.Context, addr string) (string, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(".", dns.TypeNS)
+	resp, _, err := new(dns.Client).ExchangeContext(ctx, msg, addr)
+	if err != nil {
+		return "", err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return "", fmt.Errorf("%s from %s", dns.RcodeToString[resp.Rcode], addr)
+	}
+	return fmt.Sprintf("%d records from %s", len(resp.Answer), addr), nil
+}
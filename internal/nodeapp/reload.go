@@ -0,0 +1,406 @@
+package nodeapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/config"
+	dnspkg "github.com/NetSepio/erebrus/internal/dns"
+	"github.com/NetSepio/erebrus/internal/firewall"
+	"github.com/NetSepio/erebrus/internal/store"
+	"github.com/NetSepio/erebrus/internal/supervisor"
+	"github.com/NetSepio/erebrus/internal/wg"
+	"github.com/joho/godotenv"
+)
+
+const (
+	settingConfigReload = "config_reload"
+	pidFileName         = "erebrus-node.pid"
+)
+
+// Fields a reload applies, grouped by what has to happen after they are
+// published in the running config. Anything else that changed is reported as
+// needing a restart.
+var (
+	reloadStealthFields = []string{"RealityServerNames", "RealityHandshakeServer", "Hysteria2ObfsPassword",
+		"StealthWSHost", "StealthWSCertFile", "StealthWSKeyFile",
+		"StealthConnectHost", "StealthConnectCertFile", "StealthConnectKeyFile"}
+	reloadWGFields  = []string{"WGDNS", "WGPreUp", "WGPostUp", "WGPreDown", "WGPostDown"}
+	reloadDNSFields = []string{"UpstreamDNS", "PrivateDNSDomain", "DNSQueryLogs",
+		"ErebrusProfile", "FirewallProvider", "FirewallDNSAddr", "SentinelAPIURL"}
+	reloadInfoFields = []string{"NodeName", "Region", "Zone"}
+
+	// reloadRuntimeFields are filled from the node database or by the node
+	// itself after startup, so they always differ from a fresh Load.
+	reloadRuntimeFields = []string{"NodeID", "NodeToken", "NodeKey", "NodeAPIToken",
+		"GatewayPublicKey", "SentinelLicensed"}
+)
+
+// ReloadResult is the outcome of one config reload, persisted for the
+// reload CLI.
+type ReloadResult struct {
+	At              time.Time `json:"at"`
+	Applied         []string  `json:"applied,omitempty"`
+	RestartRequired []string  `json:"restart_required,omitempty"`
+	Errors          []string  `json:"errors,omitempty"`
+}
+
+// reloader re-reads the environment on SIGHUP (or an admin socket request)
+// and applies what changed to the running node.
+type reloader struct {
+	mu       sync.Mutex // one reload at a time
+	cfg      *config.Live
+	st       *store.Store
+	sup      *supervisor.Supervisor
+	wg       *wg.Manager
+	fw       *firewall.Client
+	onChange func() // e.g. push a heartbeat with the new name/region
+
+	envFile  string
+	envKeys  map[string]bool // keys last set from envFile
+	fileKeys map[string]bool // keys last set from the EREBRUS_CONFIG file
+}
+
+// envFilePath is the env file a reload re-reads: EREBRUS_ENV_FILE, else the
+// working directory's .env outside Docker. Empty means environment only.
+func envFilePath() string {
+	if p := os.Getenv("EREBRUS_ENV_FILE"); p != "" {
+		return p
+	}
+	if os.Getenv("LOAD_CONFIG_FILE") == "" {
+		return ".env"
+	}
+	return ""
+}
+
+// watch reloads on every SIGHUP until ctx is done.
+func (r *reloader) watch(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.apply(ctx)
+		}
+	}
+}
+
+// apply reloads and persists the result for the reload CLI.
+func (r *reloader) apply(ctx context.Context) ReloadResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := r.reload(ctx)
+	slog.Info("configuration reloaded", "applied", res.Applied,
+		"restart_required", res.RestartRequired, "errors", res.Errors)
+	raw, _ := json.Marshal(res)
+	if err := r.st.SetSetting(ctx, settingConfigReload, string(raw)); err != nil {
+		slog.Warn("persist reload result failed", "err", err)
+	}
+	return res
+}
+
+func (r *reloader) reload(ctx context.Context) ReloadResult {
+	res := ReloadResult{At: time.Now().UTC()}
+	if err := r.readEnvFile(); err != nil {
+		res.Errors = append(res.Errors, err.Error())
+		return res
+	}
+	if err := r.readConfigFile(); err != nil {
+		res.Errors = append(res.Errors, "invalid config file, nothing applied: "+err.Error())
+		return res
+	}
+	if errs, _ := config.CheckSchema(os.LookupEnv); len(errs) > 0 {
+		res.Errors = append(res.Errors, "invalid configuration, nothing applied: "+errors.Join(errs...).Error())
+		return res
+	}
+	next := config.Load()
+	if err := next.Validate(); err != nil {
+		res.Errors = append(res.Errors, "invalid configuration, nothing applied: "+err.Error())
+		return res
+	}
+
+	changed := map[string]bool{}
+	for _, f := range config.Diff(r.cfg.Load(), next) {
+		changed[f] = true
+	}
+	for _, f := range reloadRuntimeFields {
+		delete(changed, f)
+	}
+	take := func(fields []string) bool {
+		var hit []string
+		for _, f := range fields {
+			if changed[f] {
+				hit = append(hit, f)
+				delete(changed, f)
+			}
+		}
+		if len(hit) == 0 {
+			return false
+		}
+		r.cfg.Update(func(c *config.Config) { config.CopyFields(c, next, hit...) })
+		res.Applied = append(res.Applied, hit...)
+		return true
+	}
+	fail := func(what string, err error) {
+		res.Errors = append(res.Errors, fmt.Sprintf("%s: %v", what, err))
+	}
+
+	if take(reloadStealthFields) && r.sup.Has("stealth") {
+		if err := r.sup.Restart("stealth"); err != nil {
+			fail("restart stealth carriers", err)
+		}
+	}
+	if take(reloadWGFields) {
+		if err := r.wg.Apply(ctx); err != nil {
+			fail("re-render WireGuard config", err)
+		}
+	}
+	prevDNS := dnsComponent(r.cfg.Load())
+	if take(reloadDNSFields) {
+		licensed := sentinelLicensed(ctx, r.cfg.Load(), r.fw)
+		cfg := r.cfg.Update(func(c *config.Config) { c.SentinelLicensed = licensed })
+		switch want := dnsComponent(cfg); {
+		case want != prevDNS:
+			res.RestartRequired = append(res.RestartRequired,
+				fmt.Sprintf("tunnel DNS (%s -> %s)", dnsLabel(prevDNS), dnsLabel(want)))
+		case want != "":
+			if err := r.sup.Restart(want); err != nil {
+				fail("restart "+want, err)
+			}
+		}
+	}
+	if take(reloadInfoFields) && r.onChange != nil {
+		r.onChange()
+	}
+
+	for _, f := range config.Diff(r.cfg.Load(), next) {
+		if changed[f] {
+			res.RestartRequired = append(res.RestartRequired, f)
+		}
+	}
+	return res
+}
+
+// readEnvFile re-reads envFile with the precedence it had at startup: the
+// process environment wins, so only keys envFile set earlier, or that nothing
+// sets, take its values. The config file's keys are cleared first, since it
+// sits beneath both.
+func (r *reloader) readEnvFile() error {
+	for k := range r.fileKeys {
+		_ = os.Unsetenv(k)
+	}
+	r.fileKeys = nil
+	if r.envFile == "" {
+		return nil
+	}
+	keys, err := applyEnvFile(r.envFile, r.envKeys)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && os.Getenv("EREBRUS_ENV_FILE") == "" {
+			return nil
+		}
+		return fmt.Errorf("read %s: %w", r.envFile, err)
+	}
+	r.envKeys = keys
+	return nil
+}
+
+// applyEnvFile sets the keys of the env file at path that the environment
+// does not set otherwise, as godotenv.Load does, and returns the keys it now
+// owns. A key the environment already holds with the file's value counts as
+// the file's: Compose injects env_file entries that way. owned are the keys an
+// earlier call returned; they take the file's new values, or are unset when
+// the file no longer has them.
+func applyEnvFile(path string, owned map[string]bool) (map[string]bool, error) {
+	vals, err := godotenv.Read(path)
+	if err != nil {
+		return owned, err
+	}
+	for k := range owned {
+		if _, ok := vals[k]; !ok {
+			_ = os.Unsetenv(k)
+		}
+	}
+	set := map[string]bool{}
+	for k, v := range vals {
+		if cur, ok := os.LookupEnv(k); ok && cur != v && !owned[k] {
+			continue // set by the environment, e.g. Compose environment:
+		}
+		_ = os.Setenv(k, v)
+		set[k] = true
+	}
+	return set, nil
+}
+
+// readConfigFile re-applies the EREBRUS_CONFIG file underneath the
+// environment. readEnvFile has cleared the keys it set last time.
+func (r *reloader) readConfigFile() error {
+	path := config.FilePath()
+	if path == "" {
+		return nil
+	}
+	layer, err := config.ApplyFile(path)
+	if err != nil {
+		return err
+	}
+	r.fileKeys = layer.Applied
+	return nil
+}
+
+// dnsComponent names the supervised tunnel DNS component cfg calls for, or ""
+// when the node serves no tunnel DNS.
+func dnsComponent(cfg *config.Config) string {
+	switch {
+	case cfg.PrivateDNSEnabled:
+		return "private_dns"
+	case cfg.HasFirewallService() && cfg.SentinelLicensed:
+		return "dns_forwarder"
+	}
+	return ""
+}
+
+func dnsLabel(name string) string {
+	if name == "" {
+		return "none"
+	}
+	return name
+}
+
+// privateDNSConfig builds the private DNS server config from the current
+// (possibly reloaded) node config.
+func privateDNSConfig(cfg *config.Config, listen string) dnspkg.Config {
+	upstream := cfg.UpstreamDNS
+	if cfg.HasFirewallService() {
+		upstream = cfg.FirewallDNSAddr
+	}
+	return dnspkg.Config{
+		Enabled: true, Domain: cfg.PrivateDNSDomain, ListenAddr: listen,
+		Upstream: upstream, QueryLogs: cfg.DNSQueryLogs,
+	}
+}
+
+// sentinelLicensed reports the SentinelLicensed value for cfg's firewall
+// provider. Only erebrus-sentinel needs a license.
+func sentinelLicensed(ctx context.Context, cfg *config.Config, fw *firewall.Client) bool {
+	if !cfg.HasFirewallService() || cfg.FirewallProvider != config.FirewallUnboundErebrus {
+		return true
+	}
+	licensed, err := fw.CheckLicense(ctx)
+	if err != nil {
+		slog.Warn("sentinel license check failed", "err", err)
+		return true // dev fallback when sidecar not up yet
+	}
+	return licensed
+}
+
+func pidFilePath(cfg *config.Config) string { return filepath.Join(cfg.StateDir, pidFileName) }
+
+// writePIDFile records the node's PID so `erebrus-node reload` can signal it.
+func writePIDFile(cfg *config.Config) (remove func(), err error) {
+	path := pidFilePath(cfg)
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o600); err != nil {
+		return func() {}, err
+	}
+	return func() { _ = os.Remove(path) }, nil
+}
+
+// nodePID reads the pid file and reports whether that process is alive.
+func nodePID(cfg *config.Config) (int, bool) {
+	raw, err := os.ReadFile(pidFilePath(cfg))
+	if err != nil {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	return pid, syscall.Kill(pid, 0) == nil
+}
+
+// runReloadCLI asks the running node to reload, over the admin socket or
+// with SIGHUP, and prints what it applied.
+func runReloadCLI(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected argument %s\nusage: erebrus-node reload", args[0])
+	}
+	cfg := loadCLIConfig()
+	admin, err := dialAdmin(cfg)
+	if err != nil {
+		return err
+	}
+	if admin != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		var res ReloadResult
+		if err := admin.call(ctx, http.MethodPost, "/v1/reload", nil, &res); err != nil {
+			return err
+		}
+		return reportReload(res)
+	}
+	pid, running := nodePID(cfg)
+	if !running {
+		return fmt.Errorf("node not running (no live pid in %s)", pidFilePath(cfg))
+	}
+	st, err := store.Open(cfg.DBPath())
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+
+	sent := time.Now().UTC()
+	if err := syscall.Kill(pid, syscall.SIGHUP); err != nil {
+		return fmt.Errorf("signal node (pid %d): %w", pid, err)
+	}
+	ctx := context.Background()
+	for deadline := sent.Add(30 * time.Second); time.Now().Before(deadline); {
+		time.Sleep(500 * time.Millisecond)
+		raw, err := st.GetSetting(ctx, settingConfigReload)
+		if err != nil || raw == "" {
+			continue
+		}
+		var res ReloadResult
+		if json.Unmarshal([]byte(raw), &res) != nil || res.At.Before(sent) {
+			continue
+		}
+		return reportReload(res)
+	}
+	return fmt.Errorf("no reload result from pid %d within 30s; check the node logs", pid)
+}
+
+func reportReload(res ReloadResult) error {
+	printReloadResult(res)
+	if len(res.Errors) > 0 {
+		return fmt.Errorf("reload finished with errors")
+	}
+	return nil
+}
+
+func printReloadResult(res ReloadResult) {
+	if len(res.Applied) == 0 && len(res.RestartRequired) == 0 && len(res.Errors) == 0 {
+		fmt.Println("no configuration changes")
+		return
+	}
+	for _, f := range res.Applied {
+		fmt.Printf("applied:          %s\n", f)
+	}
+	for _, f := range res.RestartRequired {
+		fmt.Printf("restart required: %s\n", f)
+	}
+	for _, e := range res.Errors {
+		fmt.Printf("error:            %s\n", e)
+	}
+}
@@ -0,0 +1,47 @@
+package nodeapp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyEnvFileKeepsEnvironmentPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	write := func(s string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(s), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("EREBRUS_T_OVERRIDE", "compose")   // Compose environment: entry
+	t.Setenv("EREBRUS_T_INJECTED", "from-file") // Compose env_file entry
+	t.Setenv("EREBRUS_T_FILE", "")
+	os.Unsetenv("EREBRUS_T_FILE")
+	t.Setenv("EREBRUS_T_GONE", "")
+	os.Unsetenv("EREBRUS_T_GONE")
+
+	write("EREBRUS_T_OVERRIDE=file\nEREBRUS_T_INJECTED=from-file\nEREBRUS_T_FILE=one\nEREBRUS_T_GONE=x\n")
+	owned, err := applyEnvFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owned["EREBRUS_T_OVERRIDE"] || !owned["EREBRUS_T_INJECTED"] || !owned["EREBRUS_T_FILE"] {
+		t.Fatalf("startup owned = %v", owned)
+	}
+
+	write("EREBRUS_T_OVERRIDE=file2\nEREBRUS_T_INJECTED=edited\nEREBRUS_T_FILE=two\n")
+	if _, err := applyEnvFile(path, owned); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]string{
+		"EREBRUS_T_OVERRIDE": "compose", "EREBRUS_T_INJECTED": "edited", "EREBRUS_T_FILE": "two",
+	} {
+		if got := os.Getenv(k); got != want {
+			t.Errorf("%s = %q after reload, want %q", k, got, want)
+		}
+	}
+	if _, ok := os.LookupEnv("EREBRUS_T_GONE"); ok {
+		t.Error("key removed from the file is still set")
+	}
+}
@@ -3,6 +3,7 @@ package nodeapp
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
@@ -42,18 +43,32 @@ func runRotateCarriers(args []string) error {
 		}
 	}
 
-	// Carrier rotation is a local DB operation: it only needs the state store
-	// and the stealth secrets (node_settings). It must NOT run full node
-	// validation (WG_ENDPOINT_HOST/MNEMONIC) or bind the carrier ports — doing
-	// so would clash with an already-running node.
-	cfg := config.Load()
+	// A running node rotates and restarts its carriers itself.
+	cfg := loadCLIConfig()
+	admin, err := dialAdmin(cfg)
+	if err != nil {
+		return err
+	}
+	if admin != nil {
+		req := adminRotateRequest{GracePeriod: grace.String(), PeerID: peerID}
+		if err := admin.call(context.Background(), http.MethodPost, "/v1/carriers/rotate", req, nil); err != nil {
+			return err
+		}
+		fmt.Println("carrier secrets rotated; the running node is serving the new credentials. Old ones remain valid for the grace period.")
+		return nil
+	}
+
+	// Otherwise carrier rotation is a local DB operation: it only needs the
+	// state store and the stealth secrets (node_settings). It must NOT run full
+	// node validation (WG_ENDPOINT_HOST/MNEMONIC) or bind the carrier ports —
+	// doing so would clash with an already-running node.
 	st, err := store.Open(cfg.DBPath())
 	if err != nil {
 		return err
 	}
 	defer st.Close()
 
-	stealthMgr := stealth.New(cfg, st)
+	stealthMgr := stealth.New(config.NewLive(cfg), st)
 	if err := stealthMgr.Init(context.Background()); err != nil { // loads/creates secrets, no listeners
 		return err
 	}
@@ -2,19 +2,22 @@ package nodeapp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
-	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	"github.com/NetSepio/erebrus/internal/api"
+	"github.com/NetSepio/erebrus/internal/carriers"
 	"github.com/NetSepio/erebrus/internal/config"
+	"github.com/NetSepio/erebrus/internal/diag"
 	dnspkg "github.com/NetSepio/erebrus/internal/dns"
 	"github.com/NetSepio/erebrus/internal/drop"
 	"github.com/NetSepio/erebrus/internal/firewall"
+	"github.com/NetSepio/erebrus/internal/gatewayauth"
 	"github.com/NetSepio/erebrus/internal/gatewayclient"
 	"github.com/NetSepio/erebrus/internal/node"
 	"github.com/NetSepio/erebrus/internal/p2p"
@@ -25,22 +28,41 @@ import (
 	"github.com/NetSepio/erebrus/internal/speedtest"
 	"github.com/NetSepio/erebrus/internal/stealth"
 	"github.com/NetSepio/erebrus/internal/store"
+	"github.com/NetSepio/erebrus/internal/supervisor"
 	"github.com/NetSepio/erebrus/internal/telemetry"
-	"github.com/NetSepio/erebrus/internal/transport/probe"
 	"github.com/NetSepio/erebrus/internal/wg"
+	"github.com/NetSepio/erebrus/transport"
+	"github.com/NetSepio/erebrus/transport/probe"
 )
 
-// Run starts the VPN node until SIGINT/SIGTERM.
+// Run starts the VPN node until SIGINT/SIGTERM. It returns errRestart when
+// an upgrade or rollback needs the process restarted.
 func Run(cfg *config.Config) error {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	if best, ok := probe.Select(ctx, &probe.LocalProber{
+	local := &probe.LocalProber{
 		StealthEnabled: cfg.EnableStealth,
 		WGPort:         cfg.WGEndpointPortInt(),
 		VLESSPort:      cfg.VLESSPortInt(),
 		Hysteria2Port:  cfg.Hysteria2PortInt(),
-	}, cfg.EnableStealth); ok {
+	}
+	if cfg.TUICCarrierEnabled() {
+		local.TUICPort = cfg.StealthTUICPortInt()
+	}
+	if cfg.WebSocketCarrierEnabled() {
+		local.WebSocketPort = cfg.StealthWSPortInt()
+	}
+	if cfg.HTTPSConnectCarrierEnabled() {
+		local.ConnectPort = cfg.StealthConnectPortInt()
+	}
+	offer := transport.Offer{
+		Stealth:      cfg.EnableStealth,
+		TUIC:         cfg.TUICCarrierEnabled(),
+		WebSocketTLS: cfg.WebSocketCarrierEnabled(),
+		HTTPSConnect: cfg.HTTPSConnectCarrierEnabled(),
+	}
+	if best, ok := probe.Select(ctx, local, offer); ok {
 		slog.Info("transport ladder", "preferred", best.Kind, "score", best.Score)
 	}
 
@@ -60,39 +82,82 @@ func Run(cfg *config.Config) error {
 	}
 	defer st.Close()
 
+	// Components read the configuration through live; a reload publishes a
+	// new one instead of editing cfg underneath them. Startup still fills in
+	// cfg directly below, before the reloader runs.
+	live := config.NewLive(cfg)
+
+	upg := &upgrader{cfg: cfg, st: st, stop: stop}
+	pendingUpgrade, rolledBack := upg.boot(ctx)
+	if rolledBack {
+		return errRestart
+	}
+
 	metrics := telemetry.NewMetrics()
 	dropService := drop.NewService(cfg, metrics)
-	if err := dropService.Start(ctx); err != nil {
-		slog.Warn("Drop initialization failed; VPN remains available", "err", err)
+
+	// Long-lived subsystems start in the order added once the API and gateway
+	// are configured, and stop in reverse order on shutdown.
+	sup := supervisor.New(0)
+	if cfg.DropEnabled {
+		sup.Add(&supervisor.Func{ComponentName: "drop", StartFn: dropService.Start}, supervisor.Policy{Optional: true})
 	}
 
-	wgm := wg.New(cfg, st, wg.NewController())
+	wgm := wg.New(live, st, wg.NewController())
 	wgErr := wgm.Init(ctx)
 	wgOK := wgErr == nil
 	if !wgOK {
 		slog.Warn("wireguard interface init incomplete", "err", wgErr)
 	}
 
-	stealthMgr := stealth.New(cfg, st)
-	stealthOK := false
+	stealthMgr := stealth.New(live, st)
 	if err := stealthMgr.Init(ctx); err != nil {
 		slog.Warn("stealth init failed; carriers unavailable", "err", err)
-	} else if err := stealthMgr.Start(ctx); err != nil {
-		slog.Warn("stealth carriers failed to start", "err", err)
-	} else {
-		stealthOK = cfg.EnableStealth
-		if cfg.EnableStealth {
-			slog.Info("stealth carriers listening", "vless_port", cfg.VLESSPort, "hysteria2_port", cfg.Hysteria2Port)
-		}
-		defer stealthMgr.Close()
+	} else if cfg.EnableStealth {
+		sup.Add(&supervisor.Func{
+			ComponentName: "stealth",
+			StartFn: func(ctx context.Context) error {
+				if err := stealthMgr.Start(ctx); err != nil {
+					return err
+				}
+				cfg := live.Load()
+				attrs := []any{"vless_port", cfg.VLESSPort, "hysteria2_port", cfg.Hysteria2Port}
+				if cfg.TUICCarrierEnabled() {
+					attrs = append(attrs, "tuic_port", cfg.StealthTUICPort)
+				}
+				if cfg.WebSocketCarrierEnabled() {
+					attrs = append(attrs, "ws_host", cfg.StealthWSHost, "ws_port", cfg.StealthWSPort)
+				}
+				if cfg.HTTPSConnectCarrierEnabled() {
+					attrs = append(attrs, "connect_host", cfg.StealthConnectHost, "connect_port", cfg.StealthConnectPort)
+				}
+				slog.Info("stealth carriers listening", attrs...)
+				return nil
+			},
+			StopFn: func(context.Context) error { return stealthMgr.Close() },
+			HealthFn: func() error {
+				if !stealthMgr.Running() {
+					return errors.New("sing-box not running")
+				}
+				return nil
+			},
+		}, supervisor.Policy{})
 	}
 
-	p2pNode, err := p2p.Start(ctx, cfg.Mnemonic, cfg.P2PListenPort, cfg.GatewayPeerMultiaddr)
-	if err != nil {
-		slog.Warn("libp2p host failed to start", "err", err)
-	} else {
-		defer p2pNode.Close()
-	}
+	var p2pNode *p2p.Node
+	sup.Add(&supervisor.Func{
+		ComponentName: "libp2p",
+		StartFn: func(ctx context.Context) (err error) {
+			p2pNode, err = p2p.Start(ctx, cfg.Mnemonic, cfg.P2PListenPort, cfg.GatewayPeerMultiaddr)
+			return err
+		},
+		StopFn: func(context.Context) error {
+			if p2pNode == nil {
+				return nil
+			}
+			return p2pNode.Close()
+		},
+	}, supervisor.Policy{Optional: true})
 
 	reg := registrar.New(cfg.ChainRegistration)
 	if err := reg.Register(ctx, registrar.NodeIdentity{
@@ -104,60 +169,66 @@ func Run(cfg *config.Config) error {
 
 	svcReg := &services.Registry{St: st}
 	tunnelDNS := dnspkg.DefaultListenAddr(cfg.WGIPv4Subnet, cfg.PrivateDNSAddr)
+	servedDNS := "" // tunnelDNS once a DNS component serves it
 
-	fwClient := firewall.New(cfg)
-	if cfg.HasFirewallService() && cfg.FirewallProvider == config.FirewallUnboundErebrus {
-		if licensed, err := fwClient.CheckLicense(ctx); err != nil {
-			slog.Warn("sentinel license check failed", "err", err)
-			cfg.SentinelLicensed = true // dev fallback when sidecar not up yet
-		} else {
-			cfg.SentinelLicensed = licensed
-		}
-	} else {
-		cfg.SentinelLicensed = true
-	}
+	fwClient := firewall.New(live)
+	cfg.SentinelLicensed = sentinelLicensed(ctx, cfg, fwClient)
 
+	// DNS components rebuild their config from live on every start so a
+	// reload can swap upstreams by restarting them.
 	if cfg.PrivateDNSEnabled {
-		upstream := cfg.UpstreamDNS
-		if cfg.HasFirewallService() {
-			upstream = cfg.FirewallDNSAddr
-		}
-		dnsCfg := dnspkg.Config{
-			Enabled: true, Domain: cfg.PrivateDNSDomain, ListenAddr: tunnelDNS,
-			Upstream: upstream, QueryLogs: cfg.DNSQueryLogs,
-		}
-		if err := dnsCfg.Validate(); err != nil {
+		if err := privateDNSConfig(cfg, tunnelDNS).Validate(); err != nil {
 			slog.Warn("private DNS disabled", "err", err)
 		} else {
-			go func() {
-				if err := dnspkg.New(dnsCfg, svcReg).Start(ctx); err != nil {
-					slog.Warn("private DNS stopped", "err", err)
+			sup.Add(supervisor.Blocking("private_dns", func(ctx context.Context) error {
+				dnsCfg := privateDNSConfig(live.Load(), tunnelDNS)
+				if err := dnsCfg.Validate(); err != nil {
+					return err
 				}
-			}()
+				return dnspkg.New(dnsCfg, svcReg).Start(ctx)
+			}), supervisor.Policy{})
+			servedDNS = tunnelDNS
 		}
 	} else if cfg.HasFirewallService() && cfg.SentinelLicensed {
-		fwd := dnspkg.ForwarderConfig{ListenAddr: tunnelDNS, Upstream: cfg.FirewallDNSAddr}
-		go func() {
-			if err := dnspkg.NewForwarder(fwd).Start(ctx); err != nil {
-				slog.Warn("firewall DNS forwarder stopped", "err", err)
-			}
-		}()
+		sup.Add(supervisor.Blocking("dns_forwarder", func(ctx context.Context) error {
+			fwd := dnspkg.ForwarderConfig{ListenAddr: tunnelDNS, Upstream: live.Load().FirewallDNSAddr}
+			return dnspkg.NewForwarder(fwd).Start(ctx)
+		}), supervisor.Policy{})
+		servedDNS = tunnelDNS
 		slog.Info("firewall DNS forwarder listening", "addr", tunnelDNS, "upstream", cfg.FirewallDNSAddr)
 	} else if cfg.HasFirewallService() && !cfg.SentinelLicensed {
 		slog.Warn("sentinel unlicensed — VPN DNS forwarding disabled")
 	}
 
-	agent := serviceagent.New(cfg)
+	agent := serviceagent.New(live)
 	agent.Start(ctx)
 
-	svc := node.New(cfg, st, wgm, stealthMgr, metrics)
-	apiServer := api.NewServer(cfg, svc, api.Identity{PeerID: peerID, DID: did})
+	svc := node.New(live, st, wgm, stealthMgr, metrics)
+	if err := svc.SyncCarrierUsers(ctx); err != nil {
+		slog.Warn("load peer carrier users failed", "err", err)
+	}
+	apiServer := api.NewServer(live, svc, api.Identity{PeerID: peerID, DID: did})
 	apiServer.SetDropService(dropService)
+	apiServer.SetMetrics(metrics)
 	apiServer.SetWireGuardPublicKeyProvider(wgm.ServerPublicKey)
 	svc.SetAPIStatusHook(apiServer.SetStatus)
 
+	listeners := planListeners(cfg)
+	apiCertSHA256, err := prepareListenerTLS(ctx, cfg, st, listeners)
+	if err != nil {
+		return fmt.Errorf("API TLS: %w", err)
+	}
+	if apiCertSHA256 != "" {
+		slog.Info("management API certificate", "sha256", apiCertSHA256)
+	}
+
+	diags := &diagnostics{cfg: cfg, st: st}
+
 	var gwClient *gatewayclient.Client
 	if cfg.GatewayEnabled() {
+		// One registration serves every endpoint; REST calls follow the one
+		// the control plane is using.
+		gateways := gatewayclient.NewGateways(cfg.GatewayURLs)
 		creds, err := gatewayclient.LoadCredentials(ctx, st)
 		if err != nil {
 			slog.Warn("load gateway credentials failed", "err", err)
@@ -183,12 +254,17 @@ func Run(cfg *config.Config) error {
 			cfg.GatewayPublicKey = creds.GatewayPublicKey
 		}
 		if (nodeID == "" || nodeToken == "") && cfg.GatewayAutoRegister {
-			regOut, err := gatewayclient.Register(ctx, gatewayclient.RegistrationInput{
-				GatewayURL: cfg.GatewayURL, RegistrationToken: cfg.EffectiveRegistrationToken(),
-				WalletChain: cfg.WalletChain, Mnemonic: cfg.Mnemonic, PeerID: peerID, DID: did,
-				Name: cfg.NodeName, Region: cfg.Region, Zone: cfg.Zone,
-				APIBaseURL: cfg.PublicAPIBaseURL(), NodeKey: cfg.EffectiveNodeKey(),
-				AccessMode: cfg.Mode.GatewayAccessMode(), DeploymentProfile: cfg.ErebrusProfile,
+			var regOut *gatewayclient.RegistrationResult
+			err := gateways.Try(ctx, func(base string) error {
+				var err error
+				regOut, err = gatewayclient.Register(ctx, gatewayclient.RegistrationInput{
+					GatewayURL: base, RegistrationToken: cfg.EffectiveRegistrationToken(),
+					WalletChain: cfg.WalletChain, Mnemonic: cfg.Mnemonic, PeerID: peerID, DID: did,
+					Name: cfg.NodeName, Region: cfg.Region, Zone: cfg.Zone,
+					APIBaseURL: cfg.PublicAPIBaseURL(), APICertSHA256: apiCertSHA256, NodeKey: cfg.EffectiveNodeKey(),
+					AccessMode: cfg.Mode.GatewayAccessMode(), DeploymentProfile: cfg.ErebrusProfile,
+				})
+				return err
 			})
 			if err != nil {
 				slog.Warn("gateway registration failed", "err", err)
@@ -211,21 +287,37 @@ func Run(cfg *config.Config) error {
 			}
 		}
 		cfg.NodeID = nodeID
+		gwKeys, err := gatewayclient.LoadGatewayKeys(ctx, st, cfg.GatewayPublicKey)
+		if err != nil {
+			slog.Warn("load gateway key set failed", "err", err)
+			gwKeys = gatewayauth.NewKeySet(gatewayauth.Key{PublicKey: cfg.GatewayPublicKey})
+		}
+		apiServer.SetGatewayKeys(gwKeys, startGatewayKeyRefresher(ctx, gateways, st, gwKeys))
 		if nodeID != "" && nodeToken != "" {
 			speedtestCache := speedtest.NewCache()
 			speedtestCache.Start(ctx)
 			bridge := node.NewGatewayBridge(svc, peerID, did, nodeID, speedtestCache, agent, fwClient, dropService)
-			gwClient = gatewayclient.New(cfg.GatewayURL, nodeID, nodeToken, bridge, bridge, bridge.Status)
+			bridge.SetAPIEndpoint(cfg.PublicAPIBaseURL(), apiCertSHA256)
+			bridge.SetGatewayKeys(gwKeys)
+			bridge.SetDiagnostics(diags.collect)
+			bridge.SetUpgrader(upg.install)
+			gwClient = gatewayclient.New(gateways.Active(), nodeID, nodeToken, bridge, bridge, bridge.Status)
+			gwClient.SetGateways(gateways)
+			journal := gatewayclient.NewJournal(st)
+			if err := journal.Recover(ctx); err != nil {
+				slog.Warn("recover gateway command journal failed", "err", err)
+			}
+			gwClient.SetJournal(journal)
 			refreshKey := cfg.EffectiveNodeKey()
 			gwClient.SetTokenRefresher(func(ctx context.Context) (string, error) {
 				if refreshKey == "" {
 					return "", fmt.Errorf("node_key not configured")
 				}
-				tok, err := gatewayclient.RefreshNodeToken(ctx, cfg.GatewayURL, nodeID, refreshKey)
+				tok, err := gatewayclient.RefreshNodeToken(ctx, gateways.Active(), nodeID, refreshKey)
 				if err != nil {
 					return "", err
 				}
-				cfg.NodeToken = tok
+				live.Update(func(c *config.Config) { c.NodeToken = tok })
 				if err := gatewayclient.SaveCredentials(ctx, st, &gatewayclient.Credentials{
 					NodeID: nodeID, NodeToken: tok, NodeKey: refreshKey, GatewayPublicKey: cfg.GatewayPublicKey,
 				}); err != nil {
@@ -233,7 +325,10 @@ func Run(cfg *config.Config) error {
 				}
 				return tok, nil
 			})
-			go gwClient.Run(ctx)
+			sup.Add(supervisor.Blocking("gateway", func(ctx context.Context) error {
+				gwClient.Run(ctx)
+				return nil
+			}), supervisor.Policy{})
 
 			// Shield: configure AdGuard's admin login and report it to the gateway
 			// (revealed to org paid seats). Best-effort — never blocks startup.
@@ -244,7 +339,7 @@ func Run(cfg *config.Config) error {
 						slog.Warn("adguard admin configure failed", "err", err)
 					}
 					user, pass, url := fwClient.AdminCredentials()
-					if err := gatewayclient.PostFirewallCredentials(ctx, cfg.GatewayURL, reportNodeID, reportToken, user, pass, url); err != nil {
+					if err := gatewayclient.PostFirewallCredentials(ctx, gateways.Active(), reportNodeID, reportToken, user, pass, url); err != nil {
 						slog.Warn("report firewall credentials failed", "err", err)
 					}
 				}()
@@ -254,7 +349,9 @@ func Run(cfg *config.Config) error {
 		}
 	}
 
-	apiServer.SetReadinessProvider(func() readiness.Input {
+	prober := readiness.NewProber(probeInterval, probeTimeout, nodeProbes(live, wgm, stealthMgr, servedDNS)...)
+	readinessInput := func() readiness.Input {
+		cfg := live.Load()
 		gwReg, gwConn := false, false
 		if cfg.GatewayEnabled() {
 			if cred, err := gatewayclient.LoadCredentials(ctx, st); err == nil && cred.NodeID != "" && cred.NodeToken != "" {
@@ -270,28 +367,88 @@ func Run(cfg *config.Config) error {
 		}
 		return readiness.Input{
 			Cfg: cfg, IdentityConfigured: true, GatewayRegistered: gwReg, GatewayConnected: gwConn,
-			WireGuardOK: wgOK, StealthListening: stealthOK, FirewallOK: fwOK, FirewallDetail: fwDetail,
-			DropState: dropService.Snapshot().State,
+			WireGuardOK: wgOK, StealthListening: stealthMgr.Running(), FirewallOK: fwOK, FirewallDetail: fwDetail,
+			DropState: dropService.Snapshot().State, Components: sup.Statuses(), Probes: prober.Results(),
+			Started: prober.Ran(),
 		}
-	})
+	}
+	apiServer.SetReadinessProvider(readinessInput)
+	diags.gw = gwClient
+	diags.sources = func() diag.Sources {
+		return diag.Sources{
+			Cfg: live.Load(), Store: st, WG: wg.NewController(), Inbounds: stealthMgr.Inbounds,
+			Logs: telemetry.RecentLogs, Live: true,
+			Readiness: func() readiness.Report { return readiness.Evaluate(readinessInput()) },
+		}
+	}
 	apiServer.SetServiceSnapshot(agent.Snapshot)
 
-	srv := &http.Server{
-		Addr: fmt.Sprintf("%s:%s", cfg.BindAddr, cfg.HTTPPort), Handler: apiServer.Router(),
-		ReadHeaderTimeout: 10 * time.Second,
-	}
+	svc.SetDrainHook(func(node.DrainState) {
+		if gwClient != nil {
+			gwClient.HeartbeatNow()
+		}
+	})
+	go svc.RunDrain(ctx)
+	go svc.RunPeerSync(ctx)
+
+	sup.Start(ctx)
+	startListeners(listeners, apiServer, stop)
+	go prober.Run(ctx)
 
-	go func() {
-		slog.Info("HTTP API listening", "addr", srv.Addr)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			slog.Error("http server error", "err", err)
-			stop()
+	reload := &reloader{cfg: live, st: st, sup: sup, wg: wgm, fw: fwClient,
+		envFile: envFilePath(), envKeys: startupEnvKeys, fileKeys: startupFileKeys}
+	reload.onChange = func() {
+		if gwClient != nil {
+			gwClient.HeartbeatNow()
 		}
-	}()
+	}
+	go reload.watch(ctx)
+	go diags.watch(ctx)
+	go upg.watch(ctx)
+	if pendingUpgrade != nil {
+		go upg.verify(ctx, pendingUpgrade, func() readiness.Report { return readiness.Evaluate(readinessInput()) })
+	}
+	admin := &adminServer{cfg: cfg, st: st, svc: svc, wg: wgm, status: apiServer.RouterFor(api.SurfacePublic),
+		reload: reload, diags: diags}
+	rotator := &carriers.Rotator{St: st, Stealth: stealthMgr}
+	if cfg.EnableStealth {
+		go rotator.RunExpiry(ctx)
+	}
+	admin.rotate = func(ctx context.Context, opt carriers.Options) error {
+		if err := rotator.Rotate(ctx, opt); err != nil {
+			return err
+		}
+		// Serve the new secrets now instead of at the next restart.
+		if sup.Has("stealth") {
+			return sup.Restart("stealth")
+		}
+		return nil
+	}
+	if path := cfg.AdminSocketPath(); path != "" {
+		if err := admin.listen(path, cfg.AdminSocketGroup); err != nil {
+			slog.Warn("admin socket unavailable; CLI commands fall back to the database", "path", path, "err", err)
+		}
+	}
+	if removePID, err := writePIDFile(cfg); err != nil {
+		slog.Warn("write pid file failed; `erebrus-node reload`, `diag` and `upgrade` cannot signal the node, use kill -HUP", "err", err)
+	} else {
+		defer removePID()
+	}
 
 	<-ctx.Done()
 	slog.Info("shutting down")
 	shutCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	return srv.Shutdown(shutCtx)
+	if err := admin.shutdown(shutCtx); err != nil {
+		slog.Warn("admin socket shutdown", "err", err)
+	}
+	err = shutdownListeners(shutCtx, listeners)
+	sup.Stop(shutCtx)
+	if upg.restartRequested() {
+		if err != nil {
+			slog.Warn("shutdown before restart", "err", err)
+		}
+		return errRestart
+	}
+	return err
 }
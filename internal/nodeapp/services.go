@@ -7,7 +7,6 @@ import (
 	"os"
 	"strconv"
 
-	"github.com/NetSepio/erebrus/internal/config"
 	"github.com/NetSepio/erebrus/internal/services"
 	"github.com/NetSepio/erebrus/internal/store"
 )
@@ -16,7 +15,7 @@ func runServicesCLI(args []string) error {
 	if len(args) == 0 {
 		return fmt.Errorf("usage: erebrus services list|inspect <id>|remove <id>|serve --name <name> --port <port> [--type <type>]")
 	}
-	cfg := config.Load()
+	cfg := loadCLIConfig()
 	st, err := store.Open(cfg.DBPath())
 	if err != nil {
 		return err
@@ -77,7 +76,7 @@ func runServeCLI(args []string) error {
 	if name == "" || port == 0 {
 		return fmt.Errorf("usage: erebrus serve --name <name> --port <port> [--type <type>]")
 	}
-	cfg := config.Load()
+	cfg := loadCLIConfig()
 	st, err := store.Open(cfg.DBPath())
 	if err != nil {
 		return err
@@ -1,6 +1,8 @@
 package nodeapp
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -15,7 +17,6 @@ import (
 func runStatusCLI(args []string) error {
 	preboot := false
 	jsonOut := false
-	url := fmt.Sprintf("http://127.0.0.1:%s/api/v2/status", envOr("HTTP_PORT", "9080"))
 
 	for _, a := range args {
 		switch a {
@@ -37,15 +38,9 @@ func runStatusCLI(args []string) error {
 		return printStatus(rep, jsonOut)
 	}
 
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Get(url)
+	body, err := fetchStatus(loadCLIConfig())
 	if err != nil {
-		return fmt.Errorf("node not reachable at %s: %w (is erebrus running?)", url, err)
-	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+		return err
 	}
 
 	if jsonOut {
@@ -134,6 +129,41 @@ func runStatusCLI(args []string) error {
 	return nil
 }
 
+// fetchStatus reads the running node's status over the admin socket, or
+// from the public listener on loopback when the socket is not available.
+func fetchStatus(cfg *config.Config) ([]byte, error) {
+	admin, err := dialAdmin(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if admin != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		var body []byte
+		err := admin.call(ctx, http.MethodGet, "/v1/status", nil, &body)
+		return body, err
+	}
+
+	pub := cfg.PublicListener()
+	url := fmt.Sprintf("%s://127.0.0.1:%s/api/v2/status", pub.Scheme(), pub.Port)
+	client := &http.Client{Timeout: 5 * time.Second}
+	if pub.TLSEnabled() {
+		// Loopback to our own listener; the cert is self-signed (pinned by the
+		// gateway) or issued for the public hostname, not 127.0.0.1.
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}} //nolint:gosec
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("node not reachable at %s: %w (is erebrus running?)", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
+
 func printStatus(rep readiness.Report, jsonOut bool) error {
 	if jsonOut {
 		b, _ := json.MarshalIndent(rep, "", "  ")
@@ -153,10 +183,3 @@ func printStatus(rep readiness.Report, jsonOut bool) error {
 	}
 	return nil
 }
-
-func envOr(key, def string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
-	}
-	return def
-}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/NetSepio/erebrus/internal/config"
 	"github.com/NetSepio/erebrus/internal/services"
 	"github.com/NetSepio/erebrus/internal/store"
 	"github.com/NetSepio/erebrus/internal/templates"
@@ -25,7 +24,7 @@ func runTemplatesCLI(args []string) error {
 		if len(args) < 2 {
 			return fmt.Errorf("usage: erebrus templates install <name>")
 		}
-		cfg := config.Load()
+		cfg := loadCLIConfig()
 		st, err := store.Open(cfg.DBPath())
 		if err != nil {
 			return err
@@ -0,0 +1,342 @@
+package nodeapp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/config"
+	"github.com/NetSepio/erebrus/internal/gatewayclient"
+	"github.com/NetSepio/erebrus/internal/readiness"
+	"github.com/NetSepio/erebrus/internal/store"
+	"github.com/NetSepio/erebrus/internal/upgrade"
+)
+
+const upgradeUsage = "usage: erebrus-node upgrade [--check | --status] [--manifest <url>] [--force] [--no-wait]"
+
+const (
+	// maxUpgradeBoots is how many times a pending upgrade may start before it
+	// is treated as a crash loop and rolled back.
+	maxUpgradeBoots = 3
+	// restartDelay lets the upgrade command result reach the gateway before
+	// the node goes down.
+	restartDelay      = 3 * time.Second
+	upgradePollPeriod = 5 * time.Second
+)
+
+// errRestart is returned by Run when the node should restart into the binary
+// now on disk (after an upgrade or a rollback).
+var errRestart = errors.New("restart requested")
+
+// upgrader runs self-updates inside the node and verifies them after the
+// restart into the new binary.
+type upgrader struct {
+	cfg     *config.Config
+	st      *store.Store
+	stop    context.CancelFunc
+	restart atomic.Bool
+}
+
+// install fetches, verifies and swaps in a release newer than the running
+// one, then restarts the node. manifestURL defaults to UPGRADE_MANIFEST_URL.
+func (u *upgrader) install(ctx context.Context, manifestURL string) (*upgrade.State, error) {
+	if manifestURL == "" {
+		manifestURL = u.cfg.UpgradeManifestURL
+	}
+	if s, err := upgrade.LoadState(ctx, u.st); err == nil && s != nil && s.Status == upgrade.StatusPending {
+		return s, fmt.Errorf("upgrade to %s is still being verified", s.ToVersion)
+	}
+	key, err := upgrade.ReleaseKey(u.cfg.UpgradeReleaseKey)
+	if err != nil {
+		return nil, err
+	}
+	exe, err := upgrade.Executable()
+	if err != nil {
+		return nil, err
+	}
+	gatewayclient.ReportProgress(ctx, "downloading release", 10)
+	s, err := (&upgrade.Fetcher{Key: key}).Install(ctx, u.st, manifestURL, exe, u.cfg.Version, false)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("upgrade installed; restarting", "from", s.FromVersion, "to", s.ToVersion, "exe", s.Exe)
+	gatewayclient.ReportProgress(ctx, "restarting", 90)
+	u.requestRestart(restartDelay)
+	return s, nil
+}
+
+func (u *upgrader) requestRestart(after time.Duration) {
+	if u.restart.Swap(true) {
+		return
+	}
+	time.AfterFunc(after, u.stop)
+}
+
+// restartRequested reports whether Run should return errRestart.
+func (u *upgrader) restartRequested() bool { return u.restart.Load() }
+
+// watch restarts the node on SIGUSR2 when `erebrus-node upgrade` has
+// installed a newer binary next to it.
+func (u *upgrader) watch(ctx context.Context) {
+	usr2 := make(chan os.Signal, 1)
+	signal.Notify(usr2, syscall.SIGUSR2)
+	defer signal.Stop(usr2)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-usr2:
+			s, err := upgrade.LoadState(ctx, u.st)
+			if err != nil || s == nil || s.Status != upgrade.StatusPending || s.ToVersion == u.cfg.Version {
+				slog.Warn("SIGUSR2 without a pending upgrade; ignoring")
+				continue
+			}
+			slog.Info("upgrade installed by CLI; restarting", "from", s.FromVersion, "to", s.ToVersion)
+			u.requestRestart(0)
+		}
+	}
+}
+
+// boot runs before anything else starts. It counts starts of a pending
+// upgrade and, after maxUpgradeBoots, restores the previous binary; the
+// returned state is non-nil when the caller must verify readiness.
+func (u *upgrader) boot(ctx context.Context) (pending *upgrade.State, rolledBack bool) {
+	s, err := upgrade.LoadState(ctx, u.st)
+	if err != nil {
+		slog.Warn("load upgrade state failed", "err", err)
+		return nil, false
+	}
+	if s == nil || s.Status != upgrade.StatusPending {
+		return nil, false
+	}
+	if u.cfg.Version != s.ToVersion {
+		// The restart never reached the new binary (or someone put the old
+		// one back); nothing to verify.
+		u.finish(ctx, s, upgrade.StatusFailed, fmt.Sprintf("node restarted on %s, not %s", u.cfg.Version, s.ToVersion))
+		return nil, false
+	}
+	s.Boots++
+	if s.Boots > maxUpgradeBoots {
+		u.rollback(ctx, s, fmt.Sprintf("%s restarted %d times before becoming ready", s.ToVersion, s.Boots-1))
+		return nil, true
+	}
+	if err := upgrade.SaveState(ctx, u.st, s); err != nil {
+		slog.Warn("persist upgrade state failed", "err", err)
+	}
+	slog.Info("verifying upgrade", "from", s.FromVersion, "to", s.ToVersion, "deadline", u.cfg.UpgradeHealthTimeout)
+	return s, false
+}
+
+// verify commits s once the node reports ready, or rolls back and restarts
+// into the previous binary when UPGRADE_HEALTH_TIMEOUT passes first.
+func (u *upgrader) verify(ctx context.Context, s *upgrade.State, report func() readiness.Report) {
+	deadline := time.NewTimer(u.cfg.UpgradeHealthTimeout)
+	defer deadline.Stop()
+	tick := time.NewTicker(upgradePollPeriod)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			if report().OK {
+				u.finish(ctx, s, upgrade.StatusCommitted, "")
+				_ = os.Remove(s.Prev)
+				slog.Info("upgrade committed", "version", s.ToVersion)
+				return
+			}
+		case <-deadline.C:
+			u.rollback(ctx, s, fmt.Sprintf("%s not ready after %s: %s", s.ToVersion, u.cfg.UpgradeHealthTimeout, failingChecks(report())))
+			u.requestRestart(0)
+			return
+		}
+	}
+}
+
+func (u *upgrader) rollback(ctx context.Context, s *upgrade.State, reason string) {
+	slog.Error("upgrade failed; restoring previous binary", "from", s.FromVersion, "to", s.ToVersion, "reason", reason)
+	if err := upgrade.Restore(s.Exe, s.Prev); err != nil {
+		u.finish(ctx, s, upgrade.StatusFailed, reason+"; restore previous binary: "+err.Error())
+		return
+	}
+	u.finish(ctx, s, upgrade.StatusRolledBack, reason)
+}
+
+func (u *upgrader) finish(ctx context.Context, s *upgrade.State, status, reason string) {
+	s.Status, s.Error, s.FinishedAt = status, reason, time.Now().UTC()
+	if err := upgrade.SaveState(ctx, u.st, s); err != nil {
+		slog.Warn("persist upgrade state failed", "err", err)
+	}
+}
+
+func failingChecks(r readiness.Report) string {
+	var ids []string
+	for _, c := range r.Checks {
+		if !c.Optional && !c.OK {
+			ids = append(ids, c.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return "not ready"
+	}
+	return "failing " + strings.Join(ids, ", ")
+}
+
+// restartNode replaces this process with the binary now on disk, or asks
+// systemd to restart the unit, per UPGRADE_RESTART.
+func restartNode(cfg *config.Config) error {
+	if cfg.UpgradeRestart == config.UpgradeRestartSystemd {
+		slog.Info("restarting via systemd", "unit", cfg.UpgradeSystemdUnit)
+		return exec.Command("systemctl", "--no-block", "restart", cfg.UpgradeSystemdUnit).Run()
+	}
+	exe, err := upgrade.Executable()
+	if err != nil {
+		return err
+	}
+	slog.Info("re-executing", "exe", exe)
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
+
+// runUpgradeCLI installs a release next to the running node and signals it
+// to restart, then follows the new binary's readiness verification.
+func runUpgradeCLI(args []string) error {
+	var (
+		manifestURL string
+		check       bool
+		status      bool
+		force       bool
+		noWait      bool
+	)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--manifest":
+			if i+1 >= len(args) {
+				return fmt.Errorf("--manifest requires a value")
+			}
+			manifestURL = args[i+1]
+			i++
+		case "--check":
+			check = true
+		case "--status":
+			status = true
+		case "--force":
+			force = true
+		case "--no-wait":
+			noWait = true
+		default:
+			return fmt.Errorf("unexpected argument %s\n%s", args[i], upgradeUsage)
+		}
+	}
+
+	cfg := loadCLIConfig()
+	if manifestURL == "" {
+		manifestURL = cfg.UpgradeManifestURL
+	}
+	st, err := store.Open(cfg.DBPath())
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	ctx := context.Background()
+
+	if status {
+		s, err := upgrade.LoadState(ctx, st)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("running:  %s\n", cfg.Version)
+		printUpgradeState(s)
+		return nil
+	}
+
+	key, err := upgrade.ReleaseKey(cfg.UpgradeReleaseKey)
+	if err != nil {
+		return err
+	}
+	f := &upgrade.Fetcher{Key: key}
+	if check {
+		if manifestURL == "" {
+			return errors.New("no manifest URL (set UPGRADE_MANIFEST_URL or pass --manifest)")
+		}
+		m, err := f.Manifest(ctx, manifestURL)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("running:  %s\n", cfg.Version)
+		fmt.Printf("latest:   %s\n", m.Version)
+		if upgrade.Newer(m.Version, cfg.Version) {
+			fmt.Println("an upgrade is available")
+		} else {
+			fmt.Println("up to date")
+		}
+		return nil
+	}
+
+	if s, err := upgrade.LoadState(ctx, st); err == nil && s != nil && s.Status == upgrade.StatusPending {
+		return fmt.Errorf("upgrade to %s is still being verified", s.ToVersion)
+	}
+	exe, err := upgrade.Executable()
+	if err != nil {
+		return err
+	}
+	s, err := f.Install(ctx, st, manifestURL, exe, cfg.Version, force)
+	if errors.Is(err, upgrade.ErrUpToDate) {
+		fmt.Println(err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("installed %s over %s (previous binary kept at %s)\n", s.ToVersion, s.FromVersion, s.Prev)
+
+	pid, running := nodePID(cfg)
+	if !running {
+		fmt.Println("node not running; the upgrade is verified on its next start")
+		return nil
+	}
+	if err := syscall.Kill(pid, syscall.SIGUSR2); err != nil {
+		return fmt.Errorf("signal node (pid %d): %w", pid, err)
+	}
+	if noWait {
+		fmt.Println("node restarting; check `erebrus-node upgrade --status`")
+		return nil
+	}
+	fmt.Println("node restarting; waiting for readiness...")
+	// Restart, readiness deadline and a rollback restart.
+	for deadline := time.Now().Add(cfg.UpgradeHealthTimeout + 2*time.Minute); time.Now().Before(deadline); {
+		time.Sleep(2 * time.Second)
+		cur, err := upgrade.LoadState(ctx, st)
+		if err != nil || cur == nil || cur.Status == upgrade.StatusPending {
+			continue
+		}
+		printUpgradeState(cur)
+		if cur.Status != upgrade.StatusCommitted {
+			return fmt.Errorf("upgrade %s", strings.ReplaceAll(cur.Status, "_", " "))
+		}
+		return nil
+	}
+	return errors.New("upgrade still pending; check the node logs and `erebrus-node upgrade --status`")
+}
+
+func printUpgradeState(s *upgrade.State) {
+	if s == nil {
+		fmt.Println("upgrade:  none recorded")
+		return
+	}
+	fmt.Printf("upgrade:  %s -> %s (%s)\n", s.FromVersion, s.ToVersion, s.Status)
+	fmt.Printf("started:  %s\n", s.StartedAt.Format(time.RFC3339))
+	if !s.FinishedAt.IsZero() {
+		fmt.Printf("finished: %s\n", s.FinishedAt.Format(time.RFC3339))
+	}
+	if s.Error != "" {
+		fmt.Printf("error:    %s\n", s.Error)
+	}
+}
@@ -0,0 +1,107 @@
+package readiness
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Probe actively exercises one subsystem. Run returns a short detail on
+// success; an error fails the check and becomes its detail.
+type Probe struct {
+	ID       string
+	Optional bool
+	Run      func(ctx context.Context) (string, error)
+}
+
+// Prober runs probes periodically and keeps the latest result of each.
+type Prober struct {
+	interval time.Duration
+	timeout  time.Duration
+	probes   []Probe
+
+	mu      sync.Mutex
+	results map[string]Check
+	ran     bool
+}
+
+// NewProber returns a prober that runs probes every interval, giving each
+// at most timeout.
+func NewProber(interval, timeout time.Duration, probes ...Probe) *Prober {
+	return &Prober{interval: interval, timeout: timeout, probes: probes, results: map[string]Check{}}
+}
+
+// Run probes immediately and then every interval until ctx is done.
+func (p *Prober) Run(ctx context.Context) {
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		p.RunOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// RunOnce runs every probe concurrently and records the results.
+func (p *Prober) RunOnce(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, pr := range p.probes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := p.run(ctx, pr)
+			p.mu.Lock()
+			p.results[pr.ID] = c
+			p.mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	p.mu.Lock()
+	p.ran = true
+	p.mu.Unlock()
+}
+
+// Ran reports whether a full round of probes has completed.
+func (p *Prober) Ran() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.ran
+}
+
+func (p *Prober) run(ctx context.Context, pr Probe) Check {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	start := time.Now()
+	detail, err := pr.Run(ctx)
+	c := Check{
+		ID: pr.ID, OK: err == nil, Detail: detail, Optional: pr.Optional,
+		CheckedAt: start.UTC(), LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		c.Detail = err.Error()
+	}
+	return c
+}
+
+// Results returns the latest result of every probe that has run, in the
+// order the probes were given.
+func (p *Prober) Results() []Check {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]Check, 0, len(p.results))
+	for _, pr := range p.probes {
+		if c, ok := p.results[pr.ID]; ok {
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -4,8 +4,10 @@ package readiness
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/NetSepio/erebrus/internal/config"
+	"github.com/NetSepio/erebrus/internal/supervisor"
 )
 
 // Check is one readiness predicate.
@@ -14,6 +16,9 @@ type Check struct {
 	OK       bool   `json:"ok"`
 	Detail   string `json:"detail,omitempty"`
 	Optional bool   `json:"optional,omitempty"`
+	// CheckedAt and LatencyMs are set on results of active probes.
+	CheckedAt time.Time `json:"checked_at,omitzero"`
+	LatencyMs float64   `json:"latency_ms,omitempty"`
 }
 
 // Report is the aggregate readiness result exposed on /api/v2/status.
@@ -34,6 +39,15 @@ type Input struct {
 	FirewallOK         bool
 	FirewallDetail     string
 	DropState          string
+	// Components is the supervisor's view of the node subsystems.
+	Components []supervisor.Status
+	// Probes are the latest active probe results. A "wireguard" probe
+	// replaces the WireGuardOK check and "stealth_*" probes replace the
+	// StealthListening check; the booleans only count until probes have run.
+	Probes []Check
+	// Started is set once every subsystem has started and the first round
+	// of probes has completed.
+	Started bool
 }
 
 // Evaluate builds a readiness report from config and runtime signals.
@@ -55,31 +69,88 @@ func Evaluate(in Input) Report {
 			Detail: cfg.WGEndpointHost,
 		},
 		apiKeyCheck(cfg),
-		{
-			ID:     "wireguard",
-			OK:     in.WireGuardOK,
-			Detail: wireguardDetail(in.WireGuardOK),
-		},
 	}
-	checks = append(checks, stealthCheck(cfg, in.StealthListening))
+	probed := map[string]bool{}
+	stealthProbed := false
+	for _, p := range in.Probes {
+		probed[p.ID] = true
+		if strings.HasPrefix(p.ID, "stealth_") {
+			stealthProbed = true
+		}
+	}
+	if !probed["wireguard"] {
+		checks = append(checks, Check{ID: "wireguard", OK: in.WireGuardOK, Detail: wireguardDetail(in.WireGuardOK)})
+	}
+	if !stealthProbed {
+		checks = append(checks, stealthCheck(cfg, in.StealthListening))
+	}
+	checks = append(checks, in.Probes...)
 	checks = append(checks, firewallCheck(cfg, in.FirewallOK, in.FirewallDetail))
 	checks = append(checks, dropCheck(cfg, in.DropState))
 	checks = append(checks, controlPlaneCheck(cfg, in.GatewayRegistered, in.GatewayConnected))
+	checks = append(checks, managementAPICheck(cfg))
+	for _, c := range in.Components {
+		checks = append(checks, componentCheck(c))
+	}
 
 	warnings := append([]string{}, cfg.Mode.Warnings...)
+	return Report{OK: passes(checks), Checks: checks, Warnings: warnings}
+}
 
-	ok := true
-	for _, c := range checks {
-		if c.Optional {
+// Live reports whether the node process is up and serving. It fails only
+// when restarting the process would help, never for a subsystem the
+// supervisor is already restarting.
+func Live(in Input) Report {
+	checks := []Check{{ID: "ping", OK: true, Detail: "serving"}}
+	if in.Cfg == nil {
+		checks = append(checks, Check{ID: "config", OK: false, Detail: "configuration not loaded"})
+	}
+	return Report{OK: passes(checks), Checks: checks}
+}
+
+// Startup reports whether the node has finished starting. Once it passes,
+// Live and Evaluate take over.
+func Startup(in Input) Report {
+	c := Check{ID: "started", OK: in.Started, Detail: "subsystems started, first probe round complete"}
+	if !in.Started {
+		c.Detail = "starting"
+	}
+	return Report{OK: c.OK, Checks: []Check{c}}
+}
+
+// Exclude returns r without the named checks, with OK recomputed over the
+// rest, and the names that matched no check.
+func (r Report) Exclude(ids ...string) (Report, []string) {
+	drop := map[string]bool{}
+	for _, id := range ids {
+		drop[id] = false
+	}
+	out := Report{Warnings: r.Warnings, Checks: []Check{}}
+	for _, c := range r.Checks {
+		if _, ok := drop[c.ID]; ok {
+			drop[c.ID] = true
 			continue
 		}
-		if !c.OK {
-			ok = false
-			break
+		out.Checks = append(out.Checks, c)
+	}
+	out.OK = passes(out.Checks)
+	var unmatched []string
+	for _, id := range ids {
+		if !drop[id] {
+			unmatched = append(unmatched, id)
 		}
 	}
+	return out, unmatched
+}
 
-	return Report{OK: ok, Checks: checks, Warnings: warnings}
+// passes reports whether every required check is OK.
+func passes(checks []Check) bool {
+	for _, c := range checks {
+		if !c.Optional && !c.OK {
+			return false
+		}
+	}
+	return true
 }
 
 func identityDetail(configured, hasMnemonic bool) string {
@@ -196,6 +267,42 @@ func controlPlaneCheck(cfg *config.Config, registered, connected bool) Check {
 	}
 }
 
+// componentCheck reports one supervised subsystem; a restarting component
+// fails readiness unless its policy marks it optional.
+func componentCheck(c supervisor.Status) Check {
+	detail := c.State
+	if c.Restarts > 0 {
+		detail += fmt.Sprintf(" (%d restarts)", c.Restarts)
+	}
+	if c.LastError != "" && c.State != supervisor.StateRunning {
+		detail += ": " + c.LastError
+	}
+	return Check{
+		ID:       "component_" + c.Name,
+		OK:       c.State == supervisor.StateRunning,
+		Detail:   detail,
+		Optional: c.Optional,
+	}
+}
+
+// managementAPICheck reports which listener the gateway must reach for peer
+// provisioning. A loopback-only management listener is unreachable unless
+// API_PUBLIC_URL points at a tunnel or proxy in front of it.
+func managementAPICheck(cfg *config.Config) Check {
+	mgmt := cfg.ManagementListener()
+	if !cfg.GatewayEnabled() {
+		return Check{ID: "management_api", OK: true, Optional: true, Detail: "listening on " + mgmt.Addr()}
+	}
+	if mgmt.Loopback() && strings.TrimSpace(cfg.APIPublicURL) == "" {
+		return Check{
+			ID:     "management_api",
+			OK:     false,
+			Detail: fmt.Sprintf("bound to %s — gateway cannot reach it; set MANAGEMENT_BIND_ADDR or API_PUBLIC_URL", mgmt.Addr()),
+		}
+	}
+	return Check{ID: "management_api", OK: true, Detail: "gateway provisions via " + cfg.PublicAPIBaseURL()}
+}
+
 // Preboot evaluates config-only checks before the node process is running.
 func Preboot(cfg *config.Config) Report {
 	if cfg == nil {
@@ -212,15 +319,8 @@ func Preboot(cfg *config.Config) Report {
 	}
 	checks = append(checks, Check{ID: "drop", OK: true, Optional: true, Detail: "checked after node start"})
 	checks = append(checks, Check{ID: "control_plane", OK: true, Optional: true, Detail: "checked after node start"})
-
-	ok := true
-	for _, c := range checks {
-		if !c.Optional && !c.OK {
-			ok = false
-			break
-		}
-	}
-	return Report{OK: ok, Checks: checks, Warnings: append([]string{}, cfg.Mode.Warnings...)}
+	checks = append(checks, managementAPICheck(cfg))
+	return Report{OK: passes(checks), Checks: checks, Warnings: append([]string{}, cfg.Mode.Warnings...)}
 }
 
 // AccessModeLabel returns the access mode name for display (Private, Public).
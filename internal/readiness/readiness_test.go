@@ -1,9 +1,12 @@
 package readiness
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/NetSepio/erebrus/internal/config"
+	"github.com/NetSepio/erebrus/internal/supervisor"
 )
 
 func TestEvaluateReadyPrivate(t *testing.T) {
@@ -99,3 +102,126 @@ func TestZoneLabel(t *testing.T) {
 		t.Fatalf("custom zone = %q", ZoneLabel("nyc-1"))
 	}
 }
+
+func TestEvaluateComponents(t *testing.T) {
+	cfg := config.Load()
+	cfg.Mnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	cfg.WGEndpointHost = "203.0.113.1"
+	cfg.NodeAPIToken = "secret"
+	cfg.RunType = "release"
+
+	in := Input{
+		Cfg: cfg, IdentityConfigured: true, WireGuardOK: true, StealthListening: true,
+		GatewayRegistered: true, GatewayConnected: true,
+		Components: []supervisor.Status{
+			{Name: "private_dns", State: supervisor.StateRunning},
+			{Name: "libp2p", State: supervisor.StateFailed, LastError: "bind: address in use", Optional: true},
+		},
+	}
+	if r := Evaluate(in); !r.OK {
+		t.Fatalf("optional component failure should not block readiness: %+v", r)
+	}
+
+	in.Components[0] = supervisor.Status{Name: "private_dns", State: supervisor.StateRestarting, Restarts: 2, LastError: "listen udp: permission denied"}
+	r := Evaluate(in)
+	if r.OK {
+		t.Fatal("expected restarting required component to fail readiness")
+	}
+	for _, c := range r.Checks {
+		if c.ID == "component_private_dns" && c.Detail != "restarting (2 restarts): listen udp: permission denied" {
+			t.Fatalf("detail = %q", c.Detail)
+		}
+	}
+}
+
+func TestEvaluateProbesReplaceBooleans(t *testing.T) {
+	cfg := config.Load()
+	cfg.Mnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	cfg.WGEndpointHost = "203.0.113.1"
+	cfg.NodeAPIToken = "secret"
+	cfg.RunType = "release"
+	cfg.EnableStealth = true
+
+	in := Input{
+		Cfg: cfg, IdentityConfigured: true, WireGuardOK: true, StealthListening: true,
+		Probes: []Check{
+			{ID: "wireguard", OK: true, Detail: "listening on 51820"},
+			{ID: "stealth_hysteria2", OK: false, Detail: "timeout: no recent network activity"},
+		},
+	}
+	r := Evaluate(in)
+	if r.OK {
+		t.Fatal("a failing carrier probe must fail readiness despite StealthListening")
+	}
+	ids := map[string]int{}
+	for _, c := range r.Checks {
+		ids[c.ID]++
+	}
+	if ids["stealth"] != 0 || ids["wireguard"] != 1 || ids["stealth_hysteria2"] != 1 {
+		t.Fatalf("checks = %v", ids)
+	}
+
+	in.Probes = nil
+	in.StealthListening = false
+	if r := Evaluate(in); r.OK {
+		t.Fatal("without probes the booleans must still count")
+	}
+}
+
+func TestProber(t *testing.T) {
+	p := NewProber(time.Hour, 50*time.Millisecond,
+		Probe{ID: "ok", Run: func(context.Context) (string, error) { return "fine", nil }},
+		Probe{ID: "slow", Optional: true, Run: func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}},
+	)
+	if got := p.Results(); len(got) != 0 {
+		t.Fatalf("results before first run = %+v", got)
+	}
+	p.RunOnce(context.Background())
+	got := p.Results()
+	if len(got) != 2 || got[0].ID != "ok" || got[1].ID != "slow" {
+		t.Fatalf("results = %+v", got)
+	}
+	if !got[0].OK || got[0].Detail != "fine" || got[0].CheckedAt.IsZero() {
+		t.Fatalf("ok probe = %+v", got[0])
+	}
+	if got[1].OK || !got[1].Optional || got[1].Detail != context.DeadlineExceeded.Error() || got[1].LatencyMs < 50 {
+		t.Fatalf("slow probe = %+v", got[1])
+	}
+}
+
+func TestLiveAndStartup(t *testing.T) {
+	cfg := config.Load()
+	if r := Live(Input{Cfg: cfg}); !r.OK {
+		t.Fatalf("live should pass while serving even if unready: %+v", r)
+	}
+	if r := Live(Input{}); r.OK {
+		t.Fatal("live without config should fail")
+	}
+	if r := Startup(Input{Cfg: cfg}); r.OK {
+		t.Fatal("startup should fail until started")
+	}
+	if r := Startup(Input{Cfg: cfg, Started: true}); !r.OK {
+		t.Fatalf("startup = %+v", r)
+	}
+}
+
+func TestReportExclude(t *testing.T) {
+	r := Report{Checks: []Check{
+		{ID: "identity", OK: true},
+		{ID: "wireguard", OK: false},
+		{ID: "drop", OK: false, Optional: true},
+	}}
+	got, unmatched := r.Exclude("wireguard", "nope")
+	if !got.OK || len(got.Checks) != 2 {
+		t.Fatalf("excluded report = %+v", got)
+	}
+	if len(unmatched) != 1 || unmatched[0] != "nope" {
+		t.Fatalf("unmatched = %v", unmatched)
+	}
+	if got, _ := r.Exclude(); got.OK || len(got.Checks) != 3 {
+		t.Fatalf("no exclusions = %+v", got)
+	}
+}
@@ -14,14 +14,14 @@ import (
 
 // Agent polls local firewall sidecars and exposes health for status/heartbeats.
 type Agent struct {
-	cfg *config.Config
+	cfg *config.Live
 
 	mu       sync.RWMutex
 	snapshot map[string]string
 }
 
 // New constructs an Agent.
-func New(cfg *config.Config) *Agent {
+func New(cfg *config.Live) *Agent {
 	return &Agent{cfg: cfg, snapshot: map[string]string{"vpn": "active"}}
 }
 
@@ -49,20 +49,21 @@ func (a *Agent) check() {
 	a.mu.Lock()
 	a.snapshot = status
 	a.mu.Unlock()
-	slog.Info("service health", "profile", a.cfg.ErebrusProfile, "services", status)
+	slog.Info("service health", "profile", a.cfg.Load().ErebrusProfile, "services", status)
 }
 
 func (a *Agent) probeAll() map[string]string {
+	cfg := a.cfg.Load()
 	out := map[string]string{"vpn": "active"}
-	if !a.cfg.HasFirewallService() {
+	if !cfg.HasFirewallService() {
 		return out
 	}
-	switch a.cfg.FirewallProvider {
+	switch cfg.FirewallProvider {
 	case config.FirewallAdGuardHome:
-		out["community_firewall"] = probeHTTP(a.cfg.ShieldAdminURL + "/")
+		out["community_firewall"] = probeHTTP(cfg.ShieldAdminURL + "/")
 	case config.FirewallUnboundErebrus:
-		state := probeHTTP(a.cfg.SentinelAPIURL + "/health")
-		if !a.cfg.SentinelLicensed {
+		state := probeHTTP(cfg.SentinelAPIURL + "/health")
+		if !cfg.SentinelLicensed {
 			out["erebrus_firewall"] = "unlicensed"
 		} else {
 			out["erebrus_firewall"] = state
@@ -106,16 +107,17 @@ func (a *Agent) Snapshot() map[string]string {
 
 // FirewallOK reports whether the configured firewall sidecar is healthy enough for readiness.
 func (a *Agent) FirewallOK() (bool, string) {
-	if !a.cfg.HasFirewallService() {
+	cfg := a.cfg.Load()
+	if !cfg.HasFirewallService() {
 		return true, "not configured"
 	}
 	snap := a.Snapshot()
-	switch a.cfg.FirewallProvider {
+	switch cfg.FirewallProvider {
 	case config.FirewallAdGuardHome:
 		st := snap["community_firewall"]
 		return st == "active", st
 	case config.FirewallUnboundErebrus:
-		if !a.cfg.SentinelLicensed {
+		if !cfg.SentinelLicensed {
 			return false, "unlicensed"
 		}
 		st := snap["erebrus_firewall"]
@@ -0,0 +1,115 @@
+package stealth
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/NetSepio/erebrus/transport/naive"
+)
+
+// startConnect serves the HTTPS CONNECT carrier. sing-box's naive inbound
+// resets any request that is not a proxy CONNECT, which gives the listener
+// away to an active probe; naive.Handler answers those with a plain 404
+// instead. It only relays UDP-over-TCP to the local WireGuard listener, the
+// same pin the direct outbound gives the sing-box carriers. Peers log in
+// with their UUID and password.
+func (m *Manager) startConnect() (*http.Server, error) {
+	cfg := m.cfg.Load()
+	var cert tls.Certificate
+	var err error
+	if cfg.StealthConnectCertFile != "" {
+		cert, err = tls.LoadX509KeyPair(cfg.StealthConnectCertFile, cfg.StealthConnectKeyFile)
+	} else {
+		cert, err = tls.X509KeyPair([]byte(m.certPEM), []byte(m.keyPEM))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("https connect certificate: %w", err)
+	}
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.StealthConnectPortInt()))
+	if err != nil {
+		return nil, err
+	}
+	users := &connectUsers{base: User{Name: "erebrus", UUID: m.secrets.ConnectUsername, Password: m.secrets.ConnectPassword}}
+	m.addServer(users)
+	srv := &http.Server{
+		Handler: &naive.Handler{
+			Authorize: users.authorize,
+			Upstream:  &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: cfg.WGEndpointPortInt()},
+		},
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"h2", "http/1.1"},
+			MinVersion:   tls.VersionTLS12,
+		},
+		ReadHeaderTimeout: 10 * time.Second,
+		ErrorLog:          log.New(io.Discard, "", 0), // scanners' failed handshakes
+	}
+	go func() {
+		if err := srv.ServeTLS(ln, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("https connect carrier stopped", "err", err)
+		}
+	}()
+	return srv, nil
+}
+
+// connectUsers is the HTTPS CONNECT carrier's user list: the node-wide login
+// (UUID is its username) and one per peer.
+type connectUsers struct {
+	base     User
+	mu       sync.Mutex
+	logins   map[string]User // by username
+	sessions sessions
+}
+
+// setUsers takes the peers only: the grace entries hold replaced VLESS and
+// Hysteria2 credentials, which were never CONNECT logins.
+func (c *connectUsers) setUsers(peers, _ []User) {
+	logins := make(map[string]User, len(peers)+1)
+	var names []string
+	for _, u := range append([]User{c.base}, peers...) {
+		if u.UUID != "" && u.Password != "" {
+			logins[u.UUID] = u
+			names = append(names, u.Name)
+		}
+	}
+	c.mu.Lock()
+	c.logins = logins
+	c.mu.Unlock()
+	c.sessions.reset(names)
+}
+
+// authorize admits a tunnel with a known login. The tunnel's context ends
+// when the user is revoked, which closes it.
+func (c *connectUsers) authorize(ctx context.Context, username, password string) (context.Context, bool) {
+	c.mu.Lock()
+	u, ok := c.logins[username]
+	c.mu.Unlock()
+	if !ok || subtle.ConstantTimeCompare([]byte(password), []byte(u.Password)) != 1 {
+		return nil, false
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	release, ok := c.sessions.add(u.Name, closerFunc(cancel), nil)
+	if !ok {
+		cancel()
+		return nil, false
+	}
+	context.AfterFunc(ctx, func() { release(nil) })
+	return ctx, true
+}
+
+type closerFunc func()
+
+func (f closerFunc) Close() error {
+	f()
+	return nil
+}
@@ -0,0 +1,102 @@
+package stealth
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// keyGrace holds the carrier credentials rotations replaced, as a JSON list.
+const keyGrace = "stealth_grace"
+
+// grace is a replaced set of node-wide credentials that the carriers keep
+// accepting until ExpiresAt, so clients have time to fetch new links.
+type grace struct {
+	VLESSUUID         string `json:"vless_uuid"`
+	Hysteria2Password string `json:"hysteria2_password"`
+	RealityShortID    string `json:"reality_short_id"`
+	WSPath            string `json:"ws_path,omitempty"`
+	ExpiresAt         int64  `json:"expires_at"`
+}
+
+// user is the carrier user the replaced credentials authenticate as. The
+// short-id is random per rotation, so the name is stable for the entry's
+// lifetime.
+func (g grace) user() User {
+	return User{Name: "previous:" + g.RealityShortID, UUID: g.VLESSUUID, Password: g.Hysteria2Password}
+}
+
+// loadGrace returns the stored entries that have not expired by now.
+func loadGrace(ctx context.Context, st SettingsStore, now time.Time) ([]grace, error) {
+	v, err := st.GetSetting(ctx, keyGrace)
+	if err != nil || v == "" {
+		return nil, err
+	}
+	var all []grace
+	if err := json.Unmarshal([]byte(v), &all); err != nil {
+		return nil, err
+	}
+	return unexpired(all, now), nil
+}
+
+func saveGrace(ctx context.Context, st SettingsStore, g []grace) error {
+	b, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	return st.SetSetting(ctx, keyGrace, string(b))
+}
+
+func unexpired(g []grace, now time.Time) []grace {
+	var out []grace
+	for _, e := range g {
+		if e.ExpiresAt > now.Unix() {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// graceShortIDs lists the REALITY short-ids still in their grace period.
+// They are fixed when sing-box starts: an expired one is dropped at the next
+// restart, but without its UUID it no longer authenticates anyone.
+func (m *Manager) graceShortIDs() []string {
+	m.usersMu.Lock()
+	defer m.usersMu.Unlock()
+	var ids []string
+	for _, g := range m.grace {
+		ids = append(ids, g.RealityShortID)
+	}
+	return ids
+}
+
+// graceWSPath reports whether path is a replaced WebSocket path still in its
+// grace period. Unlike the short-ids it is read per request, so expiry takes
+// effect on the running listener.
+func (m *Manager) graceWSPath(path string) bool {
+	m.usersMu.Lock()
+	defer m.usersMu.Unlock()
+	for _, g := range m.grace {
+		if g.WSPath != "" && g.WSPath == path {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpireGrace stops accepting replaced credentials whose grace period ended
+// by now. The running inbounds drop them in place and close their sessions.
+func (m *Manager) ExpireGrace(ctx context.Context, now time.Time) error {
+	m.usersMu.Lock()
+	defer m.usersMu.Unlock()
+	live := unexpired(m.grace, now)
+	if len(live) == len(m.grace) {
+		return nil
+	}
+	if err := saveGrace(ctx, m.st, live); err != nil {
+		return err
+	}
+	m.grace = live
+	m.pushUsers()
+	return nil
+}
@@ -0,0 +1,467 @@
+package stealth
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/sagernet/sing-box/adapter"
+	"github.com/sagernet/sing-box/adapter/inbound"
+	"github.com/sagernet/sing-box/common/listener"
+	"github.com/sagernet/sing-box/common/tls"
+	"github.com/sagernet/sing-box/common/uot"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/log"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing-box/transport/v2ray"
+	"github.com/sagernet/sing-quic/hysteria2"
+	"github.com/sagernet/sing-quic/tuic"
+	vmess "github.com/sagernet/sing-vmess"
+	"github.com/sagernet/sing-vmess/packetaddr"
+	"github.com/sagernet/sing-vmess/vless"
+	"github.com/sagernet/sing/common"
+	"github.com/sagernet/sing/common/auth"
+	E "github.com/sagernet/sing/common/exceptions"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+	aTLS "github.com/sagernet/sing/common/tls"
+)
+
+// The VLESS, Hysteria2 and TUIC inbounds below stand in for sing-box's own,
+// which fix their users at construction. They are trimmed to the options
+// serverOptions sets and key users by name, so the peer and grace-period
+// users can be swapped in place. The node-wide users from the options are
+// always kept.
+
+// vlessServer is the VLESS inbound, with REALITY or a V2Ray transport.
+// Peers get the flow of the node-wide user.
+type vlessServer struct {
+	inbound.Adapter
+	router    adapter.ConnectionRouterEx
+	logger    log.ContextLogger
+	listener  *listener.Listener
+	base      []option.VLESSUser
+	service   *vless.Service[string]
+	sessions  sessions
+	tlsConfig tls.ServerConfig
+	transport adapter.V2RayServerTransport
+	ws        *http.Server // the WebSocket transport behind graceWS, if any
+}
+
+var _ adapter.V2RayServerTransportHandler = (*vlessTransportHandler)(nil)
+
+func (m *Manager) newVLESSServer(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.VLESSInboundOptions) (adapter.Inbound, error) {
+	s := &vlessServer{
+		Adapter: inbound.NewAdapter(C.TypeVLESS, tag),
+		router:  uot.NewRouter(router, logger),
+		logger:  logger,
+		base:    options.Users,
+	}
+	s.service = vless.NewService[string](logger, adapter.NewUpstreamContextHandlerEx(s.newConnection, s.newPacketConnection))
+	var err error
+	if options.TLS != nil {
+		if s.tlsConfig, err = tls.NewServer(ctx, logger, *options.TLS); err != nil {
+			return nil, err
+		}
+	}
+	if options.Transport != nil {
+		s.transport, err = v2ray.NewServerTransport(ctx, logger, *options.Transport, s.tlsConfig, (*vlessTransportHandler)(s))
+		if err != nil {
+			return nil, E.Cause(err, "create server transport: ", options.Transport.Type)
+		}
+		if h, ok := s.transport.(http.Handler); ok && options.Transport.Type == C.V2RayTransportTypeWebsocket {
+			s.ws = &http.Server{
+				Handler:           graceWS{m: m, path: options.Transport.WebsocketOptions.Path, next: h},
+				ReadHeaderTimeout: C.TCPTimeout,
+				BaseContext:       func(net.Listener) context.Context { return ctx },
+				ConnContext: func(ctx context.Context, _ net.Conn) context.Context {
+					return log.ContextWithNewID(ctx)
+				},
+			}
+		}
+	}
+	s.listener = listener.New(listener.Options{
+		Context:           ctx,
+		Logger:            logger,
+		Network:           []string{N.NetworkTCP},
+		Listen:            options.ListenOptions,
+		ConnectionHandler: s,
+	})
+	m.addServer(s)
+	return s, nil
+}
+
+func (s *vlessServer) setUsers(peers, previous []User) {
+	var flow string
+	if len(s.base) > 0 {
+		flow = s.base[0].Flow
+	}
+	var names, uuids, flows []string
+	for _, u := range s.base {
+		names, uuids, flows = append(names, u.Name), append(uuids, u.UUID), append(flows, u.Flow)
+	}
+	for _, u := range append(peers, previous...) {
+		if u.UUID != "" {
+			names, uuids, flows = append(names, u.Name), append(uuids, u.UUID), append(flows, flow)
+		}
+	}
+	s.service.UpdateUsers(names, uuids, flows)
+	s.sessions.reset(names)
+}
+
+func (s *vlessServer) Start(stage adapter.StartStage) error {
+	if stage != adapter.StartStateStart {
+		return nil
+	}
+	if s.tlsConfig != nil {
+		if err := s.tlsConfig.Start(); err != nil {
+			return err
+		}
+	}
+	if s.transport == nil {
+		return s.listener.Start()
+	}
+	ln, err := s.listener.ListenTCP()
+	if err != nil {
+		return err
+	}
+	go func() {
+		var err error
+		if s.ws != nil {
+			if s.tlsConfig != nil {
+				ln = aTLS.NewListener(ln, s.tlsConfig)
+			}
+			err = s.ws.Serve(ln)
+		} else {
+			err = s.transport.Serve(ln)
+		}
+		if err != nil && !E.IsClosed(err) && err != http.ErrServerClosed {
+			s.logger.Error("transport serve error: ", err)
+		}
+	}()
+	return nil
+}
+
+func (s *vlessServer) Close() error {
+	return common.Close(s.listener, s.tlsConfig, s.transport, common.PtrOrNil(s.ws))
+}
+
+// graceWS serves the WebSocket transport on its path and on the replaced
+// paths still in their grace period, which it rewrites to the current one.
+type graceWS struct {
+	m    *Manager
+	path string
+	next http.Handler
+}
+
+func (g graceWS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != g.path && g.m.graceWSPath(r.URL.Path) {
+		r.URL.Path, r.URL.RawPath = g.path, ""
+	}
+	g.next.ServeHTTP(w, r)
+}
+
+// NewConnectionEx takes a raw TCP connection from the listener.
+func (s *vlessServer) NewConnectionEx(ctx context.Context, conn net.Conn, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) {
+	if s.tlsConfig != nil && s.transport == nil {
+		tlsConn, err := tls.ServerHandshake(ctx, conn, s.tlsConfig)
+		if err != nil {
+			N.CloseOnHandshakeFailure(conn, onClose, err)
+			s.logger.ErrorContext(ctx, E.Cause(err, "process connection from ", metadata.Source, ": TLS handshake"))
+			return
+		}
+		conn = tlsConn
+	}
+	if err := s.service.NewConnection(adapter.WithContext(ctx, &metadata), conn, metadata.Source, onClose); err != nil {
+		N.CloseOnHandshakeFailure(conn, onClose, err)
+		s.logger.ErrorContext(ctx, E.Cause(err, "process connection from ", metadata.Source))
+	}
+}
+
+func (s *vlessServer) newConnection(ctx context.Context, conn net.Conn, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) {
+	user, _ := auth.UserFromContext[string](ctx)
+	onClose, ok := s.sessions.add(user, conn, onClose)
+	if !ok {
+		N.CloseOnHandshakeFailure(conn, onClose, os.ErrPermission)
+		return
+	}
+	metadata.Inbound = s.Tag()
+	metadata.InboundType = s.Type()
+	metadata.User = user
+	s.logger.InfoContext(ctx, "[", user, "] inbound connection to ", metadata.Destination)
+	s.router.RouteConnectionEx(ctx, conn, metadata, onClose)
+}
+
+func (s *vlessServer) newPacketConnection(ctx context.Context, conn N.PacketConn, metadata adapter.InboundContext, onClose N.CloseHandlerFunc) {
+	user, _ := auth.UserFromContext[string](ctx)
+	onClose, ok := s.sessions.add(user, conn, onClose)
+	if !ok {
+		N.CloseOnHandshakeFailure(conn, onClose, os.ErrPermission)
+		return
+	}
+	metadata.Inbound = s.Tag()
+	metadata.InboundType = s.Type()
+	metadata.User = user
+	if metadata.Destination.Fqdn == packetaddr.SeqPacketMagicAddress {
+		metadata.Destination = M.Socksaddr{}
+		conn = packetaddr.NewConn(conn.(vmess.PacketConn), metadata.Destination)
+		s.logger.InfoContext(ctx, "[", user, "] inbound packet addr connection")
+	} else {
+		s.logger.InfoContext(ctx, "[", user, "] inbound packet connection to ", metadata.Destination)
+	}
+	s.router.RoutePacketConnectionEx(ctx, conn, metadata, onClose)
+}
+
+// vlessTransportHandler takes connections the V2Ray transport has unwrapped.
+type vlessTransportHandler vlessServer
+
+func (h *vlessTransportHandler) NewConnectionEx(ctx context.Context, conn net.Conn, source M.Socksaddr, destination M.Socksaddr, onClose N.CloseHandlerFunc) {
+	var metadata adapter.InboundContext
+	metadata.Source = source
+	metadata.Destination = destination
+	h.logger.InfoContext(ctx, "inbound connection from ", metadata.Source)
+	(*vlessServer)(h).NewConnectionEx(ctx, conn, metadata, onClose)
+}
+
+// hysteria2Server is the Hysteria2 inbound.
+type hysteria2Server struct {
+	inbound.Adapter
+	router    adapter.Router
+	logger    log.ContextLogger
+	listener  *listener.Listener
+	tlsConfig tls.ServerConfig
+	base      []option.Hysteria2User
+	service   *hysteria2.Service[string]
+	sessions  sessions
+}
+
+func (m *Manager) newHysteria2Server(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.Hysteria2InboundOptions) (adapter.Inbound, error) {
+	options.UDPFragmentDefault = true
+	if options.TLS == nil || !options.TLS.Enabled {
+		return nil, C.ErrTLSRequired
+	}
+	tlsConfig, err := tls.NewServer(ctx, logger, *options.TLS)
+	if err != nil {
+		return nil, err
+	}
+	var salamander string
+	if options.Obfs != nil {
+		if options.Obfs.Type != hysteria2.ObfsTypeSalamander || options.Obfs.Password == "" {
+			return nil, E.New("unsupported obfs: ", options.Obfs.Type)
+		}
+		salamander = options.Obfs.Password
+	}
+	s := &hysteria2Server{
+		Adapter:   inbound.NewAdapter(C.TypeHysteria2, tag),
+		router:    router,
+		logger:    logger,
+		listener:  listener.New(listener.Options{Context: ctx, Logger: logger, Listen: options.ListenOptions}),
+		tlsConfig: tlsConfig,
+		base:      options.Users,
+	}
+	s.service, err = hysteria2.NewService[string](hysteria2.ServiceOptions{
+		Context:               ctx,
+		Logger:                logger,
+		SalamanderPassword:    salamander,
+		TLSConfig:             tlsConfig,
+		IgnoreClientBandwidth: options.IgnoreClientBandwidth,
+		UDPTimeout:            C.UDPTimeout,
+		Handler:               s,
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.addServer(s)
+	return s, nil
+}
+
+func (s *hysteria2Server) setUsers(peers, previous []User) {
+	var names, passwords []string
+	for _, u := range s.base {
+		names, passwords = append(names, u.Name), append(passwords, u.Password)
+	}
+	for _, u := range append(peers, previous...) {
+		if u.Password != "" {
+			names, passwords = append(names, u.Name), append(passwords, u.Password)
+		}
+	}
+	s.service.UpdateUsers(names, passwords)
+	s.sessions.reset(names)
+}
+
+func (s *hysteria2Server) Start(stage adapter.StartStage) error {
+	if stage != adapter.StartStateStart {
+		return nil
+	}
+	if err := s.tlsConfig.Start(); err != nil {
+		return err
+	}
+	conn, err := s.listener.ListenUDP()
+	if err != nil {
+		return err
+	}
+	return s.service.Start(conn)
+}
+
+func (s *hysteria2Server) Close() error {
+	return common.Close(s.listener, s.tlsConfig, common.PtrOrNil(s.service))
+}
+
+func (s *hysteria2Server) metadata(ctx context.Context, source, destination M.Socksaddr) (string, adapter.InboundContext) {
+	var metadata adapter.InboundContext
+	metadata.Inbound = s.Tag()
+	metadata.InboundType = s.Type()
+	metadata.OriginDestination = s.listener.UDPAddr()
+	metadata.Source = source
+	metadata.Destination = destination
+	user, _ := auth.UserFromContext[string](ctx)
+	metadata.User = user
+	return user, metadata
+}
+
+func (s *hysteria2Server) NewConnectionEx(ctx context.Context, conn net.Conn, source M.Socksaddr, destination M.Socksaddr, onClose N.CloseHandlerFunc) {
+	ctx = log.ContextWithNewID(ctx)
+	user, metadata := s.metadata(ctx, source, destination)
+	onClose, ok := s.sessions.add(user, conn, onClose)
+	if !ok {
+		N.CloseOnHandshakeFailure(conn, onClose, os.ErrPermission)
+		return
+	}
+	s.logger.InfoContext(ctx, "[", user, "] inbound connection to ", metadata.Destination)
+	s.router.RouteConnectionEx(ctx, conn, metadata, onClose)
+}
+
+func (s *hysteria2Server) NewPacketConnectionEx(ctx context.Context, conn N.PacketConn, source M.Socksaddr, destination M.Socksaddr, onClose N.CloseHandlerFunc) {
+	ctx = log.ContextWithNewID(ctx)
+	user, metadata := s.metadata(ctx, source, destination)
+	onClose, ok := s.sessions.add(user, conn, onClose)
+	if !ok {
+		N.CloseOnHandshakeFailure(conn, onClose, os.ErrPermission)
+		return
+	}
+	s.logger.InfoContext(ctx, "[", user, "] inbound packet connection to ", metadata.Destination)
+	s.router.RoutePacketConnectionEx(ctx, conn, metadata, onClose)
+}
+
+// tuicServer is the TUIC v5 inbound. Each user logs in with a UUID and
+// password pair.
+type tuicServer struct {
+	inbound.Adapter
+	router    adapter.ConnectionRouterEx
+	logger    log.ContextLogger
+	listener  *listener.Listener
+	tlsConfig tls.ServerConfig
+	base      []option.TUICUser
+	service   *tuic.Service[string]
+	sessions  sessions
+}
+
+func (m *Manager) newTUICServer(ctx context.Context, router adapter.Router, logger log.ContextLogger, tag string, options option.TUICInboundOptions) (adapter.Inbound, error) {
+	options.UDPFragmentDefault = true
+	if options.TLS == nil || !options.TLS.Enabled {
+		return nil, C.ErrTLSRequired
+	}
+	tlsConfig, err := tls.NewServer(ctx, logger, *options.TLS)
+	if err != nil {
+		return nil, err
+	}
+	s := &tuicServer{
+		Adapter:   inbound.NewAdapter(C.TypeTUIC, tag),
+		router:    uot.NewRouter(router, logger),
+		logger:    logger,
+		listener:  listener.New(listener.Options{Context: ctx, Logger: logger, Listen: options.ListenOptions}),
+		tlsConfig: tlsConfig,
+		base:      options.Users,
+	}
+	s.service, err = tuic.NewService[string](tuic.ServiceOptions{
+		Context:           ctx,
+		Logger:            logger,
+		TLSConfig:         tlsConfig,
+		CongestionControl: options.CongestionControl,
+		UDPTimeout:        C.UDPTimeout,
+		Handler:           s,
+	})
+	if err != nil {
+		return nil, err
+	}
+	m.addServer(s)
+	return s, nil
+}
+
+// setUsers takes the peers only: the grace entries hold replaced VLESS and
+// Hysteria2 credentials, which were never TUIC logins.
+func (s *tuicServer) setUsers(peers, _ []User) {
+	var names, passwords []string
+	var uuids [][16]byte
+	add := func(name, id, password string) {
+		u, err := uuid.Parse(id)
+		if err != nil || password == "" {
+			return
+		}
+		names, uuids, passwords = append(names, name), append(uuids, [16]byte(u)), append(passwords, password)
+	}
+	for _, u := range s.base {
+		add(u.Name, u.UUID, u.Password)
+	}
+	for _, u := range peers {
+		add(u.Name, u.UUID, u.Password)
+	}
+	s.service.UpdateUsers(names, uuids, passwords)
+	s.sessions.reset(names)
+}
+
+func (s *tuicServer) Start(stage adapter.StartStage) error {
+	if stage != adapter.StartStateStart {
+		return nil
+	}
+	if err := s.tlsConfig.Start(); err != nil {
+		return err
+	}
+	conn, err := s.listener.ListenUDP()
+	if err != nil {
+		return err
+	}
+	return s.service.Start(conn)
+}
+
+func (s *tuicServer) Close() error {
+	return common.Close(s.listener, s.tlsConfig, common.PtrOrNil(s.service))
+}
+
+func (s *tuicServer) metadata(ctx context.Context, source, destination M.Socksaddr) (string, adapter.InboundContext) {
+	var metadata adapter.InboundContext
+	metadata.Inbound = s.Tag()
+	metadata.InboundType = s.Type()
+	metadata.OriginDestination = s.listener.UDPAddr()
+	metadata.Source = source
+	metadata.Destination = destination
+	user, _ := auth.UserFromContext[string](ctx)
+	metadata.User = user
+	return user, metadata
+}
+
+func (s *tuicServer) NewConnectionEx(ctx context.Context, conn net.Conn, source M.Socksaddr, destination M.Socksaddr, onClose N.CloseHandlerFunc) {
+	ctx = log.ContextWithNewID(ctx)
+	user, metadata := s.metadata(ctx, source, destination)
+	onClose, ok := s.sessions.add(user, conn, onClose)
+	if !ok {
+		N.CloseOnHandshakeFailure(conn, onClose, os.ErrPermission)
+		return
+	}
+	s.logger.InfoContext(ctx, "[", user, "] inbound connection to ", metadata.Destination)
+	s.router.RouteConnectionEx(ctx, conn, metadata, onClose)
+}
+
+func (s *tuicServer) NewPacketConnectionEx(ctx context.Context, conn N.PacketConn, source M.Socksaddr, destination M.Socksaddr, onClose N.CloseHandlerFunc) {
+	ctx = log.ContextWithNewID(ctx)
+	user, metadata := s.metadata(ctx, source, destination)
+	onClose, ok := s.sessions.add(user, conn, onClose)
+	if !ok {
+		N.CloseOnHandshakeFailure(conn, onClose, os.ErrPermission)
+		return
+	}
+	s.logger.InfoContext(ctx, "[", user, "] inbound packet connection to ", metadata.Destination)
+	s.router.RoutePacketConnectionEx(ctx, conn, metadata, onClose)
+}
@@ -25,49 +25,124 @@ type Params struct {
 	RealityShortID    string `json:"reality_short_id"`
 	Hysteria2Password string `json:"hysteria2_password"`
 	Hysteria2Obfs     string `json:"hysteria2_obfs,omitempty"` // salamander password, "" = none
+	// TUIC carrier; empty unless ENABLE_TUIC is set. It shares Host and SNI
+	// with Hysteria2.
+	TUICPort     int    `json:"tuic_port,omitempty"`
+	TUICUUID     string `json:"tuic_uuid,omitempty"`
+	TUICPassword string `json:"tuic_password,omitempty"`
+	// WebSocket carrier; empty unless STEALTH_WS_HOST is set. Clients dial
+	// the CDN hostname, not Host.
+	WSHost string `json:"ws_host,omitempty"`
+	WSPort int    `json:"ws_port,omitempty"`
+	WSPath string `json:"ws_path,omitempty"`
+	// HTTPS CONNECT carrier; empty unless STEALTH_CONNECT_HOST is set.
+	// ConnectInsecure means the node serves its self-signed certificate.
+	ConnectHost     string `json:"connect_host,omitempty"`
+	ConnectPort     int    `json:"connect_port,omitempty"`
+	ConnectUsername string `json:"connect_username,omitempty"`
+	ConnectPassword string `json:"connect_password,omitempty"`
+	ConnectInsecure bool   `json:"connect_insecure,omitempty"`
 }
 
 // Params returns the carrier parameters. Returns Enabled=false (and no secrets)
 // when stealth is off or Init has not run.
 func (m *Manager) Params() Params {
-	if !m.cfg.EnableStealth || m.secrets == nil {
+	cfg := m.cfg.Load()
+	if !cfg.EnableStealth || m.secrets == nil {
 		return Params{Enabled: false}
 	}
-	return Params{
+	p := Params{
 		Enabled:           true,
-		Host:              m.cfg.WGEndpointHost,
-		VLESSPort:         m.cfg.VLESSPortInt(),
-		Hysteria2Port:     m.cfg.Hysteria2PortInt(),
-		SNI:               m.cfg.RealitySNI(),
+		Host:              cfg.WGEndpointHost,
+		VLESSPort:         cfg.VLESSPortInt(),
+		Hysteria2Port:     cfg.Hysteria2PortInt(),
+		SNI:               cfg.RealitySNI(),
 		VLESSUUID:         m.secrets.VLESSUUID,
 		VLESSFlow:         vlessFlowVision,
 		RealityPublicKey:  m.secrets.RealityPublicKey,
 		RealityShortID:    m.secrets.RealityShortID,
 		Hysteria2Password: m.secrets.Hysteria2Password,
-		Hysteria2Obfs:     m.cfg.Hysteria2ObfsPassword,
+		Hysteria2Obfs:     cfg.Hysteria2ObfsPassword,
 	}
+	if cfg.TUICCarrierEnabled() {
+		p.TUICPort = cfg.StealthTUICPortInt()
+		p.TUICUUID = m.secrets.TUICUUID
+		p.TUICPassword = m.secrets.TUICPassword
+	}
+	if cfg.WebSocketCarrierEnabled() {
+		p.WSHost = cfg.StealthWSHost
+		p.WSPort = cfg.StealthWSPortInt()
+		p.WSPath = m.secrets.WSPath
+	}
+	if cfg.HTTPSConnectCarrierEnabled() {
+		p.ConnectHost = cfg.StealthConnectHost
+		p.ConnectPort = cfg.StealthConnectPortInt()
+		p.ConnectUsername = m.secrets.ConnectUsername
+		p.ConnectPassword = m.secrets.ConnectPassword
+		p.ConnectInsecure = cfg.StealthConnectCertFile == ""
+	}
+	return p
 }
 
 // PeerStealth is the per-client stealth section of a credential bundle.
 type PeerStealth struct {
 	VLESSURI       string `json:"vless_uri"`
 	Hysteria2URI   string `json:"hysteria2_uri"`
+	TUICURI        string `json:"tuic_uri,omitempty"`      // "" without the TUIC carrier
+	WebSocketURI   string `json:"websocket_uri,omitempty"` // "" without the WebSocket carrier
+	NaiveURI       string `json:"naive_uri,omitempty"`     // "" without the HTTPS CONNECT carrier
 	SingboxProfile any    `json:"singbox_profile"`
 }
 
 // BuildPeer renders the per-client stealth artifacts: standard vless:// and
-// hysteria2:// carrier share links plus a complete sing-box client profile that
-// tunnels WireGuard through the VLESS+REALITY carrier (Topology A — WireGuard
-// is the endpoint). clientAddrCIDR is the peer's tunnel address (e.g.
-// "10.0.0.7/32"); serverWGPub is the node's WireGuard public key (base64); psk
-// is the optional WireGuard preshared key.
-func (m *Manager) BuildPeer(label, serverWGPub, clientAddrCIDR, psk string) PeerStealth {
-	p := m.Params()
-	return PeerStealth{
+// hysteria2:// carrier share links (plus tuic://, vless:// WebSocket and
+// naive+https:// links when those carriers are on) and a complete sing-box
+// client profile that tunnels WireGuard through the VLESS+REALITY carrier
+// (Topology A — WireGuard is the endpoint). Every carrier credential is u's
+// own; a zero User gets the node-wide ones, which no peer bundle carries.
+// clientAddrCIDR is the peer's tunnel address (e.g. "10.0.0.7/32");
+// serverWGPub is the node's WireGuard public key (base64); psk is the optional
+// WireGuard preshared key.
+func (m *Manager) BuildPeer(u User, label, serverWGPub, clientAddrCIDR, psk string) PeerStealth {
+	p := m.Params().forUser(u)
+	ps := PeerStealth{
 		VLESSURI:       p.vlessURI(label),
 		Hysteria2URI:   p.hysteria2URI(label),
 		SingboxProfile: m.singboxProfile(p, serverWGPub, clientAddrCIDR, psk),
 	}
+	if p.TUICUUID != "" {
+		ps.TUICURI = p.tuicURI(label)
+	}
+	if p.WSHost != "" {
+		ps.WebSocketURI = p.webSocketURI(label)
+	}
+	if p.ConnectHost != "" {
+		ps.NaiveURI = p.naiveURI(label)
+	}
+	return ps
+}
+
+// forUser swaps in u's own credentials: the VLESS UUID, the Hysteria2
+// password, and the pair as the TUIC and HTTPS CONNECT logins.
+func (p Params) forUser(u User) Params {
+	if !p.Enabled {
+		return p
+	}
+	if u.UUID != "" {
+		p.VLESSUUID = u.UUID
+	}
+	if u.Password != "" {
+		p.Hysteria2Password = u.Password
+	}
+	if u.UUID != "" && u.Password != "" {
+		if p.TUICUUID != "" {
+			p.TUICUUID, p.TUICPassword = u.UUID, u.Password
+		}
+		if p.ConnectHost != "" {
+			p.ConnectUsername, p.ConnectPassword = u.UUID, u.Password
+		}
+	}
+	return p
 }
 
 func (p Params) vlessURI(label string) string {
@@ -84,6 +159,42 @@ func (p Params) vlessURI(label string) string {
 		p.VLESSUUID, p.Host, p.VLESSPort, q.Encode(), url.PathEscape(label))
 }
 
+func (p Params) webSocketURI(label string) string {
+	q := url.Values{}
+	q.Set("encryption", "none")
+	q.Set("security", "tls")
+	q.Set("sni", p.WSHost)
+	q.Set("fp", "chrome")
+	q.Set("type", "ws")
+	q.Set("host", p.WSHost)
+	q.Set("path", p.WSPath)
+	return fmt.Sprintf("vless://%s@%s:%d?%s#%s",
+		p.VLESSUUID, p.WSHost, p.WSPort, q.Encode(), url.PathEscape(label))
+}
+
+func (p Params) tuicURI(label string) string {
+	q := url.Values{}
+	q.Set("sni", p.SNI)
+	q.Set("alpn", "h3")
+	q.Set("allow_insecure", "1")
+	q.Set("congestion_control", tuicCongestionControl)
+	q.Set("udp_relay_mode", "native")
+	return fmt.Sprintf("tuic://%s@%s:%d?%s#%s",
+		url.UserPassword(p.TUICUUID, p.TUICPassword), p.Host, p.TUICPort, q.Encode(), url.PathEscape(label))
+}
+
+// naiveURI is NaïveProxy's share link. UDP rides over the tunnel as sing-box
+// UDP-over-TCP v2, which the link cannot express.
+func (p Params) naiveURI(label string) string {
+	q := url.Values{}
+	q.Set("padding", "true")
+	if p.ConnectInsecure {
+		q.Set("insecure", "1")
+	}
+	return fmt.Sprintf("naive+https://%s@%s:%d?%s#%s",
+		url.UserPassword(p.ConnectUsername, p.ConnectPassword), p.ConnectHost, p.ConnectPort, q.Encode(), url.PathEscape(label))
+}
+
 func (p Params) hysteria2URI(label string) string {
 	q := url.Values{}
 	q.Set("sni", p.SNI)
@@ -98,15 +209,18 @@ func (p Params) hysteria2URI(label string) string {
 }
 
 // singboxProfile builds a full client config (as a JSON-serializable map) that
-// runs WireGuard over the VLESS+REALITY carrier. The Hysteria2 carrier is also
-// included as an outbound; a client switches by repointing the WireGuard
-// endpoint's "detour" to "carrier-hysteria2". The WG peer endpoint is the node
+// runs WireGuard over the VLESS+REALITY carrier. The Hysteria2 carrier (and
+// the TUIC, WebSocket and HTTPS CONNECT ones, when on) is also included as an
+// outbound; a client switches by repointing the WireGuard endpoint's "detour"
+// to "carrier-hysteria2", "carrier-tuic", "carrier-vless-ws" or
+// "carrier-naive". The naive
+// outbound needs sing-box 1.13 or later. The WG peer endpoint is the node
 // loopback because the node's direct outbound delivers carrier traffic straight
 // to its local WireGuard listener.
 func (m *Manager) singboxProfile(p Params, serverWGPub, clientAddrCIDR, psk string) map[string]any {
 	wgPeer := map[string]any{
 		"address":                       "127.0.0.1",
-		"port":                          m.cfg.WGEndpointPortInt(),
+		"port":                          m.cfg.Load().WGEndpointPortInt(),
 		"public_key":                    serverWGPub,
 		"allowed_ips":                   []string{"0.0.0.0/0", "::/0"},
 		"persistent_keepalive_interval": 25,
@@ -143,6 +257,67 @@ func (m *Manager) singboxProfile(p Params, serverWGPub, clientAddrCIDR, psk stri
 		hy2Out["obfs"] = map[string]any{"type": "salamander", "password": p.Hysteria2Obfs}
 	}
 
+	outbounds := []map[string]any{
+		{
+			"type":        "vless",
+			"tag":         "carrier-vless",
+			"server":      p.Host,
+			"server_port": p.VLESSPort,
+			"uuid":        p.VLESSUUID,
+			"flow":        p.VLESSFlow,
+			"tls":         vlessTLS,
+		},
+		hy2Out,
+	}
+	if p.TUICUUID != "" {
+		outbounds = append(outbounds, map[string]any{
+			"type":               "tuic",
+			"tag":                "carrier-tuic",
+			"server":             p.Host,
+			"server_port":        p.TUICPort,
+			"uuid":               p.TUICUUID,
+			"password":           p.TUICPassword,
+			"congestion_control": tuicCongestionControl,
+			"udp_relay_mode":     "native",
+			"tls":                hy2TLS,
+		})
+	}
+	if p.WSHost != "" {
+		outbounds = append(outbounds, map[string]any{
+			"type":        "vless",
+			"tag":         "carrier-vless-ws",
+			"server":      p.WSHost,
+			"server_port": p.WSPort,
+			"uuid":        p.VLESSUUID,
+			"tls": map[string]any{
+				"enabled":     true,
+				"server_name": p.WSHost,
+				"utls":        map[string]any{"enabled": true, "fingerprint": "chrome"},
+			},
+			"transport": map[string]any{
+				"type":    "ws",
+				"path":    p.WSPath,
+				"headers": map[string]any{"Host": p.WSHost},
+			},
+		})
+	}
+	if p.ConnectHost != "" {
+		outbounds = append(outbounds, map[string]any{
+			"type":         "naive",
+			"tag":          "carrier-naive",
+			"server":       p.ConnectHost,
+			"server_port":  p.ConnectPort,
+			"username":     p.ConnectUsername,
+			"password":     p.ConnectPassword,
+			"udp_over_tcp": map[string]any{"enabled": true, "version": 2},
+			"tls": map[string]any{
+				"enabled":     true,
+				"server_name": p.ConnectHost,
+				"insecure":    p.ConnectInsecure,
+			},
+		})
+	}
+
 	return map[string]any{
 		"log": map[string]any{"level": "warn"},
 		"endpoints": []map[string]any{{
@@ -153,18 +328,7 @@ func (m *Manager) singboxProfile(p Params, serverWGPub, clientAddrCIDR, psk stri
 			"peers":       []map[string]any{wgPeer},
 			"detour":      "carrier-vless",
 		}},
-		"outbounds": []map[string]any{
-			{
-				"type":        "vless",
-				"tag":         "carrier-vless",
-				"server":      p.Host,
-				"server_port": p.VLESSPort,
-				"uuid":        p.VLESSUUID,
-				"flow":        p.VLESSFlow,
-				"tls":         vlessTLS,
-			},
-			hy2Out,
-		},
-		"route": map[string]any{"final": "wg-out"},
+		"outbounds": outbounds,
+		"route":     map[string]any{"final": "wg-out"},
 	}
 }
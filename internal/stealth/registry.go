@@ -4,21 +4,23 @@ import (
 	"github.com/sagernet/sing-box/adapter/endpoint"
 	"github.com/sagernet/sing-box/adapter/inbound"
 	"github.com/sagernet/sing-box/adapter/outbound"
+	C "github.com/sagernet/sing-box/constant"
+	"github.com/sagernet/sing-box/option"
 	"github.com/sagernet/sing-box/protocol/direct"
-	"github.com/sagernet/sing-box/protocol/hysteria2"
-	"github.com/sagernet/sing-box/protocol/vless"
 )
 
 // Minimal sing-box protocol registries. We deliberately avoid sing-box's
 // include.*Registry() helpers because they pull in every protocol (tor,
-// shadowsocks, shadowtls, naive, v2ray transports, TUN/gvisor …). The node only
-// needs two carrier inbounds and a direct outbound, so registering just those
-// keeps the dependency surface and binary size small.
+// shadowsocks, shadowtls, naive, TUN/gvisor …). The node only needs its
+// carrier inbounds and a direct outbound, so registering just those keeps the
+// dependency surface and binary size small. VLESS, Hysteria2 and TUIC are our
+// own inbounds (inbound.go) so per-peer users can change while they run.
 
-func inboundRegistry() *inbound.Registry {
+func (m *Manager) inboundRegistry() *inbound.Registry {
 	r := inbound.NewRegistry()
-	vless.RegisterInbound(r)
-	hysteria2.RegisterInbound(r)
+	inbound.Register[option.VLESSInboundOptions](r, C.TypeVLESS, m.newVLESSServer)
+	inbound.Register[option.Hysteria2InboundOptions](r, C.TypeHysteria2, m.newHysteria2Server)
+	inbound.Register[option.TUICInboundOptions](r, C.TypeTUIC, m.newTUICServer)
 	return r
 }
 
@@ -17,6 +17,11 @@ const (
 	keyRealityShortID = "stealth_reality_short_id"
 	keyVLESSUUID      = "stealth_vless_uuid"
 	keyHysteria2Pass  = "stealth_hysteria2_password"
+	keyWSPath         = "stealth_ws_path"
+	keyTUICUUID       = "stealth_tuic_uuid"
+	keyTUICPass       = "stealth_tuic_password"
+	keyConnectUser    = "stealth_connect_username"
+	keyConnectPass    = "stealth_connect_password"
 )
 
 // SettingsStore is the subset of the node store the stealth manager needs.
@@ -25,15 +30,21 @@ type SettingsStore interface {
 	SetSetting(ctx context.Context, key, value string) error
 }
 
-// Secrets are the node-wide credentials shared by every client of the stealth
-// carriers. Per-client authentication still happens inside WireGuard, so these
-// secrets only gate access to the obfuscated transport, not to the VPN itself.
+// Secrets are the node-wide carrier credentials. VLESS and Hysteria2 also
+// accept per-peer users (SetUsers); the rest are shared by every client.
+// Per-client authentication still happens inside WireGuard, so these secrets
+// only gate access to the obfuscated transport, not to the VPN itself.
 type Secrets struct {
 	RealityPrivateKey string // base64 RawURL, x25519
 	RealityPublicKey  string // base64 RawURL, x25519
 	RealityShortID    string // 8 hex chars
 	VLESSUUID         string
 	Hysteria2Password string
+	WSPath            string // secret WebSocket path, e.g. "/Zk3…"
+	TUICUUID          string
+	TUICPassword      string
+	ConnectUsername   string // HTTPS CONNECT Proxy-Authorization
+	ConnectPassword   string
 }
 
 // loadOrCreateSecrets reads the stealth secrets from the store, generating and
@@ -78,6 +89,28 @@ func loadOrCreateSecrets(ctx context.Context, st SettingsStore) (*Secrets, error
 		return nil, err
 	}
 
+	// The WebSocket path gates the CDN-fronted carrier: any other path gets a
+	// plain 404, so scanning the public hostname finds nothing.
+	if s.WSPath, err = getOrSet(ctx, st, keyWSPath, "/"+randToken(12)); err != nil {
+		return nil, err
+	}
+
+	// TUIC authenticates with a UUID and password pair of its own.
+	if s.TUICUUID, err = getOrSet(ctx, st, keyTUICUUID, uuid.NewString()); err != nil {
+		return nil, err
+	}
+	if s.TUICPassword, err = getOrSet(ctx, st, keyTUICPass, randToken(24)); err != nil {
+		return nil, err
+	}
+
+	// The HTTPS CONNECT carrier shows its 404 page to anyone without them.
+	if s.ConnectUsername, err = getOrSet(ctx, st, keyConnectUser, randToken(6)); err != nil {
+		return nil, err
+	}
+	if s.ConnectPassword, err = getOrSet(ctx, st, keyConnectPass, randToken(24)); err != nil {
+		return nil, err
+	}
+
 	return s, nil
 }
 
@@ -1,25 +1,36 @@
 // Package stealth runs the node's DPI-resistant carrier transports via an
 // embedded sing-box instance. When a client's WireGuard UDP is throttled or
-// blocked, it wraps the same WireGuard tunnel inside one of two carriers that
-// look like ordinary internet traffic:
+// blocked, it wraps the same WireGuard tunnel inside carriers that look like
+// ordinary internet traffic:
 //
 //   - VLESS + REALITY on tcp/:443 — indistinguishable from a real TLS session
 //     to a borrowed SNI (no fake cert; the handshake is proxied to a real site).
 //   - Hysteria2 on udp/:443 — QUIC/HTTP3 with optional Salamander obfuscation.
+//   - TUIC v5 (opt-in, ENABLE_TUIC) — another QUIC carrier, for clients that
+//     speak TUIC but not Hysteria2.
+//   - VLESS over WebSocket+TLS (opt-in, STEALTH_WS_HOST) — plain HTTPS that a
+//     CDN can front, for networks where only CDN ranges are reachable.
+//   - HTTPS CONNECT (opt-in, STEALTH_CONNECT_HOST) — NaïveProxy-style padded
+//     HTTP/2 CONNECT, served outside sing-box so probes see a plain website.
 //
-// Both carriers terminate on a single node-wide credential and route to a
-// direct outbound; per-client authentication stays in the inner WireGuard
-// tunnel, so the sing-box instance never restarts on peer churn (Topology A —
-// "WireGuard as the endpoint").
+// The carriers route to a direct outbound pinned to WireGuard, where
+// per-client authentication happens (Topology A — "WireGuard as the
+// endpoint"). Every carrier accepts each peer's own credentials, and bundles
+// carry only those; SetUsers swaps them in place, so the sing-box instance
+// never restarts on peer churn and a removed peer's carrier sessions end at
+// once. The node-wide credentials are still accepted too (bundles issued
+// before per-peer logins carry them) until a rotation replaces them.
 package stealth
 
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/netip"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/NetSepio/erebrus/internal/config"
 	"github.com/google/uuid"
@@ -29,11 +40,14 @@ import (
 	"github.com/sagernet/sing/common/json/badoption"
 )
 
-const vlessFlowVision = "xtls-rprx-vision"
+const (
+	vlessFlowVision       = "xtls-rprx-vision"
+	tuicCongestionControl = "bbr"
+)
 
 // Manager owns the embedded sing-box instance and the node-wide carrier secrets.
 type Manager struct {
-	cfg     *config.Config
+	cfg     *config.Live
 	st      SettingsStore
 	secrets *Secrets
 	certPEM string
@@ -41,16 +55,22 @@ type Manager struct {
 
 	mu       sync.Mutex
 	instance *box.Box
+	connect  *http.Server // HTTPS CONNECT carrier; nil when off
 	running  bool
+
+	usersMu sync.Mutex
+	users   []User       // per-peer carrier users, see SetUsers
+	grace   []grace      // replaced credentials still accepted, see ExpireGrace
+	servers []userServer // the running instance's VLESS and Hysteria2 inbounds
 }
 
 // New constructs a Manager. Call Init before Start or Params.
-func New(cfg *config.Config, st SettingsStore) *Manager {
+func New(cfg *config.Live, st SettingsStore) *Manager {
 	return &Manager{cfg: cfg, st: st}
 }
 
 // Enabled reports whether the stealth carriers are turned on.
-func (m *Manager) Enabled() bool { return m.cfg.EnableStealth }
+func (m *Manager) Enabled() bool { return m.cfg.Load().EnableStealth }
 
 // Init loads (creating on first run) the node-wide carrier secrets and the
 // Hysteria2 self-signed certificate. Safe to call even when stealth is disabled
@@ -60,10 +80,17 @@ func (m *Manager) Init(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("stealth secrets: %w", err)
 	}
-	certPEM, keyPEM, err := loadOrCreateCert(ctx, m.st, m.cfg.RealitySNI())
+	certPEM, keyPEM, err := loadOrCreateCert(ctx, m.st, m.cfg.Load().RealitySNI())
 	if err != nil {
 		return fmt.Errorf("stealth cert: %w", err)
 	}
+	previous, err := loadGrace(ctx, m.st, time.Now())
+	if err != nil {
+		return fmt.Errorf("stealth grace credentials: %w", err)
+	}
+	m.usersMu.Lock()
+	m.grace = previous
+	m.usersMu.Unlock()
 	m.secrets = secrets
 	m.certPEM = certPEM
 	m.keyPEM = keyPEM
@@ -73,7 +100,8 @@ func (m *Manager) Init(ctx context.Context) error {
 // Start builds and starts the embedded sing-box instance. No-op when stealth is
 // disabled. Init must have been called first.
 func (m *Manager) Start(ctx context.Context) error {
-	if !m.cfg.EnableStealth {
+	cfg := m.cfg.Load()
+	if !cfg.EnableStealth {
 		return nil
 	}
 	if m.secrets == nil {
@@ -81,7 +109,8 @@ func (m *Manager) Start(ctx context.Context) error {
 	}
 
 	opts := m.serverOptions()
-	boxCtx := box.Context(ctx, inboundRegistry(), outboundRegistry(), endpointRegistry())
+	m.dropServers()
+	boxCtx := box.Context(ctx, m.inboundRegistry(), outboundRegistry(), endpointRegistry())
 	instance, err := box.New(box.Options{Context: boxCtx, Options: opts})
 	if err != nil {
 		return fmt.Errorf("stealth: build sing-box: %w", err)
@@ -90,17 +119,99 @@ func (m *Manager) Start(ctx context.Context) error {
 		_ = instance.Close()
 		return fmt.Errorf("stealth: start sing-box: %w", err)
 	}
+	var connect *http.Server
+	if cfg.HTTPSConnectCarrierEnabled() {
+		if connect, err = m.startConnect(); err != nil {
+			_ = instance.Close()
+			return fmt.Errorf("stealth: start https connect carrier: %w", err)
+		}
+	}
 
 	m.mu.Lock()
 	m.instance = instance
+	m.connect = connect
 	m.running = true
 	m.mu.Unlock()
 	return nil
 }
 
-// RotateAllSecrets regenerates VLESS UUID, REALITY short-id, and Hysteria2
-// password, then restarts sing-box if it was running.
-func (m *Manager) RotateAllSecrets(ctx context.Context) error {
+// Running reports whether the sing-box instance is up.
+func (m *Manager) Running() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.running
+}
+
+// Inbound describes one carrier listener for diagnostics. It carries no
+// secrets.
+type Inbound struct {
+	Tag       string `json:"tag"`
+	Type      string `json:"type"`
+	Network   string `json:"network"`
+	Port      int    `json:"port"`
+	Listening bool   `json:"listening"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// Inbounds lists the carrier inbounds the node is configured to serve and
+// whether sing-box is currently running them.
+func (m *Manager) Inbounds() []Inbound {
+	cfg := m.cfg.Load()
+	if !cfg.EnableStealth {
+		return nil
+	}
+	running := m.Running()
+	obfs := "none"
+	if cfg.Hysteria2ObfsPassword != "" {
+		obfs = "salamander"
+	}
+	inbounds := []Inbound{
+		{
+			Tag: "vless-reality", Type: C.TypeVLESS, Network: "tcp", Port: cfg.VLESSPortInt(), Listening: running,
+			Detail: fmt.Sprintf("sni=%s handshake=%s", cfg.RealitySNI(), cfg.RealityHandshakeTarget()),
+		},
+		{
+			Tag: "hysteria2", Type: C.TypeHysteria2, Network: "udp", Port: cfg.Hysteria2PortInt(), Listening: running,
+			Detail: "obfs=" + obfs,
+		},
+	}
+	if cfg.TUICCarrierEnabled() {
+		inbounds = append(inbounds, Inbound{
+			Tag: "tuic", Type: C.TypeTUIC, Network: "udp", Port: cfg.StealthTUICPortInt(), Listening: running,
+			Detail: "congestion_control=" + tuicCongestionControl,
+		})
+	}
+	if cfg.WebSocketCarrierEnabled() {
+		cert := "self-signed"
+		if cfg.StealthWSCertFile != "" {
+			cert = cfg.StealthWSCertFile
+		}
+		inbounds = append(inbounds, Inbound{
+			Tag: "vless-ws", Type: C.TypeVLESS, Network: "tcp", Port: cfg.StealthWSPortInt(), Listening: running,
+			Detail: fmt.Sprintf("host=%s cert=%s", cfg.StealthWSHost, cert),
+		})
+	}
+	if cfg.HTTPSConnectCarrierEnabled() {
+		cert := "self-signed"
+		if cfg.StealthConnectCertFile != "" {
+			cert = cfg.StealthConnectCertFile
+		}
+		inbounds = append(inbounds, Inbound{
+			Tag: "https-connect", Type: "naive", Network: "tcp", Port: cfg.StealthConnectPortInt(), Listening: running,
+			Detail: fmt.Sprintf("host=%s cert=%s", cfg.StealthConnectHost, cert),
+		})
+	}
+	return inbounds
+}
+
+// RotateAllSecrets regenerates VLESS UUID, REALITY short-id, Hysteria2
+// password, TUIC credentials, WebSocket path and HTTPS CONNECT credentials.
+// It only persists and stages them: running carriers keep serving the old
+// secrets until the caller restarts them (the node's supervisor owns that).
+// Until graceUntil (when non-zero) the carriers keep accepting the replaced
+// VLESS UUID, Hysteria2 password, short-id and WebSocket path; ExpireGrace
+// retires them.
+func (m *Manager) RotateAllSecrets(ctx context.Context, graceUntil time.Time) error {
 	if m.st == nil {
 		return fmt.Errorf("stealth: not initialized")
 	}
@@ -109,6 +220,24 @@ func (m *Manager) RotateAllSecrets(ctx context.Context) error {
 			return err
 		}
 	}
+	if now := time.Now(); graceUntil.After(now) {
+		m.usersMu.Lock()
+		previous := append(unexpired(m.grace, now), grace{
+			VLESSUUID:         m.secrets.VLESSUUID,
+			Hysteria2Password: m.secrets.Hysteria2Password,
+			RealityShortID:    m.secrets.RealityShortID,
+			WSPath:            m.secrets.WSPath,
+			ExpiresAt:         graceUntil.Unix(),
+		})
+		err := saveGrace(ctx, m.st, previous)
+		if err == nil {
+			m.grace = previous
+		}
+		m.usersMu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
 	if err := m.st.SetSetting(ctx, keyVLESSUUID, uuid.NewString()); err != nil {
 		return err
 	}
@@ -118,18 +247,26 @@ func (m *Manager) RotateAllSecrets(ctx context.Context) error {
 	if err := m.st.SetSetting(ctx, keyHysteria2Pass, randToken(24)); err != nil {
 		return err
 	}
+	if err := m.st.SetSetting(ctx, keyWSPath, "/"+randToken(12)); err != nil {
+		return err
+	}
+	if err := m.st.SetSetting(ctx, keyTUICUUID, uuid.NewString()); err != nil {
+		return err
+	}
+	if err := m.st.SetSetting(ctx, keyTUICPass, randToken(24)); err != nil {
+		return err
+	}
+	if err := m.st.SetSetting(ctx, keyConnectUser, randToken(6)); err != nil {
+		return err
+	}
+	if err := m.st.SetSetting(ctx, keyConnectPass, randToken(24)); err != nil {
+		return err
+	}
 	secrets, err := loadOrCreateSecrets(ctx, m.st)
 	if err != nil {
 		return err
 	}
 	m.secrets = secrets
-	wasRunning := m.running
-	if wasRunning {
-		_ = m.Close()
-	}
-	if wasRunning && m.cfg.EnableStealth {
-		return m.Start(ctx)
-	}
 	return nil
 }
 
@@ -153,24 +290,30 @@ func (m *Manager) RotateReality(ctx context.Context) (string, error) {
 	return shortID, nil
 }
 
-// Close stops the embedded sing-box instance. Idempotent.
+// Close stops the embedded sing-box instance and the HTTPS CONNECT carrier.
+// Idempotent.
 func (m *Manager) Close() error {
 	m.mu.Lock()
-	inst := m.instance
-	m.instance = nil
+	inst, connect := m.instance, m.connect
+	m.instance, m.connect = nil, nil
 	m.running = false
 	m.mu.Unlock()
+	if connect != nil {
+		_ = connect.Close()
+	}
+	m.dropServers()
 	if inst == nil {
 		return nil
 	}
 	return inst.Close()
 }
 
-// serverOptions renders the sing-box configuration the node runs: the two
+// serverOptions renders the sing-box configuration the node runs: the
 // carrier inbounds plus a single direct outbound.
 func (m *Manager) serverOptions() option.Options {
+	cfg := m.cfg.Load()
 	logLevel := "warn"
-	if m.cfg.RunType == "debug" {
+	if cfg.RunType == "debug" {
 		logLevel = "info"
 	}
 
@@ -178,13 +321,19 @@ func (m *Manager) serverOptions() option.Options {
 	if h2, ok := m.hysteria2Inbound(); ok {
 		inbounds = append(inbounds, h2)
 	}
+	if cfg.TUICCarrierEnabled() {
+		inbounds = append(inbounds, m.tuicInbound())
+	}
+	if cfg.WebSocketCarrierEnabled() {
+		inbounds = append(inbounds, m.wsInbound())
+	}
 
 	// The direct outbound is pinned to the node's local WireGuard listener:
 	// every connection the carriers accept is forced to 127.0.0.1:<wg-port>,
 	// regardless of the inner destination. This keeps the node from acting as
-	// an open proxy for anyone holding the (shared) carrier secret — the
-	// carriers can only ever deliver packets to WireGuard, where the real
-	// per-client authentication happens.
+	// an open proxy for anyone holding a carrier credential — the carriers
+	// can only ever deliver packets to WireGuard, where the real per-client
+	// authentication happens.
 	return option.Options{
 		Log:      &option.LogOptions{Level: logLevel, Timestamp: true},
 		Inbounds: inbounds,
@@ -193,7 +342,7 @@ func (m *Manager) serverOptions() option.Options {
 			Tag:  "direct",
 			Options: &option.DirectOutboundOptions{
 				OverrideAddress: "127.0.0.1",
-				OverridePort:    uint16(m.cfg.WGEndpointPortInt()),
+				OverridePort:    uint16(cfg.WGEndpointPortInt()),
 			},
 		}},
 		Route: &option.RouteOptions{Final: "direct"},
@@ -201,12 +350,13 @@ func (m *Manager) serverOptions() option.Options {
 }
 
 func (m *Manager) vlessInbound() option.Inbound {
-	host, port := splitHostPort(m.cfg.RealityHandshakeTarget(), 443)
+	cfg := m.cfg.Load()
+	host, port := splitHostPort(cfg.RealityHandshakeTarget(), 443)
 	return option.Inbound{
 		Type: C.TypeVLESS,
 		Tag:  "vless-reality",
 		Options: &option.VLESSInboundOptions{
-			ListenOptions: listenOn(m.cfg.VLESSPortInt()),
+			ListenOptions: listenOn(cfg.VLESSPortInt()),
 			Users: []option.VLESSUser{{
 				Name: "erebrus",
 				UUID: m.secrets.VLESSUUID,
@@ -215,14 +365,14 @@ func (m *Manager) vlessInbound() option.Inbound {
 			InboundTLSOptionsContainer: option.InboundTLSOptionsContainer{
 				TLS: &option.InboundTLSOptions{
 					Enabled:    true,
-					ServerName: m.cfg.RealitySNI(),
+					ServerName: cfg.RealitySNI(),
 					Reality: &option.InboundRealityOptions{
 						Enabled: true,
 						Handshake: option.InboundRealityHandshakeOptions{
 							ServerOptions: option.ServerOptions{Server: host, ServerPort: port},
 						},
 						PrivateKey: m.secrets.RealityPrivateKey,
-						ShortID:    badoption.Listable[string]{m.secrets.RealityShortID},
+						ShortID:    append(badoption.Listable[string]{m.secrets.RealityShortID}, m.graceShortIDs()...),
 					},
 				},
 			},
@@ -231,15 +381,16 @@ func (m *Manager) vlessInbound() option.Inbound {
 }
 
 func (m *Manager) hysteria2Inbound() (option.Inbound, bool) {
+	cfg := m.cfg.Load()
 	tls := &option.InboundTLSOptions{
 		Enabled:     true,
-		ServerName:  m.cfg.RealitySNI(),
+		ServerName:  cfg.RealitySNI(),
 		ALPN:        badoption.Listable[string]{"h3"},
 		Certificate: badoption.Listable[string]{m.certPEM},
 		Key:         badoption.Listable[string]{m.keyPEM},
 	}
 	in := &option.Hysteria2InboundOptions{
-		ListenOptions:         listenOn(m.cfg.Hysteria2PortInt()),
+		ListenOptions:         listenOn(cfg.Hysteria2PortInt()),
 		IgnoreClientBandwidth: true,
 		Users: []option.Hysteria2User{{
 			Name:     "erebrus",
@@ -247,12 +398,76 @@ func (m *Manager) hysteria2Inbound() (option.Inbound, bool) {
 		}},
 		InboundTLSOptionsContainer: option.InboundTLSOptionsContainer{TLS: tls},
 	}
-	if m.cfg.Hysteria2ObfsPassword != "" {
-		in.Obfs = &option.Hysteria2Obfs{Type: "salamander", Password: m.cfg.Hysteria2ObfsPassword}
+	if cfg.Hysteria2ObfsPassword != "" {
+		in.Obfs = &option.Hysteria2Obfs{Type: "salamander", Password: cfg.Hysteria2ObfsPassword}
 	}
 	return option.Inbound{Type: C.TypeHysteria2, Tag: "hysteria2", Options: in}, true
 }
 
+// tuicInbound is TUIC v5 on the node's self-signed carrier certificate, like
+// Hysteria2. Its UDP relay reaches WireGuard through the pinned direct
+// outbound like every other carrier.
+func (m *Manager) tuicInbound() option.Inbound {
+	cfg := m.cfg.Load()
+	return option.Inbound{
+		Type: C.TypeTUIC,
+		Tag:  "tuic",
+		Options: &option.TUICInboundOptions{
+			ListenOptions: listenOn(cfg.StealthTUICPortInt()),
+			Users: []option.TUICUser{{
+				Name:     "erebrus",
+				UUID:     m.secrets.TUICUUID,
+				Password: m.secrets.TUICPassword,
+			}},
+			CongestionControl: tuicCongestionControl,
+			InboundTLSOptionsContainer: option.InboundTLSOptionsContainer{TLS: &option.InboundTLSOptions{
+				Enabled:     true,
+				ServerName:  cfg.RealitySNI(),
+				ALPN:        badoption.Listable[string]{"h3"},
+				Certificate: badoption.Listable[string]{m.certPEM},
+				Key:         badoption.Listable[string]{m.keyPEM},
+			}},
+		},
+	}
+}
+
+// wsInbound is VLESS over WebSocket behind ordinary TLS, so a CDN can
+// terminate the client's TLS and forward the upgrade to this origin. The
+// origin certificate is the operator's (e.g. a CDN-issued origin cert) or the
+// node's self-signed carrier certificate, which CDNs accept when they don't
+// verify the origin. Vision flow needs raw TLS, so this user has no flow.
+func (m *Manager) wsInbound() option.Inbound {
+	cfg := m.cfg.Load()
+	tls := &option.InboundTLSOptions{
+		Enabled:    true,
+		ServerName: cfg.StealthWSHost,
+		ALPN:       badoption.Listable[string]{"http/1.1"},
+	}
+	if cfg.StealthWSCertFile != "" {
+		tls.CertificatePath = cfg.StealthWSCertFile
+		tls.KeyPath = cfg.StealthWSKeyFile
+	} else {
+		tls.Certificate = badoption.Listable[string]{m.certPEM}
+		tls.Key = badoption.Listable[string]{m.keyPEM}
+	}
+	return option.Inbound{
+		Type: C.TypeVLESS,
+		Tag:  "vless-ws",
+		Options: &option.VLESSInboundOptions{
+			ListenOptions: listenOn(cfg.StealthWSPortInt()),
+			Users: []option.VLESSUser{{
+				Name: "erebrus",
+				UUID: m.secrets.VLESSUUID,
+			}},
+			InboundTLSOptionsContainer: option.InboundTLSOptionsContainer{TLS: tls},
+			Transport: &option.V2RayTransportOptions{
+				Type:             C.V2RayTransportTypeWebsocket,
+				WebsocketOptions: option.V2RayWebsocketOptions{Path: m.secrets.WSPath},
+			},
+		},
+	}
+}
+
 // listenOn builds ListenOptions bound to all interfaces on the given port.
 func listenOn(port int) option.ListenOptions {
 	addr := badoption.Addr(netip.IPv4Unspecified())
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"net/http"
 	"strconv"
 	"strings"
 	"testing"
@@ -103,7 +104,7 @@ func TestCertStableAndUsable(t *testing.T) {
 func TestParamsDisabled(t *testing.T) {
 	cfg := testConfig(8443, 4443)
 	cfg.EnableStealth = false
-	m := New(cfg, newMemStore())
+	m := New(config.NewLive(cfg), newMemStore())
 	if err := m.Init(context.Background()); err != nil {
 		t.Fatalf("init: %v", err)
 	}
@@ -115,7 +116,7 @@ func TestParamsDisabled(t *testing.T) {
 func TestStartListensAndClose(t *testing.T) {
 	ctx := context.Background()
 	vp, hp := freePort(t), freePort(t)
-	m := New(testConfig(vp, hp), newMemStore())
+	m := New(config.NewLive(testConfig(vp, hp)), newMemStore())
 	if err := m.Init(ctx); err != nil {
 		t.Fatalf("init: %v", err)
 	}
@@ -143,12 +144,12 @@ func TestStartListensAndClose(t *testing.T) {
 
 func TestBuildPeerArtifacts(t *testing.T) {
 	ctx := context.Background()
-	m := New(testConfig(8443, 4443), newMemStore())
+	m := New(config.NewLive(testConfig(8443, 4443)), newMemStore())
 	if err := m.Init(ctx); err != nil {
 		t.Fatalf("init: %v", err)
 	}
 
-	ps := m.BuildPeer("alice", "c2VydmVycHVibGlja2V5MDAwMDAwMDAwMDAwMDAwMD0=", "10.0.0.7/32", "")
+	ps := m.BuildPeer(User{}, "alice", "c2VydmVycHVibGlja2V5MDAwMDAwMDAwMDAwMDAwMD0=", "10.0.0.7/32", "")
 
 	if !strings.HasPrefix(ps.VLESSURI, "vless://") {
 		t.Fatalf("bad vless uri: %s", ps.VLESSURI)
@@ -175,3 +176,224 @@ func TestBuildPeerArtifacts(t *testing.T) {
 		}
 	}
 }
+
+func TestWebSocketCarrier(t *testing.T) {
+	ctx := context.Background()
+	m := New(config.NewLive(testConfig(8443, 4443)), newMemStore())
+	if err := m.Init(ctx); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if ps := m.BuildPeer(User{}, "alice", "", "10.0.0.7/32", ""); ps.WebSocketURI != "" || m.Params().WSPath != "" {
+		t.Fatal("websocket carrier offered without STEALTH_WS_HOST")
+	}
+
+	m.cfg.Update(func(c *config.Config) {
+		c.StealthWSHost = "cdn.example.com"
+		c.StealthWSPort = "2053"
+	})
+	p := m.Params()
+	if p.WSHost != "cdn.example.com" || p.WSPort != 2053 || !strings.HasPrefix(p.WSPath, "/") || len(p.WSPath) < 8 {
+		t.Fatalf("params = %+v", p)
+	}
+	ps := m.BuildPeer(User{}, "alice", "", "10.0.0.7/32", "")
+	for _, want := range []string{"vless://" + p.VLESSUUID + "@cdn.example.com:2053", "type=ws", "security=tls", "host=cdn.example.com"} {
+		if !strings.Contains(ps.WebSocketURI, want) {
+			t.Fatalf("websocket uri missing %q: %s", want, ps.WebSocketURI)
+		}
+	}
+	raw, _ := json.Marshal(ps.SingboxProfile)
+	for _, want := range []string{`"carrier-vless-ws"`, `"type":"ws"`, `"path":"` + p.WSPath + `"`} {
+		if !strings.Contains(string(raw), want) {
+			t.Fatalf("profile missing %q: %s", want, raw)
+		}
+	}
+	if in := m.Inbounds(); len(in) != 3 || in[2].Tag != "vless-ws" || in[2].Port != 2053 {
+		t.Fatalf("inbounds = %+v", in)
+	}
+
+	old := p.WSPath
+	if err := m.RotateAllSecrets(ctx, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Params().WSPath == old {
+		t.Fatal("websocket path not rotated")
+	}
+}
+
+func TestTUICCarrier(t *testing.T) {
+	ctx := context.Background()
+	m := New(config.NewLive(testConfig(8443, 4443)), newMemStore())
+	if err := m.Init(ctx); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if ps := m.BuildPeer(User{}, "alice", "", "10.0.0.7/32", ""); ps.TUICURI != "" || m.Params().TUICUUID != "" {
+		t.Fatal("tuic carrier offered without ENABLE_TUIC")
+	}
+
+	m.cfg.Update(func(c *config.Config) {
+		c.EnableTUIC = true
+		c.StealthTUICPort = "8443"
+	})
+	p := m.Params()
+	if p.TUICPort != 8443 || p.TUICUUID == "" || p.TUICUUID == p.VLESSUUID || p.TUICPassword == "" {
+		t.Fatalf("params = %+v", p)
+	}
+	ps := m.BuildPeer(User{}, "alice", "", "10.0.0.7/32", "")
+	for _, want := range []string{"tuic://" + p.TUICUUID + ":", "@127.0.0.1:8443", "congestion_control=bbr", "sni=www.microsoft.com"} {
+		if !strings.Contains(ps.TUICURI, want) {
+			t.Fatalf("tuic uri missing %q: %s", want, ps.TUICURI)
+		}
+	}
+	raw, _ := json.Marshal(ps.SingboxProfile)
+	for _, want := range []string{`"carrier-tuic"`, `"type":"tuic"`, `"uuid":"` + p.TUICUUID + `"`} {
+		if !strings.Contains(string(raw), want) {
+			t.Fatalf("profile missing %q: %s", want, raw)
+		}
+	}
+	if in := m.Inbounds(); len(in) != 3 || in[2].Tag != "tuic" || in[2].Network != "udp" {
+		t.Fatalf("inbounds = %+v", in)
+	}
+	alice := User{Name: "alice", UUID: "6f1c8f8e-3b7a-4d2e-9c1a-0a5e2b7d4c90", Password: "alice-secret"}
+	if uri := m.BuildPeer(alice, "alice", "", "10.0.0.7/32", "").TUICURI; !strings.HasPrefix(uri, "tuic://"+alice.UUID+":"+alice.Password+"@") {
+		t.Fatalf("peer tuic uri carries node-wide credentials: %s", uri)
+	}
+
+	old := p.TUICPassword
+	if err := m.RotateAllSecrets(ctx, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Params().TUICPassword == old {
+		t.Fatal("tuic password not rotated")
+	}
+}
+
+func TestHTTPSConnectCarrier(t *testing.T) {
+	ctx := context.Background()
+	m := New(config.NewLive(testConfig(freePort(t), freePort(t))), newMemStore())
+	if err := m.Init(ctx); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if ps := m.BuildPeer(User{}, "alice", "", "10.0.0.7/32", ""); ps.NaiveURI != "" || m.Params().ConnectUsername != "" {
+		t.Fatal("https connect carrier offered without STEALTH_CONNECT_HOST")
+	}
+
+	connectPort := strconv.Itoa(freePort(t))
+	m.cfg.Update(func(c *config.Config) {
+		c.StealthConnectHost = "www.example.com"
+		c.StealthConnectPort = connectPort
+	})
+	p := m.Params()
+	if p.ConnectHost != "www.example.com" || p.ConnectUsername == "" || p.ConnectPassword == "" || !p.ConnectInsecure {
+		t.Fatalf("params = %+v", p)
+	}
+	ps := m.BuildPeer(User{}, "alice", "", "10.0.0.7/32", "")
+	if want := fmt.Sprintf("naive+https://%s:%s@www.example.com:%d?", p.ConnectUsername, p.ConnectPassword, p.ConnectPort); !strings.HasPrefix(ps.NaiveURI, want) {
+		t.Fatalf("naive uri = %s, want prefix %s", ps.NaiveURI, want)
+	}
+	raw, _ := json.Marshal(ps.SingboxProfile)
+	for _, want := range []string{`"carrier-naive"`, `"type":"naive"`, `"udp_over_tcp"`} {
+		if !strings.Contains(string(raw), want) {
+			t.Fatalf("profile missing %q: %s", want, raw)
+		}
+	}
+	alice := User{Name: "alice", UUID: "6f1c8f8e-3b7a-4d2e-9c1a-0a5e2b7d4c90", Password: "alice-secret"}
+	if uri := m.BuildPeer(alice, "alice", "", "10.0.0.7/32", "").NaiveURI; !strings.HasPrefix(uri, "naive+https://"+alice.UUID+":"+alice.Password+"@") {
+		t.Fatalf("peer naive uri carries node-wide credentials: %s", uri)
+	}
+
+	// Probes see an ordinary site.
+	if err := m.Start(ctx); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer m.Close()
+	if in := m.Inbounds(); len(in) != 3 || in[2].Tag != "https-connect" || !in[2].Listening {
+		t.Fatalf("inbounds = %+v", in)
+	}
+	c := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // self-signed test node
+		ForceAttemptHTTP2: true,
+	}}
+	resp, err := c.Get(fmt.Sprintf("https://127.0.0.1:%d/", p.ConnectPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET / = %s", resp.Status)
+	}
+
+	old := p.ConnectPassword
+	if err := m.RotateAllSecrets(ctx, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if m.Params().ConnectPassword == old {
+		t.Fatal("https connect password not rotated")
+	}
+}
+
+func TestSessionsCloseOnRevoke(t *testing.T) {
+	var s sessions
+	s.reset([]string{"erebrus", "peer:alice"})
+	a, b := net.Pipe()
+	defer b.Close()
+	closed := make(chan error, 1)
+	onClose, ok := s.add("peer:alice", a, func(err error) { closed <- err })
+	if !ok {
+		t.Fatal("authorised user refused")
+	}
+	if _, ok := s.add("peer:bob", a, nil); ok {
+		t.Fatal("unknown user accepted")
+	}
+
+	s.reset([]string{"erebrus"})
+	if _, err := a.Write([]byte{0}); err == nil {
+		t.Fatal("revoked user's session still open")
+	}
+	if _, ok := s.add("peer:alice", a, nil); ok {
+		t.Fatal("revoked user accepted")
+	}
+	onClose(nil)
+	if err := <-closed; err != nil {
+		t.Fatalf("onClose got %v", err)
+	}
+	if len(s.open) != 0 {
+		t.Fatalf("sessions left: %v", s.open)
+	}
+}
+
+func TestGraceCredentialsPersist(t *testing.T) {
+	ctx := context.Background()
+	st := newMemStore()
+	m := New(config.NewLive(testConfig(freePort(t), freePort(t))), st)
+	if err := m.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	old := m.Params()
+	until := time.Now().Add(time.Hour)
+	if err := m.RotateAllSecrets(ctx, until); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted node still serves the replaced credentials.
+	m2 := New(config.NewLive(testConfig(freePort(t), freePort(t))), st)
+	if err := m2.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, users := m2.serverUsers()
+	if len(users) != 1 || users[0].UUID != old.VLESSUUID || users[0].Password != old.Hysteria2Password {
+		t.Fatalf("grace users = %+v", users)
+	}
+	if ids := m2.graceShortIDs(); len(ids) != 1 || ids[0] != old.RealityShortID {
+		t.Fatalf("grace short-ids = %v", ids)
+	}
+
+	if err := m2.ExpireGrace(ctx, until); err != nil {
+		t.Fatal(err)
+	}
+	if _, users := m2.serverUsers(); len(users) != 0 {
+		t.Fatalf("expired grace users kept: %+v", users)
+	}
+	if left, err := loadGrace(ctx, st, time.Time{}); err != nil || len(left) != 0 {
+		t.Fatalf("stored grace = %+v, %v", left, err)
+	}
+}
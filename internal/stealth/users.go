@@ -0,0 +1,139 @@
+package stealth
+
+import (
+	"io"
+	"sync"
+
+	N "github.com/sagernet/sing/common/network"
+)
+
+// User is one peer's own carrier credentials. The VLESS inbounds (REALITY
+// and WebSocket) accept UUID, the Hysteria2 inbound accepts Password, and
+// the TUIC and HTTPS CONNECT carriers accept the pair, next to the node-wide
+// secrets.
+type User struct {
+	Name     string // peer id
+	UUID     string
+	Password string
+}
+
+// userServer is an inbound whose users can change while it runs. Each
+// User's Name is the sing-box user name. previous holds the replaced
+// node-wide VLESS and Hysteria2 credentials still in their grace period.
+type userServer interface {
+	setUsers(peers, previous []User)
+}
+
+// SetUsers replaces the per-peer carrier users. Running inbounds take the new
+// list in place, without reopening their listeners, and close the sessions of
+// users that are no longer on it. Call it whenever peers are added, removed,
+// suspended or resumed.
+func (m *Manager) SetUsers(users []User) {
+	m.usersMu.Lock()
+	defer m.usersMu.Unlock()
+	m.users = append([]User(nil), users...)
+	m.pushUsers()
+}
+
+// serverUsers lists the users the inbounds accept beside the node-wide ones:
+// the peers, and the credentials still in their grace period. The prefixes
+// keep peer ids clear of the other users' names. usersMu must be held.
+func (m *Manager) serverUsers() (peers, previous []User) {
+	peers = make([]User, 0, len(m.users))
+	for _, u := range m.users {
+		u.Name = "peer:" + u.Name
+		peers = append(peers, u)
+	}
+	for _, g := range m.grace {
+		previous = append(previous, g.user())
+	}
+	return peers, previous
+}
+
+// pushUsers hands the running inbounds the current users. usersMu must be
+// held.
+func (m *Manager) pushUsers() {
+	peers, previous := m.serverUsers()
+	for _, s := range m.servers {
+		s.setUsers(peers, previous)
+	}
+}
+
+// addServer hands s the current users and keeps it up to date from now on.
+// The inbound constructors call it while sing-box is being built.
+func (m *Manager) addServer(s userServer) {
+	m.usersMu.Lock()
+	defer m.usersMu.Unlock()
+	s.setUsers(m.serverUsers())
+	m.servers = append(m.servers, s)
+}
+
+// dropServers forgets the inbounds of a sing-box instance that is going away.
+func (m *Manager) dropServers() {
+	m.usersMu.Lock()
+	m.servers = nil
+	m.usersMu.Unlock()
+}
+
+// sessions tracks an inbound's open connections by user, so that revoking a
+// user closes them rather than letting them run on. It also gates new ones:
+// a Hysteria2 client authenticates once per QUIC connection and may open
+// streams long after its user is gone.
+type sessions struct {
+	mu      sync.Mutex
+	allowed map[string]bool
+	open    map[string]map[*session]struct{}
+}
+
+type session struct{ io.Closer }
+
+// reset makes names the authorised users and closes every session of any
+// other user.
+func (s *sessions) reset(names []string) {
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		allowed[name] = true
+	}
+	var stale []*session
+	s.mu.Lock()
+	s.allowed = allowed
+	for name, open := range s.open {
+		if allowed[name] {
+			continue
+		}
+		for c := range open {
+			stale = append(stale, c)
+		}
+		delete(s.open, name)
+	}
+	s.mu.Unlock()
+	for _, c := range stale {
+		_ = c.Close()
+	}
+}
+
+// add records c as a session of user and returns the close handler that
+// forgets it again. It reports false when user is not authorised.
+func (s *sessions) add(user string, c io.Closer, onClose N.CloseHandlerFunc) (N.CloseHandlerFunc, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.allowed[user] {
+		return onClose, false
+	}
+	if s.open == nil {
+		s.open = make(map[string]map[*session]struct{})
+	}
+	if s.open[user] == nil {
+		s.open[user] = make(map[*session]struct{})
+	}
+	sess := &session{c}
+	s.open[user][sess] = struct{}{}
+	return func(err error) {
+		s.mu.Lock()
+		delete(s.open[user], sess)
+		s.mu.Unlock()
+		if onClose != nil {
+			onClose(err)
+		}
+	}, true
+}
@@ -49,6 +49,16 @@ func (s *Store) DeactivateExpiredCarrierCredentials(ctx context.Context, now int
 	return res.RowsAffected()
 }
 
+// DeactivatePeerCarrierCredentials marks a peer's own credential rows inactive.
+func (s *Store) DeactivatePeerCarrierCredentials(ctx context.Context, peerID string) (int64, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE carrier_credentials SET active=0 WHERE active=1 AND scope='peer' AND peer_id=?`, peerID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 // ListActiveCarrierCredentials returns active credential records.
 func (s *Store) ListActiveCarrierCredentials(ctx context.Context) ([]CarrierCredential, error) {
 	rows, err := s.db.QueryContext(ctx,
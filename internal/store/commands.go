@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Gateway command journal states.
+const (
+	CommandRunning = "running"
+	CommandDone    = "done"
+)
+
+// GatewayCommand is one journaled gateway control command.
+type GatewayCommand struct {
+	RequestID string
+	Action    string
+	Status    string
+	Result    string // JSON, set once done
+	Delivered bool
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+// BeginGatewayCommand records requestID as running. When the request ID is
+// already journaled it returns the existing row and started=false; the caller
+// must not execute the command again.
+func (s *Store) BeginGatewayCommand(ctx context.Context, requestID, action string) (existing *GatewayCommand, started bool, err error) {
+	now := time.Now().Unix()
+	res, err := s.db.ExecContext(ctx,
+		`INSERT INTO gateway_commands(request_id,action,status,created_at,updated_at)
+		 VALUES(?,?,?,?,?) ON CONFLICT(request_id) DO NOTHING`,
+		requestID, action, CommandRunning, now, now)
+	if err != nil {
+		return nil, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 1 {
+		return nil, true, nil
+	}
+	c, err := s.GetGatewayCommand(ctx, requestID)
+	return c, false, err
+}
+
+// GetGatewayCommand returns a journaled command or ErrNotFound.
+func (s *Store) GetGatewayCommand(ctx context.Context, requestID string) (*GatewayCommand, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT request_id,action,status,result,delivered,created_at,updated_at
+		 FROM gateway_commands WHERE request_id=?`, requestID)
+	c, err := scanGatewayCommand(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return c, err
+}
+
+// FinishGatewayCommand stores the result of a running command as undelivered.
+func (s *Store) FinishGatewayCommand(ctx context.Context, requestID, result string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE gateway_commands SET status=?, result=?, delivered=0, updated_at=? WHERE request_id=?`,
+		CommandDone, result, time.Now().Unix(), requestID)
+	return err
+}
+
+// MarkGatewayCommandDelivered records that the result reached the gateway.
+func (s *Store) MarkGatewayCommandDelivered(ctx context.Context, requestID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE gateway_commands SET delivered=1, updated_at=? WHERE request_id=?`,
+		time.Now().Unix(), requestID)
+	return err
+}
+
+// ListGatewayCommands returns journaled commands in the given status, oldest
+// first; undeliveredOnly limits it to results the gateway has not received.
+func (s *Store) ListGatewayCommands(ctx context.Context, status string, undeliveredOnly bool) ([]*GatewayCommand, error) {
+	q := `SELECT request_id,action,status,result,delivered,created_at,updated_at
+	      FROM gateway_commands WHERE status=?`
+	if undeliveredOnly {
+		q += ` AND delivered=0`
+	}
+	rows, err := s.db.QueryContext(ctx, q+` ORDER BY created_at ASC`, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*GatewayCommand
+	for rows.Next() {
+		c, err := scanGatewayCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// PruneGatewayCommands deletes finished commands last touched before cutoff.
+func (s *Store) PruneGatewayCommands(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM gateway_commands WHERE status=? AND updated_at < ?`, CommandDone, cutoff.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanGatewayCommand(sc scanner) (*GatewayCommand, error) {
+	var c GatewayCommand
+	var delivered int
+	if err := sc.Scan(&c.RequestID, &c.Action, &c.Status, &c.Result, &delivered, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return nil, err
+	}
+	c.Delivered = delivered != 0
+	return &c, nil
+}
@@ -0,0 +1,46 @@
+package store
+
+import "context"
+
+// IntegrityCheck runs SQLite's integrity and foreign-key checks. An intact
+// database returns ["ok"]; otherwise each problem is one entry.
+func (s *Store) IntegrityCheck(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `PRAGMA integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		out = append(out, line)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	fk, err := s.db.QueryContext(ctx, `PRAGMA foreign_key_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer fk.Close()
+	for fk.Next() {
+		var (
+			table, parent string
+			rowid         any
+			fkid          int
+		)
+		if err := fk.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return nil, err
+		}
+		if len(out) == 1 && out[0] == "ok" {
+			out = nil
+		}
+		out = append(out, "foreign key violation: "+table+" -> "+parent)
+	}
+	return out, fk.Err()
+}
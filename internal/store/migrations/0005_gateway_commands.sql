@@ -0,0 +1,14 @@
+-- Journal of gateway control commands by request_id, so a retried command
+-- returns its stored result instead of running twice, and results the
+-- gateway never received are re-sent after reconnect.
+CREATE TABLE IF NOT EXISTS gateway_commands (
+    request_id TEXT PRIMARY KEY,
+    action     TEXT NOT NULL,
+    status     TEXT NOT NULL,            -- running | done
+    result     TEXT NOT NULL DEFAULT '', -- CommandResult JSON once done
+    delivered  INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_gateway_commands_pending ON gateway_commands(delivered, status);
@@ -117,6 +117,19 @@ func (s *Store) SetSetting(ctx context.Context, key, value string) error {
 	return err
 }
 
+// SwapSetting sets key to value only if it still holds old, reporting
+// whether it did. Read-modify-write cycles that race with other writers (the
+// drain CLI, gateway commands) use it instead of SetSetting.
+func (s *Store) SwapSetting(ctx context.Context, key, old, value string) (bool, error) {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE node_settings SET value = ? WHERE key = ? AND value = ?`, value, key, old)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
 // --- peers ---
 
 // GetPeer returns a peer by id.
@@ -153,6 +166,20 @@ func (s *Store) DeletePeer(ctx context.Context, id string) error {
 	return err
 }
 
+// SetPeerEnabled suspends (false) or resumes (true) a peer without touching
+// its address or credentials.
+func (s *Store) SetPeerEnabled(ctx context.Context, id string, enabled bool) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE peers SET enabled=?, updated_at=? WHERE id=?`,
+		boolToInt(enabled), time.Now().Unix(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 // UpsertPeer creates or updates a peer, allocating a WireGuard IP from subnet
 // on first creation. The whole operation runs in one immediate transaction so
 // IP allocation is race-free even under concurrent calls. On update, the
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func openTest(t *testing.T) *Store {
+	t.Helper()
+	st, err := Open(filepath.Join(t.TempDir(), "node.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+	return st
+}
+
+func TestSwapSetting(t *testing.T) {
+	ctx := context.Background()
+	st := openTest(t)
+	if err := st.SetSetting(ctx, "k", "draining"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another writer got in first: the stale swap must not overwrite it.
+	if err := st.SetSetting(ctx, "k", "online"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := st.SwapSetting(ctx, "k", "draining", "drained"); err != nil || ok {
+		t.Fatalf("stale swap = %v, %v", ok, err)
+	}
+	if v, _ := st.GetSetting(ctx, "k"); v != "online" {
+		t.Fatalf("value after stale swap = %q", v)
+	}
+
+	if ok, err := st.SwapSetting(ctx, "k", "online", "draining"); err != nil || !ok {
+		t.Fatalf("swap = %v, %v", ok, err)
+	}
+	if v, _ := st.GetSetting(ctx, "k"); v != "draining" {
+		t.Fatalf("value after swap = %q", v)
+	}
+	if ok, _ := st.SwapSetting(ctx, "missing", "", "x"); ok {
+		t.Fatal("swap created a missing setting")
+	}
+}
+
+func TestSetPeerEnabled(t *testing.T) {
+	ctx := context.Background()
+	st := openTest(t)
+	if err := st.SetPeerEnabled(ctx, "ghost", false); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown peer: %v", err)
+	}
+	if _, err := st.UpsertPeer(ctx, &Peer{ID: "alice", Name: "alice", Enabled: true}, "10.8.0.1/24", GeneratedCreds{}); err != nil {
+		t.Fatal(err)
+	}
+	before, err := st.GetPeer(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.SetPeerEnabled(ctx, "alice", false); err != nil {
+		t.Fatal(err)
+	}
+	p, err := st.GetPeer(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Enabled || p.WGAllowedIP != before.WGAllowedIP {
+		t.Fatalf("suspended peer = %+v", p)
+	}
+	if err := st.SetPeerEnabled(ctx, "alice", true); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := st.GetPeer(ctx, "alice"); p == nil || !p.Enabled {
+		t.Fatalf("resumed peer = %+v", p)
+	}
+}
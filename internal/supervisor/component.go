@@ -0,0 +1,103 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Func adapts start/stop/health functions to a Component. Nil functions are
+// no-ops (Health reports healthy).
+type Func struct {
+	ComponentName string
+	StartFn       func(ctx context.Context) error
+	StopFn        func(ctx context.Context) error
+	HealthFn      func() error
+}
+
+func (f *Func) Name() string { return f.ComponentName }
+
+func (f *Func) Start(ctx context.Context) error {
+	if f.StartFn == nil {
+		return nil
+	}
+	return f.StartFn(ctx)
+}
+
+func (f *Func) Stop(ctx context.Context) error {
+	if f.StopFn == nil {
+		return nil
+	}
+	return f.StopFn(ctx)
+}
+
+func (f *Func) Health() error {
+	if f.HealthFn == nil {
+		return nil
+	}
+	return f.HealthFn()
+}
+
+// errExited is reported when a blocking component returns without error
+// while it was still supposed to run.
+var errExited = errors.New("exited unexpectedly")
+
+// Blocking adapts a run-until-cancelled function (a DNS server, the gateway
+// client) to a Component. Health reports the error it returned, if it did.
+func Blocking(name string, run func(ctx context.Context) error) Component {
+	return &blocking{name: name, run: run}
+}
+
+type blocking struct {
+	name string
+	run  func(ctx context.Context) error
+
+	mu   sync.Mutex
+	err  error
+	done chan struct{}
+}
+
+func (b *blocking) Name() string { return b.name }
+
+func (b *blocking) Start(ctx context.Context) error {
+	done := make(chan struct{})
+	b.mu.Lock()
+	b.err, b.done = nil, done
+	b.mu.Unlock()
+	go func() {
+		defer close(done)
+		err := b.run(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errExited
+		}
+		b.mu.Lock()
+		b.err = err
+		b.mu.Unlock()
+	}()
+	return nil
+}
+
+// Stop waits for the run function to return after its context was cancelled.
+func (b *blocking) Stop(ctx context.Context) error {
+	b.mu.Lock()
+	done := b.done
+	b.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *blocking) Health() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
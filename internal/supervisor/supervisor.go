@@ -0,0 +1,303 @@
+// Package supervisor runs the node's long-lived subsystems (DNS, carriers,
+// libp2p, Drop, gateway client) under one lifecycle: ordered start, health
+// polling, restart with exponential backoff, and reverse-order shutdown.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Component states.
+const (
+	StateStarting   = "starting"
+	StateRunning    = "running"
+	StateRestarting = "restarting"
+	StateFailed     = "failed"
+	StateStopped    = "stopped"
+)
+
+// Component is one supervised subsystem.
+type Component interface {
+	Name() string
+	// Start brings the component up and returns; ctx is cancelled when the
+	// supervisor stops or restarts it.
+	Start(ctx context.Context) error
+	// Stop releases what Start acquired. Called after ctx is cancelled.
+	Stop(ctx context.Context) error
+	// Health returns nil while the component works.
+	Health() error
+}
+
+// Policy controls restarts of one component.
+type Policy struct {
+	// MaxRestarts gives up after this many consecutive failed restarts;
+	// 0 restarts forever.
+	MaxRestarts int
+	MinBackoff  time.Duration // default 1s
+	MaxBackoff  time.Duration // default 1m
+	// Optional components do not fail readiness when down.
+	Optional bool
+}
+
+// Status is a component's state for /api/v2/status and readiness.
+type Status struct {
+	Name      string    `json:"name"`
+	State     string    `json:"state"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	Since     time.Time `json:"since"`
+	Optional  bool      `json:"optional,omitempty"`
+}
+
+type entry struct {
+	c      Component
+	policy Policy
+
+	cancel   context.CancelFunc
+	status   Status
+	failures int // consecutive, reset after a healthy interval
+	retryAt  time.Time
+}
+
+// Supervisor owns a set of components.
+type Supervisor struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	ctx     context.Context
+	entries []*entry
+	stopped bool
+	done    chan struct{}
+}
+
+// New creates a supervisor that checks health every interval (default 5s).
+func New(interval time.Duration) *Supervisor {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return &Supervisor{interval: interval, done: make(chan struct{})}
+}
+
+// Add registers a component. Components start in the order added.
+func (s *Supervisor) Add(c Component, p Policy) {
+	if p.MinBackoff <= 0 {
+		p.MinBackoff = time.Second
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = time.Minute
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, &entry{c: c, policy: p, status: Status{
+		Name: c.Name(), State: StateStopped, Since: time.Now(), Optional: p.Optional,
+	}})
+}
+
+// Start starts every component in order and begins supervising. A component
+// that fails to start is retried under its policy rather than aborting.
+func (s *Supervisor) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	entries := append([]*entry(nil), s.entries...)
+	s.mu.Unlock()
+	for _, e := range entries {
+		s.start(ctx, e)
+	}
+	go s.loop(ctx)
+}
+
+// Has reports whether a component with this name was added.
+func (s *Supervisor) Has(name string) bool { return s.lookup(name) != nil }
+
+// Restart stops and starts one component now (e.g. after a config reload),
+// returning its start error if it did not come back up. A component that
+// fails here is retried under its policy like any other failure.
+func (s *Supervisor) Restart(name string) error {
+	e := s.lookup(name)
+	if e == nil {
+		return fmt.Errorf("unknown component %q", name)
+	}
+	s.mu.Lock()
+	ctx := s.ctx
+	// Keep the health loop from starting it concurrently.
+	e.retryAt = time.Now().Add(e.policy.MaxBackoff)
+	s.mu.Unlock()
+	if ctx == nil {
+		return fmt.Errorf("supervisor not started")
+	}
+	s.stop(ctx, e, StateRestarting, nil)
+	s.start(ctx, e)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.status.State != StateRunning {
+		return fmt.Errorf("%s: %s", e.status.State, e.status.LastError)
+	}
+	return nil
+}
+
+func (s *Supervisor) lookup(name string) *entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if e.status.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// Stop stops components in reverse start order.
+func (s *Supervisor) Stop(ctx context.Context) {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	close(s.done)
+	entries := append([]*entry(nil), s.entries...)
+	s.mu.Unlock()
+	for i := len(entries) - 1; i >= 0; i-- {
+		s.stop(ctx, entries[i], StateStopped, nil)
+	}
+}
+
+// Statuses returns a snapshot of every component in start order.
+func (s *Supervisor) Statuses() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Status, 0, len(s.entries))
+	for _, e := range s.entries {
+		out = append(out, e.status)
+	}
+	return out
+}
+
+func (s *Supervisor) loop(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.check(ctx)
+		}
+	}
+}
+
+func (s *Supervisor) check(ctx context.Context) {
+	s.mu.Lock()
+	entries := append([]*entry(nil), s.entries...)
+	s.mu.Unlock()
+	for _, e := range entries {
+		s.mu.Lock()
+		state, retryAt := e.status.State, e.retryAt
+		s.mu.Unlock()
+		switch state {
+		case StateRunning:
+			if err := e.c.Health(); err != nil {
+				slog.Warn("component unhealthy", "component", e.c.Name(), "err", err)
+				s.fail(ctx, e, err)
+			} else {
+				// Forget past failures once the component has stayed up
+				// longer than its longest backoff.
+				s.mu.Lock()
+				if time.Since(e.status.Since) > e.policy.MaxBackoff {
+					e.failures = 0
+				}
+				s.mu.Unlock()
+			}
+		case StateRestarting:
+			if time.Now().After(retryAt) {
+				s.start(ctx, e)
+			}
+		}
+	}
+}
+
+func (s *Supervisor) start(ctx context.Context, e *entry) {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	restarting := e.status.State == StateRestarting
+	s.setState(e, StateStarting, nil)
+	s.mu.Unlock()
+
+	runCtx, cancel := context.WithCancel(ctx)
+	err := e.c.Start(runCtx)
+	if err == nil {
+		err = e.c.Health()
+	}
+	s.mu.Lock()
+	e.cancel = cancel
+	if restarting {
+		e.status.Restarts++
+	}
+	s.mu.Unlock()
+	if err != nil {
+		slog.Warn("component failed to start", "component", e.c.Name(), "err", err)
+		s.fail(ctx, e, err)
+		return
+	}
+	s.mu.Lock()
+	s.setState(e, StateRunning, nil)
+	s.mu.Unlock()
+}
+
+// fail stops e and schedules a restart, or marks it failed once the policy's
+// restart budget is spent.
+func (s *Supervisor) fail(ctx context.Context, e *entry, err error) {
+	s.stop(ctx, e, StateRestarting, err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.failures++
+	if e.policy.MaxRestarts > 0 && e.failures > e.policy.MaxRestarts {
+		s.setState(e, StateFailed, fmt.Errorf("gave up after %d restarts: %w", e.policy.MaxRestarts, err))
+		slog.Error("component failed permanently", "component", e.c.Name(), "err", err)
+		return
+	}
+	backoff := e.policy.MinBackoff << (e.failures - 1)
+	if backoff <= 0 || backoff > e.policy.MaxBackoff {
+		backoff = e.policy.MaxBackoff
+	}
+	e.retryAt = time.Now().Add(backoff)
+	slog.Info("component restart scheduled", "component", e.c.Name(), "in", backoff)
+}
+
+func (s *Supervisor) stop(ctx context.Context, e *entry, state string, cause error) {
+	s.mu.Lock()
+	cancel := e.cancel
+	e.cancel = nil
+	s.setState(e, state, cause)
+	s.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	if err := e.c.Stop(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		slog.Warn("component stop failed", "component", e.c.Name(), "err", err)
+	}
+}
+
+// setState must be called with s.mu held.
+func (s *Supervisor) setState(e *entry, state string, err error) {
+	if e.status.State != state {
+		e.status.Since = time.Now()
+	}
+	e.status.State = state
+	if err != nil {
+		e.status.LastError = err.Error()
+	} else if state == StateRunning {
+		e.status.LastError = ""
+	}
+}
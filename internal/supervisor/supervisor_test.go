@@ -0,0 +1,118 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRestartsFailedComponent(t *testing.T) {
+	var mu sync.Mutex
+	runs := 0
+	c := Blocking("dns", func(ctx context.Context) error {
+		mu.Lock()
+		runs++
+		n := runs
+		mu.Unlock()
+		if n == 1 {
+			return errors.New("bind: address in use")
+		}
+		<-ctx.Done()
+		return nil
+	})
+	s := New(10 * time.Millisecond)
+	s.Add(c, Policy{MinBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+
+	waitFor(t, func() bool {
+		st := s.Statuses()[0]
+		return st.State == StateRunning && st.Restarts == 1
+	})
+	s.Stop(context.Background())
+	if st := s.Statuses()[0]; st.State != StateStopped {
+		t.Fatalf("state after stop = %s", st.State)
+	}
+}
+
+func TestGivesUpAfterMaxRestarts(t *testing.T) {
+	s := New(10 * time.Millisecond)
+	s.Add(&Func{ComponentName: "p2p", StartFn: func(context.Context) error {
+		return errors.New("no route")
+	}}, Policy{MaxRestarts: 2, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+	waitFor(t, func() bool { return s.Statuses()[0].State == StateFailed })
+	if st := s.Statuses()[0]; st.Restarts != 2 || st.LastError == "" {
+		t.Fatalf("status = %+v", st)
+	}
+	s.Stop(context.Background())
+}
+
+func TestStopsInReverseOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	mk := func(name string) Component {
+		return &Func{ComponentName: name, StopFn: func(context.Context) error {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return nil
+		}}
+	}
+	s := New(time.Hour)
+	for _, n := range []string{"stealth", "dns", "gateway"} {
+		s.Add(mk(n), Policy{})
+	}
+	s.Start(context.Background())
+	s.Stop(context.Background())
+	if len(order) != 3 || order[0] != "gateway" || order[2] != "stealth" {
+		t.Fatalf("stop order = %v", order)
+	}
+}
+
+func TestRestartOnDemand(t *testing.T) {
+	var mu sync.Mutex
+	starts, stops := 0, 0
+	s := New(time.Hour)
+	s.Add(&Func{
+		ComponentName: "stealth",
+		StartFn:       func(context.Context) error { mu.Lock(); starts++; mu.Unlock(); return nil },
+		StopFn:        func(context.Context) error { mu.Lock(); stops++; mu.Unlock(); return nil },
+	}, Policy{})
+	if err := s.Restart("stealth"); err == nil {
+		t.Fatal("expected error before Start")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+	if err := s.Restart("stealth"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Restart("dns"); err == nil {
+		t.Fatal("expected error for unknown component")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if starts != 2 || stops != 1 {
+		t.Fatalf("starts=%d stops=%d", starts, stops)
+	}
+	if st := s.Statuses()[0]; st.State != StateRunning || st.Restarts != 1 {
+		t.Fatalf("status = %+v", st)
+	}
+}
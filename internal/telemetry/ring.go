@@ -0,0 +1,46 @@
+package telemetry
+
+import (
+	"strings"
+	"sync"
+)
+
+// logRingSize is how many recent log records RecentLogs keeps.
+const logRingSize = 2000
+
+// logRing keeps the most recent JSON log records for diagnostics bundles.
+// slog's JSON handler writes one record per Write call.
+type logRing struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+var recent = &logRing{lines: make([]string, logRingSize)}
+
+func (r *logRing) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	r.lines[r.next] = strings.TrimRight(string(p), "\n")
+	r.next = (r.next + 1) % len(r.lines)
+	if r.next == 0 {
+		r.full = true
+	}
+	r.mu.Unlock()
+	return len(p), nil
+}
+
+func (r *logRing) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]string(nil), r.lines[:r.next]...)
+	}
+	out := make([]string, 0, len(r.lines))
+	out = append(out, r.lines[r.next:]...)
+	return append(out, r.lines[:r.next]...)
+}
+
+// RecentLogs returns the node's most recent log records, oldest first, one
+// JSON object per entry. Empty unless InitLogger was called.
+func RecentLogs() []string { return recent.snapshot() }
@@ -3,6 +3,7 @@
 package telemetry
 
 import (
+	"io"
 	"log/slog"
 	"os"
 
@@ -11,27 +12,28 @@ import (
 )
 
 // InitLogger installs a JSON slog logger as the default. debug=true lowers the
-// level to Debug.
+// level to Debug. Records are also kept for RecentLogs.
 func InitLogger(debug bool) {
 	level := slog.LevelInfo
 	if debug {
 		level = slog.LevelDebug
 	}
-	h := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	h := slog.NewJSONHandler(io.MultiWriter(os.Stderr, recent), &slog.HandlerOptions{Level: level})
 	slog.SetDefault(slog.New(h))
 }
 
 // Metrics holds the node's Prometheus collectors.
 type Metrics struct {
-	WGPeers            prometheus.Gauge
-	ProxySessions      prometheus.Gauge
-	SingboxRebuilds    prometheus.Counter
-	PeerProvisioned    prometheus.Counter
-	PeerDeprovisioned  prometheus.Counter
-	DropUploads        *prometheus.CounterVec
-	DropUploadBytes    *prometheus.CounterVec
-	DropDownloadBytes  *prometheus.CounterVec
-	DropNodeOperations *prometheus.CounterVec
+	WGPeers             prometheus.Gauge
+	ProxySessions       prometheus.Gauge
+	SingboxRebuilds     prometheus.Counter
+	PeerProvisioned     prometheus.Counter
+	PeerDeprovisioned   prometheus.Counter
+	DropUploads         *prometheus.CounterVec
+	DropUploadBytes     *prometheus.CounterVec
+	DropDownloadBytes   *prometheus.CounterVec
+	DropNodeOperations  *prometheus.CounterVec
+	GatewayAuthFailures *prometheus.CounterVec
 }
 
 // NewMetrics registers and returns the node metrics on the default registry.
@@ -64,5 +66,8 @@ func NewMetrics() *Metrics {
 		DropNodeOperations: promauto.NewCounterVec(prometheus.CounterOpts{
 			Name: "drop_node_operations_total", Help: "Drop node operations by operation and result.",
 		}, []string{"operation", "result"}),
+		GatewayAuthFailures: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "erebrus_gateway_auth_failures_total", Help: "Rejected gateway call tokens by reason.",
+		}, []string{"reason"}),
 	}
 }
@@ -0,0 +1,59 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrUpToDate is returned by Install when the manifest offers nothing newer
+// and force is off.
+var ErrUpToDate = errors.New("already up to date")
+
+// Install fetches and verifies the release at manifestURL, stages and
+// preflights its binary, swaps it over exe and records a pending State. The
+// caller then restarts the node; the new process commits or rolls back.
+func (f *Fetcher) Install(ctx context.Context, st SettingsStore, manifestURL, exe, current string, force bool) (*State, error) {
+	if manifestURL == "" {
+		return nil, errors.New("no manifest URL (set UPGRADE_MANIFEST_URL)")
+	}
+	m, err := f.Manifest(ctx, manifestURL)
+	if err != nil {
+		return nil, err
+	}
+	if !force && !Newer(m.Version, current) {
+		return nil, fmt.Errorf("%w: running %s, manifest offers %s", ErrUpToDate, current, m.Version)
+	}
+	goos, goarch := Platform()
+	art, ok := m.Artifact(goos, goarch)
+	if !ok {
+		return nil, fmt.Errorf("release %s has no binary for %s/%s", m.Version, goos, goarch)
+	}
+	staged, err := f.Stage(ctx, manifestURL, art, exe)
+	if err != nil {
+		return nil, err
+	}
+	if err := Preflight(ctx, staged, m.Version); err != nil {
+		_ = os.Remove(staged)
+		return nil, err
+	}
+	prev, err := Swap(exe, staged)
+	if err != nil {
+		_ = os.Remove(staged)
+		return nil, err
+	}
+	s := &State{
+		Status: StatusPending, FromVersion: current, ToVersion: m.Version,
+		Exe: exe, Prev: prev, StartedAt: time.Now().UTC(),
+	}
+	if err := SaveState(ctx, st, s); err != nil {
+		// Without a pending record nothing would verify the new binary.
+		if rerr := Restore(exe, prev); rerr != nil {
+			return nil, fmt.Errorf("record upgrade: %v; restore previous binary: %w", err, rerr)
+		}
+		return nil, fmt.Errorf("record upgrade: %w", err)
+	}
+	return s, nil
+}
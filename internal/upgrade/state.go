@@ -0,0 +1,61 @@
+package upgrade
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const settingState = "upgrade_state"
+
+// Upgrade statuses.
+const (
+	StatusPending    = "pending"     // new binary installed, not yet proven healthy
+	StatusCommitted  = "committed"   // new binary reached readiness
+	StatusRolledBack = "rolled_back" // previous binary restored
+	StatusFailed     = "failed"      // never got as far as running the new binary
+)
+
+// State tracks one upgrade across the restart into the new binary. It lives
+// in the node database so the new process can finish (or undo) the job.
+type State struct {
+	Status      string    `json:"status"`
+	FromVersion string    `json:"from_version"`
+	ToVersion   string    `json:"to_version"`
+	Exe         string    `json:"exe"`
+	Prev        string    `json:"prev"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at,omitempty"`
+	// Boots counts starts of the new binary while pending; a crash loop
+	// rolls back without waiting for the readiness deadline.
+	Boots int    `json:"boots,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// SettingsStore is the slice of the node store State needs.
+type SettingsStore interface {
+	GetSetting(ctx context.Context, key string) (string, error)
+	SetSetting(ctx context.Context, key, value string) error
+}
+
+// LoadState returns the last upgrade, or nil if the node never upgraded.
+func LoadState(ctx context.Context, st SettingsStore) (*State, error) {
+	raw, err := st.GetSetting(ctx, settingState)
+	if err != nil || raw == "" {
+		return nil, err
+	}
+	var s State
+	if err := json.Unmarshal([]byte(raw), &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveState persists s.
+func SaveState(ctx context.Context, st SettingsStore, s *State) error {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return st.SetSetting(ctx, settingState, string(raw))
+}
@@ -0,0 +1,321 @@
+// Package upgrade implements the node's signed self-update: fetch a release
+// manifest, verify its Ed25519 signature against a pinned release key,
+// download and check the binary for this platform, and swap it into place
+// atomically with the previous binary kept for rollback.
+//
+// The manifest is plain JSON served next to a detached signature at
+// <manifest-url>.sig (base64 of the Ed25519 signature over the exact
+// manifest bytes). Artifact URLs may be relative to the manifest URL.
+package upgrade
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PinnedReleaseKey is the Ed25519 release key (hex) built into the binary,
+// set with -ldflags "-X github.com/NetSepio/erebrus/internal/upgrade.PinnedReleaseKey=…".
+// UPGRADE_RELEASE_KEY overrides it.
+var PinnedReleaseKey = ""
+
+// maxManifestBytes bounds the manifest and signature downloads.
+const maxManifestBytes = 1 << 20
+
+// Manifest describes one release.
+type Manifest struct {
+	Version    string     `json:"version"`
+	ReleasedAt time.Time  `json:"released_at,omitempty"`
+	Notes      string     `json:"notes,omitempty"`
+	Artifacts  []Artifact `json:"artifacts"`
+}
+
+// Artifact is the node binary for one platform.
+type Artifact struct {
+	OS     string `json:"os"`
+	Arch   string `json:"arch"`
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// Artifact returns the binary for goos/goarch.
+func (m *Manifest) Artifact(goos, goarch string) (Artifact, bool) {
+	for _, a := range m.Artifacts {
+		if a.OS == goos && a.Arch == goarch {
+			return a, true
+		}
+	}
+	return Artifact{}, false
+}
+
+// ParsePublicKey accepts a 32-byte Ed25519 public key as hex or base64.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, errors.New("no release key pinned (set UPGRADE_RELEASE_KEY)")
+	}
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		raw, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("release key must be a %d-byte Ed25519 key in hex or base64", ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// ReleaseKey returns the configured key, falling back to PinnedReleaseKey.
+func ReleaseKey(configured string) (ed25519.PublicKey, error) {
+	if configured == "" {
+		configured = PinnedReleaseKey
+	}
+	return ParsePublicKey(configured)
+}
+
+// Fetcher downloads and verifies releases.
+type Fetcher struct {
+	Client *http.Client
+	Key    ed25519.PublicKey
+}
+
+func (f *Fetcher) client() *http.Client {
+	if f.Client != nil {
+		return f.Client
+	}
+	return &http.Client{Timeout: 5 * time.Minute}
+}
+
+// Manifest fetches manifestURL and its signature and returns the manifest
+// only if the signature verifies.
+func (f *Fetcher) Manifest(ctx context.Context, manifestURL string) (*Manifest, error) {
+	body, err := f.get(ctx, manifestURL, maxManifestBytes)
+	if err != nil {
+		return nil, fmt.Errorf("fetch manifest: %w", err)
+	}
+	sigB64, err := f.get(ctx, manifestURL+".sig", maxManifestBytes)
+	if err != nil {
+		return nil, fmt.Errorf("fetch manifest signature: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sigB64)))
+	if err != nil {
+		return nil, fmt.Errorf("manifest signature: %w", err)
+	}
+	if !ed25519.Verify(f.Key, body, sig) {
+		return nil, errors.New("manifest signature does not verify against the release key")
+	}
+	var m Manifest
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	if m.Version == "" {
+		return nil, errors.New("manifest has no version")
+	}
+	return &m, nil
+}
+
+// Stage downloads art next to exe as <exe>.new, checks its size and SHA-256,
+// and makes it executable. The staged file is on the same filesystem as exe
+// so Swap can rename it atomically.
+func (f *Fetcher) Stage(ctx context.Context, manifestURL string, art Artifact, exe string) (string, error) {
+	src, err := resolve(manifestURL, art.URL)
+	if err != nil {
+		return "", err
+	}
+	want, err := hex.DecodeString(art.SHA256)
+	if err != nil || len(want) != sha256.Size {
+		return "", fmt.Errorf("artifact sha256 %q is not a hex SHA-256", art.SHA256)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return "", fmt.Errorf("download %s: %w", src, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download %s: status %d", src, resp.StatusCode)
+	}
+
+	staged := exe + ".new"
+	out, err := os.OpenFile(staged, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o755)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	body := io.Reader(resp.Body)
+	if art.Size > 0 {
+		body = io.LimitReader(resp.Body, art.Size+1)
+	}
+	n, err := io.Copy(io.MultiWriter(out, h), body)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	switch {
+	case err != nil:
+	case art.Size > 0 && n != art.Size:
+		err = fmt.Errorf("downloaded %d bytes, manifest says %d", n, art.Size)
+	case hex.EncodeToString(h.Sum(nil)) != hex.EncodeToString(want):
+		err = errors.New("downloaded binary does not match the manifest sha256")
+	}
+	if err != nil {
+		_ = os.Remove(staged)
+		return "", err
+	}
+	return staged, nil
+}
+
+func (f *Fetcher) get(ctx context.Context, rawURL string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: status %d", rawURL, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+func resolve(base, ref string) (string, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	return b.ResolveReference(r).String(), nil
+}
+
+// Preflight runs `<staged> version` and checks it reports want, so a binary
+// that cannot start on this host is never swapped in.
+func Preflight(ctx context.Context, staged, want string) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, staged, "version").Output()
+	if err != nil {
+		return fmt.Errorf("staged binary does not run: %w", err)
+	}
+	if got := strings.TrimSpace(string(out)); got != want {
+		return fmt.Errorf("staged binary reports version %q, manifest says %q", got, want)
+	}
+	return nil
+}
+
+// Swap moves staged over exe, keeping the current binary as <exe>.prev.
+// Both renames stay within exe's directory, so each is atomic.
+func Swap(exe, staged string) (prev string, err error) {
+	prev = exe + ".prev"
+	_ = os.Remove(prev)
+	if err := os.Link(exe, prev); err != nil {
+		// Hard links can fail (e.g. overlay lower layers); copy instead.
+		if err := copyFile(exe, prev); err != nil {
+			return "", fmt.Errorf("keep previous binary: %w", err)
+		}
+	}
+	if err := os.Rename(staged, exe); err != nil {
+		return "", fmt.Errorf("install staged binary: %w", err)
+	}
+	return prev, nil
+}
+
+// Restore puts the previous binary back.
+func Restore(exe, prev string) error {
+	tmp := exe + ".rollback"
+	if err := copyFile(prev, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, exe)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Executable is the running binary's resolved path.
+func Executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// Platform is the manifest os/arch of this binary.
+func Platform() (goos, goarch string) { return runtime.GOOS, runtime.GOARCH }
+
+// Newer reports whether version a is newer than b. Versions compare by their
+// dotted numeric prefix ("2.1.0-abc" is 2.1.0); a build suffix alone never
+// makes a version newer.
+func Newer(a, b string) bool {
+	pa, pb := numericParts(a), numericParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			return x > y
+		}
+	}
+	return false
+}
+
+func numericParts(v string) []int {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	var out []int
+	for _, p := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			break
+		}
+		out = append(out, n)
+	}
+	return out
+}
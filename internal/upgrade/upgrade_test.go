@@ -0,0 +1,148 @@
+package upgrade
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+type memSettings map[string]string
+
+func (m memSettings) GetSetting(_ context.Context, k string) (string, error) { return m[k], nil }
+func (m memSettings) SetSetting(_ context.Context, k, v string) error        { m[k] = v; return nil }
+
+// release publishes a signed manifest and a fake binary that reports
+// version under a local file server.
+func release(t *testing.T, key ed25519.PrivateKey, version string, tamper bool) string {
+	t.Helper()
+	dir := t.TempDir()
+	bin := []byte("#!/bin/sh\necho " + version + "\n")
+	sum := sha256.Sum256(bin)
+	if tamper {
+		bin = append(bin, '#')
+	}
+	if err := os.WriteFile(filepath.Join(dir, "erebrus-node"), bin, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := json.Marshal(Manifest{Version: version, Artifacts: []Artifact{{
+		OS: runtime.GOOS, Arch: runtime.GOARCH, URL: "erebrus-node", SHA256: hex.EncodeToString(sum[:]),
+	}}})
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, m))
+	_ = os.WriteFile(filepath.Join(dir, "manifest.json"), m, 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "manifest.json.sig"), []byte(sig), 0o644)
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/manifest.json"
+}
+
+func currentBinary(t *testing.T) string {
+	t.Helper()
+	exe := filepath.Join(t.TempDir(), "erebrus-node")
+	if err := os.WriteFile(exe, []byte("#!/bin/sh\necho 2.0.0\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return exe
+}
+
+func TestInstallVerifiesAndSwaps(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	url := release(t, priv, "2.1.0", false)
+	exe := currentBinary(t)
+	st := memSettings{}
+
+	f := &Fetcher{Key: pub}
+	s, err := f.Install(context.Background(), st, url, exe, "2.0.0", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Status != StatusPending || s.ToVersion != "2.1.0" || s.FromVersion != "2.0.0" {
+		t.Fatalf("state = %+v", s)
+	}
+	if err := Preflight(context.Background(), exe, "2.1.0"); err != nil {
+		t.Fatalf("installed binary: %v", err)
+	}
+	if err := Preflight(context.Background(), s.Prev, "2.0.0"); err != nil {
+		t.Fatalf("previous binary: %v", err)
+	}
+	if got, _ := LoadState(context.Background(), st); got == nil || got.Status != StatusPending {
+		t.Fatalf("persisted state = %+v", got)
+	}
+
+	if err := Restore(exe, s.Prev); err != nil {
+		t.Fatal(err)
+	}
+	if err := Preflight(context.Background(), exe, "2.0.0"); err != nil {
+		t.Fatalf("restored binary: %v", err)
+	}
+
+	if _, err := f.Install(context.Background(), st, url, exe, "2.1.0", false); !errors.Is(err, ErrUpToDate) {
+		t.Fatalf("same version: err = %v", err)
+	}
+}
+
+func TestInstallRejectsBadReleases(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+
+	cases := map[string]string{
+		"wrong key":       release(t, other, "2.1.0", false),
+		"tampered binary": release(t, priv, "2.1.0", true),
+	}
+	for name, url := range cases {
+		exe := currentBinary(t)
+		st := memSettings{}
+		if _, err := (&Fetcher{Key: pub}).Install(context.Background(), st, url, exe, "2.0.0", false); err == nil {
+			t.Errorf("%s: install succeeded", name)
+		}
+		if err := Preflight(context.Background(), exe, "2.0.0"); err != nil {
+			t.Errorf("%s: current binary changed: %v", name, err)
+		}
+		if _, err := os.Stat(exe + ".new"); !os.IsNotExist(err) {
+			t.Errorf("%s: staged file left behind", name)
+		}
+		if len(st) != 0 {
+			t.Errorf("%s: state recorded: %v", name, st)
+		}
+	}
+}
+
+func TestNewer(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"2.1.0", "2.0.0", true},
+		{"2.0.1", "2.0.0-abc123", true},
+		{"2.0.0", "2.0.0-dev", false},
+		{"v2.10.0", "2.9.9", true},
+		{"2.0.0", "2.1.0", false},
+	}
+	for _, tc := range cases {
+		if got := Newer(tc.a, tc.b); got != tc.want {
+			t.Errorf("Newer(%q, %q) = %v", tc.a, tc.b, got)
+		}
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	pub, _, _ := ed25519.GenerateKey(rand.Reader)
+	for _, s := range []string{hex.EncodeToString(pub), base64.StdEncoding.EncodeToString(pub)} {
+		if k, err := ParsePublicKey(s); err != nil || !k.Equal(pub) {
+			t.Errorf("ParsePublicKey(%q) = %v, %v", s, k, err)
+		}
+	}
+	if _, err := ParsePublicKey(""); err == nil {
+		t.Error("empty key accepted")
+	}
+}
@@ -1,6 +1,7 @@
 package wg
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os/exec"
@@ -14,9 +15,10 @@ import (
 
 // DeviceStats is a coarse, live snapshot of the WireGuard interface.
 type DeviceStats struct {
-	RxBytes   int64 // cumulative bytes received from peers
-	TxBytes   int64 // cumulative bytes sent to peers
-	Connected int   // peers with a handshake in the last 3 minutes
+	RxBytes    int64 // cumulative bytes received from peers
+	TxBytes    int64 // cumulative bytes sent to peers
+	Connected  int   // peers with a handshake in the last 3 minutes
+	ListenPort int   // UDP port the device listens on
 }
 
 // PeerTransfer is live transfer counters for one WireGuard peer.
@@ -42,6 +44,19 @@ type Controller interface {
 	PeerTransfers(iface string) ([]PeerTransfer, error)
 }
 
+// NewOfflineController returns a Controller that never touches the device,
+// for CLIs that edit peers while the running node owns the interface.
+func NewOfflineController() Controller { return offlineController{} }
+
+type offlineController struct{}
+
+var errOffline = errors.New("wireguard device not managed by this process")
+
+func (offlineController) BringUp(string, string) error                 { return nil }
+func (offlineController) SyncPeers(string, []*store.Peer) error        { return nil }
+func (offlineController) Stats(string) (DeviceStats, error)            { return DeviceStats{}, errOffline }
+func (offlineController) PeerTransfers(string) ([]PeerTransfer, error) { return nil, errOffline }
+
 // realController talks to the kernel via wg-quick and wgctrl.
 type realController struct{}
 
@@ -109,7 +124,7 @@ func (r *realController) Stats(iface string) (DeviceStats, error) {
 	if err != nil {
 		return DeviceStats{}, err
 	}
-	var st DeviceStats
+	st := DeviceStats{ListenPort: d.ListenPort}
 	cutoff := time.Now().Add(-3 * time.Minute)
 	for _, p := range d.Peers {
 		st.RxBytes += p.ReceiveBytes
@@ -25,17 +25,20 @@ const (
 
 // Manager owns the node's WireGuard state.
 type Manager struct {
-	cfg  *config.Config
+	cfg  *config.Live
 	st   *store.Store
 	ctrl Controller
 
 	mu         sync.RWMutex
 	privateKey string
 	publicKey  string
+	// suspended keeps every peer off the live interface (drained node) while
+	// the rendered config still lists them for a later resume.
+	suspended bool
 }
 
 // New constructs a Manager. Call Init before use.
-func New(cfg *config.Config, st *store.Store, ctrl Controller) *Manager {
+func New(cfg *config.Live, st *store.Store, ctrl Controller) *Manager {
 	return &Manager{cfg: cfg, st: st, ctrl: ctrl}
 }
 
@@ -44,16 +47,17 @@ func New(cfg *config.Config, st *store.Store, ctrl Controller) *Manager {
 // without NET_ADMIN in local dev) is logged by the caller but not fatal — the
 // conf file is still written for later activation.
 func (m *Manager) Init(ctx context.Context) error {
+	cfg := m.cfg.Load()
 	if err := m.loadOrCreateKeys(ctx); err != nil {
 		return err
 	}
-	if err := os.MkdirAll(m.cfg.WGConfDir, 0o700); err != nil {
+	if err := os.MkdirAll(cfg.WGConfDir, 0o700); err != nil {
 		return err
 	}
 	if err := m.writeServerConf(ctx); err != nil {
 		return err
 	}
-	return m.ctrl.BringUp(m.cfg.WGInterface, m.confPath())
+	return m.ctrl.BringUp(cfg.WGInterface, m.confPath())
 }
 
 // ServerPublicKey returns the node's WireGuard public key.
@@ -65,25 +69,31 @@ func (m *Manager) ServerPublicKey() string {
 
 // Endpoint returns host:port clients should dial.
 func (m *Manager) Endpoint() string {
-	return fmt.Sprintf("%s:%s", m.cfg.WGEndpointHost, m.cfg.WGEndpointPort)
+	cfg := m.cfg.Load()
+	return fmt.Sprintf("%s:%s", cfg.WGEndpointHost, cfg.WGEndpointPort)
 }
 
 // Subnet returns the configured IPv4 subnet (server host CIDR).
-func (m *Manager) Subnet() string { return m.cfg.WGIPv4Subnet }
+func (m *Manager) Subnet() string { return m.cfg.Load().WGIPv4Subnet }
 
 // Stats returns a live device snapshot (transfer counters, active peers).
 // Returns a zero value when the interface is not up (e.g. dev without NET_ADMIN).
 func (m *Manager) Stats() DeviceStats {
-	st, err := m.ctrl.Stats(m.cfg.WGInterface)
+	st, err := m.ctrl.Stats(m.cfg.Load().WGInterface)
 	if err != nil {
 		return DeviceStats{}
 	}
 	return st
 }
 
+// Device reads the live device, failing when the interface is gone.
+func (m *Manager) Device() (DeviceStats, error) {
+	return m.ctrl.Stats(m.cfg.Load().WGInterface)
+}
+
 // PeerTransfers returns per-peer transfer counters keyed by WG public key.
 func (m *Manager) PeerTransfers() []PeerTransfer {
-	pt, err := m.ctrl.PeerTransfers(m.cfg.WGInterface)
+	pt, err := m.ctrl.PeerTransfers(m.cfg.Load().WGInterface)
 	if err != nil {
 		return nil
 	}
@@ -93,14 +103,30 @@ func (m *Manager) PeerTransfers() []PeerTransfer {
 // Apply re-renders the interface config from the current peer set and syncs the
 // live peer list. Call after any peer add/update/remove.
 func (m *Manager) Apply(ctx context.Context) error {
+	cfg := m.cfg.Load()
 	if err := m.writeServerConf(ctx); err != nil {
 		return err
 	}
+	m.mu.RLock()
+	suspended := m.suspended
+	m.mu.RUnlock()
+	if suspended {
+		return m.ctrl.SyncPeers(cfg.WGInterface, nil)
+	}
 	peers, err := m.st.ListPeers(ctx)
 	if err != nil {
 		return err
 	}
-	return m.ctrl.SyncPeers(m.cfg.WGInterface, peers)
+	return m.ctrl.SyncPeers(cfg.WGInterface, peers)
+}
+
+// SetSuspended removes all peers from the live interface (disconnecting
+// them) or restores them. Stored peers are untouched.
+func (m *Manager) SetSuspended(ctx context.Context, suspended bool) error {
+	m.mu.Lock()
+	m.suspended = suspended
+	m.mu.Unlock()
+	return m.Apply(ctx)
 }
 
 // ClientConfig renders a wg-quick config for a peer, with the private key left
@@ -108,7 +134,7 @@ func (m *Manager) Apply(ctx context.Context) error {
 func (m *Manager) ClientConfig(p *store.Peer) (string, error) {
 	return renderClient(clientTplData{
 		Address:         p.WGAllowedIP,
-		DNS:             m.cfg.WGDNS,
+		DNS:             m.cfg.Load().WGDNS,
 		ServerPublicKey: m.ServerPublicKey(),
 		PresharedKey:    p.WGPresharedKey,
 		Endpoint:        m.Endpoint(),
@@ -146,6 +172,7 @@ func (m *Manager) loadOrCreateKeys(ctx context.Context) error {
 }
 
 func (m *Manager) writeServerConf(ctx context.Context) error {
+	cfg := m.cfg.Load()
 	peers, err := m.st.ListPeers(ctx)
 	if err != nil {
 		return err
@@ -156,12 +183,12 @@ func (m *Manager) writeServerConf(ctx context.Context) error {
 
 	data, err := renderServer(serverTplData{
 		Address:    m.serverAddress(),
-		ListenPort: m.cfg.WGEndpointPortInt(),
+		ListenPort: cfg.WGEndpointPortInt(),
 		PrivateKey: priv,
-		PreUp:      m.cfg.WGPreUp,
-		PostUp:     m.cfg.WGPostUp,
-		PreDown:    m.cfg.WGPreDown,
-		PostDown:   m.cfg.WGPostDown,
+		PreUp:      cfg.WGPreUp,
+		PostUp:     cfg.WGPostUp,
+		PreDown:    cfg.WGPreDown,
+		PostDown:   cfg.WGPostDown,
 		Peers:      peers,
 	})
 	if err != nil {
@@ -173,18 +200,20 @@ func (m *Manager) writeServerConf(ctx context.Context) error {
 // serverAddress returns the server's own address inside the subnet as a CIDR,
 // e.g. "10.0.0.1/16".
 func (m *Manager) serverAddress() string {
-	ip, ipnet, err := net.ParseCIDR(m.cfg.WGIPv4Subnet)
+	cfg := m.cfg.Load()
+	ip, ipnet, err := net.ParseCIDR(cfg.WGIPv4Subnet)
 	if err != nil {
-		return m.cfg.WGIPv4Subnet
+		return cfg.WGIPv4Subnet
 	}
 	ones, _ := ipnet.Mask.Size()
 	return fmt.Sprintf("%s/%d", ip.String(), ones)
 }
 
 func (m *Manager) confPath() string {
-	name := m.cfg.WGInterface
+	cfg := m.cfg.Load()
+	name := cfg.WGInterface
 	if !strings.HasSuffix(name, ".conf") {
 		name += ".conf"
 	}
-	return filepath.Join(m.cfg.WGConfDir, name)
+	return filepath.Join(cfg.WGConfDir, name)
 }
@@ -0,0 +1,86 @@
+package naive
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+
+	M "github.com/sagernet/sing/common/metadata"
+	"github.com/sagernet/sing/common/uot"
+	"golang.org/x/net/http2"
+)
+
+// Params identify an HTTPS CONNECT listener.
+type Params struct {
+	ServerName string // TLS server name; the host of addr when empty
+	Username   string
+	Password   string
+	Insecure   bool // skip certificate verification, e.g. a self-signed node
+}
+
+// Dial opens a padded CONNECT tunnel to target ("host:port") through the
+// listener at addr. The tunnel lives until Close or ctx ends.
+func Dial(ctx context.Context, addr string, p Params, target string) (*Conn, error) {
+	serverName := p.ServerName
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(addr)
+	}
+	tr := &http2.Transport{
+		TLSClientConfig: &tls.Config{
+			ServerName:         serverName,
+			NextProtos:         []string{http2.NextProtoTLS},
+			InsecureSkipVerify: p.Insecure, //nolint:gosec // operator's choice for self-signed nodes
+		},
+		DialTLSContext: func(ctx context.Context, _, _ string, cfg *tls.Config) (net.Conn, error) {
+			d := tls.Dialer{Config: cfg}
+			return d.DialContext(ctx, "tcp", addr)
+		},
+	}
+	pr, pw := io.Pipe()
+	req, err := http.NewRequestWithContext(ctx, http.MethodConnect, "", pr)
+	if err != nil {
+		return nil, err
+	}
+	req.URL = &url.URL{Scheme: "https", Host: target}
+	req.Host = target
+	req.Header.Set(PaddingHeader, Padding())
+	req.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(p.Username+":"+p.Password)))
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		pw.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		pw.Close()
+		tr.CloseIdleConnections()
+		return nil, fmt.Errorf("CONNECT: %s", resp.Status)
+	}
+	return NewConn(resp.Body, pw, func() error {
+		pw.Close()
+		err := resp.Body.Close()
+		tr.CloseIdleConnections()
+		return err
+	}), nil
+}
+
+// ListenPacket opens a UDP-over-TCP session to dst ("host:port") through the
+// listener at addr; a node delivers it to its own WireGuard listener
+// whatever dst says.
+func ListenPacket(ctx context.Context, addr string, p Params, dst string) (net.PacketConn, error) {
+	conn, err := Dial(ctx, addr, p, net.JoinHostPort(uot.MagicAddress, "443"))
+	if err != nil {
+		return nil, err
+	}
+	pc, err := (&uot.Client{Version: uot.Version}).DialConn(conn, true, M.ParseSocksaddr(dst))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return pc, nil
+}
@@ -0,0 +1,137 @@
+// Package naive speaks the HTTPS CONNECT carrier: NaïveProxy's HTTP/2
+// CONNECT tunnel over TLS, whose first frames in each direction carry random
+// padding so their sizes do not reveal the tunnelled protocol. WireGuard
+// rides inside as UDP-over-TCP (sing-box's "uot" v2): the client CONNECTs to
+// the magic host sp.v2.udp-over-tcp.arpa and frames datagrams in the stream.
+//
+// Handler is the node side, Dial the client side.
+package naive
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// PaddingHeader is the request and response header by which client and
+// server agree to pad the first frames.
+const PaddingHeader = "Padding"
+
+const (
+	paddedFrames  = 8
+	maxPaddedData = 1<<16 - 1
+	maxPadding    = 255
+)
+
+// Padding returns a random value for PaddingHeader. The first 16 characters
+// are ones HPACK does not Huffman-code, so the header's size on the wire
+// varies with its length.
+func Padding() string {
+	b := make([]byte, 30+rand.IntN(32))
+	for i := range b {
+		if i < 16 {
+			b[i] = "!#$()+<>?@[]^`{}"[rand.IntN(16)]
+		} else {
+			b[i] = '~'
+		}
+	}
+	return string(b)
+}
+
+// Conn is one CONNECT tunnel. The first eight reads and writes each way are
+// framed as [2-byte length][1-byte padding length][data][padding]; after
+// that, bytes pass through as they are. Deadlines are not supported: Close
+// interrupts a blocked Read.
+type Conn struct {
+	r     io.Reader
+	w     io.Writer
+	close func() error
+
+	rmu         sync.Mutex
+	readFrames  int
+	readData    int // data left in the current frame
+	readPadding int // padding after it
+
+	wmu         sync.Mutex
+	writeFrames int
+}
+
+// NewConn wraps the two halves of a CONNECT stream; close tears both down.
+func NewConn(r io.Reader, w io.Writer, close func() error) *Conn {
+	return &Conn{r: r, w: w, close: close}
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	for c.readData == 0 {
+		if c.readFrames == paddedFrames {
+			return c.r.Read(p)
+		}
+		var hdr [3]byte
+		if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+			return 0, err
+		}
+		c.readFrames++
+		c.readData = int(binary.BigEndian.Uint16(hdr[:2]))
+		c.readPadding = int(hdr[2])
+		if c.readData == 0 {
+			if err := c.skipPadding(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := c.r.Read(p[:min(len(p), c.readData)])
+	c.readData -= n
+	if c.readData == 0 && err == nil {
+		err = c.skipPadding()
+	}
+	return n, err
+}
+
+func (c *Conn) skipPadding() error {
+	_, err := io.CopyN(io.Discard, c.r, int64(c.readPadding))
+	c.readPadding = 0
+	return err
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	var n int
+	for c.writeFrames < paddedFrames && len(p) > n {
+		data := p[n:min(len(p), n+maxPaddedData)]
+		padding := rand.IntN(maxPadding + 1)
+		frame := make([]byte, 3+len(data)+padding)
+		binary.BigEndian.PutUint16(frame, uint16(len(data)))
+		frame[2] = byte(padding)
+		copy(frame[3:], data)
+		if _, err := c.w.Write(frame); err != nil {
+			return n, err
+		}
+		c.writeFrames++
+		n += len(data)
+	}
+	if n == len(p) {
+		return n, nil
+	}
+	m, err := c.w.Write(p[n:])
+	return n + m, err
+}
+
+// Close ends the tunnel.
+func (c *Conn) Close() error { return c.close() }
+
+// LocalAddr is unknown on a multiplexed stream.
+func (c *Conn) LocalAddr() net.Addr { return &net.TCPAddr{} }
+
+// RemoteAddr is unknown on a multiplexed stream.
+func (c *Conn) RemoteAddr() net.Addr { return &net.TCPAddr{} }
+
+func (c *Conn) SetDeadline(time.Time) error      { return errors.ErrUnsupported }
+func (c *Conn) SetReadDeadline(time.Time) error  { return errors.ErrUnsupported }
+func (c *Conn) SetWriteDeadline(time.Time) error { return errors.ErrUnsupported }
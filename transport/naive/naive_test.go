@@ -0,0 +1,145 @@
+package naive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConnFraming(t *testing.T) {
+	var wire bytes.Buffer
+	w := NewConn(nil, &wire, nil)
+	var want []byte
+	for i := 0; i < paddedFrames+2; i++ {
+		msg := bytes.Repeat([]byte{byte(i)}, 10*i)
+		want = append(want, msg...)
+		if n, err := w.Write(msg); n != len(msg) || err != nil {
+			t.Fatalf("write %d: %d, %v", i, n, err)
+		}
+	}
+	if wire.Len() < len(want)+3*paddedFrames {
+		t.Fatalf("%d bytes on the wire for %d of data", wire.Len(), len(want))
+	}
+	got, err := io.ReadAll(NewConn(&wire, nil, nil))
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("read back %d bytes (%v), want %d", len(got), err, len(want))
+	}
+}
+
+func TestHandler(t *testing.T) {
+	echo, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		b := make([]byte, 1500)
+		for {
+			n, from, err := echo.ReadFromUDP(b)
+			if err != nil {
+				return
+			}
+			echo.WriteToUDP(b[:n], from)
+		}
+	}()
+
+	srv := httptest.NewUnstartedServer(&Handler{Username: "u", Password: "p", Upstream: echo.LocalAddr().(*net.UDPAddr)})
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Whatever the client names, datagrams reach the upstream.
+	pc, err := ListenPacket(ctx, addr, Params{ServerName: "example.com", Username: "u", Password: "p", Insecure: true}, "192.0.2.1:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	b := make([]byte, 1500)
+	for i := 0; i < paddedFrames+4; i++ {
+		msg := []byte(fmt.Sprintf("datagram %d", i))
+		if _, err := pc.WriteTo(msg, nil); err != nil {
+			t.Fatal(err)
+		}
+		n, _, err := pc.ReadFrom(b)
+		if err != nil || string(b[:n]) != string(msg) {
+			t.Fatalf("echo %d = %q, %v", i, b[:n], err)
+		}
+	}
+
+	// Wrong credentials and plain requests see an ordinary site.
+	if _, err := Dial(ctx, addr, Params{Username: "u", Password: "x", Insecure: true}, "sp.v2.udp-over-tcp.arpa:443"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("bad credentials: %v", err)
+	}
+	if _, err := Dial(ctx, addr, Params{Username: "u", Password: "p", Insecure: true}, "example.com:443"); err == nil {
+		t.Fatal("CONNECT to an arbitrary host accepted")
+	}
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET / = %s", resp.Status)
+	}
+}
+
+func TestHandlerAuthorize(t *testing.T) {
+	up, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer up.Close()
+	revoke := make(chan context.CancelFunc, 1)
+	srv := httptest.NewUnstartedServer(&Handler{
+		Authorize: func(ctx context.Context, user, pass string) (context.Context, bool) {
+			if user != "alice" || pass != "p" {
+				return nil, false
+			}
+			ctx, cancel := context.WithCancel(ctx)
+			revoke <- cancel
+			return ctx, true
+		},
+		Upstream: up.LocalAddr().(*net.UDPAddr),
+	})
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := Dial(ctx, addr, Params{Username: "bob", Password: "p", Insecure: true}, "sp.v2.udp-over-tcp.arpa:443"); err == nil {
+		t.Fatal("unknown user accepted")
+	}
+	pc, err := ListenPacket(ctx, addr, Params{ServerName: "example.com", Username: "alice", Password: "p", Insecure: true}, "192.0.2.1:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	if _, err := pc.WriteTo([]byte("hello"), nil); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1500)
+	if _, _, err := up.ReadFromUDP(b); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ending the tunnel's context closes it.
+	(<-revoke)()
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := pc.ReadFrom(b); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("revoked tunnel still open: %v", err)
+	}
+}
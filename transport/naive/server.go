@@ -0,0 +1,143 @@
+package naive
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/sagernet/sing/common/buf"
+	M "github.com/sagernet/sing/common/metadata"
+	"github.com/sagernet/sing/common/uot"
+)
+
+// Handler serves the carrier. Only an HTTP/2 CONNECT to the UDP-over-TCP
+// magic host, with padding and valid Proxy-Authorization, opens a tunnel;
+// every other request, including a CONNECT with the wrong credentials, gets
+// Fallback so the listener looks like an ordinary HTTPS site. Each tunnel
+// relays datagrams to Upstream whatever destination the client names, so
+// the handler is never an open proxy.
+type Handler struct {
+	Username string
+	Password string
+	// Authorize, when set, replaces Username and Password: it checks a
+	// tunnel's credentials and returns the context the tunnel runs under.
+	// The tunnel closes when that context is done.
+	Authorize func(ctx context.Context, username, password string) (context.Context, bool)
+	Upstream  *net.UDPAddr
+	Fallback  http.Handler // nil = http.NotFound
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, ok := h.accept(r)
+	if !ok {
+		if h.Fallback != nil {
+			h.Fallback.ServeHTTP(w, r)
+		} else {
+			http.NotFound(w, r)
+		}
+		return
+	}
+	rc := http.NewResponseController(w)
+	w.Header().Set(PaddingHeader, Padding())
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+	conn := NewConn(r.Body, flushWriter{w, rc}, r.Body.Close)
+	defer context.AfterFunc(ctx, func() { _ = conn.Close() })()
+	req, err := uot.ReadRequest(conn)
+	if err != nil {
+		return
+	}
+	up, err := net.DialUDP("udp", nil, h.Upstream)
+	if err != nil {
+		return
+	}
+	relay(uot.NewConn(conn, *req), up, req.Destination)
+}
+
+// accept reports whether r may open a tunnel, and the context it runs under.
+func (h *Handler) accept(r *http.Request) (context.Context, bool) {
+	if r.Method != http.MethodConnect || r.ProtoMajor != 2 || r.Header.Get(PaddingHeader) == "" {
+		return nil, false
+	}
+	if host, _, err := net.SplitHostPort(r.Host); err != nil || host != uot.MagicAddress {
+		return nil, false
+	}
+	user, pass, ok := parseProxyAuth(r.Header.Get("Proxy-Authorization"))
+	if !ok {
+		return nil, false
+	}
+	if h.Authorize != nil {
+		return h.Authorize(r.Context(), user, pass)
+	}
+	return r.Context(), subtle.ConstantTimeCompare([]byte(user), []byte(h.Username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(pass), []byte(h.Password)) == 1
+}
+
+// parseProxyAuth decodes a Basic Proxy-Authorization value.
+func parseProxyAuth(v string) (user, pass string, ok bool) {
+	r := http.Request{Header: http.Header{"Authorization": {v}}}
+	return r.BasicAuth()
+}
+
+// relay copies datagrams between a UDP-over-TCP tunnel and up until either
+// side fails. Replies carry the address the client last sent to.
+func relay(tunnel *uot.Conn, up *net.UDPConn, dst M.Socksaddr) {
+	var (
+		mu   sync.Mutex
+		last = dst
+		done = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		b := make([]byte, 65535)
+		for {
+			n, err := up.Read(b)
+			if err != nil {
+				tunnel.Close()
+				return
+			}
+			mu.Lock()
+			to := last
+			mu.Unlock()
+			if err := tunnel.WritePacket(buf.As(b[:n]), to); err != nil {
+				up.Close()
+				return
+			}
+		}
+	}()
+	b := buf.NewPacket()
+	defer b.Release()
+	for {
+		b.Reset()
+		to, err := tunnel.ReadPacket(b)
+		if err != nil {
+			break
+		}
+		mu.Lock()
+		last = to
+		mu.Unlock()
+		if _, err := up.Write(b.Bytes()); err != nil {
+			break
+		}
+	}
+	up.Close()
+	<-done
+}
+
+// flushWriter pushes every write out as HTTP/2 DATA frames immediately.
+type flushWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err == nil {
+		err = f.rc.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,127 @@
+package probe
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/sagernet/quic-go"
+	sbtls "github.com/sagernet/sing-box/common/tls"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing-box/transport/v2raywebsocket"
+	"github.com/sagernet/sing-quic/hysteria2"
+	"github.com/sagernet/sing/common/json/badoption"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+)
+
+// ErrNoRealityClient means the REALITY client could not be built: either the
+// binary lacks it (sing-box needs -tags with_utls) or the parameters are bad.
+var ErrNoRealityClient = errors.New("REALITY client unavailable")
+
+// RealityParams identify a VLESS+REALITY listener.
+type RealityParams struct {
+	ServerName string // borrowed SNI
+	PublicKey  string // x25519, base64url
+	ShortID    string // hex
+}
+
+// RealityHandshake dials addr and completes a REALITY-authenticated TLS
+// handshake. Success means the listener recognised the client as its own
+// rather than passing it through to the borrowed site. The caller owns the
+// returned connection.
+func RealityHandshake(ctx context.Context, addr string, p RealityParams) (net.Conn, error) {
+	cfg, err := sbtls.NewClient(ctx, addr, option.OutboundTLSOptions{
+		Enabled:    true,
+		ServerName: p.ServerName,
+		UTLS:       &option.OutboundUTLSOptions{Enabled: true, Fingerprint: "chrome"},
+		Reality:    &option.OutboundRealityOptions{Enabled: true, PublicKey: p.PublicKey, ShortID: p.ShortID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoRealityClient, err)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn, err := sbtls.ClientHandshake(ctx, conn, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// WebSocketParams identify a VLESS over WebSocket+TLS listener.
+type WebSocketParams struct {
+	Host     string // TLS server name and HTTP Host: the CDN hostname
+	Path     string // secret upgrade path
+	Insecure bool   // skip certificate verification, e.g. a self-signed origin
+}
+
+// WebSocketHandshake dials addr, completes TLS and upgrades to a WebSocket on
+// p.Path; the listener refuses any other path. addr is the CDN edge or, to
+// bypass the CDN, the origin itself. The caller owns the returned connection.
+func WebSocketHandshake(ctx context.Context, addr string, p WebSocketParams) (net.Conn, error) {
+	cfg, err := sbtls.NewClient(ctx, addr, option.OutboundTLSOptions{
+		Enabled: true, ServerName: p.Host, Insecure: p.Insecure, ALPN: []string{"http/1.1"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	c, err := v2raywebsocket.NewClient(ctx, N.SystemDialer, M.ParseSocksaddr(addr), option.V2RayWebsocketOptions{
+		Path:    p.Path,
+		Headers: badoption.HTTPHeader{"Host": {p.Host}},
+	}, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return c.DialContext(ctx)
+}
+
+// TLSHandshake completes a plain TLS 1.3 handshake with addr for serverName
+// without verifying the certificate. Against a REALITY listener it proves the
+// listener passes unknown clients through to its handshake target.
+func TLSHandshake(ctx context.Context, addr, serverName string) error {
+	d := tls.Dialer{Config: &tls.Config{
+		ServerName:         serverName,
+		MinVersion:         tls.VersionTLS13,
+		InsecureSkipVerify: true, //nolint:gosec // reachability only
+	}}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// QUICHandshake completes a QUIC handshake with the Hysteria2 or TUIC
+// listener at addr, Salamander-obfuscating packets when obfs is set (Hysteria2
+// only). The listener's certificate is self-signed, so it is not verified.
+func QUICHandshake(ctx context.Context, addr, serverName, obfs string) error {
+	raddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	udp, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return err
+	}
+	defer udp.Close()
+	var pc net.PacketConn = udp
+	if obfs != "" {
+		pc = hysteria2.NewSalamanderConn(udp, []byte(obfs))
+	}
+	conn, err := quic.Dial(ctx, pc, raddr, &tls.Config{
+		ServerName:         serverName,
+		NextProtos:         []string{"h3"},
+		InsecureSkipVerify: true, //nolint:gosec // self-signed carrier cert
+	}, &quic.Config{})
+	if err != nil {
+		return err
+	}
+	return conn.CloseWithError(0, "")
+}
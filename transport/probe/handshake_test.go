@@ -0,0 +1,135 @@
+package probe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/NetSepio/erebrus/internal/config"
+	"github.com/NetSepio/erebrus/internal/stealth"
+)
+
+type memStore map[string]string
+
+func (s memStore) GetSetting(_ context.Context, k string) (string, error) { return s[k], nil }
+func (s memStore) SetSetting(_ context.Context, k, v string) error        { s[k] = v; return nil }
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+// startCarriers runs the node's stealth carriers on loopback, borrowing the
+// handshake of a local TLS server and delivering to WireGuard on wgPort. The
+// WebSocket carrier is on, for cdn.example.com on Params().WSPort.
+func startCarriers(t *testing.T, obfs string, wgPort int) (*stealth.Manager, int, int) {
+	t.Helper()
+	target := httptest.NewUnstartedServer(http.NotFoundHandler())
+	target.StartTLS()
+	t.Cleanup(target.Close)
+
+	vp, hp, wp, cp, tp := freePort(t), freePort(t), freePort(t), freePort(t), freePort(t)
+	cfg := &config.Config{
+		RunType: "release", NodeName: "probe-test", EnableStealth: true,
+		WGEndpointHost: "127.0.0.1", WGEndpointPort: strconv.Itoa(wgPort),
+		VLESSPort: strconv.Itoa(vp), Hysteria2Port: strconv.Itoa(hp),
+		RealityServerNames: []string{"example.com"}, RealityHandshakeServer: target.Listener.Addr().String(),
+		Hysteria2ObfsPassword: obfs,
+		StealthWSHost:         "cdn.example.com", StealthWSPort: strconv.Itoa(wp),
+		StealthConnectHost: "www.example.com", StealthConnectPort: strconv.Itoa(cp),
+		EnableTUIC: true, StealthTUICPort: strconv.Itoa(tp),
+	}
+	m := stealth.New(config.NewLive(cfg), memStore{})
+	ctx := context.Background()
+	if err := m.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m, vp, hp
+}
+
+func TestHandshakes(t *testing.T) {
+	m, vp, hp := startCarriers(t, "", 51820)
+	p := m.Params()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	vless := fmt.Sprintf("127.0.0.1:%d", vp)
+
+	if err := TLSHandshake(ctx, vless, p.SNI); err != nil {
+		t.Errorf("TLS through the REALITY fallback: %v", err)
+	}
+	if err := QUICHandshake(ctx, fmt.Sprintf("127.0.0.1:%d", hp), p.SNI, ""); err != nil {
+		t.Errorf("QUIC handshake: %v", err)
+	}
+	if err := QUICHandshake(ctx, fmt.Sprintf("127.0.0.1:%d", p.TUICPort), p.SNI, ""); err != nil {
+		t.Errorf("TUIC QUIC handshake: %v", err)
+	}
+
+	conn, err := RealityHandshake(ctx, vless, RealityParams{ServerName: p.SNI, PublicKey: p.RealityPublicKey, ShortID: p.RealityShortID})
+	if errors.Is(err, ErrNoRealityClient) {
+		t.Skipf("built without the REALITY client: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("REALITY handshake: %v", err)
+	}
+	conn.Close()
+
+	// A wrong short ID is passed through to the borrowed site, which the
+	// client detects.
+	if conn, err := RealityHandshake(ctx, vless, RealityParams{ServerName: p.SNI, PublicKey: p.RealityPublicKey, ShortID: "0badc0de"}); err == nil {
+		conn.Close()
+		t.Error("REALITY handshake with a wrong short ID succeeded")
+	}
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	m, _, _ := startCarriers(t, "", 51820)
+	p := m.Params()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addr := fmt.Sprintf("127.0.0.1:%d", p.WSPort)
+
+	conn, err := WebSocketHandshake(ctx, addr, WebSocketParams{Host: p.WSHost, Path: p.WSPath, Insecure: true})
+	if err != nil {
+		t.Fatalf("WebSocket upgrade: %v", err)
+	}
+	conn.Close()
+	if conn, err := WebSocketHandshake(ctx, addr, WebSocketParams{Host: p.WSHost, Path: "/", Insecure: true}); err == nil {
+		conn.Close()
+		t.Error("WebSocket upgrade on the wrong path succeeded")
+	}
+	if conn, err := WebSocketHandshake(ctx, addr, WebSocketParams{Host: p.WSHost, Path: p.WSPath}); err == nil {
+		conn.Close()
+		t.Error("self-signed origin passed certificate verification")
+	}
+}
+
+func TestQUICHandshakeObfs(t *testing.T) {
+	m, _, hp := startCarriers(t, "salamander-secret", 51820)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addr := fmt.Sprintf("127.0.0.1:%d", hp)
+	if err := QUICHandshake(ctx, addr, m.Params().SNI, "salamander-secret"); err != nil {
+		t.Fatalf("obfuscated QUIC handshake: %v", err)
+	}
+
+	short, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := QUICHandshake(short, addr, m.Params().SNI, ""); err == nil {
+		t.Error("plain QUIC reached an obfuscated listener")
+	}
+}
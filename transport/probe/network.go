@@ -0,0 +1,497 @@
+package probe
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	sbtls "github.com/sagernet/sing-box/common/tls"
+	"github.com/sagernet/sing-box/option"
+	"github.com/sagernet/sing-quic/hysteria2"
+	"github.com/sagernet/sing-quic/tuic"
+	"github.com/sagernet/sing-vmess/vless"
+	"github.com/sagernet/sing/common/logger"
+	M "github.com/sagernet/sing/common/metadata"
+	N "github.com/sagernet/sing/common/network"
+
+	"github.com/NetSepio/erebrus/transport"
+	"github.com/NetSepio/erebrus/transport/naive"
+)
+
+// Target is a node as a client sees it, usually parsed from the credential
+// bundle the node issued for that client.
+type Target struct {
+	WGEndpoint  string    // host:port
+	WGServerKey [32]byte  // node's WireGuard public key
+	WGClientKey *[32]byte // client private key; nil when the bundle omits it
+	VLESS       *VLESSTarget
+	Hysteria2   *Hysteria2Target
+	TUIC        *TUICTarget
+	WebSocket   *WebSocketTarget
+	Connect     *ConnectTarget
+}
+
+// VLESSTarget is a VLESS+REALITY carrier.
+type VLESSTarget struct {
+	Addr    string
+	UUID    string
+	Flow    string
+	Reality RealityParams
+}
+
+// Hysteria2Target is a Hysteria2 carrier.
+type Hysteria2Target struct {
+	Addr       string
+	Password   string
+	ServerName string
+	Obfs       string // Salamander password, "" = none
+}
+
+// TUICTarget is a TUIC v5 carrier.
+type TUICTarget struct {
+	Addr              string
+	UUID              string
+	Password          string
+	ServerName        string
+	CongestionControl string
+}
+
+// WebSocketTarget is a VLESS over WebSocket+TLS carrier, usually reached
+// through a CDN.
+type WebSocketTarget struct {
+	Addr string // CDN hostname:port
+	UUID string
+	WebSocketParams
+}
+
+// ConnectTarget is an HTTPS CONNECT (naive) carrier.
+type ConnectTarget struct {
+	Addr string
+	naive.Params
+}
+
+// ParseBundle reads a credential bundle as returned by the node's peer API
+// or `erebrus-node peers add --json`. The client private key is taken from
+// the WireGuard client config when it has been filled in.
+func ParseBundle(data []byte) (*Target, error) {
+	var b struct {
+		WireGuard struct {
+			ClientConf      string `json:"client_conf"`
+			ServerPublicKey string `json:"server_public_key"`
+			Endpoint        string `json:"endpoint"`
+		} `json:"wireguard"`
+		Transports []struct {
+			Kind transport.Kind `json:"kind"`
+			URI  string         `json:"uri"`
+		} `json:"transports"`
+		VLESSURI     string `json:"vless_uri"`
+		Hysteria2URI string `json:"hysteria2_uri"`
+	}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("parse bundle: %w", err)
+	}
+	if b.WireGuard.Endpoint == "" {
+		return nil, errors.New("bundle has no wireguard endpoint")
+	}
+	t := &Target{WGEndpoint: b.WireGuard.Endpoint}
+	var err error
+	if t.WGServerKey, err = parseKey(b.WireGuard.ServerPublicKey); err != nil {
+		return nil, fmt.Errorf("server public key: %w", err)
+	}
+	if priv := confValue(b.WireGuard.ClientConf, "PrivateKey"); priv != "" {
+		if k, err := parseKey(priv); err == nil {
+			t.WGClientKey = &k
+		}
+	}
+	if b.VLESSURI != "" {
+		if t.VLESS, err = ParseVLESSURI(b.VLESSURI); err != nil {
+			return nil, err
+		}
+	}
+	if b.Hysteria2URI != "" {
+		if t.Hysteria2, err = ParseHysteria2URI(b.Hysteria2URI); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range b.Transports {
+		switch e.Kind {
+		case transport.KindTUIC:
+			if t.TUIC, err = ParseTUICURI(e.URI); err != nil {
+				return nil, err
+			}
+		case transport.KindWebSocketTLS:
+			if t.WebSocket, err = ParseWebSocketURI(e.URI); err != nil {
+				return nil, err
+			}
+		case transport.KindHTTPSConnect:
+			if t.Connect, err = ParseNaiveURI(e.URI); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return t, nil
+}
+
+// SetClientKey sets the client private key (base64, as in wg-quick configs).
+func (t *Target) SetClientKey(s string) error {
+	k, err := parseKey(s)
+	if err != nil {
+		return err
+	}
+	t.WGClientKey = &k
+	return nil
+}
+
+// Kinds returns the transports the target offers, in ladder order.
+func (t *Target) Kinds() []transport.Kind {
+	kinds := []transport.Kind{transport.KindDirectWG}
+	if t.VLESS != nil {
+		kinds = append(kinds, transport.KindVLESSReality)
+	}
+	if t.Hysteria2 != nil {
+		kinds = append(kinds, transport.KindHysteria2)
+	}
+	if t.TUIC != nil {
+		kinds = append(kinds, transport.KindTUIC)
+	}
+	if t.WebSocket != nil {
+		kinds = append(kinds, transport.KindWebSocketTLS)
+	}
+	if t.Connect != nil {
+		kinds = append(kinds, transport.KindHTTPSConnect)
+	}
+	return transport.SortByLadder(kinds)
+}
+
+// ParseVLESSURI parses a vless:// share link with REALITY security.
+func ParseVLESSURI(s string) (*VLESSTarget, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "vless" || u.User == nil {
+		return nil, fmt.Errorf("invalid vless URI")
+	}
+	q := u.Query()
+	if q.Get("security") != "reality" {
+		return nil, fmt.Errorf("vless URI security %q, want reality", q.Get("security"))
+	}
+	return &VLESSTarget{
+		Addr: u.Host, UUID: u.User.Username(), Flow: q.Get("flow"),
+		Reality: RealityParams{ServerName: q.Get("sni"), PublicKey: q.Get("pbk"), ShortID: q.Get("sid")},
+	}, nil
+}
+
+// ParseWebSocketURI parses a vless:// share link with a ws transport over
+// TLS. The upgrade Host defaults to the SNI, and the SNI to the address.
+func ParseWebSocketURI(s string) (*WebSocketTarget, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "vless" || u.User == nil {
+		return nil, fmt.Errorf("invalid vless URI")
+	}
+	q := u.Query()
+	if q.Get("type") != "ws" || q.Get("security") != "tls" {
+		return nil, fmt.Errorf("vless URI type %q security %q, want ws over tls", q.Get("type"), q.Get("security"))
+	}
+	host := q.Get("host")
+	if host == "" {
+		host = q.Get("sni")
+	}
+	if host == "" {
+		host = u.Hostname()
+	}
+	insecure := q.Get("allowInsecure") == "1" || q.Get("insecure") == "1"
+	return &WebSocketTarget{
+		Addr: u.Host, UUID: u.User.Username(),
+		WebSocketParams: WebSocketParams{Host: host, Path: q.Get("path"), Insecure: insecure},
+	}, nil
+}
+
+// ParseTUICURI parses a tuic:// share link.
+func ParseTUICURI(s string) (*TUICTarget, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "tuic" || u.User == nil {
+		return nil, fmt.Errorf("invalid tuic URI")
+	}
+	pass, _ := u.User.Password()
+	q := u.Query()
+	return &TUICTarget{
+		Addr: u.Host, UUID: u.User.Username(), Password: pass,
+		ServerName: q.Get("sni"), CongestionControl: q.Get("congestion_control"),
+	}, nil
+}
+
+// ParseNaiveURI parses a naive+https:// share link.
+func ParseNaiveURI(s string) (*ConnectTarget, error) {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "naive+https" || u.User == nil {
+		return nil, fmt.Errorf("invalid naive URI")
+	}
+	pass, _ := u.User.Password()
+	q := u.Query()
+	return &ConnectTarget{Addr: u.Host, Params: naive.Params{
+		ServerName: u.Hostname(), Username: u.User.Username(), Password: pass,
+		Insecure: q.Get("allowInsecure") == "1" || q.Get("insecure") == "1",
+	}}, nil
+}
+
+// ParseHysteria2URI parses a hysteria2:// share link.
+func ParseHysteria2URI(s string) (*Hysteria2Target, error) {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "hysteria2" && u.Scheme != "hy2") || u.User == nil {
+		return nil, fmt.Errorf("invalid hysteria2 URI")
+	}
+	q := u.Query()
+	t := &Hysteria2Target{Addr: u.Host, Password: u.User.Username(), ServerName: q.Get("sni")}
+	if q.Get("obfs") == "salamander" {
+		t.Obfs = q.Get("obfs-password")
+	}
+	return t, nil
+}
+
+// NetworkProber measures each transport of a Target end to end. With the
+// client private key it sends WireGuard handshake initiations, directly or
+// through the carrier, and reports their median round trip and the share
+// left unanswered. Without it, carriers are measured by session setup time
+// and direct WireGuard cannot be tested.
+type NetworkProber struct {
+	Target   *Target
+	Count    int           // handshake initiations per transport (default 5)
+	Interval time.Duration // between initiations (default 200ms)
+	Wait     time.Duration // for the last reply (default 2s)
+
+	lastPing time.Time
+}
+
+// Probe tests kinds one at a time. It is not safe for concurrent use.
+func (p *NetworkProber) Probe(ctx context.Context, kinds []transport.Kind) []transport.ProbeResult {
+	out := make([]transport.ProbeResult, 0, len(kinds))
+	for _, k := range kinds {
+		r := transport.ProbeResult{Kind: k}
+		latency, loss, err := p.probe(ctx, k)
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Success = true
+			r.LatencyMs = int(latency.Round(time.Millisecond) / time.Millisecond)
+			r.PacketLossPct = loss
+			r.Score = transport.Score(r, false, false)
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func (p *NetworkProber) probe(ctx context.Context, k transport.Kind) (time.Duration, float64, error) {
+	t := p.Target
+	switch k {
+	case transport.KindDirectWG:
+		if t.WGClientKey == nil {
+			return 0, 0, errors.New("client private key required for a WireGuard handshake")
+		}
+		addr, err := net.ResolveUDPAddr("udp", t.WGEndpoint)
+		if err != nil {
+			return 0, 0, err
+		}
+		pc, err := net.ListenPacket("udp", "")
+		if err != nil {
+			return 0, 0, err
+		}
+		return p.ping(ctx, pc, addr)
+	case transport.KindVLESSReality:
+		if t.VLESS == nil {
+			return 0, 0, errors.New("bundle has no vless+reality carrier")
+		}
+		return p.carrier(ctx, func(ctx context.Context) (net.PacketConn, func(), error) {
+			conn, err := RealityHandshake(ctx, t.VLESS.Addr, t.VLESS.Reality)
+			if err != nil {
+				return nil, nil, err
+			}
+			return p.vlessPacketConn(conn, t.VLESS.UUID, t.VLESS.Flow)
+		})
+	case transport.KindHysteria2:
+		if t.Hysteria2 == nil {
+			return 0, 0, errors.New("bundle has no hysteria2 carrier")
+		}
+		return p.carrier(ctx, func(ctx context.Context) (net.PacketConn, func(), error) {
+			tlsCfg, err := sbtls.NewClient(ctx, t.Hysteria2.Addr, option.OutboundTLSOptions{
+				Enabled: true, ServerName: t.Hysteria2.ServerName, Insecure: true, ALPN: []string{"h3"},
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			c, err := hysteria2.NewClient(hysteria2.ClientOptions{
+				Context: ctx, Dialer: N.SystemDialer, Logger: logger.NOP(),
+				ServerAddress: M.ParseSocksaddr(t.Hysteria2.Addr), Password: t.Hysteria2.Password,
+				SalamanderPassword: t.Hysteria2.Obfs, TLSConfig: tlsCfg,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			pc, err := c.ListenPacket(ctx)
+			if err != nil {
+				c.CloseWithError(err)
+				return nil, nil, err
+			}
+			return pc, func() { c.CloseWithError(nil) }, nil
+		})
+	case transport.KindTUIC:
+		if t.TUIC == nil {
+			return 0, 0, errors.New("bundle has no tuic carrier")
+		}
+		return p.carrier(ctx, func(ctx context.Context) (net.PacketConn, func(), error) {
+			id, err := uuid.Parse(t.TUIC.UUID)
+			if err != nil {
+				return nil, nil, fmt.Errorf("tuic uuid: %w", err)
+			}
+			tlsCfg, err := sbtls.NewClient(ctx, t.TUIC.Addr, option.OutboundTLSOptions{
+				Enabled: true, ServerName: t.TUIC.ServerName, Insecure: true, ALPN: []string{"h3"},
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			c, err := tuic.NewClient(tuic.ClientOptions{
+				Context: ctx, Dialer: N.SystemDialer, ServerAddress: M.ParseSocksaddr(t.TUIC.Addr),
+				TLSConfig: tlsCfg, UUID: id, Password: t.TUIC.Password, CongestionControl: t.TUIC.CongestionControl,
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			pc, err := c.ListenPacket(ctx)
+			if err != nil {
+				c.CloseWithError(err)
+				return nil, nil, err
+			}
+			return pc, func() { c.CloseWithError(nil) }, nil
+		})
+	case transport.KindWebSocketTLS:
+		if t.WebSocket == nil {
+			return 0, 0, errors.New("bundle has no websocket carrier")
+		}
+		return p.carrier(ctx, func(ctx context.Context) (net.PacketConn, func(), error) {
+			conn, err := WebSocketHandshake(ctx, t.WebSocket.Addr, t.WebSocket.WebSocketParams)
+			if err != nil {
+				return nil, nil, err
+			}
+			return p.vlessPacketConn(conn, t.WebSocket.UUID, "")
+		})
+	case transport.KindHTTPSConnect:
+		if t.Connect == nil {
+			return 0, 0, errors.New("bundle has no https connect carrier")
+		}
+		return p.carrier(ctx, func(ctx context.Context) (net.PacketConn, func(), error) {
+			pc, err := naive.ListenPacket(ctx, t.Connect.Addr, t.Connect.Params, p.innerAddr().String())
+			if err != nil {
+				return nil, nil, err
+			}
+			return pc, func() { pc.Close() }, nil
+		})
+	}
+	return 0, 0, errors.New("not implemented")
+}
+
+// carrier opens a carrier session and, with the client key, pings WireGuard
+// through it; without, the session setup time is the latency.
+func (p *NetworkProber) carrier(ctx context.Context, open func(context.Context) (net.PacketConn, func(), error)) (time.Duration, float64, error) {
+	start := time.Now()
+	pc, closeFn, err := open(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer closeFn()
+	if p.Target.WGClientKey == nil {
+		pc.Close()
+		return time.Since(start), 0, nil
+	}
+	return p.ping(ctx, pc, p.innerAddr())
+}
+
+// vlessPacketConn opens a VLESS UDP session to the WireGuard listener over
+// conn, closing conn on failure.
+func (p *NetworkProber) vlessPacketConn(conn net.Conn, uuid, flow string) (net.PacketConn, func(), error) {
+	c, err := vless.NewClient(uuid, flow, logger.NOP())
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	pc, err := c.DialEarlyXUDPPacketConn(conn, M.ParseSocksaddr(p.innerAddr().String()))
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return pc, func() { conn.Close() }, nil
+}
+
+// innerAddr is where carriers deliver WireGuard packets: the node's own
+// WireGuard listener, as in the bundle's sing-box profile.
+func (p *NetworkProber) innerAddr() *net.UDPAddr {
+	port := 51820
+	if _, ps, err := net.SplitHostPort(p.Target.WGEndpoint); err == nil {
+		if n, err := strconv.Atoi(ps); err == nil {
+			port = n
+		}
+	}
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+}
+
+func (p *NetworkProber) params() (count int, interval, wait time.Duration) {
+	count, interval, wait = p.Count, p.Interval, p.Wait
+	if count <= 0 {
+		count = 5
+	}
+	if interval <= 0 {
+		interval = 200 * time.Millisecond
+	}
+	if wait <= 0 {
+		wait = 2 * time.Second
+	}
+	return count, interval, wait
+}
+
+func (p *NetworkProber) ping(ctx context.Context, pc net.PacketConn, addr net.Addr) (time.Duration, float64, error) {
+	count, interval, wait := p.params()
+	// WireGuard drops initiations from one peer that arrive within 20ms of
+	// each other, so keep Interval after the previous transport's last one.
+	if d := time.Until(p.lastPing.Add(interval)); d > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(d):
+		}
+	}
+	keys := WireGuardKeys{Private: *p.Target.WGClientKey, ServerPublic: p.Target.WGServerKey}
+	rtts, err := wgPing(ctx, pc, addr, keys, count, interval, wait)
+	p.lastPing = time.Now()
+	if err != nil {
+		return 0, 100, err
+	}
+	slices.Sort(rtts)
+	loss := float64(count-len(rtts)) * 100 / float64(count)
+	return rtts[len(rtts)/2], loss, nil
+}
+
+func parseKey(s string) ([32]byte, error) {
+	var k [32]byte
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != len(k) {
+		return k, errors.New("not a base64 WireGuard key")
+	}
+	copy(k[:], b)
+	return k, nil
+}
+
+// confValue returns the first "key = value" in a wg-quick config.
+func confValue(conf, key string) string {
+	for _, line := range strings.Split(conf, "\n") {
+		k, v, ok := strings.Cut(line, "=")
+		if ok && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
@@ -1,12 +1,12 @@
-// Package probe defines the transport probing interface. Concrete network
-// probes are added incrementally; the node ships with a local evaluator that
-// scores configured listeners.
+// Package probe tests the transports of the ladder. NetworkProber measures a
+// node from a client's side using its credential bundle; LocalProber scores
+// the node's own configured listeners.
 package probe
 
 import (
 	"context"
 
-	"github.com/NetSepio/erebrus/internal/transport"
+	"github.com/NetSepio/erebrus/transport"
 )
 
 // Prober checks transport reachability from the node's perspective.
@@ -20,6 +20,9 @@ type LocalProber struct {
 	WGPort         int
 	VLESSPort      int
 	Hysteria2Port  int
+	TUICPort       int // 0 when the TUIC carrier is off
+	WebSocketPort  int // 0 when the WebSocket carrier is off
+	ConnectPort    int // 0 when the HTTPS CONNECT carrier is off
 }
 
 // Probe returns synthetic success for implemented local listeners.
@@ -40,12 +43,30 @@ func (p *LocalProber) Probe(_ context.Context, kinds []transport.Kind) []transpo
 			} else {
 				r.Error = "hysteria2 not enabled"
 			}
+		case transport.KindTUIC:
+			if p.StealthEnabled && p.TUICPort > 0 {
+				r.Success = true
+			} else {
+				r.Error = "tuic not enabled"
+			}
 		case transport.KindVLESSReality:
 			if p.StealthEnabled && p.VLESSPort > 0 {
 				r.Success = true
 			} else {
 				r.Error = "vless+reality not enabled"
 			}
+		case transport.KindWebSocketTLS:
+			if p.StealthEnabled && p.WebSocketPort > 0 {
+				r.Success = true
+			} else {
+				r.Error = "websocket carrier not enabled"
+			}
+		case transport.KindHTTPSConnect:
+			if p.StealthEnabled && p.ConnectPort > 0 {
+				r.Success = true
+			} else {
+				r.Error = "https connect carrier not enabled"
+			}
 		default:
 			r.Error = "not implemented"
 		}
@@ -56,8 +77,8 @@ func (p *LocalProber) Probe(_ context.Context, kinds []transport.Kind) []transpo
 }
 
 // Select runs the ladder and returns the best transport.
-func Select(ctx context.Context, prober Prober, stealthEnabled bool) (transport.ProbeResult, bool) {
-	kinds := transport.ImplementedLadder(stealthEnabled)
+func Select(ctx context.Context, prober Prober, offer transport.Offer) (transport.ProbeResult, bool) {
+	kinds := transport.ImplementedLadder(offer)
 	results := prober.Probe(ctx, kinds)
 	return transport.SelectBest(results)
 }
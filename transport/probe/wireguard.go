@@ -0,0 +1,251 @@
+package probe
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+// WireGuard handshake initiation (Noise IKpsk2, see the WireGuard paper §5.4).
+// The preshared key only enters the responder's message, so the initiator
+// needs just its own private key and the server's public key.
+const (
+	wgConstruction = "Noise_IKpsk2_25519_ChaChaPoly_BLAKE2s"
+	wgIdentifier   = "WireGuard v1 zx2c4 Jason@zx2c4.com"
+	wgLabelMAC1    = "mac1----"
+
+	wgInitiationSize  = 148
+	wgResponseSize    = 92
+	wgCookieReplySize = 64
+)
+
+// WireGuardKeys are what a client needs to initiate a handshake.
+type WireGuardKeys struct {
+	Private      [32]byte // client private key
+	ServerPublic [32]byte
+}
+
+// wgInitiation builds a handshake initiation with the given sender index.
+func wgInitiation(k WireGuardKeys, sender uint32, now time.Time) ([]byte, error) {
+	var eph [32]byte
+	if _, err := rand.Read(eph[:]); err != nil {
+		return nil, err
+	}
+	ephPub, err := curve25519.X25519(eph[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	staticPub, err := curve25519.X25519(k.Private[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := make([]byte, wgInitiationSize)
+	msg[0] = 1
+	binary.LittleEndian.PutUint32(msg[4:8], sender)
+	copy(msg[8:40], ephPub)
+
+	ck := blakeHash([]byte(wgConstruction))
+	h := blakeHash(ck[:], []byte(wgIdentifier))
+	h = blakeHash(h[:], k.ServerPublic[:])
+	ck, _ = kdf2(ck[:], ephPub)
+	h = blakeHash(h[:], ephPub)
+
+	ss, err := curve25519.X25519(eph[:], k.ServerPublic[:])
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	ck, key = kdf2(ck[:], ss)
+	if err := seal(msg[40:40], key, staticPub, h[:]); err != nil {
+		return nil, err
+	}
+	h = blakeHash(h[:], msg[40:88])
+
+	ss, err = curve25519.X25519(k.Private[:], k.ServerPublic[:])
+	if err != nil {
+		return nil, err
+	}
+	_, key = kdf2(ck[:], ss)
+	ts := tai64n(now)
+	if err := seal(msg[88:88], key, ts[:], h[:]); err != nil {
+		return nil, err
+	}
+
+	macKey := blakeHash([]byte(wgLabelMAC1), k.ServerPublic[:])
+	mac, err := blake2s.New128(macKey[:])
+	if err != nil {
+		return nil, err
+	}
+	mac.Write(msg[:116])
+	mac.Sum(msg[116:116])
+	// mac2 stays zero: we hold no cookie.
+	return msg, nil
+}
+
+// wgReplyIndex returns the receiver index of a handshake response or cookie
+// reply; both prove the server processed our initiation.
+func wgReplyIndex(b []byte) (uint32, bool) {
+	switch {
+	case len(b) == wgResponseSize && b[0] == 2:
+		return binary.LittleEndian.Uint32(b[8:12]), true
+	case len(b) == wgCookieReplySize && b[0] == 3:
+		return binary.LittleEndian.Uint32(b[4:8]), true
+	}
+	return 0, false
+}
+
+// wgPing sends count handshake initiations to addr over pc, interval apart,
+// and returns the round-trip time of each one answered within wait of being
+// sent. It closes pc.
+func wgPing(ctx context.Context, pc net.PacketConn, addr net.Addr, k WireGuardKeys, count int, interval, wait time.Duration) ([]time.Duration, error) {
+	var (
+		mu   sync.Mutex
+		sent = map[uint32]time.Time{}
+		rtts []time.Duration
+		done = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			idx, ok := wgReplyIndex(buf[:n])
+			if !ok {
+				continue
+			}
+			mu.Lock()
+			if t, ok := sent[idx]; ok {
+				delete(sent, idx)
+				rtts = append(rtts, time.Since(t))
+			}
+			mu.Unlock()
+		}
+	}()
+
+	var sendErr error
+	for i := 0; i < count && sendErr == nil; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				sendErr = ctx.Err()
+				continue
+			case <-time.After(interval):
+			}
+		}
+		var idx [4]byte
+		if _, err := rand.Read(idx[:]); err != nil {
+			sendErr = err
+			break
+		}
+		sender := binary.LittleEndian.Uint32(idx[:])
+		msg, err := wgInitiation(k, sender, time.Now())
+		if err != nil {
+			sendErr = err
+			break
+		}
+		mu.Lock()
+		sent[sender] = time.Now()
+		mu.Unlock()
+		if _, err := pc.WriteTo(msg, addr); err != nil {
+			sendErr = err
+		}
+	}
+
+	// Wait for the outstanding replies.
+	deadline := time.After(wait)
+	tick := time.NewTicker(10 * time.Millisecond)
+	defer tick.Stop()
+wait:
+	for {
+		mu.Lock()
+		pending := len(sent)
+		mu.Unlock()
+		if pending == 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			break wait
+		case <-done:
+			break wait
+		case <-deadline:
+			break wait
+		case <-tick.C:
+		}
+	}
+	pc.Close()
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	if len(rtts) == 0 && sendErr != nil {
+		return nil, sendErr
+	}
+	if len(rtts) == 0 {
+		return nil, errors.New("no handshake response")
+	}
+	return rtts, nil
+}
+
+func newBlake() hash.Hash {
+	h, _ := blake2s.New256(nil)
+	return h
+}
+
+func blakeHash(parts ...[]byte) [32]byte {
+	h := newBlake()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	var out [32]byte
+	h.Sum(out[:0])
+	return out
+}
+
+func hmacBlake(key []byte, parts ...[]byte) [32]byte {
+	m := hmac.New(newBlake, key)
+	for _, p := range parts {
+		m.Write(p)
+	}
+	var out [32]byte
+	m.Sum(out[:0])
+	return out
+}
+
+// kdf2 is the Noise HKDF with two outputs; its first output is KDF1.
+func kdf2(key, input []byte) (t1, t2 [32]byte) {
+	t0 := hmacBlake(key, input)
+	t1 = hmacBlake(t0[:], []byte{1})
+	t2 = hmacBlake(t0[:], t1[:], []byte{2})
+	return t1, t2
+}
+
+func seal(dst []byte, key [32]byte, plaintext, ad []byte) error {
+	aead, err := chacha20poly1305.New(key[:])
+	if err != nil {
+		return err
+	}
+	var nonce [chacha20poly1305.NonceSize]byte
+	aead.Seal(dst, nonce[:], plaintext, ad)
+	return nil
+}
+
+func tai64n(t time.Time) [12]byte {
+	var out [12]byte
+	binary.BigEndian.PutUint64(out[:8], 0x400000000000000a+uint64(t.Unix()))
+	binary.BigEndian.PutUint32(out[8:], uint32(t.Nanosecond()))
+	return out
+}
@@ -0,0 +1,71 @@
+package probe
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/tuntest"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// startWireGuard runs a userspace WireGuard device on a loopback UDP port
+// with one peer, returning the port and the peer's keys.
+func startWireGuard(t *testing.T, port int) WireGuardKeys {
+	t.Helper()
+	server, _ := wgtypes.GeneratePrivateKey()
+	client, _ := wgtypes.GeneratePrivateKey()
+	psk, _ := wgtypes.GenerateKey()
+	dev := device.NewDevice(tuntest.NewChannelTUN().TUN(), conn.NewDefaultBind(), device.NewLogger(device.LogLevelSilent, ""))
+	t.Cleanup(dev.Close)
+	cfg := fmt.Sprintf("private_key=%s\nlisten_port=%d\npublic_key=%s\npreshared_key=%s\nallowed_ip=10.0.0.2/32\n",
+		hexKey(server), port, hexKey(client.PublicKey()), hexKey(psk))
+	if err := dev.IpcSet(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Up(); err != nil {
+		t.Fatal(err)
+	}
+	return WireGuardKeys{Private: client, ServerPublic: server.PublicKey()}
+}
+
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+	c, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	return c.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestWireGuardPing(t *testing.T) {
+	port := freeUDPPort(t)
+	keys := startWireGuard(t, port)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rtts, err := wgPing(ctx, pc, addr, keys, 3, 50*time.Millisecond, time.Second)
+	if err != nil || len(rtts) != 3 {
+		t.Fatalf("rtts = %v, err = %v", rtts, err)
+	}
+
+	// An unknown client key is silently dropped.
+	stranger, _ := wgtypes.GeneratePrivateKey()
+	pc, _ = net.ListenPacket("udp", "127.0.0.1:0")
+	if _, err := wgPing(ctx, pc, addr, WireGuardKeys{Private: stranger, ServerPublic: keys.ServerPublic}, 1, 0, 300*time.Millisecond); err == nil {
+		t.Fatal("handshake with an unknown key answered")
+	}
+}
+
+func hexKey(k wgtypes.Key) string { return hex.EncodeToString(k[:]) }
@@ -11,6 +11,7 @@ type Kind string
 const (
 	KindDirectWG     Kind = "direct_wireguard_udp"
 	KindHysteria2    Kind = "hysteria2_quic_udp"
+	KindTUIC         Kind = "tuic_quic_udp"
 	KindVLESSReality Kind = "vless_reality_tcp"
 	KindWebSocketTLS Kind = "websocket_tls_tcp"
 	KindHTTPSConnect Kind = "https_connect_tcp"
@@ -20,27 +21,48 @@ const (
 var DefaultLadder = []Kind{
 	KindDirectWG,
 	KindHysteria2,
+	KindTUIC,
 	KindVLESSReality,
 	KindWebSocketTLS,
 	KindHTTPSConnect,
 }
 
-// ImplementedLadder returns transports the node can offer today.
-func ImplementedLadder(stealthEnabled bool) []Kind {
-	if !stealthEnabled {
+// Offer is what a node serves besides direct WireGuard.
+type Offer struct {
+	Stealth      bool // VLESS+REALITY and Hysteria2
+	TUIC         bool // TUIC v5 over QUIC; needs Stealth
+	WebSocketTLS bool // VLESS over WebSocket+TLS, usually behind a CDN; needs Stealth
+	HTTPSConnect bool // padded HTTP/2 CONNECT (naive); needs Stealth
+}
+
+// ImplementedLadder returns the transports a node with offer o serves, in
+// ladder order.
+func ImplementedLadder(o Offer) []Kind {
+	if !o.Stealth {
 		return []Kind{KindDirectWG}
 	}
-	return []Kind{KindDirectWG, KindHysteria2, KindVLESSReality}
+	kinds := []Kind{KindDirectWG, KindHysteria2}
+	if o.TUIC {
+		kinds = append(kinds, KindTUIC)
+	}
+	kinds = append(kinds, KindVLESSReality)
+	if o.WebSocketTLS {
+		kinds = append(kinds, KindWebSocketTLS)
+	}
+	if o.HTTPSConnect {
+		kinds = append(kinds, KindHTTPSConnect)
+	}
+	return kinds
 }
 
 // ProbeResult is the outcome of probing one transport.
 type ProbeResult struct {
-	Kind          Kind
-	Success       bool
-	LatencyMs     int
-	PacketLossPct float64
-	Error         string
-	Score         int
+	Kind          Kind    `json:"kind"`
+	Success       bool    `json:"success"`
+	LatencyMs     int     `json:"latency_ms"`
+	PacketLossPct float64 `json:"packet_loss_pct"`
+	Error         string  `json:"error,omitempty"`
+	Score         int     `json:"score"`
 }
 
 // Score computes the transport ranking per the v2 upgrade plan.
@@ -105,9 +127,9 @@ func SortByLadder(kinds []Kind) []Kind {
 	return out
 }
 
-// IsImplemented reports whether a kind has a node-side implementation.
-func IsImplemented(k Kind, stealthEnabled bool) bool {
-	for _, x := range ImplementedLadder(stealthEnabled) {
+// IsImplemented reports whether a node with offer o serves kind k.
+func IsImplemented(k Kind, o Offer) bool {
+	for _, x := range ImplementedLadder(o) {
 		if x == k {
 			return true
 		}
@@ -0,0 +1,63 @@
+package transport
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDefaultLadderOrder(t *testing.T) {
+	if DefaultLadder[0] != KindDirectWG {
+		t.Fatalf("first = %s", DefaultLadder[0])
+	}
+	if DefaultLadder[1] != KindHysteria2 {
+		t.Fatalf("second = %s", DefaultLadder[1])
+	}
+}
+
+func TestScore(t *testing.T) {
+	r := ProbeResult{Kind: KindDirectWG, Success: true, LatencyMs: 50, PacketLossPct: 1}
+	s := Score(r, true, true)
+	// 100 - 5 - 2 + 20 + 10 = 123
+	if s != 123 {
+		t.Fatalf("score = %d", s)
+	}
+}
+
+func TestSelectBest(t *testing.T) {
+	results := []ProbeResult{
+		{Kind: KindDirectWG, Success: true, LatencyMs: 10},
+		{Kind: KindHysteria2, Success: true, LatencyMs: 5},
+		{Kind: KindVLESSReality, Success: false},
+	}
+	best, ok := SelectBest(results)
+	if !ok || best.Kind != KindHysteria2 {
+		t.Fatalf("best = %+v ok=%v", best, ok)
+	}
+}
+
+func TestImplementedLadder(t *testing.T) {
+	if len(ImplementedLadder(Offer{})) != 1 {
+		t.Fatal("expected wg only without stealth")
+	}
+	if len(ImplementedLadder(Offer{Stealth: true})) != 3 {
+		t.Fatal("expected 3 with stealth")
+	}
+	if len(ImplementedLadder(Offer{WebSocketTLS: true})) != 1 {
+		t.Fatal("websocket carrier needs stealth")
+	}
+	got := ImplementedLadder(Offer{Stealth: true, WebSocketTLS: true})
+	if len(got) != 4 || got[3] != KindWebSocketTLS {
+		t.Fatalf("with websocket = %v", got)
+	}
+	if !IsImplemented(KindWebSocketTLS, Offer{Stealth: true, WebSocketTLS: true}) || IsImplemented(KindHTTPSConnect, Offer{Stealth: true, WebSocketTLS: true}) {
+		t.Fatal("IsImplemented disagrees with ImplementedLadder")
+	}
+	got = ImplementedLadder(Offer{Stealth: true, TUIC: true})
+	if fmt.Sprint(got) != fmt.Sprint([]Kind{KindDirectWG, KindHysteria2, KindTUIC, KindVLESSReality}) {
+		t.Fatalf("with tuic = %v", got)
+	}
+	got = ImplementedLadder(Offer{Stealth: true, HTTPSConnect: true})
+	if len(got) != 4 || got[3] != KindHTTPSConnect || len(ImplementedLadder(Offer{HTTPSConnect: true})) != 1 {
+		t.Fatalf("with https connect = %v", got)
+	}
+}